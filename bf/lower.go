@@ -4,44 +4,175 @@ import (
 	"fmt"
 	"go/token"
 	"math/big"
+	"sort"
 
+	"github.com/andrewarchi/nebula/diag"
 	"github.com/andrewarchi/nebula/ir"
 )
 
-type bracketBlock struct {
-	Block *ir.BasicBlock
-	Pos   token.Pos
+// Options configures Brainfuck semantics that differ between
+// implementations. The zero value uses unbounded cells and an unbounded
+// tape.
+type Options struct {
+	CellBits int  // Width of cells when wrapping
+	Wrap     bool // Wrap cells modulo 2^CellBits after + and -
+	TapeSize int  // Number of cells, with the pointer wrapping around; 0 is unbounded
+
+	MaxNesting int // Maximum depth of nested brackets; 0 is unlimited
+
+	EOF EOFPolicy // Value of the cell after , at EOF
+}
+
+// EOFPolicy is the behavior of , at EOF.
+type EOFPolicy uint8
+
+// EOF policies.
+const (
+	LeaveUnchanged EOFPolicy = iota // Cell keeps its value
+	Zero                            // Cell is set to 0
+	NegOne                          // Cell is set to -1
+)
+
+// BracketError is an error given when a bracket is unmatched or nested
+// too deeply.
+type BracketError struct {
+	Err     string
+	Pos     token.Position // Start of span, at the offending bracket for [
+	End     token.Position // End of span (inclusive), at the offending bracket for ]
+	Context token.Position // Related bracket, if valid
+}
+
+func (err *BracketError) Error() string {
+	msg := fmt.Sprintf("%s at %v", err.Err, err.Pos)
+	if end := err.End; end != err.Pos {
+		if end.Filename == err.Pos.Filename {
+			end.Filename = ""
+		}
+		msg = fmt.Sprintf("%s-%v", msg, end)
+	}
+	if err.Context.IsValid() {
+		msg = fmt.Sprintf("%s (nearest [ at %v)", msg, err.Context)
+	}
+	return msg
+}
+
+// Diagnostic converts the error to a diagnostic.
+func (err *BracketError) Diagnostic() *diag.Diagnostic {
+	msg := err.Err
+	if err.Context.IsValid() {
+		msg = fmt.Sprintf("%s (nearest [ at %v)", msg, err.Context)
+	}
+	return &diag.Diagnostic{Severity: diag.Error, Code: "bracket", Message: msg, Pos: err.Pos, End: err.End}
+}
+
+// MatchBrackets pairs each [ with its ], returning the index of the
+// matching bracket for each bracket token. Every unmatched bracket is
+// reported: an unmatched [ spans to the end of the program and a stray ]
+// refers to the nearest preceding [ for context. Brackets nested deeper
+// than maxNesting are reported when maxNesting is positive.
+func MatchBrackets(tokens []*Token, file *token.File, maxNesting int) (map[int]int, []error) {
+	match := make(map[int]int)
+	var errs []error
+	var open []int
+	lastOpen := -1
+	for i, tok := range tokens {
+		switch tok.Type {
+		case Bracket:
+			open = append(open, i)
+			lastOpen = i
+			if maxNesting > 0 && len(open) == maxNesting+1 {
+				pos := file.Position(tok.Pos)
+				errs = append(errs, &BracketError{
+					Err: fmt.Sprintf("Brackets nested deeper than %d", maxNesting),
+					Pos: pos, End: pos,
+					Context: file.Position(tokens[open[0]].Pos),
+				})
+			}
+		case EndBracket:
+			if len(open) == 0 {
+				err := &BracketError{Err: "End bracket not matched", Pos: file.Position(tok.Pos)}
+				err.End = err.Pos
+				if lastOpen >= 0 {
+					err.Context = file.Position(tokens[lastOpen].Pos)
+				}
+				errs = append(errs, err)
+				continue
+			}
+			j := open[len(open)-1]
+			open = open[:len(open)-1]
+			match[i], match[j] = j, i
+		}
+	}
+	for _, i := range open {
+		errs = append(errs, &BracketError{
+			Err: "Bracket not matched",
+			Pos: file.Position(tokens[i].Pos),
+			End: file.Position(tokens[len(tokens)-1].Pos),
+		})
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*BracketError).Pos.Offset < errs[j].(*BracketError).Pos.Offset
+	})
+	return match, errs
 }
 
-// LowerIR lowers a Brainfuck program to Nebula IR in SSA form.
+// LowerIR lowers a Brainfuck program to Nebula IR in SSA form. The data
+// pointer is stored at heap address 0 and cells start at address 1.
+//
+// The clear idioms [-] and [+] are lowered to a store of zero. When
+// cells are unbounded, a clear loop that would never terminate, such as
+// [-] on a negative cell, is lowered to a loop without a body.
 func (p *Program) LowerIR() (*ir.Program, []error) {
 	b := ir.NewBuilder(p.File)
 	b.SetCurrentBlock(b.CreateBlock())
 	dataPtr := ir.NewIntConst(big.NewInt(0), token.NoPos)
+	zero := ir.NewIntConst(big.NewInt(0), token.NoPos)
 	one := ir.NewIntConst(big.NewInt(1), token.NoPos)
 	b.CreateStoreHeapStmt(dataPtr, one, token.NoPos)
-	var bracketStack []bracketBlock
-	var errs []error
-	for _, tok := range p.Tokens {
+	opts := p.Options
+	match, errs := MatchBrackets(p.Tokens, p.File, opts.MaxNesting)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	heads := make(map[int]*ir.BasicBlock)
+	for i := 0; i < len(p.Tokens); i++ {
+		tok := p.Tokens[i]
 		switch tok.Type {
 		case IncPtr:
 			load := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			inc := b.CreateBinaryExpr(ir.Add, load, one, tok.Pos)
+			var inc ir.Value
+			if opts.TapeSize > 0 {
+				// ptr mod size + 1
+				mod := b.CreateBinaryExpr(ir.Mod, load, opts.tapeSize(), tok.Pos)
+				inc = b.CreateBinaryExpr(ir.Add, mod, one, tok.Pos)
+			} else {
+				inc = b.CreateBinaryExpr(ir.Add, load, one, tok.Pos)
+			}
 			b.CreateStoreHeapStmt(dataPtr, inc, tok.Pos)
 		case DecPtr:
 			load := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			dec := b.CreateBinaryExpr(ir.Sub, load, one, tok.Pos)
+			var dec ir.Value
+			if opts.TapeSize > 0 {
+				// (ptr + size - 2) mod size + 1, which keeps the
+				// dividend non-negative
+				sizeMinus2 := ir.NewIntConst(big.NewInt(int64(opts.TapeSize)-2), token.NoPos)
+				add := b.CreateBinaryExpr(ir.Add, load, sizeMinus2, tok.Pos)
+				mod := b.CreateBinaryExpr(ir.Mod, add, opts.tapeSize(), tok.Pos)
+				dec = b.CreateBinaryExpr(ir.Add, mod, one, tok.Pos)
+			} else {
+				dec = b.CreateBinaryExpr(ir.Sub, load, one, tok.Pos)
+			}
 			b.CreateStoreHeapStmt(dataPtr, dec, tok.Pos)
 		case IncData:
 			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
 			val := b.CreateLoadHeapExpr(data, tok.Pos)
 			inc := b.CreateBinaryExpr(ir.Add, val, one, tok.Pos)
-			b.CreateStoreHeapStmt(data, inc, tok.Pos)
+			b.CreateStoreHeapStmt(data, opts.wrapCell(b, inc, tok.Pos), tok.Pos)
 		case DecData:
 			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
 			val := b.CreateLoadHeapExpr(data, tok.Pos)
 			dec := b.CreateBinaryExpr(ir.Sub, val, one, tok.Pos)
-			b.CreateStoreHeapStmt(data, dec, tok.Pos)
+			b.CreateStoreHeapStmt(data, opts.wrapCell(b, dec, tok.Pos), tok.Pos)
 		case Print:
 			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
 			val := b.CreateLoadHeapExpr(data, tok.Pos)
@@ -49,8 +180,43 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 		case Read:
 			val := b.CreateReadExpr(ir.ReadByte, tok.Pos)
 			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
+			if opts.EOF == NegOne {
+				b.CreateStoreHeapStmt(data, val, tok.Pos)
+				break
+			}
+			// ReadByte gives -1 at EOF, so branch on its sign.
+			store := b.CreateBlock()
+			var eof *ir.BasicBlock
+			if opts.EOF == Zero {
+				eof = b.CreateBlock()
+			}
+			next := b.CreateBlock()
+			if eof == nil {
+				b.CreateJmpCondTerm(ir.Jn, val, next, store, tok.Pos)
+			} else {
+				b.CreateJmpCondTerm(ir.Jn, val, eof, store, tok.Pos)
+			}
+			b.SetCurrentBlock(store)
 			b.CreateStoreHeapStmt(data, val, tok.Pos)
+			if eof == nil {
+				b.CreateJmpTerm(ir.Fallthrough, next, tok.Pos)
+			} else {
+				b.CreateJmpTerm(ir.Jmp, next, tok.Pos)
+				b.SetCurrentBlock(eof)
+				b.CreateStoreHeapStmt(data, zero, tok.Pos)
+				b.CreateJmpTerm(ir.Fallthrough, next, tok.Pos)
+			}
+			b.SetCurrentBlock(next)
 		case Bracket:
+			if dec, ok := p.clearLoop(i, match); ok {
+				data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
+				if !opts.Wrap || opts.CellBits <= 0 {
+					guardClear(b, data, dec, tok.Pos)
+				}
+				b.CreateStoreHeapStmt(data, zero, tok.Pos)
+				i = match[i]
+				break
+			}
 			if len(b.CurrentBlock().Nodes) != 0 {
 				head := b.CreateBlock()
 				b.CreateJmpTerm(ir.Fallthrough, head, tok.Pos)
@@ -60,15 +226,10 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 			val := b.CreateLoadHeapExpr(data, tok.Pos)
 			next := b.CreateBlock()
 			b.CreateJmpCondTerm(ir.Jz, val, nil, next, tok.Pos)
-			bracketStack = append(bracketStack, bracketBlock{b.CurrentBlock(), tok.Pos})
+			heads[i] = b.CurrentBlock()
 			b.SetCurrentBlock(next)
 		case EndBracket:
-			if len(bracketStack) == 0 {
-				errs = append(errs, fmt.Errorf("End bracket not matched at %v", tok.Pos))
-				continue
-			}
-			head := bracketStack[len(bracketStack)-1].Block
-			bracketStack = bracketStack[:len(bracketStack)-1]
+			head := heads[match[i]]
 			next := b.CreateBlock()
 			head.Terminator.(*ir.JmpCondTerm).Succs()[0] = next
 			b.CreateJmpTerm(ir.Jmp, head, tok.Pos)
@@ -80,12 +241,57 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 		exitPos = p.Tokens[len(p.Tokens)-1].Pos
 	}
 	b.CreateExitTerm(exitPos)
-	for _, bracket := range bracketStack {
-		errs = append(errs, fmt.Errorf("Bracket not matched at %v", bracket.Pos))
-	}
 	ssa, err := b.Program()
 	if err != nil {
 		errs = append(errs, err)
 	}
 	return ssa, errs
 }
+
+// clearLoop returns whether the loop starting at the bracket at i is
+// the clear idiom [-] or [+], and whether it decrements.
+func (p *Program) clearLoop(i int, match map[int]int) (dec, ok bool) {
+	if match[i] != i+2 {
+		return false, false
+	}
+	switch p.Tokens[i+1].Type {
+	case DecData:
+		return true, true
+	case IncData:
+		return false, true
+	}
+	return false, false
+}
+
+// guardClear emits a loop without a body, taken when a clear loop over
+// unbounded cells would never terminate: when a decrementing loop
+// starts on a negative cell or an incrementing loop on a positive cell.
+func guardClear(b *ir.Builder, data ir.Value, dec bool, pos token.Pos) {
+	var cond ir.Value = b.CreateLoadHeapExpr(data, pos)
+	if !dec {
+		cond = b.CreateUnaryExpr(ir.Neg, cond, pos)
+	}
+	spin := b.CreateBlock()
+	next := b.CreateBlock()
+	b.CreateJmpCondTerm(ir.Jn, cond, spin, next, pos)
+	b.SetCurrentBlock(spin)
+	b.CreateJmpTerm(ir.Jmp, spin, pos)
+	b.SetCurrentBlock(next)
+}
+
+// wrapCell masks a cell value to CellBits bits when wrapping is
+// enabled. Masking a negative value in two's complement gives the
+// wrapped unsigned value, so a decremented zero cell becomes
+// 2^CellBits-1.
+func (opts *Options) wrapCell(b *ir.Builder, val ir.Value, pos token.Pos) ir.Value {
+	if !opts.Wrap || opts.CellBits <= 0 {
+		return val
+	}
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(opts.CellBits))
+	mask.Sub(mask, big.NewInt(1))
+	return b.CreateBinaryExpr(ir.And, val, ir.NewIntConst(mask, token.NoPos), pos)
+}
+
+func (opts *Options) tapeSize() ir.Value {
+	return ir.NewIntConst(big.NewInt(int64(opts.TapeSize)), token.NoPos)
+}
@@ -0,0 +1,137 @@
+package bf
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/interp"
+)
+
+func runBF(t *testing.T, src string, opts Options, in string) string {
+	t.Helper()
+	file := token.NewFileSet().AddFile("test.bf", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, errs := (&Program{Tokens: tokens, File: file, Options: opts}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("lowering %q: %v", src, errs)
+	}
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("verifying %q: %v", src, errs)
+	}
+	var out bytes.Buffer
+	if err := interp.Run(p, strings.NewReader(in), &out); err != nil {
+		t.Fatalf("running %q: %v", src, err)
+	}
+	return out.String()
+}
+
+func TestLowerIRWrap(t *testing.T) {
+	if out := runBF(t, "-.", Options{CellBits: 8, Wrap: true}, ""); out != "\xff" {
+		t.Errorf("wrapping decrement: got %q, want \"\\xff\"", out)
+	}
+	if out := runBF(t, "-[+]+.", Options{CellBits: 8, Wrap: true}, ""); out != "\x01" {
+		t.Errorf("wrapping increment: got %q, want \"\\x01\"", out)
+	}
+	if out := runBF(t, "+>>>.", Options{TapeSize: 3}, ""); out != "\x01" {
+		t.Errorf("wrapping tape right: got %q, want \"\\x01\"", out)
+	}
+	if out := runBF(t, "<++<<<.", Options{TapeSize: 3}, ""); out != "\x02" {
+		t.Errorf("wrapping tape left: got %q, want \"\\x02\"", out)
+	}
+}
+
+func TestLowerIRClearLoop(t *testing.T) {
+	src := "+++[-]."
+	file := token.NewFileSet().AddFile("test.bf", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, errs := (&Program{Tokens: tokens, File: file, Options: Options{CellBits: 8, Wrap: true}}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(p.Blocks) != 1 {
+		t.Fatalf("clear loop not removed:\n%v", p)
+	}
+	var stores []*ir.StoreHeapStmt
+	for _, node := range p.Blocks[0].Nodes {
+		if store, ok := node.(*ir.StoreHeapStmt); ok {
+			stores = append(stores, store)
+		}
+	}
+	last := stores[len(stores)-1]
+	if c, ok := last.Operand(1).Def().(*ir.IntConst); !ok || c.Int().Sign() != 0 {
+		t.Errorf("clear loop not lowered to a store of zero:\n%v", p)
+	}
+
+	for _, test := range []struct {
+		Src  string
+		Opts Options
+		Out  string
+	}{
+		{"+++[-].", Options{}, "\x00"},
+		{"---[+].", Options{}, "\x00"},
+		{"-[+].", Options{CellBits: 8, Wrap: true}, "\x00"},
+		{"+[+]+.", Options{CellBits: 8, Wrap: true}, "\x01"},
+	} {
+		if out := runBF(t, test.Src, test.Opts, ""); out != test.Out {
+			t.Errorf("%q: got %q, want %q", test.Src, out, test.Out)
+		}
+	}
+}
+
+func TestMatchBrackets(t *testing.T) {
+	for _, test := range []struct {
+		Src        string
+		MaxNesting int
+		Errs       []string
+	}{
+		{"+[>[-]<", 0, []string{"Bracket not matched at test.bf:1:2-1:7"}},
+		{"[-]+]", 0, []string{"End bracket not matched at test.bf:1:5 (nearest [ at test.bf:1:1)"}},
+		{"]+", 0, []string{"End bracket not matched at test.bf:1:1"}},
+		{"[[[-]]]", 2, []string{"Brackets nested deeper than 2 at test.bf:1:3 (nearest [ at test.bf:1:1)"}},
+		{"[[-]]", 2, nil},
+	} {
+		file := token.NewFileSet().AddFile("test.bf", -1, len(test.Src))
+		tokens, err := LexTokens(file, []byte(test.Src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &Program{Tokens: tokens, File: file, Options: Options{MaxNesting: test.MaxNesting}}
+		ssa, errs := p.LowerIR()
+		if len(errs) != len(test.Errs) {
+			t.Errorf("%q: got errors %v, want %q", test.Src, errs, test.Errs)
+			continue
+		}
+		if len(errs) != 0 && ssa != nil {
+			t.Errorf("%q: got program with bracket errors", test.Src)
+		}
+		for i, err := range errs {
+			if err.Error() != test.Errs[i] {
+				t.Errorf("%q: got error %q, want %q", test.Src, err, test.Errs[i])
+			}
+		}
+	}
+}
+
+func TestLowerIREOF(t *testing.T) {
+	for _, test := range []struct {
+		EOF EOFPolicy
+		Out string
+	}{
+		{LeaveUnchanged, "\x07"},
+		{Zero, "\x00"},
+		{NegOne, "\xff"},
+	} {
+		if out := runBF(t, "+++++++,.", Options{EOF: test.EOF}, ""); out != test.Out {
+			t.Errorf("policy %d: got %q, want %q", test.EOF, out, test.Out)
+		}
+	}
+}
@@ -77,8 +77,9 @@ func (typ Type) StringBF() string {
 
 // Program is a sequence of Brainfuck tokens with file information.
 type Program struct {
-	Tokens []*Token
-	File   *token.File
+	Tokens  []*Token
+	File    *token.File
+	Options Options
 }
 
 func (p *Program) String() string {
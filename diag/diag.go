@@ -0,0 +1,132 @@
+// Package diag reports errors and warnings with source positions in a
+// uniform structure.
+package diag // import "github.com/andrewarchi/nebula/diag"
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+)
+
+// Diagnostic is a message about a program, such as an error from
+// lowering or a warning from analysis.
+type Diagnostic struct {
+	Severity Severity
+	Code     string // Short stable identifier, such as "stack-bounds"
+	Message  string
+	Pos      token.Position    // Start of range; invalid when unknown
+	End      token.Position    // End of range; invalid when unknown
+	Data     map[string]string // Structured details for tools, such as for remarks
+}
+
+// Severity is the importance of a diagnostic.
+type Severity uint8
+
+// Severity levels.
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// Diagnoser is implemented by errors that can be described as a
+// diagnostic.
+type Diagnoser interface {
+	Diagnostic() *Diagnostic
+}
+
+// From converts an error to a diagnostic. Errors that do not implement
+// Diagnoser become diagnostics with error severity and no position.
+func From(err error) *Diagnostic {
+	switch err := err.(type) {
+	case *Diagnostic:
+		return err
+	case Diagnoser:
+		return err.Diagnostic()
+	}
+	return &Diagnostic{Severity: Error, Message: err.Error()}
+}
+
+func (d *Diagnostic) Error() string {
+	msg := fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	if d.Pos.IsValid() || d.Pos.Filename != "" {
+		msg = fmt.Sprintf("%v: %s", d.Pos, msg)
+	}
+	if d.Code != "" {
+		msg = fmt.Sprintf("%s [%s]", msg, d.Code)
+	}
+	return msg
+}
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return fmt.Sprintf("Severity(%d)", uint8(s))
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type jsonPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type jsonDiagnostic struct {
+	Severity Severity          `json:"severity"`
+	Code     string            `json:"code,omitempty"`
+	Message  string            `json:"message"`
+	Pos      *jsonPosition     `json:"pos,omitempty"`
+	End      *jsonPosition     `json:"end,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// MarshalJSON encodes the diagnostic as an object, omitting unknown
+// positions.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonDiagnostic{
+		Severity: d.Severity,
+		Code:     d.Code,
+		Message:  d.Message,
+		Pos:      toJSONPosition(d.Pos),
+		End:      toJSONPosition(d.End),
+		Data:     d.Data,
+	})
+}
+
+func toJSONPosition(pos token.Position) *jsonPosition {
+	if !pos.IsValid() {
+		return nil
+	}
+	return &jsonPosition{pos.Filename, pos.Offset, pos.Line, pos.Column}
+}
+
+// Printer writes diagnostics as text, one per line, or as JSON, one
+// object per line.
+type Printer struct {
+	W    io.Writer
+	JSON bool
+}
+
+// Print writes a diagnostic for err.
+func (p *Printer) Print(err error) error {
+	d := From(err)
+	if p.JSON {
+		enc := json.NewEncoder(p.W)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(d)
+	}
+	_, werr := fmt.Fprintln(p.W, d)
+	return werr
+}
@@ -0,0 +1,54 @@
+// Package frontend dispatches source files to the language frontends
+// that lower them to Nebula IR.
+package frontend // import "github.com/andrewarchi/nebula/frontend"
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Frontend is a parsed program that can be lowered to IR.
+type Frontend interface {
+	LowerIR() (*ir.Program, []error)
+}
+
+// LexFunc parses a source file into a program for a frontend.
+type LexFunc func(filename string, src []byte) (Frontend, error)
+
+var frontends = make(map[string]LexFunc)
+
+// Register registers a frontend for files with the extension, such as
+// ".ws". Registering an extension again replaces the previous frontend.
+func Register(ext string, lex LexFunc) {
+	frontends[ext] = lex
+}
+
+// Lookup returns the frontend registered for the extension of the
+// filename.
+func Lookup(filename string) (LexFunc, bool) {
+	lex, ok := frontends[filepath.Ext(filename)]
+	return lex, ok
+}
+
+// Lex parses a source file with the frontend registered for its
+// extension.
+func Lex(filename string, src []byte) (Frontend, error) {
+	lex, ok := Lookup(filename)
+	if !ok {
+		return nil, fmt.Errorf("unrecognized file type: %s", filename)
+	}
+	return lex(filename, src)
+}
+
+// Extensions returns the registered extensions in sorted order.
+func Extensions() []string {
+	exts := make([]string, 0, len(frontends))
+	for ext := range frontends {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
@@ -0,0 +1,50 @@
+package frontend
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+type dummy struct {
+	filename string
+	src      []byte
+}
+
+func (d *dummy) LowerIR() (*ir.Program, []error) {
+	b := ir.NewBuilder(token.NewFileSet().AddFile(d.filename, -1, len(d.src)))
+	b.InitBlocks(1)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		return nil, []error{err}
+	}
+	return p, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register(".dummy", func(filename string, src []byte) (Frontend, error) {
+		return &dummy{filename, src}, nil
+	})
+	defer delete(frontends, ".dummy")
+
+	f, err := Lex("prog.dummy", []byte("src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := f.(*dummy)
+	if !ok || d.filename != "prog.dummy" || string(d.src) != "src" {
+		t.Fatalf("got frontend %#v, want dummy for prog.dummy", f)
+	}
+	p, errs := f.LowerIR()
+	if len(errs) != 0 || len(p.Blocks) != 1 {
+		t.Errorf("lowering dummy: got %v, %v", p, errs)
+	}
+	if exts := Extensions(); len(exts) != 1 || exts[0] != ".dummy" {
+		t.Errorf("got extensions %q, want [.dummy]", exts)
+	}
+	if _, err := Lex("prog.unknown", nil); err == nil {
+		t.Error("expected error for unregistered extension")
+	}
+}
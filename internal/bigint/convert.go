@@ -1,6 +1,7 @@
 package bigint
 
 import (
+	"fmt"
 	"math"
 	"math/big"
 	"strings"
@@ -18,6 +19,32 @@ func ToInt(x *big.Int) (int, bool) {
 	return int(i64), x.IsInt64() && int64(minInt) <= i64 && i64 <= int64(maxInt)
 }
 
+// RangeError is an error given when a *big.Int is outside of the
+// range allowed by a checked conversion.
+type RangeError struct {
+	Value *big.Int
+	Max   int
+}
+
+func (err *RangeError) Error() string {
+	if err.Value.Cmp(big.NewInt(int64(err.Max))) > 0 {
+		return fmt.Sprintf("value %v exceeds limit of %d by %v", err.Value, err.Max,
+			new(big.Int).Sub(err.Value, big.NewInt(int64(err.Max))))
+	}
+	return fmt.Sprintf("value %v is below minimum int", err.Value)
+}
+
+// ToIntChecked converts a *big.Int x to an int and returns a
+// *RangeError when x is greater than max or cannot be contained within
+// int.
+func ToIntChecked(x *big.Int, max int) (int, error) {
+	n, ok := ToInt(x)
+	if !ok || n > max {
+		return 0, &RangeError{x, max}
+	}
+	return n, nil
+}
+
 // ToUint converts a *big.Int x to a uint and returns whether x can be
 // contained within uint.
 func ToUint(x *big.Int) (uint, bool) {
@@ -0,0 +1,34 @@
+package bigint
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestToIntChecked(t *testing.T) {
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	for _, test := range []struct {
+		X   *big.Int
+		Max int
+		N   int
+		Err string
+	}{
+		{big.NewInt(5), 10, 5, ""},
+		{big.NewInt(10), 10, 10, ""},
+		{big.NewInt(-3), 10, -3, ""},
+		{big.NewInt(12), 10, 0, "value 12 exceeds limit of 10 by 2"},
+		{huge, 10, 0, "value 100000000000000000000 exceeds limit of 10 by 99999999999999999990"},
+		{new(big.Int).Neg(huge), 10, 0, "value -100000000000000000000 is below minimum int"},
+	} {
+		n, err := ToIntChecked(test.X, test.Max)
+		if test.Err == "" {
+			if err != nil || n != test.N {
+				t.Errorf("ToIntChecked(%v, %d) = %d, %v, want %d", test.X, test.Max, n, err, test.N)
+			}
+			continue
+		}
+		if _, ok := err.(*RangeError); !ok || err.Error() != test.Err {
+			t.Errorf("ToIntChecked(%v, %d) error = %v, want %q", test.X, test.Max, err, test.Err)
+		}
+	}
+}
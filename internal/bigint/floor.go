@@ -0,0 +1,36 @@
+package bigint
+
+import "math/big"
+
+var one = big.NewInt(1)
+
+// FloorDiv sets z to the quotient x/y rounded toward negative infinity
+// and returns z. This is the division of Whitespace, which follows
+// Haskell's div. It differs from big.Int.Div, which implements
+// Euclidean division, when y is negative.
+func FloorDiv(z, x, y *big.Int) *big.Int {
+	if z == y {
+		y = new(big.Int).Set(y)
+	}
+	r := new(big.Int)
+	z.QuoRem(x, y, r)
+	if r.Sign() != 0 && r.Sign() != y.Sign() {
+		z.Sub(z, one)
+	}
+	return z
+}
+
+// FloorMod sets z to the modulus x%y, which has the sign of y, and
+// returns z. This is the modulo of Whitespace, which follows Haskell's
+// mod. It differs from big.Int.Mod, which implements Euclidean modulus,
+// when y is negative.
+func FloorMod(z, x, y *big.Int) *big.Int {
+	if z == y {
+		y = new(big.Int).Set(y)
+	}
+	new(big.Int).QuoRem(x, y, z)
+	if z.Sign() != 0 && z.Sign() != y.Sign() {
+		z.Add(z, y)
+	}
+	return z
+}
@@ -0,0 +1,39 @@
+package bigint
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFloorDivMod(t *testing.T) {
+	for _, test := range []struct {
+		X, Y, Div, Mod int64
+	}{
+		{7, 2, 3, 1},
+		{-7, 2, -4, 1},
+		{7, -2, -4, -1},
+		{-7, -2, 3, -1},
+		{6, -3, -2, 0},
+		{-6, 3, -2, 0},
+		{0, -5, 0, 0},
+	} {
+		x, y := big.NewInt(test.X), big.NewInt(test.Y)
+		if div := FloorDiv(new(big.Int), x, y); div.Int64() != test.Div {
+			t.Errorf("%d div %d: got %v, want %d", test.X, test.Y, div, test.Div)
+		}
+		if mod := FloorMod(new(big.Int), x, y); mod.Int64() != test.Mod {
+			t.Errorf("%d mod %d: got %v, want %d", test.X, test.Y, mod, test.Mod)
+		}
+		// Results may alias operands.
+		if div := FloorDiv(y, x, y); div.Int64() != test.Div {
+			t.Errorf("%d div %d aliasing y: got %v, want %d", test.X, test.Y, div, test.Div)
+		}
+		y.SetInt64(test.Y)
+		if mod := FloorMod(y, x, y); mod.Int64() != test.Mod {
+			t.Errorf("%d mod %d aliasing y: got %v, want %d", test.X, test.Y, mod, test.Mod)
+		}
+		if test.X != test.Y*test.Div+test.Mod {
+			t.Errorf("%d div %d: quotient and modulus inconsistent", test.X, test.Y)
+		}
+	}
+}
@@ -54,9 +54,9 @@ func (m *Map) Has(key *big.Int) bool {
 func (m *Map) Put(key *big.Int, v interface{}) bool {
 	hash := key.Int64()
 	bucket := m.m[hash]
-	for _, pair := range bucket {
+	for i, pair := range bucket {
 		if pair.K.Cmp(key) == 0 {
-			pair.V = v
+			bucket[i].V = v
 			return true
 		}
 	}
@@ -0,0 +1,29 @@
+package bigint
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMapCollidingKeys(t *testing.T) {
+	// Keys with the same low 64 bits share a bucket.
+	small := big.NewInt(1)
+	large := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), small)
+	m := NewMap()
+	m.Put(small, "small")
+	m.Put(large, "large")
+	if m.Len() != 2 {
+		t.Fatalf("got length %d, want 2", m.Len())
+	}
+	for _, test := range []struct {
+		Key  *big.Int
+		Want string
+	}{{small, "small"}, {large, "large"}} {
+		if v, ok := m.Get(test.Key); !ok || v != test.Want {
+			t.Errorf("Get(%v) = %v, %t, want %s", test.Key, v, ok, test.Want)
+		}
+	}
+	if m.Has(new(big.Int).Lsh(big.NewInt(1), 64)) {
+		t.Error("Has(2^64) = true, want false")
+	}
+}
@@ -37,6 +37,17 @@ func (g Digraph) PostOrder() []int {
 	return postOrder
 }
 
+// ReversePostOrder traverses the graph with depth first search from
+// the root and returns the nodes reachable from it in reverse
+// post-order.
+func (g Digraph) ReversePostOrder(root int) []int {
+	postOrder := g.visit(root, nil)
+	for i, j := 0, len(postOrder)-1; i < j; i, j = i+1, j-1 {
+		postOrder[i], postOrder[j] = postOrder[j], postOrder[i]
+	}
+	return postOrder
+}
+
 func (g Digraph) visit(node int, postOrder []int) []int {
 	if g[node].Visited {
 		return postOrder
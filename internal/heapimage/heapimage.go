@@ -0,0 +1,38 @@
+// Package heapimage reads heap images, which seed the heap of a program
+// before it runs.
+package heapimage // import "github.com/andrewarchi/nebula/internal/heapimage"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Read reads a heap image of little-endian signed 64-bit cells. The
+// first cell is at heap address 0 and cells follow consecutively.
+func Read(r io.Reader) ([]int64, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("heap image length %d is not a multiple of 8", len(b))
+	}
+	cells := make([]int64, len(b)/8)
+	for i := range cells {
+		cells[i] = int64(binary.LittleEndian.Uint64(b[i*8:]))
+	}
+	return cells, nil
+}
+
+// ReadFile reads a heap image from the named file.
+func ReadFile(filename string) ([]int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
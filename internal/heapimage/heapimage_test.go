@@ -0,0 +1,23 @@
+package heapimage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	image := []byte{
+		42, 0, 0, 0, 0, 0, 0, 0,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	}
+	cells, err := Read(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 2 || cells[0] != 42 || cells[1] != -1 {
+		t.Errorf("got cells %v, want [42 -1]", cells)
+	}
+	if _, err := Read(bytes.NewReader(image[:7])); err == nil {
+		t.Error("expected error for truncated image")
+	}
+}
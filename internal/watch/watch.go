@@ -0,0 +1,84 @@
+// Package watch polls files for changes.
+package watch // import "github.com/andrewarchi/nebula/internal/watch"
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Poller watches a file by polling its modification time and size,
+// which avoids a dependency on platform file notification APIs.
+type Poller struct {
+	Path     string
+	Interval time.Duration // Time between polls
+	Debounce time.Duration // Time a change must be stable before reporting
+}
+
+// Watch calls onChange once the file has changed and then stayed
+// unchanged for the debounce duration, so that a burst of rapid saves
+// triggers a single call. It polls until the context is cancelled and
+// returns the context error, or an error if the file cannot be
+// statted initially.
+func (p *Poller) Watch(ctx context.Context, onChange func()) error {
+	last, err := p.stat()
+	if err != nil {
+		return err
+	}
+	s := &pollState{p: p, last: last}
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if s.tick(now) {
+				onChange()
+			}
+		}
+	}
+}
+
+// pollState is the state of a Watch between polls.
+type pollState struct {
+	p         *Poller
+	last      fileStamp
+	pending   bool // Whether a change has not yet been reported
+	changedAt time.Time
+}
+
+// tick polls the file at time now and reports whether a change has
+// been stable for the debounce duration.
+func (s *pollState) tick(now time.Time) bool {
+	curr, err := s.p.stat()
+	if err != nil {
+		return false // file may be mid-save
+	}
+	if !curr.equal(s.last) {
+		s.last = curr
+		s.pending = true
+		s.changedAt = now
+	} else if s.pending && now.Sub(s.changedAt) >= s.p.Debounce {
+		s.pending = false
+		return true
+	}
+	return false
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+func (p *Poller) stat() (fileStamp, error) {
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{info.ModTime(), info.Size()}, nil
+}
@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollerDebounce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "program.wsa")
+	if err := ioutil.WriteFile(path, []byte("push 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Poller{Path: path, Debounce: 50 * time.Millisecond}
+	last, err := p.stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ticks are driven by hand with fixed times, rather than by a ticker.
+	s := &pollState{p: p, last: last}
+	start := time.Now()
+	tick := func(ms int, want bool) {
+		t.Helper()
+		if got := s.tick(start.Add(time.Duration(ms) * time.Millisecond)); got != want {
+			t.Errorf("at %dms: got change %t, want %t", ms, got, want)
+		}
+	}
+	tick(0, false)
+	// A burst of saves, each changing the size, triggers one change once
+	// the file has been stable for the debounce duration.
+	for i := 2; i <= 4; i++ {
+		if err := ioutil.WriteFile(path, []byte(strings.Repeat("push 1\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tick(10*i, false)
+	}
+	tick(60, false)
+	tick(90, true)
+	tick(200, false)
+}
+
+func TestPollerWatchCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "program.wsa")
+	if err := ioutil.WriteFile(path, []byte("push 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := &Poller{Path: path, Interval: time.Hour}
+	if err := p.Watch(ctx, func() { t.Error("unexpected change") }); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
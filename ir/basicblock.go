@@ -2,6 +2,7 @@ package ir
 
 import (
 	"fmt"
+	"go/token"
 	"math/big"
 )
 
@@ -68,15 +69,15 @@ func (block *BasicBlock) String() string {
 	return NewFormatter().FormatBlock(block)
 }
 
-// Succs returns all outgoing edges of the block.
+// Succs returns all outgoing edges of the block. A ret has an edge to
+// the block that each of its callers returns to, which is nil for a
+// nil caller.
 func (block *BasicBlock) Succs() []*BasicBlock {
 	switch term := block.Terminator.(type) {
 	case *RetTerm:
 		exits := make([]*BasicBlock, len(block.Callers))
 		for i, caller := range block.Callers {
-			if caller != nil {
-				exits[i] = caller.Next
-			}
+			exits[i] = returnSucc(caller)
 		}
 		return exits
 	default:
@@ -84,6 +85,83 @@ func (block *BasicBlock) Succs() []*BasicBlock {
 	}
 }
 
+// returnSucc returns the block that a call from caller returns to.
+func returnSucc(caller *BasicBlock) *BasicBlock {
+	if caller == nil {
+		return nil
+	}
+	if call, ok := caller.Terminator.(*CallTerm); ok {
+		return call.succs[1]
+	}
+	return caller.Next
+}
+
+// StackEffect summarizes the effect of a block on the stack, relative
+// to the stack frame at block entry.
+type StackEffect struct {
+	Access uint // Incoming slots that must exist
+	Pops   uint // Incoming slots removed or overwritten
+	Pushes uint // Slots left on top of the remaining incoming slots
+}
+
+// StackEffect computes the stack effect of the block from its stack
+// instructions.
+func (block *BasicBlock) StackEffect() StackEffect {
+	var access, pops uint
+	offset := 0
+	for _, inst := range block.Nodes {
+		switch inst := inst.(type) {
+		case *AccessStackStmt:
+			if d := int(inst.StackSize) - offset; d > int(access) {
+				access = uint(d)
+			}
+		case *LoadStackExpr:
+			if d := int(inst.StackPos) - offset; d > int(access) {
+				access = uint(d)
+			}
+		case *StoreStackStmt:
+			if d := int(inst.StackPos) - offset; d > int(pops) {
+				pops = uint(d)
+			}
+		case *OffsetStackStmt:
+			offset += inst.Offset
+			if -offset > int(pops) {
+				pops = uint(-offset)
+			}
+		}
+	}
+	if pops > access {
+		access = pops
+	}
+	return StackEffect{access, pops, uint(int(pops) + offset)}
+}
+
+// SourceRange returns the earliest and latest valid positions of the
+// instructions and terminator in the block, so that executed blocks can
+// be mapped back to source spans. Both are NoPos when no instruction
+// has a position.
+func (block *BasicBlock) SourceRange() (start, end token.Pos) {
+	check := func(inst Inst) {
+		pos := inst.Pos()
+		if !pos.IsValid() {
+			return
+		}
+		if !start.IsValid() || pos < start {
+			start = pos
+		}
+		if pos > end {
+			end = pos
+		}
+	}
+	for _, inst := range block.Nodes {
+		check(inst)
+	}
+	if block.Terminator != nil {
+		check(block.Terminator)
+	}
+	return start, end
+}
+
 // Disconnect removes incoming edges to a basic block. The block is not
 // removed from the program block slice and callers are not updated.
 func (block *BasicBlock) Disconnect() {
@@ -94,6 +172,9 @@ func (block *BasicBlock) Disconnect() {
 		block.Next.Prev = block.Prev
 	}
 	for _, exit := range block.Succs() {
+		if exit == nil {
+			continue
+		}
 		i := 0
 		for _, entry := range exit.Entries {
 			if entry != block {
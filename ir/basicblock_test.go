@@ -0,0 +1,42 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestSourceRange(t *testing.T) {
+	src := "push 1\nprinti\nreadi\njz next\nnext:\nend\n"
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	file.SetLinesForContent([]byte(src))
+	line := func(n int) token.Pos { return file.LineStart(n) }
+
+	b := NewBuilder(file)
+	b.InitBlocks(2)
+	one := NewIntConst(big.NewInt(1), line(1))
+	b.CreatePrintStmt(PrintInt, one, line(2))
+	b.CreateFlushStmt(token.NoPos)
+	read := b.CreateReadExpr(ReadInt, line(3))
+	b.CreateJmpCondTerm(Jz, read, b.Block(1), b.Block(1), line(4))
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateExitTerm(line(6))
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := p.Blocks[0]
+	start, end := block.SourceRange()
+	if start != line(2) || end != line(4) {
+		t.Errorf("got range [%v, %v], want [%v, %v]", file.Position(start), file.Position(end), file.Position(line(2)), file.Position(line(4)))
+	}
+	for _, inst := range append(block.Nodes, block.Terminator) {
+		if pos := inst.Pos(); pos.IsValid() && (pos < start || pos > end) {
+			t.Errorf("%s at %v outside block range", inst.OpString(), file.Position(pos))
+		}
+	}
+	if start, end := (&BasicBlock{}).SourceRange(); start.IsValid() || end.IsValid() {
+		t.Errorf("empty block: got range [%d, %d], want no positions", start, end)
+	}
+}
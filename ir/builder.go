@@ -11,6 +11,7 @@ type Builder struct {
 	curr   *BasicBlock
 	nextID int
 	file   *token.File
+	names  NamePolicy
 }
 
 // RetUnderflowError is an error given when ret is executed without a
@@ -24,6 +25,12 @@ func NewBuilder(file *token.File) *Builder {
 	return &Builder{file: file}
 }
 
+// SetNamePolicy sets the policy used to name blocks when the program is
+// completed. A nil policy selects LabelIndexNames.
+func (b *Builder) SetNamePolicy(policy NamePolicy) {
+	b.names = policy
+}
+
 // Blocks returns all blocks.
 func (b *Builder) Blocks() []*BasicBlock { return b.blocks }
 
@@ -167,6 +174,14 @@ func (b *Builder) CreateFlushStmt(pos token.Pos) *FlushStmt {
 	return flush
 }
 
+// CreatePhiExpr constructs a PhiExpr and appends it to the current
+// block.
+func (b *Builder) CreatePhiExpr(pos token.Pos) *PhiExpr {
+	phi := NewPhiExpr(pos)
+	b.curr.AppendInst(phi)
+	return phi
+}
+
 // CreateCallTerm constructs a CallTerm and appends it to the current
 // block.
 func (b *Builder) CreateCallTerm(callee, next *BasicBlock, pos token.Pos) *CallTerm {
@@ -209,7 +224,11 @@ func (b *Builder) CreateExitTerm(pos token.Pos) *ExitTerm {
 
 // Program completes IR construction and returns a program.
 func (b *Builder) Program() (*Program, error) {
-	b.nameBlocks()
+	names := b.names
+	if names == nil {
+		names = LabelIndexNames
+	}
+	names(b.blocks, b.file)
 	err := connectEntries(b.blocks[0], b.blocks)
 	p := &Program{
 		Name:        b.file.Name(),
@@ -221,28 +240,6 @@ func (b *Builder) Program() (*Program, error) {
 	return p, err
 }
 
-func (b *Builder) nameBlocks() {
-	prevLabel := ""
-	labelIndex := 0
-	for _, block := range b.blocks {
-		if len(block.Labels) != 0 {
-			prevLabel = ""
-			labelIndex = 0
-			for _, label := range block.Labels {
-				if label.Name != "" && block.LabelName == "" {
-					block.LabelName = label.Name
-					prevLabel = label.Name
-					labelIndex = 1
-				}
-			}
-		}
-		if block.LabelName == "" && prevLabel != "" {
-			block.LabelName = fmt.Sprintf("%s%d", prevLabel, labelIndex)
-			labelIndex++
-		}
-	}
-}
-
 // ConnectEntries connects the block entries.
 func connectEntries(entry *BasicBlock, blocks []*BasicBlock) error {
 	entry.Entries = append(entry.Entries, nil)
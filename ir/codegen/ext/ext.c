@@ -1,46 +1,163 @@
+#include <ctype.h>
 #include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
 
-extern uint64_t stack_len;
-extern uint64_t call_stack_len;
+// The I/O streams and exit behavior can be overridden when the runtime
+// is embedded, such as for JIT execution.
+#ifndef NEBULA_IN
+#define NEBULA_IN stdin
+#endif
+#ifndef NEBULA_OUT
+#define NEBULA_OUT stdout
+#endif
+#ifndef NEBULA_EXIT
+#define NEBULA_EXIT(code) exit(code)
+#endif
 
 void print_byte(int64_t b) {
-  fputc(b, stdout);
+  fputc(b, NEBULA_OUT);
+}
+
+// print_string writes a run of constant printc output, which codegen
+// merges into one string.
+void print_string(const char *s, int64_t n) {
+  fwrite(s, 1, n, NEBULA_OUT);
+}
+
+// print_rune writes a Unicode code point encoded in UTF-8. Values that
+// are not valid code points are written as U+FFFD.
+void print_rune(int64_t r) {
+  if (r < 0 || r > 0x10ffff || (r >= 0xd800 && r <= 0xdfff)) {
+    r = 0xfffd;
+  }
+  if (r < 0x80) {
+    fputc(r, NEBULA_OUT);
+  } else if (r < 0x800) {
+    fputc(0xc0 | (r >> 6), NEBULA_OUT);
+    fputc(0x80 | (r & 0x3f), NEBULA_OUT);
+  } else if (r < 0x10000) {
+    fputc(0xe0 | (r >> 12), NEBULA_OUT);
+    fputc(0x80 | ((r >> 6) & 0x3f), NEBULA_OUT);
+    fputc(0x80 | (r & 0x3f), NEBULA_OUT);
+  } else {
+    fputc(0xf0 | (r >> 18), NEBULA_OUT);
+    fputc(0x80 | ((r >> 12) & 0x3f), NEBULA_OUT);
+    fputc(0x80 | ((r >> 6) & 0x3f), NEBULA_OUT);
+    fputc(0x80 | (r & 0x3f), NEBULA_OUT);
+  }
 }
 
 void print_int(int64_t i) {
-  printf("%d", (int) i);
+  fprintf(NEBULA_OUT, "%d", (int) i);
 }
 
 int64_t read_byte() {
-  return fgetc(stdin);
+  return fgetc(NEBULA_IN);
 }
 
+// read_int parses an integer with the grammar documented for
+// ir.ReadInt: leading whitespace other than newlines is skipped, then an
+// optional sign and digits are read and the rest of the line is
+// discarded. A line without digits, including an empty line, reads as 0
+// and EOF before any input reads as -1.
 int64_t read_int() {
-  int i;
-  fscanf(stdin, "%d", &i);
-  return i;
+  int c = fgetc(NEBULA_IN);
+  while (c != '\n' && isspace(c)) {
+    c = fgetc(NEBULA_IN);
+  }
+  if (c == EOF) {
+    return -1;
+  }
+  int64_t sign = 1;
+  if (c == '+' || c == '-') {
+    if (c == '-') {
+      sign = -1;
+    }
+    c = fgetc(NEBULA_IN);
+  }
+  int64_t i = 0;
+  while (isdigit(c)) {
+    i = i * 10 + (c - '0');
+    c = fgetc(NEBULA_IN);
+  }
+  while (c != '\n' && c != EOF) {
+    c = fgetc(NEBULA_IN);
+  }
+  return sign * i;
 }
 
 void flush() {
-  fflush(stdout);
+  fflush(NEBULA_OUT);
+}
+
+// The growable heap, used when codegen.Config.GrowableHeap is set, is
+// allocated on first access and doubled to fit the highest address
+// accessed. New cells are zero.
+static int64_t *heap_cells;
+static uint64_t heap_cap;
+
+// heap_cell returns a pointer to the heap cell at addr, growing the
+// heap as needed. The pointer is invalidated by the next call.
+int64_t *heap_cell(int64_t addr) {
+  if (addr < 0) {
+    fprintf(stderr, "Negative heap address %lld\n", (long long) addr);
+    fflush(stderr);
+    NEBULA_EXIT(1);
+  }
+  if ((uint64_t) addr >= heap_cap) {
+    uint64_t cap = heap_cap != 0 ? heap_cap : 4096;
+    while (cap <= (uint64_t) addr) {
+      cap *= 2;
+    }
+    int64_t *cells = NULL;
+    if (cap <= SIZE_MAX / sizeof(int64_t)) {
+      cells = realloc(heap_cells, cap * sizeof(int64_t));
+    }
+    if (cells == NULL) {
+      fprintf(stderr, "Heap exhausted at address %lld\n", (long long) addr);
+      fflush(stderr);
+      NEBULA_EXIT(1);
+    }
+    memset(cells + heap_cap, 0, (cap - heap_cap) * sizeof(int64_t));
+    heap_cells = cells;
+    heap_cap = cap;
+  }
+  return &heap_cells[addr];
+}
+
+// heap_free releases the growable heap, so that the next access starts
+// with an empty heap.
+void heap_free() {
+  free(heap_cells);
+  heap_cells = NULL;
+  heap_cap = 0;
 }
 
 // TODO change to procedure generated in IR to enable transformations.
-void check_stack(uint64_t n, char *block, char *pos) {
+void check_stack(uint64_t stack_len, uint64_t n, char *block, char *pos) {
   if (stack_len < n) {
     fprintf(stderr, "Data stack underflow in %s at %s\n", block, pos);
     fflush(stderr);
-    exit(1);
+    NEBULA_EXIT(1);
   }
 }
 
 // TODO change to procedure generated in IR to enable transformations.
-void check_call_stack(char *block, char *pos) {
+void check_call_stack(uint64_t call_stack_len, char *block, char *pos) {
   if (call_stack_len < 1) {
     fprintf(stderr, "Call stack underflow in %s at %s\n", block, pos);
     fflush(stderr);
-    exit(1);
+    NEBULA_EXIT(1);
+  }
+}
+
+// check_overflow exits when checked arithmetic overflowed.
+void check_overflow(int64_t overflow, char *block, char *pos) {
+  if (overflow) {
+    fprintf(stderr, "Integer overflow in %s at %s\n", block, pos);
+    fflush(stderr);
+    NEBULA_EXIT(1);
   }
 }
@@ -0,0 +1,11 @@
+// Package jit executes LLVM modules emitted by codegen in process with
+// the MCJIT execution engine, linked against the Nebula runtime.
+//
+// JIT execution requires building with the jit tag, so that the runtime
+// is compiled in with cgo. Otherwise, Run returns ErrUnavailable.
+package jit // import "github.com/andrewarchi/nebula/ir/codegen/jit"
+
+import "errors"
+
+// ErrUnavailable is returned when Nebula was built without JIT support.
+var ErrUnavailable = errors.New("jit: unavailable; rebuild with -tags jit")
@@ -0,0 +1,102 @@
+// +build jit
+
+package jit
+
+/*
+#define _GNU_SOURCE // fmemopen, open_memstream
+#include <setjmp.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+static FILE *nebula_in;
+static FILE *nebula_out;
+static jmp_buf nebula_exit_buf;
+static int nebula_exit_code;
+
+#define NEBULA_IN nebula_in
+#define NEBULA_OUT nebula_out
+#define NEBULA_EXIT(code) (nebula_exit_code = (code), longjmp(nebula_exit_buf, 1))
+
+#include "../ext/ext.c"
+
+// nebula_run calls the entry function with input read from in and
+// output written to a buffer. Runtime errors, which would otherwise
+// exit the process, return the exit code instead.
+static int nebula_run(void *entry, char *in, size_t in_len, char **out, size_t *out_len) {
+  nebula_in = in_len != 0 ? fmemopen(in, in_len, "r") : fopen("/dev/null", "r");
+  nebula_out = open_memstream(out, out_len);
+  int code;
+  if (setjmp(nebula_exit_buf)) {
+    code = nebula_exit_code;
+  } else {
+    code = ((int (*)(void)) entry)();
+  }
+  fclose(nebula_in);
+  fclose(nebula_out);
+  heap_free();
+  return code;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"llvm.org/llvm/bindings/go/llvm"
+)
+
+// Available reports whether JIT execution is supported.
+const Available = true
+
+var runtimeFuncs = map[string]unsafe.Pointer{
+	"print_byte":       C.print_byte,
+	"print_rune":       C.print_rune,
+	"print_string":     C.print_string,
+	"print_int":        C.print_int,
+	"read_byte":        C.read_byte,
+	"read_int":         C.read_int,
+	"flush":            C.flush,
+	"check_stack":      C.check_stack,
+	"check_call_stack": C.check_call_stack,
+	"check_overflow":   C.check_overflow,
+	"heap_cell":        C.heap_cell,
+}
+
+// Run JIT compiles the module and calls its entry function with the
+// given input. It returns the output and the exit code. The execution
+// engine takes ownership of the module and disposes it.
+func Run(mod llvm.Module, entry string, in []byte) ([]byte, int, error) {
+	llvm.LinkInMCJIT()
+	if err := llvm.InitializeNativeTarget(); err != nil {
+		return nil, 0, err
+	}
+	if err := llvm.InitializeNativeAsmPrinter(); err != nil {
+		return nil, 0, err
+	}
+	fn := mod.NamedFunction(entry)
+	if fn.IsNil() {
+		return nil, 0, fmt.Errorf("jit: entry function %s not defined", entry)
+	}
+	engine, err := llvm.NewMCJITCompiler(mod, llvm.NewMCJITCompilerOptions())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer engine.Dispose()
+	for name, addr := range runtimeFuncs {
+		if f := mod.NamedFunction(name); !f.IsNil() {
+			engine.AddGlobalMapping(f, addr)
+		}
+	}
+
+	var cIn *C.char
+	if len(in) != 0 {
+		cIn = (*C.char)(C.CBytes(in))
+		defer C.free(unsafe.Pointer(cIn))
+	}
+	var out *C.char
+	var outLen C.size_t
+	code := C.nebula_run(engine.PointerToGlobal(fn), cIn, C.size_t(len(in)), &out, &outLen)
+	defer C.free(unsafe.Pointer(out))
+	return C.GoBytes(unsafe.Pointer(out), C.int(outLen)), int(code), nil
+}
@@ -0,0 +1,183 @@
+// +build jit
+
+package jit
+
+import (
+	"bytes"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir/codegen"
+	"github.com/andrewarchi/nebula/ir/interp"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestRunMatchesInterp(t *testing.T) {
+	//     push 0
+	//     readi
+	//     push 0
+	//     retrieve   ; n
+	//     dup
+	//     push 3
+	//     mul
+	//     printi     ; n*3
+	//     push 10
+	//     printc
+	//     dup
+	//     push -20
+	//     add
+	//     printi     ; n-20
+	//     push 10
+	//     printc
+	//     dup
+	//     push 7
+	//     div
+	//     printi     ; n/7
+	//     push 10
+	//     printc
+	//     push 7
+	//     mod
+	//     printi     ; n%7
+	//     end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+	}
+	for _, op := range []struct {
+		Type ws.Type
+		Arg  int64
+	}{{ws.Mul, 3}, {ws.Add, -20}, {ws.Div, 7}} {
+		tokens = append(tokens,
+			&ws.Token{Type: ws.Dup},
+			&ws.Token{Type: ws.Push, Arg: big.NewInt(op.Arg)},
+			&ws.Token{Type: op.Type},
+			&ws.Token{Type: ws.Printi},
+			&ws.Token{Type: ws.Push, Arg: big.NewInt('\n')},
+			&ws.Token{Type: ws.Printc})
+	}
+	tokens = append(tokens,
+		&ws.Token{Type: ws.Push, Arg: big.NewInt(7)},
+		&ws.Token{Type: ws.Mod},
+		&ws.Token{Type: ws.Printi},
+		&ws.Token{Type: ws.End})
+	file := token.NewFileSet().AddFile("arith.ws", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for _, in := range []string{"0\n", "12\n", "100\n"} {
+		var want bytes.Buffer
+		if err := interp.Run(p, strings.NewReader(in), &want); err != nil {
+			t.Fatal(err)
+		}
+		mod, err := codegen.EmitLLVMModule(p, codegen.Config{
+			MaxStackLen:     codegen.DefaultMaxStackLen,
+			MaxCallStackLen: codegen.DefaultMaxCallStackLen,
+			MaxHeapBound:    codegen.DefaultMaxHeapBound,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, code, err := Run(mod, "main", []byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 0 {
+			t.Errorf("input %q: exited with %d", in, code)
+		}
+		if string(out) != want.String() {
+			t.Errorf("input %q: got output %q, want %q", in, out, want.String())
+		}
+	}
+}
+
+func TestRunGrowableHeap(t *testing.T) {
+	//     push 4096
+	//     push 42
+	//     store
+	//     push 4096
+	//     retrieve
+	//     printi
+	//     end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(4096)},
+		{Type: ws.Push, Arg: big.NewInt(42)},
+		{Type: ws.Store},
+		{Type: ws.Push, Arg: big.NewInt(4096)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("growable.ws", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	mod, err := codegen.EmitLLVMModule(p, codegen.Config{
+		MaxStackLen:     codegen.DefaultMaxStackLen,
+		MaxCallStackLen: codegen.DefaultMaxCallStackLen,
+		MaxHeapBound:    4096,
+		GrowableHeap:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, code, err := Run(mod, "main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 0 || string(out) != "42" {
+		t.Errorf("got output %q and exit code %d, want %q and 0", out, code, "42")
+	}
+}
+
+func TestRunBlockFuncs(t *testing.T) {
+	//     push 1
+	//     push 2
+	//     call l
+	//     push 3
+	//     printi
+	//     end
+	// l:
+	//     add
+	//     printi
+	//     ret
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Call, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Printi},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.Ret},
+	}
+	file := token.NewFileSet().AddFile("blockfuncs.ws", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	mod, err := codegen.EmitLLVMModule(p, codegen.Config{
+		MaxStackLen:     codegen.DefaultMaxStackLen,
+		MaxCallStackLen: codegen.DefaultMaxCallStackLen,
+		MaxHeapBound:    codegen.DefaultMaxHeapBound,
+		BlockFuncs:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, code, err := Run(mod, "main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 0 || string(out) != "33" {
+		t.Errorf("got output %q and exit code %d, want %q and 0", out, code, "33")
+	}
+}
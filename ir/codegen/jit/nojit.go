@@ -0,0 +1,14 @@
+// +build !jit
+
+package jit
+
+import "llvm.org/llvm/bindings/go/llvm"
+
+// Available reports whether JIT execution is supported.
+const Available = false
+
+// Run returns ErrUnavailable, because Nebula was built without the jit
+// tag.
+func Run(mod llvm.Module, entry string, in []byte) ([]byte, int, error) {
+	return nil, 0, ErrUnavailable
+}
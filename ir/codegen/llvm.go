@@ -3,8 +3,13 @@
 package codegen // import "github.com/andrewarchi/nebula/ir/codegen"
 
 import (
+	"errors"
 	"fmt"
 	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
 
 	"github.com/andrewarchi/nebula/internal/bigint"
 	"github.com/andrewarchi/nebula/ir"
@@ -18,24 +23,36 @@ type moduleBuilder struct {
 	config Config
 
 	program *ir.Program
+	prefix  string // Prefix for program-specific symbols, empty for a single program
 	blocks  map[*ir.BasicBlock]llvm.BasicBlock
+	funcs   map[*ir.BasicBlock]llvm.Value      // Block functions, when BlockFuncs is set
+	exits   map[*ir.BasicBlock]llvm.BasicBlock // LLVM block ending each block, for phi edges
 	defs    map[ir.Value]llvm.Value
-	strings map[string]llvm.Value
+	phis    []*ir.PhiExpr         // Phis with incoming edges to resolve
+	strings map[string]llvm.Value // Declared in order of first use, which follows the blocks
 
 	stack        llvm.Value
 	stackLen     llvm.Value
 	callStack    llvm.Value
 	callStackLen llvm.Value
 	heap         llvm.Value
+	heapGEPs     map[int64]llvm.Value // GEPs of constant heap addresses in the current LLVM block
+	stackTrap    *stackTrap           // Shared stack underflow block, when StackTraps is set
+	fn           llvm.Value           // Function being emitted
+	reentrant    bool                 // Reset the globals at entry, so the entry can be called again
 
 	main           llvm.Value
 	printByte      llvm.Value
+	printRune      llvm.Value
+	printString    llvm.Value
 	printInt       llvm.Value
 	readByte       llvm.Value
 	readInt        llvm.Value
 	flush          llvm.Value
 	checkStack     llvm.Value
 	checkCallStack llvm.Value
+	checkOverflow  llvm.Value
+	heapCell       llvm.Value
 }
 
 // Config contains allocation size configuration for codegen.
@@ -43,8 +60,31 @@ type Config struct {
 	MaxStackLen     uint
 	MaxCallStackLen uint
 	MaxHeapBound    uint
+	SharedHeap      bool              // Share one heap between programs in a module
+	StackTraps      bool              // Guard blocks with a branch to a shared trap rather than calling check_stack
+	AllocaStack     bool              // Allocate the stack in the entry function rather than as globals
+	GrowableHeap    bool              // Access the heap through the runtime heap_cell, which grows it without bound
+	BlockFuncs      bool              // Emit each block as a function tail calling its successors
+	ArithOverflow   ArithOverflow     // Behavior of overflowing arithmetic
+	HeapImage       []int64           // Initial heap cells, starting at address 0
+	OutputEncoding  ir.OutputEncoding // Encoding of printc output
 }
 
+// ArithOverflow is the behavior of add, sub, mul, and neg when the
+// result overflows 64 bits.
+type ArithOverflow uint8
+
+// Overflow behaviors.
+const (
+	// Wrap wraps around in two's complement.
+	Wrap ArithOverflow = iota
+	// Trap exits with an error at runtime by calling check_overflow.
+	Trap
+	// NoSignedWrap marks arithmetic with nsw, so that LLVM may assume
+	// that no signed overflow occurs and optimize accordingly.
+	NoSignedWrap
+)
+
 // Default configuration values.
 const (
 	DefaultMaxStackLen     = 1024
@@ -52,6 +92,68 @@ const (
 	DefaultMaxHeapBound    = 4096
 )
 
+// LLVMVersion returns the version of the LLVM libraries that codegen is
+// linked against. The emitted IR depends on it, such as whether
+// pointers are opaque.
+func LLVMVersion() string {
+	return llvm.Version
+}
+
+func (config *Config) validate() error {
+	if !config.GrowableHeap && uint(len(config.HeapImage)) > config.MaxHeapBound {
+		return fmt.Errorf("codegen: heap image of %d cells exceeds heap bound %d", len(config.HeapImage), config.MaxHeapBound)
+	}
+	if config.BlockFuncs && config.AllocaStack {
+		return errors.New("codegen: block functions cannot share an alloca stack")
+	}
+	return nil
+}
+
+// validateProgram checks that the program can be emitted with the
+// configuration. Values cannot flow between block functions, so phis
+// and uses of values defined in other blocks, such as those forwarded
+// by stackprop, licm, or mem2reg, are rejected when BlockFuncs is set.
+func (config *Config) validateProgram(program *ir.Program) error {
+	if !config.BlockFuncs {
+		return nil
+	}
+	for _, block := range program.Blocks {
+		defs := make(map[ir.Value]bool)
+		for _, inst := range block.Nodes {
+			if _, ok := inst.(*ir.PhiExpr); ok {
+				return fmt.Errorf("codegen: block functions cannot lower phi in %s", block.Name())
+			}
+			if err := checkLocalOperands(inst, block, defs); err != nil {
+				return err
+			}
+			if val, ok := inst.(ir.Value); ok {
+				defs[val] = true
+			}
+		}
+		if err := checkLocalOperands(block.Terminator, block, defs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLocalOperands checks that every operand of inst is a constant or
+// is defined earlier in its block.
+func checkLocalOperands(inst ir.Inst, block *ir.BasicBlock, defs map[ir.Value]bool) error {
+	user, ok := inst.(ir.User)
+	if !ok {
+		return nil
+	}
+	for _, operand := range user.Operands() {
+		def := operand.Def()
+		if _, ok := def.(*ir.IntConst); ok || defs[def] {
+			continue
+		}
+		return fmt.Errorf("codegen: block functions cannot lower %s in %s, which uses a value defined in another block", inst.OpString(), block.Name())
+	}
+	return nil
+}
+
 var (
 	zero = llvm.ConstInt(llvm.Int64Type(), 0, false)
 	one  = llvm.ConstInt(llvm.Int64Type(), 1, false)
@@ -59,27 +161,164 @@ var (
 
 // EmitLLVMModule generates a LLVM IR module for the given program.
 func EmitLLVMModule(program *ir.Program, config Config) (llvm.Module, error) {
+	if err := config.validate(); err != nil {
+		return llvm.Module{}, err
+	}
+	if err := config.validateProgram(program); err != nil {
+		return llvm.Module{}, err
+	}
+	ctx := llvm.GlobalContext()
+	m := newModuleBuilder(ctx, ctx.NewModule(program.Name), program, "", config)
+	m.declareFuncs()
+	m.declareGlobals()
+	m.emitBlocks()
+	err := llvm.VerifyModule(m.module, llvm.PrintMessageAction)
+	return m.module, err
+}
+
+// WriteLLVMModule generates a LLVM IR module for the given program and
+// writes it to w, as bitcode when bitcode is set and otherwise as
+// textual IR. Nothing is written when the module fails to verify.
+func WriteLLVMModule(w io.Writer, program *ir.Program, config Config, bitcode bool) error {
+	mod, err := EmitLLVMModule(program, config)
+	if err != nil {
+		return err
+	}
+	defer mod.Dispose()
+	return WriteModule(w, mod, bitcode)
+}
+
+// WriteModule writes a LLVM module to w, as bitcode when bitcode is set
+// and otherwise as textual IR.
+func WriteModule(w io.Writer, mod llvm.Module, bitcode bool) error {
+	if bitcode {
+		buf := llvm.WriteBitcodeToMemoryBuffer(mod)
+		defer buf.Dispose()
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	_, err := io.WriteString(w, mod.String())
+	return err
+}
+
+// EmitLLVMModules generates a single LLVM IR module containing several
+// programs. Each program is emitted as a distinct entry function named
+// <prefix>_main, where the prefix is derived from the program name, and
+// program-specific globals are named <prefix>.<name>. The
+// module has no main function, so that a driver can dispatch to the
+// entries. Entries take argc and argv, like main, and reset the stack,
+// the call stack, and an unshared heap when called, so that a driver
+// can call them more than once. When config.SharedHeap is set, all
+// programs use the same heap. A growable heap is owned by the runtime
+// and is always shared.
+func EmitLLVMModules(programs []*ir.Program, config Config) (llvm.Module, error) {
+	if err := config.validate(); err != nil {
+		return llvm.Module{}, err
+	}
+	for _, program := range programs {
+		if err := config.validateProgram(program); err != nil {
+			return llvm.Module{}, err
+		}
+	}
 	ctx := llvm.GlobalContext()
-	m := moduleBuilder{
+	module := ctx.NewModule("nebula")
+	var (
+		strs   = make(map[string]llvm.Value)
+		heap   llvm.Value
+		shared bool
+	)
+	for i, prefix := range ProgramPrefixes(programs) {
+		m := newModuleBuilder(ctx, module, programs[i], prefix, config)
+		m.strings = strs
+		m.reentrant = true
+		if i == 0 {
+			m.declareFuncs()
+		} else {
+			m.lookupFuncs()
+		}
+		if shared {
+			m.heap = heap
+		}
+		m.declareGlobals()
+		if config.SharedHeap && !shared {
+			heap, shared = m.heap, true
+		}
+		m.emitBlocks()
+	}
+	err := llvm.VerifyModule(module, llvm.PrintMessageAction)
+	return module, err
+}
+
+// ProgramPrefixes derives a unique symbol prefix for each program from
+// the base of its file name. Collisions are resolved by appending an
+// underscore and the program index, or a later index when that name is
+// also taken by another program.
+func ProgramPrefixes(programs []*ir.Program) []string {
+	prefixes := make([]string, len(programs))
+	names := make(map[string]bool)
+	for i, program := range programs {
+		prefixes[i] = sanitizeSymbol(program.Name)
+		names[prefixes[i]] = true
+	}
+	seen := make(map[string]bool)
+	for i, prefix := range prefixes {
+		if seen[prefix] {
+			for n := i; ; n++ {
+				unique := fmt.Sprintf("%s_%d", prefix, n)
+				if !names[unique] && !seen[unique] {
+					prefix = unique
+					break
+				}
+			}
+		}
+		seen[prefix] = true
+		prefixes[i] = prefix
+	}
+	return prefixes
+}
+
+func sanitizeSymbol(filename string) string {
+	name := filepath.Base(filename)
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "program"
+	}
+	return b.String()
+}
+
+func newModuleBuilder(ctx llvm.Context, module llvm.Module, program *ir.Program, prefix string, config Config) *moduleBuilder {
+	return &moduleBuilder{
 		ctx:     ctx,
 		b:       ctx.NewBuilder(),
-		module:  ctx.NewModule(program.Name),
+		module:  module,
 		config:  config,
 		program: program,
+		prefix:  prefix,
 		blocks:  make(map[*ir.BasicBlock]llvm.BasicBlock),
+		funcs:   make(map[*ir.BasicBlock]llvm.Value),
+		exits:   make(map[*ir.BasicBlock]llvm.BasicBlock),
 		defs:    make(map[ir.Value]llvm.Value),
 		strings: make(map[string]llvm.Value),
 	}
-	m.declareFuncs()
-	m.declareGlobals()
-	m.emitBlocks()
-	err := llvm.VerifyModule(m.module, llvm.PrintMessageAction)
-	return m.module, err
 }
 
 func (m *moduleBuilder) declareFuncs() {
-	mainTyp := llvm.FunctionType(llvm.Int32Type(), []llvm.Type{}, false)
-	m.main = llvm.AddFunction(m.module, "main", mainTyp)
+	m.declareMain()
 
 	printcTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type()}, false)
 	printiTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type()}, false)
@@ -87,8 +326,8 @@ func (m *moduleBuilder) declareFuncs() {
 	readiTyp := llvm.FunctionType(llvm.Int64Type(), []llvm.Type{}, false)
 	flushTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{}, false)
 	cStrTyp := llvm.PointerType(llvm.Int8Type(), 0)
-	checkStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), cStrTyp, cStrTyp}, false)
-	checkCallStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{cStrTyp, cStrTyp}, false)
+	checkStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), llvm.Int64Type(), cStrTyp, cStrTyp}, false)
+	checkCallStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), cStrTyp, cStrTyp}, false)
 
 	m.printByte = llvm.AddFunction(m.module, "print_byte", printcTyp)
 	m.printInt = llvm.AddFunction(m.module, "print_int", printiTyp)
@@ -107,41 +346,342 @@ func (m *moduleBuilder) declareFuncs() {
 	m.checkCallStack.SetLinkage(llvm.ExternalLinkage)
 }
 
+// lookupFuncs declares the entry function and reuses the runtime
+// functions already declared in the module.
+func (m *moduleBuilder) lookupFuncs() {
+	m.declareMain()
+
+	m.printByte = m.module.NamedFunction("print_byte")
+	m.printInt = m.module.NamedFunction("print_int")
+	m.readByte = m.module.NamedFunction("read_byte")
+	m.readInt = m.module.NamedFunction("read_int")
+	m.flush = m.module.NamedFunction("flush")
+	m.checkStack = m.module.NamedFunction("check_stack")
+	m.checkCallStack = m.module.NamedFunction("check_call_stack")
+}
+
+// symbol returns the name of a program-specific global. In a module of
+// several programs, the name is qualified by the program prefix and a
+// dot, which sanitizeSymbol never produces, so that the globals of one
+// program cannot collide with those of another or with an entry.
+func (m *moduleBuilder) symbol(name string) string {
+	if m.prefix == "" {
+		return name
+	}
+	return m.prefix + "." + name
+}
+
+// declareMain declares the entry function. A reentrant entry is called
+// from C, so it takes the argc and argv of main, which are unused.
+func (m *moduleBuilder) declareMain() {
+	var params []llvm.Type
+	if m.reentrant {
+		argvTyp := llvm.PointerType(llvm.PointerType(llvm.Int8Type(), 0), 0)
+		params = []llvm.Type{llvm.Int32Type(), argvTyp}
+	}
+	mainTyp := llvm.FunctionType(llvm.Int32Type(), params, false)
+	name := "main"
+	if m.prefix != "" {
+		name = m.prefix + "_main"
+	}
+	m.main = llvm.AddFunction(m.module, name, mainTyp)
+}
+
 func (m *moduleBuilder) declareGlobals() {
-	stackTyp := llvm.ArrayType(llvm.Int64Type(), int(m.config.MaxStackLen))
 	callStackTyp := llvm.ArrayType(llvm.PointerType(llvm.Int8Type(), 0), int(m.config.MaxCallStackLen))
 	heapTyp := llvm.ArrayType(llvm.Int64Type(), int(m.config.MaxHeapBound))
 
-	m.stackLen = llvm.AddGlobal(m.module, llvm.Int64Type(), "stack_len")
-	m.stack = llvm.AddGlobal(m.module, stackTyp, "stack")
-	m.callStack = llvm.AddGlobal(m.module, callStackTyp, "call_stack")
-	m.callStackLen = llvm.AddGlobal(m.module, llvm.Int64Type(), "call_stack_len")
-	m.heap = llvm.AddGlobal(m.module, heapTyp, "heap")
-
-	m.stack.SetInitializer(llvm.ConstNull(stackTyp))
-	m.stackLen.SetInitializer(zero)
+	if !m.config.AllocaStack {
+		stackTyp := llvm.ArrayType(llvm.Int64Type(), int(m.config.MaxStackLen))
+		m.stackLen = llvm.AddGlobal(m.module, llvm.Int64Type(), m.symbol("stack_len"))
+		m.stack = llvm.AddGlobal(m.module, stackTyp, m.symbol("stack"))
+		m.stack.SetInitializer(llvm.ConstNull(stackTyp))
+		m.stackLen.SetInitializer(zero)
+	}
+	m.callStack = llvm.AddGlobal(m.module, callStackTyp, m.symbol("call_stack"))
+	m.callStackLen = llvm.AddGlobal(m.module, llvm.Int64Type(), m.symbol("call_stack_len"))
 	m.callStack.SetInitializer(llvm.ConstNull(callStackTyp))
 	m.callStackLen.SetInitializer(zero)
-	m.heap.SetInitializer(llvm.ConstNull(heapTyp))
+
+	if m.heap.IsNil() && !m.config.GrowableHeap {
+		heapName := m.symbol("heap")
+		if m.config.SharedHeap {
+			heapName = "heap"
+		}
+		m.heap = llvm.AddGlobal(m.module, heapTyp, heapName)
+		m.heap.SetInitializer(m.heapInitializer(heapTyp))
+	}
+}
+
+// heapInitializer returns the initial value of the heap, which is
+// seeded from the heap image and otherwise zero.
+func (m *moduleBuilder) heapInitializer(heapTyp llvm.Type) llvm.Value {
+	if len(m.config.HeapImage) == 0 {
+		return llvm.ConstNull(heapTyp)
+	}
+	cells := make([]llvm.Value, m.config.MaxHeapBound)
+	for i := range cells {
+		if i < len(m.config.HeapImage) {
+			cells[i] = llvm.ConstInt(llvm.Int64Type(), uint64(m.config.HeapImage[i]), true)
+		} else {
+			cells[i] = zero
+		}
+	}
+	return llvm.ConstArray(llvm.Int64Type(), cells)
 }
 
 func (m *moduleBuilder) emitBlocks() {
+	if m.config.BlockFuncs {
+		m.emitBlockFuncs()
+		return
+	}
+	m.fn = m.main
 	entry := m.ctx.AddBasicBlock(m.main, "")
 	for _, block := range m.program.Blocks {
 		m.blocks[block] = m.ctx.AddBasicBlock(m.main, block.Name())
 	}
 
 	m.b.SetInsertPoint(entry, entry.FirstInstruction())
+	if m.config.AllocaStack {
+		m.allocaStack()
+	}
+	if m.reentrant {
+		m.resetGlobals()
+	}
+	if m.config.GrowableHeap {
+		m.seedGrowableHeap()
+	}
 	m.b.CreateBr(m.blocks[m.program.Entry])
 	for _, block := range m.program.Blocks {
 		llvmBlock := m.blocks[block]
 		m.b.SetInsertPoint(llvmBlock, llvmBlock.FirstInstruction())
-		stackLen := m.b.CreateLoad(m.stackLen, "stack_len")
-		for _, inst := range block.Nodes {
-			stackLen = m.emitInst(inst, block, stackLen)
-		}
+		m.emitNodes(block)
+		m.exits[block] = m.b.GetInsertBlock()
 		m.emitTerminator(block)
 	}
+	m.resolvePhis()
+}
+
+// emitNodes emits the instructions of a block. Phis lead the block, so
+// they are emitted before the stack length is loaded, as LLVM requires
+// phis to be first in a block.
+func (m *moduleBuilder) emitNodes(block *ir.BasicBlock) {
+	m.heapGEPs = make(map[int64]llvm.Value)
+	nodes := block.Nodes
+	for len(nodes) != 0 {
+		if _, ok := nodes[0].(*ir.PhiExpr); !ok {
+			break
+		}
+		m.emitInst(nodes[0], block, llvm.Value{})
+		nodes = nodes[1:]
+	}
+	stackLen := m.b.CreateLoad(m.stackLen, "stack_len")
+	for i := 0; i < len(nodes); i++ {
+		if str, n := m.constPrintRun(nodes[i:]); n > 1 {
+			m.emitPrintString(str)
+			i += n - 1
+			continue
+		}
+		stackLen = m.emitInst(nodes[i], block, stackLen)
+	}
+}
+
+// constPrintRun returns the output of the run of printc instructions
+// of constants at the start of nodes and the length of the run, so that
+// the run can be written as a single string.
+func (m *moduleBuilder) constPrintRun(nodes []ir.Inst) (string, int) {
+	var b strings.Builder
+	n := 0
+	for _, inst := range nodes {
+		print, ok := inst.(*ir.PrintStmt)
+		if !ok || print.Op != ir.PrintByte {
+			break
+		}
+		c, ok := print.Operand(0).Def().(*ir.IntConst)
+		if !ok || !c.Int().IsInt64() {
+			break
+		}
+		v := c.Int().Int64()
+		if m.config.OutputEncoding == ir.UTF8 {
+			if v < 0 || v > unicode.MaxRune {
+				v = unicode.ReplacementChar
+			}
+			b.WriteRune(rune(v))
+		} else {
+			if v < 0 || v > 0xff {
+				break
+			}
+			b.WriteByte(byte(v))
+		}
+		n++
+	}
+	return b.String(), n
+}
+
+// emitPrintString emits a write of a constant string.
+func (m *moduleBuilder) emitPrintString(str string) {
+	ptr := m.b.CreateInBoundsGEP(m.constString(str), []llvm.Value{zero, zero}, "str")
+	n := llvm.ConstInt(llvm.Int64Type(), uint64(len(str)), false)
+	m.b.CreateCall(m.stringPrinter(), []llvm.Value{ptr, n}, "")
+}
+
+// resolvePhis adds the incoming edges of phis, once all blocks have
+// been emitted, since incoming values may be defined by blocks emitted
+// after the phi. Each edge is from the LLVM block that ends the
+// predecessor, which differs from its first block when emitting the
+// predecessor split it, such as for a stack guard.
+func (m *moduleBuilder) resolvePhis() {
+	for _, phi := range m.phis {
+		values := phi.Values()
+		vals := make([]llvm.Value, len(values))
+		blocks := make([]llvm.BasicBlock, len(values))
+		for i, incoming := range values {
+			vals[i] = m.lookupValue(incoming.Value)
+			blocks[i] = m.exits[incoming.Block]
+		}
+		m.defs[phi].AddIncoming(vals, blocks)
+	}
+	m.phis = nil
+}
+
+// emitBlockFuncs emits each block as an internal function named after
+// the block, which tail calls the function of its successor, so that
+// profilers attribute time to individual blocks. Return addresses on
+// the call stack are pointers to block functions. The entry function
+// calls the function of the entry block. Values may not be used
+// outside of the block that defines them.
+//
+// The tail calls are only hints, so unless the output is built with
+// optimization, each jump grows the native stack.
+func (m *moduleBuilder) emitBlockFuncs() {
+	fnTyp := llvm.FunctionType(llvm.Int32Type(), []llvm.Type{}, false)
+	for _, block := range m.program.Blocks {
+		fn := llvm.AddFunction(m.module, m.symbol("block."+block.Name()), fnTyp)
+		fn.SetLinkage(llvm.InternalLinkage)
+		m.funcs[block] = fn
+	}
+
+	entry := m.ctx.AddBasicBlock(m.main, "")
+	m.b.SetInsertPointAtEnd(entry)
+	if m.reentrant {
+		m.resetGlobals()
+	}
+	if m.config.GrowableHeap {
+		m.seedGrowableHeap()
+	}
+	code := m.b.CreateCall(m.funcs[m.program.Entry], []llvm.Value{}, "code")
+	m.b.CreateRet(code)
+	for _, block := range m.program.Blocks {
+		m.fn = m.funcs[block]
+		m.stackTrap = nil
+		m.b.SetInsertPointAtEnd(m.ctx.AddBasicBlock(m.fn, ""))
+		m.emitNodes(block)
+		m.emitBlockFuncTerminator(block)
+	}
+}
+
+// emitBlockFuncTerminator emits the terminator of a block function as
+// tail calls to the functions of its successors.
+func (m *moduleBuilder) emitBlockFuncTerminator(block *ir.BasicBlock) {
+	switch term := block.Terminator.(type) {
+	case *ir.CallTerm:
+		callStackLen := m.b.CreateLoad(m.callStackLen, "call_stack_len")
+		gep := m.b.CreateInBoundsGEP(m.callStack, []llvm.Value{zero, callStackLen}, "ret_addr.gep")
+		callStackLen = m.b.CreateAdd(callStackLen, one, "call_stack_len")
+		m.b.CreateStore(callStackLen, m.callStackLen)
+		addr := llvm.ConstBitCast(m.funcs[term.Succ(1)], llvm.PointerType(llvm.Int8Type(), 0))
+		m.b.CreateStore(addr, gep)
+		m.emitTailCall(m.funcs[term.Succ(0)])
+	case *ir.JmpTerm:
+		m.emitTailCall(m.funcs[term.Succ(0)])
+	case *ir.JmpCondTerm:
+		cond := m.jmpCond(term)
+		then := m.ctx.AddBasicBlock(m.fn, term.Succ(0).Name())
+		els := m.ctx.AddBasicBlock(m.fn, term.Succ(1).Name())
+		m.b.CreateCondBr(cond, then, els)
+		m.b.SetInsertPointAtEnd(then)
+		m.emitTailCall(m.funcs[term.Succ(0)])
+		m.b.SetInsertPointAtEnd(els)
+		m.emitTailCall(m.funcs[term.Succ(1)])
+	case *ir.RetTerm:
+		callStackLen := m.b.CreateLoad(m.callStackLen, "call_stack_len")
+		m.b.CreateCall(m.checkCallStack, []llvm.Value{callStackLen, m.blockName(block), m.instPos(term)}, "")
+		callStackLen = m.b.CreateSub(callStackLen, one, "call_stack_len")
+		m.b.CreateStore(callStackLen, m.callStackLen)
+		gep := m.b.CreateInBoundsGEP(m.callStack, []llvm.Value{zero, callStackLen}, "ret_addr.gep")
+		addr := m.b.CreateLoad(gep, "ret_addr")
+		fnTyp := llvm.FunctionType(llvm.Int32Type(), []llvm.Type{}, false)
+		m.emitTailCall(m.b.CreateBitCast(addr, llvm.PointerType(fnTyp, 0), "ret_fn"))
+	case *ir.ExitTerm:
+		m.b.CreateRet(llvm.ConstInt(llvm.Int32Type(), 0, false))
+	default:
+		panic("codegen: unrecognized terminator type")
+	}
+}
+
+// emitTailCall emits a tail call to a block function and returns its
+// exit code. The call is marked tail, which is only a hint, since the
+// LLVM bindings cannot mark it musttail. Only an optimized build
+// eliminates the call, so that without optimization, every jump adds a
+// native stack frame and a long-running program overflows the C stack.
+func (m *moduleBuilder) emitTailCall(fn llvm.Value) {
+	code := m.b.CreateCall(fn, []llvm.Value{}, "code")
+	code.SetTailCall(true)
+	m.b.CreateRet(code)
+}
+
+// allocaStack allocates the stack and its length in the entry block of
+// the program function. Since neither escapes the function, LLVM can
+// promote the length to an SSA value and forward stores to loads of
+// stack slots across calls to the runtime, which it cannot do for
+// globals.
+func (m *moduleBuilder) allocaStack() {
+	stackTyp := llvm.ArrayType(llvm.Int64Type(), int(m.config.MaxStackLen))
+	m.stack = m.b.CreateAlloca(stackTyp, "stack")
+	m.stackLen = m.b.CreateAlloca(llvm.Int64Type(), "stack_len")
+	m.b.CreateStore(zero, m.stackLen)
+}
+
+// resetGlobals empties the stack and call stack and restores the heap
+// to its initial value, which a previous call of the entry may have
+// left changed. A shared or growable heap is kept, since it outlives
+// any one program.
+func (m *moduleBuilder) resetGlobals() {
+	if !m.config.AllocaStack {
+		m.b.CreateStore(zero, m.stackLen)
+	}
+	m.b.CreateStore(zero, m.callStackLen)
+	if m.config.SharedHeap || m.config.GrowableHeap {
+		return
+	}
+	i8Ptr := llvm.PointerType(llvm.Int8Type(), 0)
+	heap := m.b.CreateBitCast(m.heap, i8Ptr, "heap.ptr")
+	size := llvm.ConstInt(llvm.Int64Type(), uint64(m.config.MaxHeapBound)*8, false)
+	volatile := llvm.ConstInt(llvm.Int1Type(), 0, false)
+	if len(m.config.HeapImage) == 0 {
+		memsetTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{i8Ptr, llvm.Int8Type(), llvm.Int64Type(), llvm.Int1Type()}, false)
+		memset := m.intrinsic("llvm.memset.p0i8.i64", memsetTyp)
+		m.b.CreateCall(memset, []llvm.Value{heap, llvm.ConstInt(llvm.Int8Type(), 0, false), size, volatile}, "")
+		return
+	}
+	heapTyp := llvm.ArrayType(llvm.Int64Type(), int(m.config.MaxHeapBound))
+	image := llvm.AddGlobal(m.module, heapTyp, m.symbol("heap_image"))
+	image.SetInitializer(m.heapInitializer(heapTyp))
+	image.SetGlobalConstant(true)
+	image.SetLinkage(llvm.PrivateLinkage)
+	memcpyTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{i8Ptr, i8Ptr, llvm.Int64Type(), llvm.Int1Type()}, false)
+	memcpy := m.intrinsic("llvm.memcpy.p0i8.p0i8.i64", memcpyTyp)
+	src := m.b.CreateBitCast(image, i8Ptr, "heap_image.ptr")
+	m.b.CreateCall(memcpy, []llvm.Value{heap, src, size, volatile}, "")
+}
+
+// intrinsic declares an LLVM intrinsic, reusing it when a previous
+// program in the module declared it.
+func (m *moduleBuilder) intrinsic(name string, typ llvm.Type) llvm.Value {
+	if fn := m.module.NamedFunction(name); !fn.IsNil() {
+		return fn
+	}
+	return llvm.AddFunction(m.module, name, typ)
 }
 
 func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen llvm.Value) llvm.Value {
@@ -151,16 +691,10 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		rhs := m.lookupValue(inst.Operand(1).Def())
 		var val llvm.Value
 		switch inst.Op {
-		case ir.Add:
-			val = m.b.CreateAdd(lhs, rhs, "add")
-		case ir.Sub:
-			val = m.b.CreateSub(lhs, rhs, "sub")
-		case ir.Mul:
-			val = m.b.CreateMul(lhs, rhs, "mul")
-		case ir.Div:
-			val = m.b.CreateSDiv(lhs, rhs, "div")
-		case ir.Mod:
-			val = m.b.CreateSRem(lhs, rhs, "mod")
+		case ir.Add, ir.Sub, ir.Mul:
+			val = m.emitArith(inst.Op, lhs, rhs, block, inst)
+		case ir.Div, ir.Mod:
+			val = m.emitFloorDiv(inst.Op, lhs, rhs)
 		case ir.Shl:
 			val = m.b.CreateShl(lhs, rhs, "shl")
 		case ir.LShr:
@@ -181,7 +715,7 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		switch inst.Op {
 		case ir.Neg:
 			val := m.lookupValue(inst.Operand(0).Def())
-			m.defs[inst] = m.b.CreateSub(zero, val, "neg")
+			m.defs[inst] = m.emitArith(ir.Sub, zero, val, block, inst)
 		default:
 			panic("codegen: unrecognized unary op")
 		}
@@ -197,7 +731,11 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 			panic(fmt.Sprintf("codegen: invalid access count: %d", inst.StackSize))
 		}
 		n := llvm.ConstInt(llvm.Int64Type(), uint64(inst.StackSize), false)
-		m.b.CreateCall(m.checkStack, []llvm.Value{n, m.blockName(block), m.instPos(inst)}, "")
+		if m.config.StackTraps {
+			m.emitStackGuard(stackLen, n, block, inst)
+			break
+		}
+		m.b.CreateCall(m.checkStack, []llvm.Value{stackLen, n, m.blockName(block), m.instPos(inst)}, "")
 	case *ir.OffsetStackStmt:
 		n := llvm.ConstInt(llvm.Int64Type(), uint64(inst.Offset), false)
 		stackLen = m.b.CreateAdd(stackLen, n, "offsetstack")
@@ -214,6 +752,9 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		switch inst.Op {
 		case ir.PrintByte:
 			f = m.printByte
+			if m.config.OutputEncoding == ir.UTF8 {
+				f = m.runePrinter()
+			}
 		case ir.PrintInt:
 			f = m.printInt
 		default:
@@ -234,12 +775,220 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		m.defs[inst] = m.b.CreateCall(f, []llvm.Value{}, "read")
 	case *ir.FlushStmt:
 		m.b.CreateCall(m.flush, []llvm.Value{}, "")
+	case *ir.PhiExpr:
+		m.defs[inst] = m.b.CreatePHI(llvm.Int64Type(), "phi")
+		m.phis = append(m.phis, inst)
 	default:
 		panic("codegen: unrecognized instruction type")
 	}
 	return stackLen
 }
 
+// stackTrap is a block shared by all stack guards in a program, which
+// reports an underflow through check_stack. The arguments are merged
+// with phis from each guarding block.
+type stackTrap struct {
+	block                 llvm.BasicBlock
+	stackLen, n, name, op llvm.Value
+}
+
+// emitStackGuard emits a single comparison of the stack length against
+// the depth required by the block, branching to the shared trap block
+// on underflow. The remainder of the block is emitted in a new LLVM
+// block. Lowering emits at most one AccessStackStmt per block, so this
+// replaces a check_stack call per block with an inline comparison.
+func (m *moduleBuilder) emitStackGuard(stackLen, n llvm.Value, block *ir.BasicBlock, inst ir.Inst) {
+	trap := m.getStackTrap()
+	guard := m.b.GetInsertBlock()
+	name, op := m.blockName(block), m.instPos(inst)
+	underflow := m.b.CreateICmp(llvm.IntULT, stackLen, n, "underflow")
+	ok := m.ctx.AddBasicBlock(m.fn, block.Name()+".ok")
+	m.b.CreateCondBr(underflow, trap.block, ok)
+	trap.stackLen.AddIncoming([]llvm.Value{stackLen}, []llvm.BasicBlock{guard})
+	trap.n.AddIncoming([]llvm.Value{n}, []llvm.BasicBlock{guard})
+	trap.name.AddIncoming([]llvm.Value{name}, []llvm.BasicBlock{guard})
+	trap.op.AddIncoming([]llvm.Value{op}, []llvm.BasicBlock{guard})
+	m.b.SetInsertPointAtEnd(ok)
+	m.heapGEPs = make(map[int64]llvm.Value)
+}
+
+// getStackTrap returns the shared stack underflow block, creating it on
+// first use.
+func (m *moduleBuilder) getStackTrap() *stackTrap {
+	if m.stackTrap != nil {
+		return m.stackTrap
+	}
+	insert := m.b.GetInsertBlock()
+	cStrTyp := llvm.PointerType(llvm.Int8Type(), 0)
+	trap := &stackTrap{block: m.ctx.AddBasicBlock(m.fn, "stack_underflow")}
+	m.b.SetInsertPointAtEnd(trap.block)
+	trap.stackLen = m.b.CreatePHI(llvm.Int64Type(), "stack_len")
+	trap.n = m.b.CreatePHI(llvm.Int64Type(), "n")
+	trap.name = m.b.CreatePHI(cStrTyp, "name")
+	trap.op = m.b.CreatePHI(cStrTyp, "op")
+	m.b.CreateCall(m.checkStack, []llvm.Value{trap.stackLen, trap.n, trap.name, trap.op}, "")
+	m.b.CreateUnreachable()
+	m.b.SetInsertPointAtEnd(insert)
+	m.stackTrap = trap
+	return trap
+}
+
+// emitArith emits an add, sub, or mul with the configured overflow
+// behavior. Increments and decrements are named inc and dec so they
+// stand out in the emitted IR.
+func (m *moduleBuilder) emitArith(op ir.BinaryOp, lhs, rhs llvm.Value, block *ir.BasicBlock, inst ir.Inst) llvm.Value {
+	name := op.String()
+	if bin, ok := inst.(*ir.BinaryExpr); ok {
+		if _, delta, ok := bin.IncDec(); ok {
+			name = "inc"
+			if delta < 0 {
+				name = "dec"
+			}
+		}
+	}
+	switch m.config.ArithOverflow {
+	case Wrap:
+		switch op {
+		case ir.Add:
+			return m.b.CreateAdd(lhs, rhs, name)
+		case ir.Sub:
+			return m.b.CreateSub(lhs, rhs, name)
+		case ir.Mul:
+			return m.b.CreateMul(lhs, rhs, name)
+		}
+	case NoSignedWrap:
+		switch op {
+		case ir.Add:
+			return m.b.CreateNSWAdd(lhs, rhs, name)
+		case ir.Sub:
+			return m.b.CreateNSWSub(lhs, rhs, name)
+		case ir.Mul:
+			return m.b.CreateNSWMul(lhs, rhs, name)
+		}
+	case Trap:
+		result := m.b.CreateCall(m.overflowIntrinsic(op), []llvm.Value{lhs, rhs}, name+".result")
+		val := m.b.CreateExtractValue(result, 0, name)
+		overflow := m.b.CreateExtractValue(result, 1, name+".overflow")
+		overflow = m.b.CreateZExt(overflow, llvm.Int64Type(), name+".overflow")
+		m.b.CreateCall(m.overflowCheck(), []llvm.Value{overflow, m.blockName(block), m.instPos(inst)}, "")
+		return val
+	default:
+		panic("codegen: unrecognized overflow behavior")
+	}
+	panic("codegen: unrecognized arithmetic op")
+}
+
+// emitFloorDiv emits a div or mod rounded toward negative infinity, as
+// in the interpreter and constant folding. LLVM sdiv and srem truncate
+// toward zero, so when the remainder is nonzero and its sign differs
+// from that of the divisor, the quotient is decremented and the divisor
+// is added to the remainder.
+func (m *moduleBuilder) emitFloorDiv(op ir.BinaryOp, lhs, rhs llvm.Value) llvm.Value {
+	rem := m.b.CreateSRem(lhs, rhs, "rem")
+	signs := m.b.CreateXor(rem, rhs, "rem.signs")
+	adjust := m.b.CreateAnd(
+		m.b.CreateICmp(llvm.IntNE, rem, zero, "rem.nonzero"),
+		m.b.CreateICmp(llvm.IntSLT, signs, zero, "rem.signdiff"), "adjust")
+	if op == ir.Mod {
+		return m.b.CreateAdd(rem, m.b.CreateSelect(adjust, rhs, zero, "mod.adjust"), "mod")
+	}
+	quo := m.b.CreateSDiv(lhs, rhs, "quo")
+	return m.b.CreateSub(quo, m.b.CreateZExt(adjust, llvm.Int64Type(), "div.adjust"), "div")
+}
+
+// overflowIntrinsic declares the LLVM overflow-checking intrinsic for
+// an arithmetic op.
+func (m *moduleBuilder) overflowIntrinsic(op ir.BinaryOp) llvm.Value {
+	var name string
+	switch op {
+	case ir.Add:
+		name = "llvm.sadd.with.overflow.i64"
+	case ir.Sub:
+		name = "llvm.ssub.with.overflow.i64"
+	case ir.Mul:
+		name = "llvm.smul.with.overflow.i64"
+	default:
+		panic("codegen: no overflow intrinsic for op")
+	}
+	if fn := m.module.NamedFunction(name); !fn.IsNil() {
+		return fn
+	}
+	resultTyp := llvm.StructType([]llvm.Type{llvm.Int64Type(), llvm.Int1Type()}, false)
+	typ := llvm.FunctionType(resultTyp, []llvm.Type{llvm.Int64Type(), llvm.Int64Type()}, false)
+	return llvm.AddFunction(m.module, name, typ)
+}
+
+// runePrinter declares the runtime print_rune function, which writes
+// printc output as UTF-8.
+func (m *moduleBuilder) runePrinter() llvm.Value {
+	if m.printRune.IsNil() {
+		m.printRune = m.module.NamedFunction("print_rune")
+	}
+	if m.printRune.IsNil() {
+		typ := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type()}, false)
+		m.printRune = llvm.AddFunction(m.module, "print_rune", typ)
+		m.printRune.SetLinkage(llvm.ExternalLinkage)
+	}
+	return m.printRune
+}
+
+// stringPrinter declares the runtime print_string function, which
+// writes a string of the given length.
+func (m *moduleBuilder) stringPrinter() llvm.Value {
+	if m.printString.IsNil() {
+		m.printString = m.module.NamedFunction("print_string")
+	}
+	if m.printString.IsNil() {
+		cStrTyp := llvm.PointerType(llvm.Int8Type(), 0)
+		typ := llvm.FunctionType(llvm.VoidType(), []llvm.Type{cStrTyp, llvm.Int64Type()}, false)
+		m.printString = llvm.AddFunction(m.module, "print_string", typ)
+		m.printString.SetLinkage(llvm.ExternalLinkage)
+	}
+	return m.printString
+}
+
+// heapCellFunc declares the runtime heap_cell function, which returns a
+// pointer to a cell of the growable heap.
+func (m *moduleBuilder) heapCellFunc() llvm.Value {
+	if m.heapCell.IsNil() {
+		m.heapCell = m.module.NamedFunction("heap_cell")
+	}
+	if m.heapCell.IsNil() {
+		cellTyp := llvm.PointerType(llvm.Int64Type(), 0)
+		typ := llvm.FunctionType(cellTyp, []llvm.Type{llvm.Int64Type()}, false)
+		m.heapCell = llvm.AddFunction(m.module, "heap_cell", typ)
+		m.heapCell.SetLinkage(llvm.ExternalLinkage)
+	}
+	return m.heapCell
+}
+
+// seedGrowableHeap stores the non-zero cells of the heap image to the
+// growable heap in the entry block, since the runtime allocates the
+// heap zeroed.
+func (m *moduleBuilder) seedGrowableHeap() {
+	for i, cell := range m.config.HeapImage {
+		if cell != 0 {
+			addr := llvm.ConstInt(llvm.Int64Type(), uint64(i), false)
+			gep := m.b.CreateCall(m.heapCellFunc(), []llvm.Value{addr}, "cell")
+			m.b.CreateStore(llvm.ConstInt(llvm.Int64Type(), uint64(cell), true), gep)
+		}
+	}
+}
+
+// overflowCheck declares the runtime check_overflow function.
+func (m *moduleBuilder) overflowCheck() llvm.Value {
+	if m.checkOverflow.IsNil() {
+		m.checkOverflow = m.module.NamedFunction("check_overflow")
+	}
+	if m.checkOverflow.IsNil() {
+		cStrTyp := llvm.PointerType(llvm.Int8Type(), 0)
+		typ := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), cStrTyp, cStrTyp}, false)
+		m.checkOverflow = llvm.AddFunction(m.module, "check_overflow", typ)
+		m.checkOverflow.SetLinkage(llvm.ExternalLinkage)
+	}
+	return m.checkOverflow
+}
+
 func (m *moduleBuilder) emitTerminator(block *ir.BasicBlock) {
 	switch term := block.Terminator.(type) {
 	case *ir.CallTerm:
@@ -253,22 +1002,11 @@ func (m *moduleBuilder) emitTerminator(block *ir.BasicBlock) {
 	case *ir.JmpTerm:
 		m.b.CreateBr(m.blocks[term.Succ(0)])
 	case *ir.JmpCondTerm:
-		val := m.lookupValue(term.Operand(0).Def())
-		var cond llvm.Value
-		switch term.Op {
-		case ir.Jz:
-			cond = m.b.CreateICmp(llvm.IntEQ, val, zero, "jz")
-		case ir.Jnz:
-			cond = m.b.CreateICmp(llvm.IntNE, val, zero, "jnz")
-		case ir.Jn:
-			cond = m.b.CreateICmp(llvm.IntSLT, val, zero, "jn")
-		default:
-			panic("codegen: unrecognized conditional jump op")
-		}
+		cond := m.jmpCond(term)
 		m.b.CreateCondBr(cond, m.blocks[term.Succ(0)], m.blocks[term.Succ(1)])
 	case *ir.RetTerm:
-		m.b.CreateCall(m.checkCallStack, []llvm.Value{m.blockName(block), m.instPos(term)}, "")
 		callStackLen := m.b.CreateLoad(m.callStackLen, "call_stack_len")
+		m.b.CreateCall(m.checkCallStack, []llvm.Value{callStackLen, m.blockName(block), m.instPos(term)}, "")
 		callStackLen = m.b.CreateSub(callStackLen, one, "call_stack_len")
 		m.b.CreateStore(callStackLen, m.callStackLen)
 		gep := m.b.CreateInBoundsGEP(m.callStack, []llvm.Value{zero, callStackLen}, "ret_addr.gep")
@@ -287,6 +1025,21 @@ func (m *moduleBuilder) emitTerminator(block *ir.BasicBlock) {
 	}
 }
 
+// jmpCond emits the comparison of a conditional jump.
+func (m *moduleBuilder) jmpCond(term *ir.JmpCondTerm) llvm.Value {
+	val := m.lookupValue(term.Operand(0).Def())
+	switch term.Op {
+	case ir.Jz:
+		return m.b.CreateICmp(llvm.IntEQ, val, zero, "jz")
+	case ir.Jnz:
+		return m.b.CreateICmp(llvm.IntNE, val, zero, "jnz")
+	case ir.Jn:
+		return m.b.CreateICmp(llvm.IntSLT, val, zero, "jn")
+	default:
+		panic("codegen: unrecognized conditional jump op")
+	}
+}
+
 func (m *moduleBuilder) lookupValue(val ir.Value) llvm.Value {
 	switch v := val.(type) {
 	case *ir.IntConst:
@@ -309,15 +1062,37 @@ func (m *moduleBuilder) stackAddr(pos uint, stackLen llvm.Value) llvm.Value {
 	return m.b.CreateInBoundsGEP(m.stack, []llvm.Value{zero, idx}, name+".gep")
 }
 
+// heapAddr computes the address of a heap cell. Constant addresses are
+// computed once per LLVM block, so repeated accesses to a cell share a
+// pointer that LLVM can keep in a register. With a growable heap, the
+// address is computed by the runtime on every access, since growing
+// the heap moves it.
 func (m *moduleBuilder) heapAddr(addr ir.Value) llvm.Value {
+	if m.config.GrowableHeap {
+		return m.b.CreateCall(m.heapCellFunc(), []llvm.Value{m.lookupValue(addr)}, "cell")
+	}
+	if c, ok := addr.(*ir.IntConst); ok {
+		if i64, ok := bigint.ToInt64(c.Int()); ok {
+			if gep, ok := m.heapGEPs[i64]; ok {
+				return gep
+			}
+			gep := m.b.CreateInBoundsGEP(m.heap, []llvm.Value{zero, m.lookupValue(addr)}, "gep")
+			m.heapGEPs[i64] = gep
+			return gep
+		}
+	}
 	return m.b.CreateInBoundsGEP(m.heap, []llvm.Value{zero, m.lookupValue(addr)}, "gep")
 }
 
+// constString returns the global for a constant string, declaring it
+// on first use. Blocks and their instructions are emitted in the order
+// of the program, so strings are declared in a reproducible order
+// without sorting, and the map is only used for lookups.
 func (m *moduleBuilder) constString(str string) llvm.Value {
 	if val, ok := m.strings[str]; ok {
 		return val
 	}
-	val := llvm.AddGlobal(m.module, llvm.ArrayType(llvm.Int8Type(), len(str)+1), "str_"+str)
+	val := llvm.AddGlobal(m.module, llvm.ArrayType(llvm.Int8Type(), len(str)+1), ".str."+str)
 	val.SetInitializer(m.ctx.ConstString(str, true))
 	val.SetLinkage(llvm.PrivateLinkage)
 	m.strings[str] = val
@@ -329,9 +1104,12 @@ func (m *moduleBuilder) blockName(block *ir.BasicBlock) llvm.Value {
 }
 
 func (m *moduleBuilder) instPos(inst ir.Inst) llvm.Value {
-	str := "<unknown>"
+	return m.b.CreateInBoundsGEP(m.constString(m.posString(inst)), []llvm.Value{zero, zero}, "op")
+}
+
+func (m *moduleBuilder) posString(inst ir.Inst) string {
 	if pos := inst.Pos(); pos != token.NoPos {
-		str = m.program.File.Position(inst.Pos()).String()
+		return m.program.File.Position(pos).String()
 	}
-	return m.b.CreateInBoundsGEP(m.constString(str), []llvm.Value{zero, zero}, "op")
+	return "<unknown>"
 }
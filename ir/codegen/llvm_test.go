@@ -0,0 +1,766 @@
+package codegen
+
+import (
+	"bytes"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+	"llvm.org/llvm/bindings/go/llvm"
+)
+
+func TestEmitLLVMModules(t *testing.T) {
+	// push 1
+	// push 2
+	// store
+	// end
+	a := lowerTokens(t, "programs/a.out.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Store},
+		{Type: ws.End},
+	})
+	// push 3
+	// push 4
+	// store
+	// end
+	b := lowerTokens(t, "b.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Push, Arg: big.NewInt(4)},
+		{Type: ws.Store},
+		{Type: ws.End},
+	})
+	config := Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	}
+
+	if prefixes := ProgramPrefixes([]*ir.Program{a, b, a}); prefixes[0] != "a" || prefixes[1] != "b" || prefixes[2] != "a_2" {
+		t.Errorf("got prefixes %q, want [a b a_2]", prefixes)
+	}
+	a2 := &ir.Program{Name: "x/a_2.ws"}
+	if prefixes := ProgramPrefixes([]*ir.Program{a, a2, a}); prefixes[0] != "a" || prefixes[1] != "a_2" || prefixes[2] != "a_3" {
+		t.Errorf("got prefixes %q, want [a a_2 a_3]", prefixes)
+	}
+
+	mod, err := EmitLLVMModules([]*ir.Program{a, b}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mod.NamedFunction("main").IsNil() {
+		t.Error("combined module defines main")
+	}
+	for _, name := range []string{"a.stack", "a.heap", "b.stack", "b.heap"} {
+		if mod.NamedGlobal(name).IsNil() {
+			t.Errorf("global %s not defined", name)
+		}
+	}
+
+	llvm.LinkInMCJIT()
+	if err := llvm.InitializeNativeTarget(); err != nil {
+		t.Fatal(err)
+	}
+	if err := llvm.InitializeNativeAsmPrinter(); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := llvm.NewMCJITCompiler(mod, llvm.NewMCJITCompilerOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Dispose()
+	for _, entry := range []string{"a_main", "b_main"} {
+		fn := mod.NamedFunction(entry)
+		if fn.IsNil() {
+			t.Errorf("entry %s not defined", entry)
+			continue
+		}
+		if code := engine.RunFunction(fn, mainArgs()).Int(true); code != 0 {
+			t.Errorf("entry %s exited with %d, want 0", entry, code)
+		}
+	}
+}
+
+func TestEmitLLVMModulesReentrant(t *testing.T) {
+	// push 1
+	// push 1
+	// retrieve
+	// push 1
+	// add
+	// store
+	// end
+	p := lowerTokens(t, "count.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Store},
+		{Type: ws.End},
+	})
+	mod, err := EmitLLVMModules([]*ir.Program{p}, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	llvm.LinkInMCJIT()
+	if err := llvm.InitializeNativeTarget(); err != nil {
+		t.Fatal(err)
+	}
+	if err := llvm.InitializeNativeAsmPrinter(); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := llvm.NewMCJITCompiler(mod, llvm.NewMCJITCompilerOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Dispose()
+	fn := mod.NamedFunction("count_main")
+	heap := engine.PointerToGlobal(mod.NamedGlobal("count.heap"))
+	// Each call starts from a zero heap, so the count is 1 every time.
+	for i := 0; i < 2; i++ {
+		if code := engine.RunFunction(fn, mainArgs()).Int(true); code != 0 {
+			t.Fatalf("call %d exited with %d, want 0", i+1, code)
+		}
+		if cell := *(*int64)(unsafe.Pointer(uintptr(heap) + 8)); cell != 1 {
+			t.Errorf("call %d: got heap[1] = %d, want 1", i+1, cell)
+		}
+	}
+}
+
+// mainArgs returns the argc and argv arguments of an entry function,
+// with no arguments.
+func mainArgs() []llvm.GenericValue {
+	return []llvm.GenericValue{
+		llvm.NewGenericValueFromInt(llvm.Int32Type(), 0, false),
+		llvm.NewGenericValueFromPointer(nil),
+	}
+}
+
+func TestEmitLLVMModulesSharedHeap(t *testing.T) {
+	a := lowerTokens(t, "a.ws", []*ws.Token{{Type: ws.End}})
+	b := lowerTokens(t, "b.ws", []*ws.Token{{Type: ws.End}})
+	mod, err := EmitLLVMModules([]*ir.Program{a, b}, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+		SharedHeap:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.NamedGlobal("heap").IsNil() {
+		t.Error("shared heap not defined")
+	}
+	if !mod.NamedGlobal("a.heap").IsNil() || !mod.NamedGlobal("b.heap").IsNil() {
+		t.Error("program heap defined with shared heap")
+	}
+}
+
+func TestEmitLLVMModulesPrefixCollision(t *testing.T) {
+	// The call stack of a and the stack of a_call would both be named
+	// a_call_stack if prefixes were joined to names with an underscore.
+	a := lowerTokens(t, "a.ws", []*ws.Token{{Type: ws.End}})
+	aCall := lowerTokens(t, "a_call.ws", []*ws.Token{{Type: ws.End}})
+	mod, err := EmitLLVMModules([]*ir.Program{a, aCall}, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.call_stack", "a_call.stack"} {
+		if mod.NamedGlobal(name).IsNil() {
+			t.Errorf("global %s not defined", name)
+		}
+	}
+	for _, entry := range []string{"a_main", "a_call_main"} {
+		if mod.NamedFunction(entry).IsNil() {
+			t.Errorf("entry %s not defined", entry)
+		}
+	}
+	if ll := mod.String(); strings.Contains(ll, ".1 =") {
+		t.Errorf("module has renamed symbols:\n%s", ll)
+	}
+}
+
+func lowerTokens(t *testing.T, filename string, tokens []*ws.Token) *ir.Program {
+	t.Helper()
+	file := token.NewFileSet().AddFile(filename, -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("lowering %s: %v", filename, errs)
+	}
+	return p
+}
+
+func TestEmitArithOverflowTrap(t *testing.T) {
+	// push 0
+	// readi
+	// push 0
+	// retrieve
+	// dup
+	// add
+	// printi
+	// end
+	p := lowerTokens(t, "overflow.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Dup},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	})
+	for _, test := range []struct {
+		Overflow ArithOverflow
+		Want     []string
+		NotWant  []string
+	}{
+		{Wrap, []string{"add i64"}, []string{"nsw", "with.overflow", "check_overflow"}},
+		{NoSignedWrap, []string{"add nsw i64"}, []string{"with.overflow", "check_overflow"}},
+		{Trap, []string{"call { i64, i1 } @llvm.sadd.with.overflow.i64", "call void @check_overflow"}, nil},
+	} {
+		mod, err := EmitLLVMModule(p, Config{
+			MaxStackLen:     DefaultMaxStackLen,
+			MaxCallStackLen: DefaultMaxCallStackLen,
+			MaxHeapBound:    DefaultMaxHeapBound,
+			ArithOverflow:   test.Overflow,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ll := mod.String()
+		for _, want := range test.Want {
+			if !strings.Contains(ll, want) {
+				t.Errorf("overflow %d: module does not contain %q:\n%s", test.Overflow, want, ll)
+			}
+		}
+		for _, notWant := range test.NotWant {
+			if strings.Contains(ll, notWant) {
+				t.Errorf("overflow %d: module contains %q:\n%s", test.Overflow, notWant, ll)
+			}
+		}
+	}
+}
+
+func TestEmitFloorDiv(t *testing.T) {
+	// push 0
+	// readi
+	// push 1
+	// readi
+	// push 0
+	// retrieve
+	// push 1
+	// retrieve
+	// div
+	// printi
+	// push 0
+	// retrieve
+	// push 1
+	// retrieve
+	// mod
+	// printi
+	// end
+	loadOperands := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Retrieve},
+	}
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Readi},
+	}
+	tokens = append(tokens, loadOperands...)
+	tokens = append(tokens, &ws.Token{Type: ws.Div}, &ws.Token{Type: ws.Printi})
+	tokens = append(tokens, loadOperands...)
+	tokens = append(tokens, &ws.Token{Type: ws.Mod}, &ws.Token{Type: ws.Printi}, &ws.Token{Type: ws.End})
+	p := lowerTokens(t, "floordiv.ws", tokens)
+
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Truncated division is corrected to round toward negative infinity
+	// when the remainder and divisor differ in sign, such as for -7/2.
+	ll := mod.String()
+	for _, want := range []string{
+		"%quo = sdiv i64",
+		"%rem = srem i64",
+		"%rem.signdiff = icmp slt i64 %rem.signs, 0",
+		"%div = sub i64 %quo, %div.adjust",
+		"%mod.adjust = select i1 %adjust",
+		"%mod = add i64 %rem",
+	} {
+		if !strings.Contains(ll, want) {
+			t.Errorf("module does not contain %q:\n%s", want, ll)
+		}
+	}
+}
+
+func TestHeapAddrCached(t *testing.T) {
+	p := lowerTokens(t, "heap.ws", []*ws.Token{{Type: ws.End}})
+	ctx := llvm.GlobalContext()
+	m := newModuleBuilder(ctx, ctx.NewModule("heap"), p, "", Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+		StackTraps:      true,
+	})
+	m.declareFuncs()
+	m.declareGlobals()
+	m.fn = m.main
+	m.b.SetInsertPointAtEnd(ctx.AddBasicBlock(m.main, ""))
+	m.heapGEPs = make(map[int64]llvm.Value)
+
+	five := ir.NewIntConst(big.NewInt(5), token.NoPos)
+	if gep := m.heapAddr(five); m.heapAddr(ir.NewIntConst(big.NewInt(5), token.NoPos)) != gep {
+		t.Error("GEP of heap cell 5 not reused within a block")
+	}
+	// The remainder of a block after a stack guard is emitted in a new
+	// LLVM block, so the cache starts over.
+	m.emitStackGuard(zero, one, p.Entry, p.Entry.Terminator)
+	if len(m.heapGEPs) != 0 {
+		t.Errorf("got %d cached GEPs after a stack guard, want 0", len(m.heapGEPs))
+	}
+}
+
+func TestEmitLLVMModuleDeterministic(t *testing.T) {
+	// push 1
+	// push 2
+	// add
+	// printi
+	// end
+	p := lowerTokens(t, "test", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	})
+	config := Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+		ArithOverflow:   Trap,
+	}
+	mod1, err := EmitLLVMModule(p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod2, err := EmitLLVMModule(p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll1, ll2 := mod1.String(), mod2.String()
+	if ll1 != ll2 {
+		t.Errorf("modules differ:\n%s\n---\n%s", ll1, ll2)
+	}
+}
+
+func TestEmitLLVMModuleStringOrder(t *testing.T) {
+	// dup
+	// printi
+	// call 0
+	// end
+	// label 0
+	// drop
+	// ret
+	p := lowerTokens(t, "order.ws", []*ws.Token{
+		{Type: ws.Dup},
+		{Type: ws.Printi},
+		{Type: ws.Call, Arg: big.NewInt(0)},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Drop},
+		{Type: ws.Ret},
+	})
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// String globals are declared in the order that the code first
+	// references them.
+	var globals, uses []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(mod.String(), "\n") {
+		if strings.HasPrefix(line, "@.str.") || strings.HasPrefix(line, "@\".str.") {
+			globals = append(globals, line[:strings.Index(line, " = ")])
+			continue
+		}
+		for {
+			first, i := "", len(line)
+			for _, global := range globals {
+				if j := strings.Index(line, global+","); j != -1 && j < i {
+					first, i = global, j
+				}
+			}
+			if first == "" {
+				break
+			}
+			if !seen[first] {
+				seen[first] = true
+				uses = append(uses, first)
+			}
+			line = line[i+len(first):]
+		}
+	}
+	if len(globals) < 2 {
+		t.Fatalf("got %d string globals, want several:\n%s", len(globals), mod.String())
+	}
+	if strings.Join(globals, " ") != strings.Join(uses, " ") {
+		t.Errorf("got string globals in order %q, want order of first use %q", globals, uses)
+	}
+}
+
+func TestEmitStackTraps(t *testing.T) {
+	// dup
+	// printi
+	// jmp l
+	// label l
+	// add
+	// printi
+	// end
+	p := lowerTokens(t, "traps.ws", []*ws.Token{
+		{Type: ws.Dup},
+		{Type: ws.Printi},
+		{Type: ws.Jmp, Arg: big.NewInt(0)},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	})
+	for _, traps := range []bool{false, true} {
+		mod, err := EmitLLVMModule(p, Config{
+			MaxStackLen:     DefaultMaxStackLen,
+			MaxCallStackLen: DefaultMaxCallStackLen,
+			MaxHeapBound:    DefaultMaxHeapBound,
+			StackTraps:      traps,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ll := mod.String()
+		guards := strings.Count(ll, "icmp ult")
+		calls := strings.Count(ll, "call void @check_stack")
+		switch {
+		case !traps && (guards != 0 || calls != 2):
+			t.Errorf("without traps: got %d guards and %d check_stack calls, want 0 and 2:\n%s", guards, calls, ll)
+		case traps && (guards != 2 || calls != 1 || !strings.Contains(ll, "stack_underflow:")):
+			t.Errorf("with traps: got %d guards and %d check_stack calls, want 2 and 1 in a shared trap:\n%s", guards, calls, ll)
+		}
+	}
+}
+
+func TestEmitAllocaStack(t *testing.T) {
+	// push 1
+	// push 2
+	// call l
+	// end
+	// label l
+	// add
+	// printi
+	// ret
+	p := lowerTokens(t, "alloca.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Call, Arg: big.NewInt(0)},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.Ret},
+	})
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+		AllocaStack:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mod.NamedGlobal("stack").IsNil() || !mod.NamedGlobal("stack_len").IsNil() {
+		t.Error("global stack defined with alloca stack")
+	}
+	if ll := mod.String(); !strings.Contains(ll, "%stack = alloca [1024 x i64]") {
+		t.Errorf("stack not allocated in main:\n%s", ll)
+	}
+}
+
+func TestEmitGrowableHeap(t *testing.T) {
+	// push 4096
+	// push 1
+	// store
+	// end
+	p := lowerTokens(t, "growable.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(4096)},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Store},
+		{Type: ws.End},
+	})
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    4096,
+		GrowableHeap:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mod.NamedGlobal("heap").IsNil() {
+		t.Error("static heap defined with growable heap")
+	}
+	if ll := mod.String(); !strings.Contains(ll, "call i64* @heap_cell(i64 4096)") {
+		t.Errorf("store not through heap_cell:\n%s", ll)
+	}
+}
+
+func TestEmitBlockFuncs(t *testing.T) {
+	// push 1
+	// push 2
+	// call l
+	// end
+	// label l
+	// add
+	// printi
+	// ret
+	p := lowerTokens(t, "blockfuncs.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Call, Arg: big.NewInt(0)},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.Ret},
+	})
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+		BlockFuncs:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range p.Blocks {
+		if mod.NamedFunction("block." + block.Name()).IsNil() {
+			t.Errorf("no function for %s", block.Name())
+		}
+	}
+	if ll := mod.String(); strings.Count(ll, "tail call i32") != 2 {
+		t.Errorf("got %d tail calls, want 2:\n%s", strings.Count(ll, "tail call i32"), ll)
+	}
+
+	if _, err := EmitLLVMModule(p, Config{BlockFuncs: true, AllocaStack: true}); err == nil {
+		t.Error("block functions with alloca stack: expected error")
+	}
+
+	// block_0:
+	//     %0 = readi
+	//     jmp block_1
+	// block_1:
+	//     printi %0
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("crossblock.ws", -1, 0))
+	b.InitBlocks(2)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpTerm(ir.Jmp, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreatePrintStmt(ir.PrintInt, read, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	cross, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EmitLLVMModule(cross, Config{BlockFuncs: true}); err == nil {
+		t.Error("block functions with a value used across blocks: expected error")
+	}
+}
+
+func TestEmitPhi(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     jz %0 block_2 block_3
+	// block_1:
+	//     %3 = phi [%1 block_2] [%2 block_3]
+	//     printi %3
+	//     exit
+	// block_2:
+	//     %1 = add %0 1
+	//     jmp block_1
+	// block_3:
+	//     %2 = sub %0 1
+	//     jmp block_1
+	b := ir.NewBuilder(token.NewFileSet().AddFile("phi.ws", -1, 0))
+	b.InitBlocks(4)
+	one := ir.NewIntConst(big.NewInt(1), token.NoPos)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read, b.Block(2), b.Block(3), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	phi := b.CreatePhiExpr(token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, phi, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	for i, op := range []ir.BinaryOp{ir.Add, ir.Sub} {
+		b.SetCurrentBlock(b.Block(i + 2))
+		phi.AddIncoming(b.CreateBinaryExpr(op, read, one, token.NoPos), b.Block(i+2))
+		b.CreateJmpTerm(ir.Jmp, b.Block(1), token.NoPos)
+	}
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+
+	// The phi is emitted before the blocks defining its incoming values.
+	config := Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	}
+	mod, err := EmitLLVMModule(p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll := mod.String()
+	if !strings.Contains(ll, "%phi = phi i64 [ %inc, %block_2 ], [ %dec, %block_3 ]") {
+		t.Errorf("phi not lowered with incoming edges:\n%s", ll)
+	}
+
+	config.BlockFuncs = true
+	if _, err := EmitLLVMModule(p, config); err == nil {
+		t.Error("block functions with phi: expected error")
+	}
+}
+
+func TestEmitOutputEncoding(t *testing.T) {
+	// push 200
+	// printc
+	// end
+	p := lowerTokens(t, "encoding.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(200)},
+		{Type: ws.Printc},
+		{Type: ws.End},
+	})
+	for _, test := range []struct {
+		Enc  ir.OutputEncoding
+		Want string
+	}{
+		{ir.Byte, "call void @print_byte(i64 200)"},
+		{ir.UTF8, "call void @print_rune(i64 200)"},
+	} {
+		mod, err := EmitLLVMModule(p, Config{
+			MaxStackLen:     DefaultMaxStackLen,
+			MaxCallStackLen: DefaultMaxCallStackLen,
+			MaxHeapBound:    DefaultMaxHeapBound,
+			OutputEncoding:  test.Enc,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ll := mod.String(); !strings.Contains(ll, test.Want) {
+			t.Errorf("%s: module does not contain %q:\n%s", test.Enc, test.Want, ll)
+		}
+	}
+}
+
+func TestEmitConstPrintString(t *testing.T) {
+	// push 'a'
+	// printc
+	// push 'b'
+	// printc
+	// push 'c'
+	// printc
+	// end
+	var tokens []*ws.Token
+	for _, c := range "abc" {
+		tokens = append(tokens, &ws.Token{Type: ws.Push, Arg: big.NewInt(int64(c))}, &ws.Token{Type: ws.Printc})
+	}
+	tokens = append(tokens, &ws.Token{Type: ws.End})
+	p := lowerTokens(t, "abc.ws", tokens)
+	mod, err := EmitLLVMModule(p, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll := mod.String()
+	if n := strings.Count(ll, "call void @print_string("); n != 1 {
+		t.Errorf("got %d string writes, want 1:\n%s", n, ll)
+	}
+	if !strings.Contains(ll, `c"abc\00"`) || !strings.Contains(ll, ", i64 3)") {
+		t.Errorf("module does not write constant string \"abc\" of length 3:\n%s", ll)
+	}
+	if strings.Contains(ll, "call void @print_byte(") {
+		t.Errorf("module prints bytes individually:\n%s", ll)
+	}
+}
+
+func TestWriteLLVMModule(t *testing.T) {
+	// push 1
+	// printi
+	// end
+	p := lowerTokens(t, "write.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	})
+	config := Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	}
+	mod, err := EmitLLVMModule(p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mod.String()
+
+	var ll bytes.Buffer
+	if err := WriteLLVMModule(&ll, p, config, false); err != nil {
+		t.Fatal(err)
+	}
+	if ll.String() != want {
+		t.Errorf("textual IR differs from EmitLLVMModule:\n%s\nwant:\n%s", ll.String(), want)
+	}
+	var bc bytes.Buffer
+	if err := WriteLLVMModule(&bc, p, config, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bc.Bytes(), []byte("BC\xc0\xde")) {
+		t.Errorf("output is not bitcode: % x", bc.Bytes())
+	}
+}
+
+func TestLLVMVersion(t *testing.T) {
+	if LLVMVersion() == "" {
+		t.Error("empty LLVM version")
+	}
+}
@@ -0,0 +1,117 @@
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scaffold is a ready-to-build project for a compiled program: its LLVM
+// IR, the C runtime, and a Makefile that links them into an executable
+// with clang, llvm-link, and llc.
+//
+// When Library is set, the Makefile instead builds a static archive,
+// lib<Name>.a, of the program and the runtime, for linking into a C or
+// Go program that calls the program as a function. The LLVM IR must
+// then be emitted by EmitLLVMModules, so that the entry is named
+// <Name>_main rather than main, and Name must be the prefix given by
+// ProgramPrefixes. A header, <Name>.h, declares the entry.
+type Scaffold struct {
+	Name    string // Executable name, also used for the .ll file
+	LLVMIR  string // Textual LLVM IR of the program module
+	Runtime []byte // Source of the C runtime, ext.c
+	Library bool   // Build a static archive rather than an executable
+}
+
+// Files returns the scaffold file names and contents.
+func (s *Scaffold) Files() map[string][]byte {
+	files := map[string][]byte{
+		s.Name + ".ll": []byte(s.LLVMIR),
+		"ext.c":        s.Runtime,
+		"Makefile":     []byte(s.Makefile()),
+	}
+	if s.Library {
+		files[s.Name+".h"] = []byte(s.Header())
+	}
+	return files
+}
+
+// Header returns a C header declaring the entry of the library. The
+// entry takes the arguments of main, runs the program to completion,
+// and returns 0 when it ends. It starts from an empty stack and the
+// initial heap each time, so it may be called more than once. Traps
+// exit the process, as in an executable.
+func (s *Scaffold) Header() string {
+	guard := strings.ToUpper(s.Name) + "_H"
+	return fmt.Sprintf(`#ifndef %[1]s
+#define %[1]s
+
+int %[2]s_main(int argc, char **argv);
+
+#endif
+`, guard, s.Name)
+}
+
+// Makefile returns a Makefile that builds the executable with the same
+// steps as the compile script, or the static archive for a library.
+func (s *Scaffold) Makefile() string {
+	if s.Library {
+		return s.libraryMakefile()
+	}
+	return fmt.Sprintf(`LLVM_FLAGS ?= -O3
+
+%[1]s: %[1]s.o.s
+	clang $(LLVM_FLAGS) -o $@ $<
+
+%[1]s.o.s: %[1]s.o
+	llc $(LLVM_FLAGS) $<
+
+%[1]s.o: %[1]s.ll ext.ll
+	llvm-link -o $@ $^
+
+ext.ll: ext.c
+	clang $(LLVM_FLAGS) -S -emit-llvm -o $@ $<
+
+clean:
+	rm -f %[1]s %[1]s.o %[1]s.o.s ext.ll
+
+.PHONY: clean
+`, s.Name)
+}
+
+// libraryMakefile returns a Makefile that builds a static archive of
+// position-independent objects, so that it can be linked into PIE
+// executables.
+func (s *Scaffold) libraryMakefile() string {
+	return fmt.Sprintf(`LLVM_FLAGS ?= -O3
+
+lib%[1]s.a: %[1]s.o ext.o
+	ar rcs $@ $^
+
+%[1]s.o: %[1]s.ll
+	llc $(LLVM_FLAGS) -relocation-model=pic -filetype=obj -o $@ $<
+
+ext.o: ext.c
+	clang $(LLVM_FLAGS) -fPIC -c -o $@ $<
+
+clean:
+	rm -f lib%[1]s.a %[1]s.o ext.o
+
+.PHONY: clean
+`, s.Name)
+}
+
+// Write writes the scaffold files to dir, creating it if needed.
+func (s *Scaffold) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, contents := range s.Files() {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
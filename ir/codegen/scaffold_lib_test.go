@@ -0,0 +1,96 @@
+// +build toolchain
+
+package codegen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// TestScaffoldLibraryLink builds the static archive of a program with
+// clang, llc, and ar, then links it into a C driver. Run it with
+// go test -tags toolchain.
+func TestScaffoldLibraryLink(t *testing.T) {
+	for _, tool := range []string{"make", "clang", "llc", "ar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// push 0; retrieve; printi; push '\n'; printc; push 0; push 1; store; end
+	p := lowerTokens(t, "hello.ws", []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt('\n')},
+		{Type: ws.Printc},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Store},
+		{Type: ws.End},
+	})
+	mod, err := EmitLLVMModules([]*ir.Program{p}, Config{
+		MaxStackLen:     DefaultMaxStackLen,
+		MaxCallStackLen: DefaultMaxCallStackLen,
+		MaxHeapBound:    DefaultMaxHeapBound,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime, err := ioutil.ReadFile(filepath.Join("ext", "ext.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scaffold{Name: "hello", LLVMIR: mod.String(), Runtime: runtime, Library: true}
+	if err := s.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry returns, so the driver can continue after it, and resets
+	// the heap, so the second call prints 0 again.
+	driver := `#include <stdio.h>
+#include "hello.h"
+
+int main(int argc, char **argv) {
+  int code = hello_main(argc, argv);
+  code |= hello_main(argc, argv);
+  printf("exit %d\n", code);
+  return code;
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "driver.c"), []byte(driver), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"make", "libhello.a"},
+		{"clang", "-o", "driver", "driver.c", "-L.", "-lhello"},
+	} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", args[0], err, out)
+		}
+	}
+	cmd := exec.Command(filepath.Join(dir, "driver"))
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "0\n0\nexit 0\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,71 @@
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScaffoldWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Scaffold{
+		Name:    "hello_world",
+		LLVMIR:  "; ModuleID = 'hello_world'\n",
+		Runtime: []byte("int main() {}\n"),
+	}
+	if err := s.Write(filepath.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"hello_world.ll": s.LLVMIR,
+		"ext.c":          string(s.Runtime),
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	makefile, err := ioutil.ReadFile(filepath.Join(dir, "out", "Makefile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []string{
+		"hello_world: hello_world.o.s\n",
+		"hello_world.o: hello_world.ll ext.ll\n",
+		"ext.ll: ext.c\n",
+	} {
+		if !strings.Contains(string(makefile), rule) {
+			t.Errorf("Makefile missing rule %q:\n%s", rule, makefile)
+		}
+	}
+}
+
+func TestScaffoldLibrary(t *testing.T) {
+	s := &Scaffold{Name: "hello_world", Library: true}
+	files := s.Files()
+	header, ok := files["hello_world.h"]
+	if !ok {
+		t.Fatal("header not written")
+	}
+	if !strings.Contains(string(header), "int hello_world_main(int argc, char **argv);\n") {
+		t.Errorf("header does not declare entry:\n%s", header)
+	}
+	for _, rule := range []string{
+		"libhello_world.a: hello_world.o ext.o\n",
+		"hello_world.o: hello_world.ll\n",
+		"ext.o: ext.c\n",
+	} {
+		if !strings.Contains(string(files["Makefile"]), rule) {
+			t.Errorf("Makefile missing rule %q:\n%s", rule, files["Makefile"])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffOutlines formats a structural diff between two program outlines.
+// Blocks are matched by name and listed in the order of a, followed by
+// blocks only in b. Removed blocks are prefixed with "- " and added
+// blocks with "+ ". For a block in both whose instructions differ, a
+// "@@ name" header is followed by the removed and added instructions,
+// without unchanged context. Value IDs are assigned program-wide, so an
+// instruction added in one block renumbers the values after it.
+func DiffOutlines(a, b ProgramOutline) string {
+	var sb strings.Builder
+	bBlocks := make(map[string]*BlockOutline, len(b.Blocks))
+	for i := range b.Blocks {
+		bBlocks[b.Blocks[i].Name] = &b.Blocks[i]
+	}
+	aNames := make(map[string]bool, len(a.Blocks))
+	for i := range a.Blocks {
+		ab := &a.Blocks[i]
+		aNames[ab.Name] = true
+		bb, ok := bBlocks[ab.Name]
+		if !ok {
+			fmt.Fprintf(&sb, "- %s\n", ab.Name)
+			continue
+		}
+		if lines := diffLines(blockLines(ab), blockLines(bb)); len(lines) != 0 {
+			fmt.Fprintf(&sb, "@@ %s\n", ab.Name)
+			for _, line := range lines {
+				sb.WriteString(line)
+				sb.WriteByte('\n')
+			}
+		}
+	}
+	for _, bb := range b.Blocks {
+		if !aNames[bb.Name] {
+			fmt.Fprintf(&sb, "+ %s\n", bb.Name)
+		}
+	}
+	return sb.String()
+}
+
+func blockLines(block *BlockOutline) []string {
+	lines := make([]string, 0, len(block.Insts)+1)
+	for _, inst := range block.Insts {
+		lines = append(lines, inst.Text)
+	}
+	return append(lines, block.Terminator.Text)
+}
+
+// diffLines computes a minimal line diff from a longest common
+// subsequence and returns only the removed and added lines.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,36 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestDiffOutlines(t *testing.T) {
+	// block_0: %0 = readint; %1 = <op> %0 1; printint %1; jmp block_1
+	// block_1: exit
+	build := func(op BinaryOp) *Program {
+		b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+		b.InitBlocks(2)
+		read := b.CreateReadExpr(ReadInt, token.NoPos)
+		bin := b.CreateBinaryExpr(op, read, NewIntConst(big.NewInt(1), token.NoPos), token.NoPos)
+		b.CreatePrintStmt(PrintInt, bin, token.NoPos)
+		b.CreateJmpTerm(Fallthrough, b.Block(1), token.NoPos)
+		b.SetCurrentBlock(b.Block(1))
+		b.CreateExitTerm(token.NoPos)
+		p, err := b.Program()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	a, b := build(Add), build(Sub)
+
+	if diff := DiffOutlines(a.Outline(), a.Outline()); diff != "" {
+		t.Errorf("got diff of identical programs:\n%s", diff)
+	}
+	want := "@@ block_0\n- %1 = add %0 1\n+ %1 = sub %0 1\n"
+	if diff := DiffOutlines(a.Outline(), b.Outline()); diff != want {
+		t.Errorf("got diff:\n%s\nwant:\n%s", diff, want)
+	}
+}
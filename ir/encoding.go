@@ -0,0 +1,25 @@
+package ir
+
+// OutputEncoding is the encoding of characters written by printc. The
+// encodings agree for values 0 to 127 and differ above.
+type OutputEncoding uint8
+
+// Output encodings.
+const (
+	// Byte writes the low 8 bits of the value as a raw byte. It is the
+	// default.
+	Byte OutputEncoding = iota
+	// UTF8 writes the value as a Unicode code point encoded in UTF-8.
+	// Values that are not valid code points are written as U+FFFD.
+	UTF8
+)
+
+func (enc OutputEncoding) String() string {
+	switch enc {
+	case Byte:
+		return "byte"
+	case UTF8:
+		return "utf8"
+	}
+	return "encodingerr"
+}
@@ -2,15 +2,31 @@ package ir
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // Formatter pretty prints Nebula IR.
 type Formatter struct {
-	ids    map[Value]int
-	nextID int
+	ids              map[Value]int
+	nextID           int
+	BlockOrder       BlockOrder // Order to print blocks in programs
+	StackArt         bool       // Draw the stack effect above each block
+	Verbose          bool       // Show pseudo-ops, such as inc and dec
+	ElideFallthrough bool       // Omit fallthroughs to the next block printed
 }
 
+// BlockOrder is the order in which blocks are printed.
+type BlockOrder uint8
+
+// Block orders.
+const (
+	SourceOrder BlockOrder = iota // order in program source
+	RPOOrder                      // reverse post-order from the entry
+	IDOrder                       // ascending block ID
+	NameOrder                     // lexicographic block name
+)
+
 // NewFormatter constructs a Formatter.
 func NewFormatter() *Formatter {
 	return &Formatter{
@@ -19,21 +35,75 @@ func NewFormatter() *Formatter {
 	}
 }
 
-// FormatProgram pretty prints a Program.
+// FormatProgram pretty prints a Program. Value IDs are assigned with
+// AssignIDs before printing.
 func (f *Formatter) FormatProgram(p *Program) string {
+	f.AssignIDs(p)
 	var b strings.Builder
-	for i, block := range p.Blocks {
+	blocks := f.orderBlocks(p)
+	for i, block := range blocks {
 		if i != 0 {
 			b.WriteByte('\n')
 		}
-		b.WriteString(f.FormatBlock(block))
+		var next *BasicBlock
+		if i+1 < len(blocks) {
+			next = blocks[i+1]
+		}
+		b.WriteString(f.formatBlock(block, next))
 	}
 	return b.String()
 }
 
+// AssignIDs assigns IDs to the values defined in the program in a
+// canonical order: by block in the formatter's block order, then by
+// instruction. Values that already have IDs keep them. Assigning IDs
+// up front makes them independent of the order in which values are
+// later formatted, such as phi operands that refer to later values.
+func (f *Formatter) AssignIDs(p *Program) {
+	for _, block := range f.orderBlocks(p) {
+		for _, inst := range block.Nodes {
+			if val, ok := inst.(Value); ok {
+				f.valueID(val)
+			}
+		}
+	}
+}
+
+func (f *Formatter) orderBlocks(p *Program) []*BasicBlock {
+	switch f.BlockOrder {
+	case SourceOrder:
+		return p.Blocks
+	case RPOOrder:
+		return p.ReversePostOrder()
+	}
+	blocks := append([]*BasicBlock{}, p.Blocks...)
+	switch f.BlockOrder {
+	case IDOrder:
+		sort.SliceStable(blocks, func(i, j int) bool {
+			return blocks[i].ID < blocks[j].ID
+		})
+	case NameOrder:
+		sort.SliceStable(blocks, func(i, j int) bool {
+			return blocks[i].Name() < blocks[j].Name()
+		})
+	default:
+		panic("ir: unrecognized block order")
+	}
+	return blocks
+}
+
 // FormatBlock pretty prints a BasicBlock.
 func (f *Formatter) FormatBlock(block *BasicBlock) string {
+	return f.formatBlock(block, block.Next)
+}
+
+// formatBlock pretty prints a BasicBlock that is followed in the
+// output by next.
+func (f *Formatter) formatBlock(block, next *BasicBlock) string {
 	var b strings.Builder
+	if f.StackArt {
+		writeStackArt(&b, block.StackEffect())
+	}
 	name := block.Name()
 	b.WriteString(name)
 	b.WriteString(":\n")
@@ -59,6 +129,10 @@ func (f *Formatter) FormatBlock(block *BasicBlock) string {
 		b.WriteString(f.FormatInst(inst))
 		b.WriteByte('\n')
 	}
+	if jmp, ok := block.Terminator.(*JmpTerm); ok && f.ElideFallthrough &&
+		jmp.Op == Fallthrough && jmp.Succ(0) == next && next != nil {
+		return b.String()
+	}
 	b.WriteString("    ")
 	b.WriteString(f.FormatInst(block.Terminator))
 	b.WriteByte('\n')
@@ -72,6 +146,19 @@ func (f *Formatter) FormatInst(inst Inst) string {
 		b.WriteString(f.FormatValue(val))
 		b.WriteString(" = ")
 	}
+	if bin, ok := inst.(*BinaryExpr); ok && f.Verbose {
+		if x, delta, ok := bin.IncDec(); ok {
+			op := "inc"
+			if delta < 0 {
+				op = "dec"
+			}
+			b.WriteString(op)
+			writeStackPos(&b, inst)
+			b.WriteByte(' ')
+			b.WriteString(f.FormatValue(x))
+			return b.String()
+		}
+	}
 	b.WriteString(inst.OpString())
 	writeStackPos(&b, inst)
 	if phi, ok := inst.(*PhiExpr); ok {
@@ -82,8 +169,7 @@ func (f *Formatter) FormatInst(inst Inst) string {
 			b.WriteString(val.Block.Name())
 			b.WriteByte(']')
 		}
-	}
-	if user, ok := inst.(User); ok {
+	} else if user, ok := inst.(User); ok {
 		for _, op := range user.Operands() {
 			b.WriteByte(' ')
 			if op == nil {
@@ -108,15 +194,19 @@ func (f *Formatter) FormatValue(val Value) string {
 	case *IntConst:
 		return v.Int().String()
 	}
-	var id int
-	if vid, ok := f.ids[val]; ok {
-		id = vid
-	} else {
-		id = f.nextID
-		f.ids[val] = f.nextID
-		f.nextID++
+	return fmt.Sprintf("%%%d", f.valueID(val))
+}
+
+// valueID returns the ID of a value, assigning the next ID on first
+// use.
+func (f *Formatter) valueID(val Value) int {
+	if id, ok := f.ids[val]; ok {
+		return id
 	}
-	return fmt.Sprintf("%%%d", id)
+	id := f.nextID
+	f.ids[val] = id
+	f.nextID++
+	return id
 }
 
 // FormatStack pretty prints a stack.
@@ -144,6 +234,82 @@ func (f *Formatter) FormatStack(s *Stack) string {
 	return b.String()
 }
 
+// FormatStackDiff pretty prints the fields and slots that differ
+// between two stacks, one difference per line.
+func (f *Formatter) FormatStackDiff(a, b *Stack) string {
+	var d strings.Builder
+	f.writeValuesDiff(&d, "values", a.values, b.values)
+	f.writeValuesDiff(&d, "under", a.under, b.under)
+	if a.pops != b.pops {
+		fmt.Fprintf(&d, "pops: %d != %d\n", a.pops, b.pops)
+	}
+	if a.accesses != b.accesses {
+		fmt.Fprintf(&d, "accesses: %d != %d\n", a.accesses, b.accesses)
+	}
+	return d.String()
+}
+
+func (f *Formatter) writeValuesDiff(b *strings.Builder, name string, x, y []Value) {
+	if len(x) != len(y) {
+		fmt.Fprintf(b, "len(%s): %d != %d\n", name, len(x), len(y))
+	}
+	for i := 0; i < len(x) || i < len(y); i++ {
+		var vx, vy Value
+		if i < len(x) {
+			vx = x[i]
+		}
+		if i < len(y) {
+			vy = y[i]
+		}
+		if vx != vy {
+			fmt.Fprintf(b, "%s[%d]: %s != %s\n", name, i, f.formatOptValue(vx), f.formatOptValue(vy))
+		}
+	}
+}
+
+func (f *Formatter) formatOptValue(val Value) string {
+	if val == nil {
+		return "-"
+	}
+	return f.FormatValue(val)
+}
+
+// writeStackArt draws a stack effect as comment lines. Incoming slots
+// are numbered by depth from the top, popped slots are marked with ^,
+// and pushed slots are drawn as +:
+//
+//	; in:  ...|3|2|1|
+//	; pop:       ^ ^
+//	; out: ...|3|+|
+func writeStackArt(b *strings.Builder, effect StackEffect) {
+	var in, pop strings.Builder
+	in.WriteString("; in:  ...|")
+	pop.WriteString("; pop:     ")
+	for i := effect.Access; i > 0; i-- {
+		slot := fmt.Sprint(i)
+		in.WriteString(slot)
+		in.WriteByte('|')
+		mark := ' '
+		if i <= effect.Pops {
+			mark = '^'
+		}
+		pop.WriteString(strings.Repeat(" ", len(slot)-1))
+		pop.WriteRune(mark)
+		pop.WriteByte(' ')
+	}
+	b.WriteString(in.String())
+	b.WriteByte('\n')
+	b.WriteString(strings.TrimRight(pop.String(), " "))
+	b.WriteString("\n; out: ...|")
+	for i := effect.Access; i > effect.Pops; i-- {
+		fmt.Fprintf(b, "%d|", i)
+	}
+	for i := uint(0); i < effect.Pushes; i++ {
+		b.WriteString("+|")
+	}
+	b.WriteByte('\n')
+}
+
 func writeBlockSlice(b *strings.Builder, blocks []*BasicBlock) {
 	if len(blocks) == 0 {
 		b.WriteString("-")
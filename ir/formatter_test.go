@@ -0,0 +1,183 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestFormatProgramRPO(t *testing.T) {
+	// block_0: jmp block_2
+	// block_1: exit
+	// block_2: jz block_1 block_3
+	// block_3: jmp block_1
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	b.CreateJmpTerm(Jmp, b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	read := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(1), b.Block(3), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateJmpTerm(Jmp, b.Block(1), token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		Order BlockOrder
+		Names []string
+	}{
+		{SourceOrder, []string{"block_0", "block_1", "block_2", "block_3"}},
+		{RPOOrder, []string{"block_0", "block_2", "block_3", "block_1"}},
+	} {
+		f := NewFormatter()
+		f.BlockOrder = test.Order
+		if names := blockHeaders(f.FormatProgram(p)); !equalStrings(names, test.Names) {
+			t.Errorf("order %d: got blocks %q, want %q", test.Order, names, test.Names)
+		}
+	}
+}
+
+func blockHeaders(ir string) []string {
+	var names []string
+	for _, line := range strings.Split(ir, "\n") {
+		if strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " ") {
+			names = append(names, strings.TrimSuffix(line, ":"))
+		}
+	}
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFormatStackArt(t *testing.T) {
+	// Lowered from: add
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	b.CreateAccessStackStmt(2, token.NoPos)
+	lhs := b.CreateLoadStackExpr(2, token.NoPos)
+	rhs := b.CreateLoadStackExpr(1, token.NoPos)
+	sum := b.CreateBinaryExpr(Add, lhs, rhs, token.NoPos)
+	b.CreateOffsetStackStmt(-1, token.NoPos)
+	b.CreateStoreStackStmt(1, sum, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := p.Blocks[0]
+	if effect, want := block.StackEffect(), (StackEffect{Access: 2, Pops: 2, Pushes: 1}); effect != want {
+		t.Errorf("got stack effect %+v, want %+v", effect, want)
+	}
+	f := NewFormatter()
+	f.StackArt = true
+	art := "; in:  ...|2|1|\n" +
+		"; pop:     ^ ^\n" +
+		"; out: ...|+|\n"
+	if got := f.FormatBlock(block); !strings.HasPrefix(got, art+"block_0:\n") {
+		t.Errorf("got block:\n%s\nwant prefix:\n%s", got, art)
+	}
+}
+
+func TestFormatIncDec(t *testing.T) {
+	read := NewReadExpr(ReadInt, token.NoPos)
+	one := NewIntConst(big.NewInt(1), token.NoPos)
+	two := NewIntConst(big.NewInt(2), token.NoPos)
+	for _, test := range []struct {
+		Inst          Inst
+		Plain, Pretty string
+	}{
+		{NewBinaryExpr(Add, read, one, token.NoPos), "%1 = add %0 1", "%1 = inc %0"},
+		{NewBinaryExpr(Add, one, read, token.NoPos), "%1 = add 1 %0", "%1 = inc %0"},
+		{NewBinaryExpr(Sub, read, one, token.NoPos), "%1 = sub %0 1", "%1 = dec %0"},
+		{NewBinaryExpr(Sub, one, read, token.NoPos), "%1 = sub 1 %0", "%1 = sub 1 %0"},
+		{NewBinaryExpr(Add, read, two, token.NoPos), "%1 = add %0 2", "%1 = add %0 2"},
+	} {
+		f := NewFormatter()
+		f.FormatValue(read)
+		if got := f.FormatInst(test.Inst); got != test.Plain {
+			t.Errorf("got %q, want %q", got, test.Plain)
+		}
+		f.Verbose = true
+		if got := f.FormatInst(test.Inst); got != test.Pretty {
+			t.Errorf("verbose: got %q, want %q", got, test.Pretty)
+		}
+	}
+}
+
+func TestFormatElideFallthrough(t *testing.T) {
+	// block_0: fallthrough block_1
+	// block_1: fallthrough block_2
+	// block_2: exit
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.CreateJmpTerm(Fallthrough, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateJmpTerm(Fallthrough, b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFormatter()
+	f.ElideFallthrough = true
+	if out := f.FormatProgram(p); strings.Contains(out, "fallthrough") {
+		t.Errorf("in-order fallthroughs not elided:\n%s", out)
+	}
+	f.BlockOrder = NameOrder
+	p.Blocks[1].LabelName = "z"
+	if out := f.FormatProgram(p); strings.Count(out, "fallthrough") != 2 {
+		t.Errorf("out-of-order fallthroughs elided:\n%s", out)
+	}
+}
+
+func TestAssignIDs(t *testing.T) {
+	// block_0: %0 = readint; fallthrough block_1
+	// block_1: %1 = phi [%0 block_0] [%3 block_1]; %2 = readint; %3 = add %1 %2; jz %3 block_2 block_1
+	// block_2: exit
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	read0 := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpTerm(Fallthrough, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	phi := b.CreatePhiExpr(token.NoPos)
+	read1 := b.CreateReadExpr(ReadInt, token.NoPos)
+	add := b.CreateBinaryExpr(Add, phi, read1, token.NoPos)
+	phi.AddIncoming(read0, b.Block(0))
+	phi.AddIncoming(add, b.Block(1))
+	b.CreateJmpCondTerm(Jz, add, b.Block(2), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := NewFormatter().FormatProgram(p)
+	if !strings.Contains(want, "%1 = phi [%0 block_0] [%3 block_1]") {
+		t.Errorf("IDs not assigned in definition order:\n%s", want)
+	}
+	f := NewFormatter()
+	f.AssignIDs(p)
+	f.FormatBlock(p.Blocks[1]) // format out of order
+	if got := f.FormatProgram(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmitGoBuilder generates Go source for a function that reconstructs
+// the program using the Builder API, for use as a hand-editable test
+// fixture. The generated function has the signature
+//
+//	func buildProgram(file *token.File) (*ir.Program, error)
+//
+// and requires the imports go/token, math/big, and ir. Source positions
+// are not preserved. Block instructions are emitted in reverse
+// post-order, so that values used across blocks are defined before
+// their uses. An error is returned for a value used where its
+// definition does not reach, other than as a phi incoming value.
+func EmitGoBuilder(p *Program) (string, error) {
+	g := &goBuilder{names: make(map[Value]string)}
+	g.emit(p)
+	if g.err != nil {
+		return "", g.err
+	}
+	return g.b.String(), nil
+}
+
+type goBuilder struct {
+	b      strings.Builder
+	names  map[Value]string
+	blocks map[*BasicBlock]string
+	phis   []*PhiExpr
+	block  *BasicBlock // Block being emitted
+	err    error
+}
+
+func (g *goBuilder) emit(p *Program) {
+	g.blocks = make(map[*BasicBlock]string, len(p.Blocks))
+	for i, block := range p.Blocks {
+		g.blocks[block] = fmt.Sprintf("block%d", i)
+	}
+
+	g.b.WriteString("func buildProgram(file *token.File) (*ir.Program, error) {\n")
+	g.b.WriteString("\tb := ir.NewBuilder(file)\n")
+	fmt.Fprintf(&g.b, "\tb.InitBlocks(%d)\n", len(p.Blocks))
+	for i, block := range p.Blocks {
+		fmt.Fprintf(&g.b, "\t%s := b.Block(%d)\n", g.blocks[block], i)
+	}
+	for _, block := range p.Blocks {
+		if len(block.Labels) != 0 {
+			fmt.Fprintf(&g.b, "\t%s.Labels = []ir.Label{", g.blocks[block])
+			for i, label := range block.Labels {
+				if i != 0 {
+					g.b.WriteString(", ")
+				}
+				fmt.Fprintf(&g.b, "{ID: %s, Name: %q}", goBigInt(label.ID.String()), label.Name)
+			}
+			g.b.WriteString("}\n")
+		}
+		if block.LabelName != "" {
+			fmt.Fprintf(&g.b, "\t%s.LabelName = %q\n", g.blocks[block], block.LabelName)
+		}
+	}
+
+	for _, block := range p.ReversePostOrder() {
+		g.block = block
+		fmt.Fprintf(&g.b, "\n\tb.SetCurrentBlock(%s)\n", g.blocks[block])
+		for _, inst := range block.Nodes {
+			g.emitInst(inst)
+		}
+		g.emitInst(block.Terminator)
+	}
+
+	if len(g.phis) != 0 {
+		g.b.WriteByte('\n')
+	}
+	for _, phi := range g.phis {
+		for _, incoming := range phi.Values() {
+			g.block = incoming.Block
+			fmt.Fprintf(&g.b, "\t%s.AddIncoming(%s, %s)\n", g.names[phi], g.value(incoming.Value), g.blocks[incoming.Block])
+		}
+	}
+	g.b.WriteString("\n\treturn b.Program()\n}\n")
+}
+
+func (g *goBuilder) emitInst(inst Inst) {
+	var call string
+	switch inst := inst.(type) {
+	case *BinaryExpr:
+		call = fmt.Sprintf("CreateBinaryExpr(ir.%s, %s, %s", goBinaryOps[inst.Op], g.operand(inst, 0), g.operand(inst, 1))
+	case *UnaryExpr:
+		call = fmt.Sprintf("CreateUnaryExpr(ir.%s, %s", goUnaryOps[inst.Op], g.operand(inst, 0))
+	case *LoadStackExpr:
+		call = fmt.Sprintf("CreateLoadStackExpr(%d", inst.StackPos)
+	case *StoreStackStmt:
+		call = fmt.Sprintf("CreateStoreStackStmt(%d, %s", inst.StackPos, g.operand(inst, 0))
+	case *AccessStackStmt:
+		call = fmt.Sprintf("CreateAccessStackStmt(%d", inst.StackSize)
+	case *OffsetStackStmt:
+		call = fmt.Sprintf("CreateOffsetStackStmt(%d", inst.Offset)
+	case *LoadHeapExpr:
+		call = fmt.Sprintf("CreateLoadHeapExpr(%s", g.operand(inst, 0))
+	case *StoreHeapStmt:
+		call = fmt.Sprintf("CreateStoreHeapStmt(%s, %s", g.operand(inst, 0), g.operand(inst, 1))
+	case *PrintStmt:
+		call = fmt.Sprintf("CreatePrintStmt(ir.%s, %s", goPrintOps[inst.Op], g.operand(inst, 0))
+	case *ReadExpr:
+		call = fmt.Sprintf("CreateReadExpr(ir.%s", goReadOps[inst.Op])
+	case *FlushStmt:
+		call = "CreateFlushStmt("
+	case *PhiExpr:
+		call = "CreatePhiExpr("
+		g.phis = append(g.phis, inst)
+	case *CallTerm:
+		call = fmt.Sprintf("CreateCallTerm(%s, %s", g.blocks[inst.Succ(0)], g.blocks[inst.Succ(1)])
+	case *JmpTerm:
+		call = fmt.Sprintf("CreateJmpTerm(ir.%s, %s", goJmpOps[inst.Op], g.blocks[inst.Succ(0)])
+	case *JmpCondTerm:
+		call = fmt.Sprintf("CreateJmpCondTerm(ir.%s, %s, %s, %s", goJmpCondOps[inst.Op], g.operand(inst, 0), g.blocks[inst.Succ(0)], g.blocks[inst.Succ(1)])
+	case *RetTerm:
+		call = "CreateRetTerm("
+	case *ExitTerm:
+		call = "CreateExitTerm("
+	default:
+		panic("ir: unrecognized instruction type")
+	}
+	if !strings.HasSuffix(call, "(") {
+		call += ", "
+	}
+	g.b.WriteByte('\t')
+	_, isPhi := inst.(*PhiExpr)
+	if val, ok := inst.(Value); ok && (val.NUses() != 0 || isPhi) {
+		name := fmt.Sprintf("v%d", len(g.names))
+		g.names[val] = name
+		g.b.WriteString(name)
+		g.b.WriteString(" := ")
+	}
+	fmt.Fprintf(&g.b, "b.%stoken.NoPos)\n", call)
+}
+
+func (g *goBuilder) operand(user User, n int) string {
+	return g.value(user.Operand(n).Def())
+}
+
+func (g *goBuilder) value(val Value) string {
+	if c, ok := val.(*IntConst); ok {
+		return fmt.Sprintf("ir.NewIntConst(%s, token.NoPos)", goBigInt(c.Int().String()))
+	}
+	if name, ok := g.names[val]; ok {
+		return name
+	}
+	if g.err == nil {
+		g.err = fmt.Errorf("ir: %T used in %s before its definition", val, g.block.Name())
+	}
+	return "nil"
+}
+
+func goBigInt(n string) string {
+	if len(n) <= 18 {
+		return fmt.Sprintf("big.NewInt(%s)", n)
+	}
+	return fmt.Sprintf("func() *big.Int { n, _ := new(big.Int).SetString(%q, 10); return n }()", n)
+}
+
+var (
+	goBinaryOps = [...]string{
+		Add: "Add", Sub: "Sub", Mul: "Mul", Div: "Div", Mod: "Mod",
+		Shl: "Shl", LShr: "LShr", AShr: "AShr", And: "And", Or: "Or", Xor: "Xor",
+	}
+	goUnaryOps   = [...]string{Neg: "Neg"}
+	goPrintOps   = [...]string{PrintByte: "PrintByte", PrintInt: "PrintInt"}
+	goReadOps    = [...]string{ReadByte: "ReadByte", ReadInt: "ReadInt"}
+	goJmpOps     = [...]string{Jmp: "Jmp", Fallthrough: "Fallthrough"}
+	goJmpCondOps = [...]string{Jz: "Jz", Jnz: "Jnz", Jn: "Jn"}
+)
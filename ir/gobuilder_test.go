@@ -0,0 +1,73 @@
+package ir
+
+import (
+	"go/parser"
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestEmitGoBuilder(t *testing.T) {
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.Block(1).Labels = []Label{{ID: big.NewInt(1), Name: "loop"}}
+	b.CreateAccessStackStmt(1, token.NoPos)
+	n := b.CreateLoadStackExpr(1, token.NoPos)
+	b.CreateReadExpr(ReadByte, token.NoPos)
+	b.CreateJmpTerm(Fallthrough, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	phi := b.CreatePhiExpr(token.NoPos)
+	dec := b.CreateBinaryExpr(Sub, phi, NewIntConst(big.NewInt(1), token.NoPos), token.NoPos)
+	phi.AddIncoming(n, b.Block(0))
+	phi.AddIncoming(dec, b.Block(1))
+	b.CreatePrintStmt(PrintInt, dec, token.NoPos)
+	b.CreateJmpCondTerm(Jnz, dec, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `func buildProgram(file *token.File) (*ir.Program, error) {
+	b := ir.NewBuilder(file)
+	b.InitBlocks(3)
+	block0 := b.Block(0)
+	block1 := b.Block(1)
+	block2 := b.Block(2)
+	block1.Labels = []ir.Label{{ID: big.NewInt(1), Name: "loop"}}
+	block1.LabelName = "loop"
+	block2.LabelName = "loop1"
+
+	b.SetCurrentBlock(block0)
+	b.CreateAccessStackStmt(1, token.NoPos)
+	v0 := b.CreateLoadStackExpr(1, token.NoPos)
+	b.CreateReadExpr(ir.ReadByte, token.NoPos)
+	b.CreateJmpTerm(ir.Fallthrough, block1, token.NoPos)
+
+	b.SetCurrentBlock(block1)
+	v1 := b.CreatePhiExpr(token.NoPos)
+	v2 := b.CreateBinaryExpr(ir.Sub, v1, ir.NewIntConst(big.NewInt(1), token.NoPos), token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, v2, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jnz, v2, block1, block2, token.NoPos)
+
+	b.SetCurrentBlock(block2)
+	b.CreateExitTerm(token.NoPos)
+
+	v1.AddIncoming(v0, block0)
+	v1.AddIncoming(v2, block1)
+
+	return b.Program()
+}
+`
+	got, err := EmitGoBuilder(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "build.go", "package p\n\n"+got, 0); err != nil {
+		t.Errorf("emitted invalid Go: %v", err)
+	}
+}
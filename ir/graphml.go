@@ -0,0 +1,53 @@
+package ir
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// GraphML creates a control flow graph in the GraphML format, for
+// tools such as yEd or Gephi. Nodes carry the block name and stack
+// effect and edges carry their kind, as in DotDigraph.
+func (p *Program) GraphML() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="access" for="node" attr.name="access" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="pops" for="node" attr.name="pops" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="pushes" for="node" attr.name="pushes" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="exit" for="node" attr.name="exit" attr.type="boolean"/>` + "\n")
+	b.WriteString(`  <key id="kind" for="edge" attr.name="kind" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="caller" for="edge" attr.name="caller" attr.type="string"/>` + "\n")
+	b.WriteString(`  <graph id="cfg" edgedefault="directed">` + "\n")
+	p.RenumberBlockIDs()
+	for _, block := range p.Blocks {
+		effect := block.StackEffect()
+		_, exit := block.Terminator.(*ExitTerm)
+		fmt.Fprintf(&b, "    <node id=\"block_%d\">\n", block.ID)
+		writeGraphMLData(&b, "name", block.Name())
+		writeGraphMLData(&b, "access", effect.Access)
+		writeGraphMLData(&b, "pops", effect.Pops)
+		writeGraphMLData(&b, "pushes", effect.Pushes)
+		writeGraphMLData(&b, "exit", exit)
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range p.Edges() {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"block_%d\" target=\"block_%d\">\n", i, e.From.ID, e.To.ID)
+		writeGraphMLData(&b, "kind", e.Kind)
+		if e.Caller != nil {
+			writeGraphMLData(&b, "caller", e.Caller.Name())
+		}
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n")
+	b.WriteString("</graphml>\n")
+	return b.String()
+}
+
+func writeGraphMLData(b *strings.Builder, key string, val interface{}) {
+	fmt.Fprintf(b, "      <data key=\"%s\">", key)
+	xml.EscapeText(b, []byte(fmt.Sprint(val)))
+	b.WriteString("</data>\n")
+}
@@ -0,0 +1,72 @@
+package ir
+
+import (
+	"encoding/xml"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestGraphML(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_2 block_1
+	// block_1: call block_3
+	// block_2: exit
+	// block_3: ret
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	read := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(2), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateCallTerm(b.Block(3), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateRetTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		Key string `xml:"key,attr"`
+		Val string `xml:",chardata"`
+	}
+	var doc struct {
+		Nodes []struct {
+			ID   string `xml:"id,attr"`
+			Data []data `xml:"data"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []data `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal([]byte(p.GraphML()), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []string
+	for _, n := range doc.Nodes {
+		nodes = append(nodes, n.ID)
+		if len(n.Data) == 0 || n.Data[0].Key != "name" || n.Data[0].Val != n.ID {
+			t.Errorf("node %s has data %v", n.ID, n.Data)
+		}
+	}
+	if want := []string{"block_0", "block_1", "block_2", "block_3"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("got nodes %v, want %v", nodes, want)
+	}
+	var edges []string
+	for _, e := range doc.Edges {
+		edges = append(edges, e.Source+" -> "+e.Target+" "+e.Data[0].Val)
+	}
+	want := []string{
+		"block_0 -> block_2 true",
+		"block_0 -> block_1 false",
+		"block_1 -> block_3 call",
+		"block_3 -> block_2 ret",
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("got edges %v, want %v", edges, want)
+	}
+}
@@ -95,6 +95,9 @@ type UserBase struct {
 
 // Operands returns the user's operands.
 func (user *UserBase) Operands() []*ValueUse {
+	if len(user.operands) > len(user.operands2) {
+		return append([]*ValueUse{}, user.operands...) // Copy to prevent indexed writes
+	}
 	var operands2 = user.operands2 // Copy array to prevent indexed writes
 	return operands2[:len(user.operands)]
 }
@@ -132,6 +135,21 @@ func (user *UserBase) initOperands(u User, vals ...Value) {
 	}
 }
 
+// addOperand appends an operand, growing beyond the fixed storage when
+// needed.
+func (user *UserBase) addOperand(u User, val Value) {
+	use := &ValueUse{val, u, len(user.operands)}
+	if len(user.operands) < len(user.operands2) {
+		user.operands = user.operands2[:len(user.operands)+1]
+		user.operands[len(user.operands)-1] = use
+	} else {
+		user.operands = append(user.operands, use)
+	}
+	if val != nil {
+		val.AddUse(use)
+	}
+}
+
 // ClearOperands clears all operands and removes the uses.
 func (user *UserBase) ClearOperands() {
 	for i, operand := range user.operands {
@@ -212,9 +230,13 @@ type IntConst struct {
 	PosBase
 }
 
+// intLookup interns constant values. It is only used for lookups and is
+// never iterated, so it does not affect the order of emitted output.
 var intLookup = bigint.NewMap()
 
-// NewIntConst constructs an IntConst.
+// NewIntConst constructs an IntConst. Equal constants share the
+// underlying *big.Int, but each IntConst has its own position, so that
+// repeated pushes of a constant are each positioned at their push.
 func NewIntConst(val *big.Int, pos token.Pos) *IntConst {
 	pair, _ := intLookup.GetOrPutPair(val, nil) // keep only one equivalent *big.Int
 	return &IntConst{val: pair.K, PosBase: PosBase{pos: pos}}
@@ -287,6 +309,41 @@ func NewBinaryExpr(op BinaryOp, lhs, rhs Value, pos token.Pos) *BinaryExpr {
 // OpString pretty prints the op kind.
 func (bin *BinaryExpr) OpString() string { return bin.Op.String() }
 
+// IncDec reports whether the expression increments or decrements a
+// value by one, as in add x 1, add 1 x, or sub x 1, which Whitespace
+// programs use in place of missing inc and dec instructions. The
+// returned delta is 1 or -1.
+func (bin *BinaryExpr) IncDec() (x Value, delta int, ok bool) {
+	lhs, rhs := bin.Operand(0).Def(), bin.Operand(1).Def()
+	if bin.Op == Add {
+		if isUnit(lhs) != 0 && isUnit(rhs) == 0 {
+			lhs, rhs = rhs, lhs
+		}
+		if d := isUnit(rhs); d != 0 {
+			return lhs, d, true
+		}
+	} else if bin.Op == Sub {
+		if d := isUnit(rhs); d != 0 {
+			return lhs, -d, true
+		}
+	}
+	return nil, 0, false
+}
+
+// isUnit returns 1 or -1 when val is a constant with that value and 0
+// otherwise.
+func isUnit(val Value) int {
+	if c, ok := val.(*IntConst); ok && c.Int().IsInt64() {
+		switch c.Int().Int64() {
+		case 1:
+			return 1
+		case -1:
+			return -1
+		}
+	}
+	return 0
+}
+
 // UnaryOp is the operator kind of a unary expression.
 type UnaryOp uint8
 
@@ -459,6 +516,16 @@ func (print *PrintStmt) OpString() string { return print.Op.String() }
 type ReadOp uint8
 
 // Read operations.
+//
+// ReadByte reads a single byte, or -1 at EOF.
+//
+// ReadInt skips leading whitespace other than newlines, then parses an
+// optional sign followed by decimal digits, stopping at the first
+// non-digit. The remainder of the line is discarded. A line without
+// digits, including an empty line, reads as 0 and EOF before any
+// non-whitespace character reads as -1:
+//
+//	readint = { space - "\n" } [ "+" | "-" ] { digit } { any } ( "\n" | EOF )
 const (
 	ReadByte ReadOp = iota + 1
 	ReadInt
@@ -503,10 +570,11 @@ func NewFlushStmt(pos token.Pos) *FlushStmt {
 func (*FlushStmt) OpString() string { return "flush" }
 
 // PhiExpr is an SSA Φ function with pairs of values and predecessor
-// blocks.
+// blocks. The incoming values are the operands of the phi.
 type PhiExpr struct {
-	values []PhiValue
+	blocks []*BasicBlock
 	ValueBase
+	UserBase
 	PosBase
 }
 
@@ -516,13 +584,27 @@ type PhiValue struct {
 	Block *BasicBlock
 }
 
+// NewPhiExpr constructs a PhiExpr with no incoming values.
+func NewPhiExpr(pos token.Pos) *PhiExpr {
+	phi := &PhiExpr{PosBase: PosBase{pos: pos}}
+	phi.initOperands(phi)
+	return phi
+}
+
 // AddIncoming adds a val for an incoming edge to the phi expression.
 func (phi *PhiExpr) AddIncoming(val Value, block *BasicBlock) {
-	phi.values = append(phi.values, PhiValue{val, block})
+	phi.addOperand(phi, val)
+	phi.blocks = append(phi.blocks, block)
 }
 
 // Values returns pairs of values and predecessor blocks.
-func (phi *PhiExpr) Values() []PhiValue { return phi.values }
+func (phi *PhiExpr) Values() []PhiValue {
+	values := make([]PhiValue, len(phi.blocks))
+	for i, block := range phi.blocks {
+		values[i] = PhiValue{phi.operands[i].def, block}
+	}
+	return values
+}
 
 // OpString pretty prints the op kind.
 func (phi *PhiExpr) OpString() string { return "phi" }
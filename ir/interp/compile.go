@@ -0,0 +1,213 @@
+package interp
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// instFunc executes a compiled instruction.
+type instFunc func(i *Interp) error
+
+// valueFunc evaluates a compiled operand.
+type valueFunc func(i *Interp) *big.Int
+
+// compiled returns the instructions of a block compiled to closures,
+// compiling it on first entry. Compiling resolves the instruction type,
+// opcode, and constant operands once per block, rather than on every
+// execution as execInst does.
+func (i *Interp) compiled(block *ir.BasicBlock) []instFunc {
+	if block == i.codeBlock {
+		return i.blockCode
+	}
+	code, ok := i.code[block]
+	if !ok {
+		code = compileBlock(block)
+		if i.code == nil {
+			i.code = make(map[*ir.BasicBlock][]instFunc)
+		}
+		i.code[block] = code
+	}
+	i.codeBlock, i.blockCode = block, code
+	return code
+}
+
+func compileBlock(block *ir.BasicBlock) []instFunc {
+	code := make([]instFunc, len(block.Nodes))
+	for j, inst := range block.Nodes {
+		code[j] = compileInst(inst)
+	}
+	return code
+}
+
+// compileInst compiles an instruction to a closure. It is the only
+// dispatch on instruction type; execInst uses it uncached.
+func compileInst(inst ir.Inst) instFunc {
+	switch inst := inst.(type) {
+	case *ir.BinaryExpr:
+		return compileBinary(inst)
+	case *ir.UnaryExpr:
+		switch inst.Op {
+		case ir.Neg:
+			x := compileValue(inst.Operand(0).Def())
+			return func(i *Interp) error {
+				i.vals[inst] = new(big.Int).Neg(x(i))
+				return nil
+			}
+		default:
+			panic("interp: unrecognized unary op")
+		}
+	case *ir.LoadStackExpr:
+		return func(i *Interp) error {
+			i.vals[inst] = i.stack[i.stackIndex(inst.StackPos, inst)]
+			return nil
+		}
+	case *ir.StoreStackStmt:
+		val := compileValue(inst.Operand(0).Def())
+		return func(i *Interp) error {
+			i.stack[i.stackIndex(inst.StackPos, inst)] = val(i)
+			return nil
+		}
+	case *ir.AccessStackStmt:
+		return func(i *Interp) error {
+			if uint(len(i.stack)) < inst.StackSize {
+				i.trap("Data stack underflow", inst)
+			}
+			return nil
+		}
+	case *ir.OffsetStackStmt:
+		offset := inst.Offset
+		if offset < 0 {
+			return func(i *Interp) error {
+				if len(i.stack) < -offset {
+					i.trap("Data stack underflow", inst)
+				}
+				i.stack = i.stack[:len(i.stack)+offset]
+				return nil
+			}
+		}
+		return func(i *Interp) error {
+			for n := 0; n < offset; n++ {
+				i.stack = append(i.stack, nil)
+			}
+			return nil
+		}
+	case *ir.LoadHeapExpr:
+		addr := compileValue(inst.Operand(0).Def())
+		return func(i *Interp) error {
+			i.vals[inst] = i.load(addr(i))
+			return nil
+		}
+	case *ir.StoreHeapStmt:
+		addr, val := compileValue(inst.Operand(0).Def()), compileValue(inst.Operand(1).Def())
+		return func(i *Interp) error {
+			i.store(addr(i), val(i))
+			return nil
+		}
+	case *ir.PrintStmt:
+		val := compileValue(inst.Operand(0).Def())
+		switch inst.Op {
+		case ir.PrintByte:
+			return func(i *Interp) error {
+				return i.printByte(val(i))
+			}
+		case ir.PrintInt:
+			return func(i *Interp) error {
+				_, err := i.out.WriteString(val(i).String())
+				return err
+			}
+		default:
+			panic("interp: unrecognized print op")
+		}
+	case *ir.ReadExpr:
+		return func(i *Interp) error {
+			val, err := i.read(inst)
+			if err != nil {
+				return err
+			}
+			i.vals[inst] = val
+			return nil
+		}
+	case *ir.FlushStmt:
+		return func(i *Interp) error {
+			return i.out.Flush()
+		}
+	case *ir.PhiExpr:
+		// evaluated on block entry by execPhis
+		return func(i *Interp) error { return nil }
+	default:
+		panic("interp: unrecognized instruction type")
+	}
+}
+
+// compileBinary compiles a binary expression, selecting the big.Int
+// operation by opcode ahead of time. Errors are trapped as in binary.
+func compileBinary(bin *ir.BinaryExpr) instFunc {
+	if inc, ok := compileIncDec(bin); ok {
+		return inc
+	}
+	lhs, rhs := compileValue(bin.Operand(0).Def()), compileValue(bin.Operand(1).Def())
+	op := func(f func(z, x, y *big.Int) *big.Int) instFunc {
+		return func(i *Interp) error {
+			i.vals[bin] = f(new(big.Int), lhs(i), rhs(i))
+			return nil
+		}
+	}
+	switch bin.Op {
+	case ir.Add:
+		return op((*big.Int).Add)
+	case ir.Sub:
+		return op((*big.Int).Sub)
+	case ir.Mul:
+		return op((*big.Int).Mul)
+	case ir.And:
+		return op((*big.Int).And)
+	case ir.Or:
+		return op((*big.Int).Or)
+	case ir.Xor:
+		return op((*big.Int).Xor)
+	case ir.Div, ir.Mod, ir.Shl, ir.LShr, ir.AShr:
+		return func(i *Interp) error {
+			i.vals[bin] = i.binary(bin, lhs(i), rhs(i))
+			return nil
+		}
+	}
+	panic("interp: unrecognized binary op")
+}
+
+// compileIncDec compiles an increment or decrement, as reported by
+// ir.BinaryExpr.IncDec, to add or subtract one without evaluating the
+// constant operand.
+func compileIncDec(bin *ir.BinaryExpr) (instFunc, bool) {
+	x, delta, ok := bin.IncDec()
+	if !ok {
+		return nil, false
+	}
+	val := compileValue(x)
+	if delta > 0 {
+		return func(i *Interp) error {
+			i.vals[bin] = new(big.Int).Add(val(i), one)
+			return nil
+		}, true
+	}
+	return func(i *Interp) error {
+		i.vals[bin] = new(big.Int).Sub(val(i), one)
+		return nil
+	}, true
+}
+
+// compileValue returns a function evaluating an operand. Constants are
+// resolved at compile time, avoiding the lookup in value.
+func compileValue(val ir.Value) valueFunc {
+	if c, ok := val.(*ir.IntConst); ok {
+		n := c.Int()
+		return func(i *Interp) *big.Int { return n }
+	}
+	return func(i *Interp) *big.Int {
+		if n, ok := i.vals[val]; ok {
+			return n
+		}
+		panic(fmt.Sprintf("interp: value not defined at %s", i.position(val.Pos())))
+	}
+}
@@ -0,0 +1,119 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/optimize"
+)
+
+// TestCompiledDispatch checks that cached compiled blocks produce the
+// same output, error, and final state as executing each instruction
+// with execInst.
+func TestCompiledDispatch(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(programsDir, "rosetta/*.ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, filepath.Join(programsDir, "pi.out.ws"),
+		filepath.Join(programsDir, "test_ret_underflow.out.ws"))
+	for _, file := range files {
+		name := filepath.ToSlash(strings.TrimPrefix(file, programsDir+string(filepath.Separator)))
+		test := programTests[name]
+		if test.Skip {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			p := lowerFile(t, file)
+			optimize.RunPasses(p, optimize.Passes, optimize.PassOptions{})
+			in := test.Input
+			if test.InFile != "" {
+				b, err := ioutil.ReadFile(filepath.Join(programsDir, test.InFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+				in = string(b)
+			}
+			run := func(uncached bool) (string, string, string) {
+				var out bytes.Buffer
+				i := NewInterp(p, strings.NewReader(in), &lineLimitWriter{&out, test.MaxLines})
+				i.uncached = uncached
+				err := i.Run()
+				s := i.Save()
+				return out.String(), fmt.Sprint(err), fmt.Sprint(s.Stack, s.Heap)
+			}
+			out, err, state := run(false)
+			wantOut, wantErr, wantState := run(true)
+			if out != wantOut {
+				t.Errorf("output differs\ngot:\n%s\nwant:\n%s", out, wantOut)
+			}
+			if err != wantErr {
+				t.Errorf("got error %s, want %s", err, wantErr)
+			}
+			if state != wantState {
+				t.Errorf("got state %s, want %s", state, wantState)
+			}
+		})
+	}
+}
+
+func TestOffsetStackUnderflow(t *testing.T) {
+	// block_0: offset -2; exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	b.CreateOffsetStackStmt(-2, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uncached := range []bool{false, true} {
+		i := NewInterp(p, strings.NewReader(""), ioutil.Discard)
+		i.uncached = uncached
+		i.stack = []*big.Int{big.NewInt(1)}
+		err := i.Run()
+		if want := "Data stack underflow in block_0 at <unknown>"; fmt.Sprint(err) != want {
+			t.Errorf("uncached=%t: got error %v, want %q", uncached, err, want)
+		}
+	}
+}
+
+func TestCompileIncDec(t *testing.T) {
+	read := ir.NewReadExpr(ir.ReadInt, token.NoPos)
+	one := ir.NewIntConst(big.NewInt(1), token.NoPos)
+	negOne := ir.NewIntConst(big.NewInt(-1), token.NoPos)
+	two := ir.NewIntConst(big.NewInt(2), token.NoPos)
+	for _, test := range []struct {
+		Bin  *ir.BinaryExpr
+		Inc  bool
+		Want int64
+	}{
+		{ir.NewBinaryExpr(ir.Add, read, one, token.NoPos), true, 6},
+		{ir.NewBinaryExpr(ir.Add, one, read, token.NoPos), true, 6},
+		{ir.NewBinaryExpr(ir.Add, read, negOne, token.NoPos), true, 4},
+		{ir.NewBinaryExpr(ir.Sub, read, one, token.NoPos), true, 4},
+		{ir.NewBinaryExpr(ir.Sub, read, negOne, token.NoPos), true, 6},
+		{ir.NewBinaryExpr(ir.Sub, one, read, token.NoPos), false, -4},
+		{ir.NewBinaryExpr(ir.Add, read, two, token.NoPos), false, 7},
+	} {
+		name := ir.NewFormatter().FormatInst(test.Bin)
+		if _, ok := compileIncDec(test.Bin); ok != test.Inc {
+			t.Errorf("%s: got inc/dec %t, want %t", name, ok, test.Inc)
+		}
+		i := NewInterp(&ir.Program{}, strings.NewReader(""), ioutil.Discard)
+		i.vals[read] = big.NewInt(5)
+		if err := compileBinary(test.Bin)(i); err != nil {
+			t.Fatal(err)
+		}
+		if got := i.vals[test.Bin]; got.Int64() != test.Want {
+			t.Errorf("%s: got %v, want %d", name, got, test.Want)
+		}
+	}
+}
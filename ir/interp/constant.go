@@ -0,0 +1,38 @@
+package interp
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// maxConstantSteps bounds the instructions executed by IsConstantOutput,
+// so that programs that do not terminate are rejected.
+const maxConstantSteps = 1 << 22
+
+// IsConstantOutput returns the output of the program, if it takes no
+// input and always produces the same output, so that a build tool can
+// cache it. The program is evaluated by the interpreter. Programs that
+// read input, trap, or do not exit within a bounded number of steps are
+// not constant.
+func IsConstantOutput(p *ir.Program) (string, bool) {
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			if _, ok := inst.(*ir.ReadExpr); ok {
+				return "", false
+			}
+		}
+	}
+	var out bytes.Buffer
+	vm := NewInterp(p, strings.NewReader(""), &out)
+	for steps := 0; !vm.Exited(); steps++ {
+		if steps == maxConstantSteps {
+			return "", false
+		}
+		if err := vm.Step(); err != nil {
+			return "", false
+		}
+	}
+	return out.String(), true
+}
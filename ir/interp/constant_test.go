@@ -0,0 +1,72 @@
+package interp
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestIsConstantOutput(t *testing.T) {
+	// push 3
+	// printi
+	// push '.'
+	// printc
+	// push 1
+	// loop:
+	//     dup
+	//     printi
+	//     push 3
+	//     add
+	//     dup
+	//     push 7
+	//     sub
+	//     jn loop
+	// drop
+	// end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt('.')},
+		{Type: ws.Printc},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Dup},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Add},
+		{Type: ws.Dup},
+		{Type: ws.Push, Arg: big.NewInt(7)},
+		{Type: ws.Sub},
+		{Type: ws.Jn, Arg: big.NewInt(0)},
+		{Type: ws.Drop},
+		{Type: ws.End},
+	}
+	lower := func(tokens []*ws.Token) *ir.Program {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		return p
+	}
+
+	out, ok := IsConstantOutput(lower(tokens))
+	if !ok || out != "3.14" {
+		t.Errorf("got output %q and %t, want \"3.14\" and true", out, ok)
+	}
+
+	// push 0
+	// readi
+	// end
+	read := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.End},
+	}
+	if _, ok := IsConstantOutput(lower(read)); ok {
+		t.Error("program reading input is constant")
+	}
+}
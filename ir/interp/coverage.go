@@ -0,0 +1,118 @@
+package interp
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Profile enables counting how many times each block is entered.
+func (i *Interp) Profile() {
+	if i.counts == nil {
+		i.counts = make(map[*ir.BasicBlock]uint64)
+	}
+}
+
+// BlockCounts returns the number of times each block has been entered
+// since profiling was enabled.
+func (i *Interp) BlockCounts() map[*ir.BasicBlock]uint64 {
+	return i.counts
+}
+
+// CoverageSpan is the span of source covered by a block. Blocks are
+// assigned the source from their first instruction, or first pushed
+// constant, to the start of the next block, so that the spans of all
+// blocks partition the source.
+type CoverageSpan struct {
+	Block      *ir.BasicBlock
+	Start, End int // Byte offsets in source; End is exclusive
+	Count      uint64
+}
+
+// Coverage maps block execution counts to source spans, in source
+// order. Blocks without positions are omitted. The program should be
+// lowered without optimization, so that dead blocks are still present.
+func Coverage(p *ir.Program, counts map[*ir.BasicBlock]uint64) []CoverageSpan {
+	type blockRange struct {
+		block      *ir.BasicBlock
+		start, end token.Pos
+	}
+	var ranges []blockRange
+	for _, block := range p.Blocks {
+		if start, end := block.SourceRange(); start.IsValid() {
+			ranges = append(ranges, blockRange{block, start, end})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	spans := make([]CoverageSpan, len(ranges))
+	for i, r := range ranges {
+		// Constants pushed in the block have no instruction, but precede
+		// their first use.
+		prevEnd := token.NoPos
+		if i > 0 {
+			prevEnd = ranges[i-1].end
+		}
+		start := constStart(r.block, prevEnd, r.start)
+		spans[i] = CoverageSpan{Block: r.block, Start: p.File.Offset(start), Count: counts[r.block]}
+	}
+	for i := range spans {
+		if i+1 < len(spans) {
+			spans[i].End = spans[i+1].Start
+		} else {
+			spans[i].End = p.File.Size()
+		}
+	}
+	return spans
+}
+
+// constStart returns the earliest position of a constant operand in
+// the block that is after prevEnd and before start.
+func constStart(block *ir.BasicBlock, prevEnd, start token.Pos) token.Pos {
+	check := func(inst ir.Inst) {
+		user, ok := inst.(ir.User)
+		if !ok {
+			return
+		}
+		for _, use := range user.Operands() {
+			if c, ok := use.Def().(*ir.IntConst); ok && c.Pos() > prevEnd && c.Pos() < start {
+				start = c.Pos()
+			}
+		}
+	}
+	for _, inst := range block.Nodes {
+		check(inst)
+	}
+	check(block.Terminator)
+	return start
+}
+
+// FormatCoverage formats a coverage report, with a summary of executed
+// blocks and bytes, followed by the span of each block that did not
+// execute.
+func FormatCoverage(file *token.File, spans []CoverageSpan) string {
+	var blocks, bytes, total int
+	var uncovered []CoverageSpan
+	for _, span := range spans {
+		total += span.End - span.Start
+		if span.Count != 0 {
+			blocks++
+			bytes += span.End - span.Start
+		} else {
+			uncovered = append(uncovered, span)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "coverage: %d of %d blocks executed, %d of %d bytes\n", blocks, len(spans), bytes, total)
+	for _, span := range uncovered {
+		start := file.Position(file.Pos(span.Start))
+		end := file.Position(file.Pos(span.End))
+		end.Filename = ""
+		fmt.Fprintf(&b, "uncovered: %s %v-%v (%d bytes)\n", span.Block.Name(), start, end, span.End-span.Start)
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package interp
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCoverage(t *testing.T) {
+	//     push 0
+	//     jz 0
+	//     push 1   ; never executed
+	//     printi   ; never executed
+	// 0:
+	//     end
+	const (
+		push0  = "   \n"
+		jz0    = "\n\t  \n"
+		push1  = "   \t\n"
+		printi = "\t\n \t"
+		label0 = "\n   \n"
+		end    = "\n\n\n"
+	)
+	src := []byte(push0 + jz0 + push1 + printi + label0 + end)
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := ws.LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	vm := NewInterp(p, strings.NewReader(""), &bytes.Buffer{})
+	vm.Profile()
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	spans := Coverage(p, vm.BlockCounts())
+	var uncovered []CoverageSpan
+	for _, span := range spans {
+		if span.Count == 0 {
+			uncovered = append(uncovered, span)
+		}
+	}
+	start := len(push0 + jz0)
+	stop := start + len(push1+printi+label0) // labels have no instruction
+	if len(uncovered) != 1 || uncovered[0].Start != start || uncovered[0].End != stop {
+		t.Fatalf("got uncovered spans %+v, want bytes %d-%d", uncovered, start, stop)
+	}
+	if report := FormatCoverage(file, spans); !strings.Contains(report, "2 of 3 blocks executed, 12 of 26 bytes") ||
+		!strings.Contains(report, "uncovered: block_1 test.ws:4:1-8:1 (14 bytes)") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
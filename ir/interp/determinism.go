@@ -0,0 +1,130 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Errors returned by CheckDeterminism.
+var (
+	ErrReadsInput = errors.New("interp: program reads input")
+	ErrStepLimit  = errors.New("interp: step limit reached before exit")
+)
+
+// DivergenceError reports the first difference between two runs of a
+// program.
+type DivergenceError struct {
+	What string // Part of the result that differs: output, error, stack, or heap
+	A, B string // Values in the first and second run
+}
+
+func (err *DivergenceError) Error() string {
+	return fmt.Sprintf("nondeterministic %s: first run has %s, second run has %s", err.What, err.A, err.B)
+}
+
+// run is the result of a bounded run of a program.
+type run struct {
+	out   string
+	err   error
+	state *State
+}
+
+// CheckDeterminism runs a program that takes no input twice and
+// compares the output, runtime error, and final stack and heap of the
+// runs, returning a DivergenceError for the first difference. Any
+// difference is a bug in the interpreter, IR, or frontend, such as
+// depending on map iteration order. Heap cells read before they are
+// written are zero, so they do not cause divergence. Runs are bounded
+// by the same number of steps as IsConstantOutput. When the runs agree
+// but do not exit normally, the runtime error or ErrStepLimit is
+// returned. The heap is seeded with heap and printc writes with enc, as
+// in Interp. The output of the first run is returned.
+func CheckDeterminism(p *ir.Program, heap []int64, enc ir.OutputEncoding) (string, error) {
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			if _, ok := inst.(*ir.ReadExpr); ok {
+				return "", ErrReadsInput
+			}
+		}
+	}
+	a, b := runBounded(p, heap, enc), runBounded(p, heap, enc)
+	if err := compareRuns(a, b); err != nil {
+		return a.out, err
+	}
+	return a.out, a.err
+}
+
+func runBounded(p *ir.Program, heap []int64, enc ir.OutputEncoding) *run {
+	var out bytes.Buffer
+	vm := NewInterp(p, strings.NewReader(""), &out)
+	vm.SeedHeap(heap)
+	vm.SetOutputEncoding(enc)
+	var err error
+	for steps := 0; !vm.Exited(); steps++ {
+		if steps == maxConstantSteps {
+			err = ErrStepLimit
+			break
+		}
+		if err = vm.Step(); err != nil {
+			break
+		}
+	}
+	return &run{out.String(), err, vm.Save()}
+}
+
+func compareRuns(a, b *run) error {
+	if a.out != b.out {
+		i := 0
+		for i < len(a.out) && i < len(b.out) && a.out[i] == b.out[i] {
+			i++
+		}
+		return &DivergenceError{"output", fmt.Sprintf("%q at byte %d", a.out[i:], i), fmt.Sprintf("%q", b.out[i:])}
+	}
+	if errString(a.err) != errString(b.err) {
+		return &DivergenceError{"error", fmt.Sprintf("%q", errString(a.err)), fmt.Sprintf("%q", errString(b.err))}
+	}
+	return compareStates(a.state, b.state)
+}
+
+// compareStates compares the final stack and heap of two runs.
+func compareStates(a, b *State) error {
+	if len(a.Stack) != len(b.Stack) {
+		return &DivergenceError{"stack", fmt.Sprintf("length %d", len(a.Stack)), fmt.Sprintf("length %d", len(b.Stack))}
+	}
+	for i := range a.Stack {
+		if !equalInts(a.Stack[i], b.Stack[i]) {
+			return &DivergenceError{"stack", fmt.Sprintf("%v at %d", a.Stack[i], i), fmt.Sprint(b.Stack[i])}
+		}
+	}
+	for _, pair := range a.Heap.Pairs() {
+		v, _ := b.Heap.Get(pair.K)
+		if vb, _ := v.(*big.Int); !equalInts(pair.V.(*big.Int), vb) {
+			return &DivergenceError{"heap", fmt.Sprintf("%v at %v", pair.V, pair.K), fmt.Sprint(vb)}
+		}
+	}
+	for _, pair := range b.Heap.Pairs() {
+		if _, ok := a.Heap.Get(pair.K); !ok {
+			return &DivergenceError{"heap", fmt.Sprintf("<nil> at %v", pair.K), fmt.Sprint(pair.V)}
+		}
+	}
+	return nil
+}
+
+func equalInts(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
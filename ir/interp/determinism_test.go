@@ -0,0 +1,107 @@
+package interp
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCheckDeterminism(t *testing.T) {
+	// push 5
+	// retrieve  ; uninitialized cell reads as 0
+	// printi
+	// end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(5)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	out, err := CheckDeterminism(p, nil, ir.Byte)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "0" {
+		t.Errorf("got output %q, want %q", out, "0")
+	}
+
+	// push 0
+	// readi
+	// end
+	tokens = []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.End},
+	}
+	p, errs = (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if _, err := CheckDeterminism(p, nil, ir.Byte); err != ErrReadsInput {
+		t.Errorf("got error %v, want %v", err, ErrReadsInput)
+	}
+}
+
+func TestCheckDeterminismAbnormalExit(t *testing.T) {
+	file := token.NewFileSet().AddFile("test", -1, 0)
+
+	// push 1
+	// printi
+	// drop      ; stack underflow
+	// end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Printi},
+		{Type: ws.Drop},
+		{Type: ws.End},
+	}
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	out, err := CheckDeterminism(p, nil, ir.Byte)
+	if _, ok := err.(*RuntimeError); !ok {
+		t.Errorf("got error %v, want runtime error", err)
+	}
+	if out != "1" {
+		t.Errorf("got output %q, want %q", out, "1")
+	}
+
+	// loop:
+	//     jmp loop
+	tokens = []*ws.Token{
+		{Type: ws.Label, Arg: big.NewInt(0)},
+		{Type: ws.Jmp, Arg: big.NewInt(0)},
+	}
+	p, errs = (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if _, err := CheckDeterminism(p, nil, ir.Byte); err != ErrStepLimit {
+		t.Errorf("got error %v, want %v", err, ErrStepLimit)
+	}
+}
+
+func TestCompareStates(t *testing.T) {
+	a := &State{Stack: []*big.Int{big.NewInt(1)}, Heap: bigint.NewMap()}
+	b := &State{Stack: []*big.Int{big.NewInt(1)}, Heap: bigint.NewMap()}
+	a.Heap.Put(big.NewInt(3), big.NewInt(7))
+	b.Heap.Put(big.NewInt(3), big.NewInt(8))
+	err, ok := compareStates(a, b).(*DivergenceError)
+	if !ok || err.What != "heap" || err.A != "7 at 3" || err.B != "8" {
+		t.Errorf("got %v, want heap divergence at 3", err)
+	}
+	b.Heap.Put(big.NewInt(3), big.NewInt(7))
+	if err := compareStates(a, b); err != nil {
+		t.Errorf("equal states: got %v", err)
+	}
+}
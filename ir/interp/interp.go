@@ -0,0 +1,443 @@
+// Package interp executes Nebula IR directly.
+package interp // import "github.com/andrewarchi/nebula/ir/interp"
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/token"
+	"io"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+var one = big.NewInt(1)
+
+// Interp is an interpreter for Nebula IR programs.
+type Interp struct {
+	program *ir.Program
+	stack   []*big.Int
+	heap    *bigint.Map // map[*big.Int]*big.Int
+	calls   []*ir.BasicBlock
+	vals    map[ir.Value]*big.Int
+	block   *ir.BasicBlock // Currently executing block
+	index   int            // Index of next instruction in block
+	prev    *ir.BasicBlock // Previously executed block
+	recent  [maxRecent]*ir.BasicBlock
+	nRecent int // Number of blocks entered; recent is a ring buffer
+	in      *bufio.Reader
+	out     *bufio.Writer
+	enc     ir.OutputEncoding         // Encoding of printc output
+	trace   io.Writer                 // Execution log, if tracing
+	counts  map[*ir.BasicBlock]uint64 // Block execution counts, if profiling
+
+	code      map[*ir.BasicBlock][]instFunc // Blocks compiled on entry
+	codeBlock *ir.BasicBlock                // Block of blockCode
+	blockCode []instFunc                    // Compiled code of the current block
+	uncached  bool                          // Use execInst rather than cached compiled code
+}
+
+// RuntimeError is an error encountered while executing a program, such
+// as a stack underflow.
+type RuntimeError struct {
+	Err   string
+	Block *ir.BasicBlock
+	Pos   string
+}
+
+func (err *RuntimeError) Error() string {
+	return fmt.Sprintf("%s in %s at %s", err.Err, err.Block.Name(), err.Pos)
+}
+
+// maxRecent is the number of recently executed blocks retained for
+// runtime stack traces.
+const maxRecent = 32
+
+// RetUnderflowError is a runtime error from a ret with an empty call
+// stack. It is the runtime counterpart of ir.RetUnderflowError.
+type RetUnderflowError struct {
+	RuntimeError
+	Trace []*ir.BasicBlock // Recently executed blocks, ending with the ret
+}
+
+func (err *RetUnderflowError) Error() string {
+	var b strings.Builder
+	b.WriteString(err.RuntimeError.Error())
+	b.WriteString("\n  trace: ")
+	for i, block := range err.Trace {
+		if i != 0 {
+			b.WriteString(" -> ")
+		}
+		b.WriteString(block.Name())
+	}
+	return b.String()
+}
+
+// NewInterp constructs an interpreter for a program.
+func NewInterp(p *ir.Program, in io.Reader, out io.Writer) *Interp {
+	return &Interp{
+		program: p,
+		heap:    bigint.NewMap(),
+		vals:    make(map[ir.Value]*big.Int),
+		block:   p.Entry,
+		in:      bufio.NewReader(in),
+		out:     bufio.NewWriter(out),
+	}
+}
+
+// SeedHeap stores the cells of a heap image in the heap, starting at
+// address 0, before the program runs.
+func (i *Interp) SeedHeap(cells []int64) {
+	for addr, val := range cells {
+		i.heap.Put(big.NewInt(int64(addr)), big.NewInt(val))
+	}
+}
+
+// SetOutputEncoding sets the encoding of characters written by printc,
+// which is ir.Byte by default.
+func (i *Interp) SetOutputEncoding(enc ir.OutputEncoding) {
+	i.enc = enc
+}
+
+// Run executes a program until it exits or encounters an error.
+func Run(p *ir.Program, in io.Reader, out io.Writer) error {
+	return NewInterp(p, in, out).Run()
+}
+
+// Run executes the program until it exits or encounters an error.
+func (i *Interp) Run() error {
+	return i.RunContext(context.Background())
+}
+
+// RunContext executes the program until it exits, encounters an error,
+// or the context is cancelled. A cancelled run can be resumed by
+// calling Run again.
+func (i *Interp) RunContext(ctx context.Context) (err error) {
+	defer i.flush(&err)
+	defer i.recoverError(&err)
+	for i.block != nil {
+		if i.index == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if err := i.step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes a single instruction or terminator.
+func (i *Interp) Step() (err error) {
+	defer i.flush(&err)
+	defer i.recoverError(&err)
+	if i.block == nil {
+		return nil
+	}
+	return i.step()
+}
+
+// Exited returns whether the program has exited.
+func (i *Interp) Exited() bool {
+	return i.block == nil
+}
+
+func (i *Interp) step() error {
+	if i.index == 0 {
+		i.recent[i.nRecent%maxRecent] = i.block
+		i.nRecent++
+		if i.counts != nil {
+			i.counts[i.block]++
+		}
+		i.execPhis()
+	}
+	if i.index < len(i.block.Nodes) {
+		inst := i.block.Nodes[i.index]
+		i.index++
+		var err error
+		if i.uncached {
+			err = i.execInst(inst)
+		} else {
+			err = i.compiled(i.block)[i.index-1](i)
+		}
+		if err != nil {
+			return err
+		}
+		if i.trace != nil {
+			i.traceInst(inst)
+		}
+		return nil
+	}
+	next := i.execTerm(i.block.Terminator)
+	if i.trace != nil {
+		i.traceTerm(i.block.Terminator, next)
+	}
+	i.prev, i.block, i.index = i.block, next, 0
+	return nil
+}
+
+func (i *Interp) recoverError(err *error) {
+	if r := recover(); r != nil {
+		switch rerr := r.(type) {
+		case *RuntimeError:
+			*err = rerr
+		case *RetUnderflowError:
+			*err = rerr
+		default:
+			panic(r)
+		}
+	}
+}
+
+func (i *Interp) flush(err *error) {
+	if ferr := i.out.Flush(); *err == nil {
+		*err = ferr
+	}
+}
+
+// execInst executes an instruction by compiling it on each execution,
+// without caching the compiled block.
+func (i *Interp) execInst(inst ir.Inst) error {
+	return compileInst(inst)(i)
+}
+
+// execPhis evaluates the phis at the start of the block. All phis
+// select their values before any are assigned, so a phi may refer to
+// the value of another phi in the same block from the previous
+// iteration.
+func (i *Interp) execPhis() {
+	var phis []*ir.PhiExpr
+	var vals []*big.Int
+	for _, inst := range i.block.Nodes {
+		phi, ok := inst.(*ir.PhiExpr)
+		if !ok {
+			break
+		}
+		phis = append(phis, phi)
+		vals = append(vals, i.phiValue(phi))
+	}
+	for j, phi := range phis {
+		i.vals[phi] = vals[j]
+	}
+}
+
+func (i *Interp) phiValue(phi *ir.PhiExpr) *big.Int {
+	for _, incoming := range phi.Values() {
+		if incoming.Block == i.prev {
+			return i.value(incoming.Value)
+		}
+	}
+	pred := "<entry>"
+	if i.prev != nil {
+		pred = i.prev.Name()
+	}
+	i.trap("Phi has no value for predecessor "+pred, phi)
+	panic("unreachable")
+}
+
+func (i *Interp) execTerm(term ir.TermInst) *ir.BasicBlock {
+	switch term := term.(type) {
+	case *ir.CallTerm:
+		i.calls = append(i.calls, term.Succ(1))
+		return term.Succ(0)
+	case *ir.JmpTerm:
+		return term.Succ(0)
+	case *ir.JmpCondTerm:
+		val := i.value(term.Operand(0).Def())
+		var cond bool
+		switch term.Op {
+		case ir.Jz:
+			cond = val.Sign() == 0
+		case ir.Jnz:
+			cond = val.Sign() != 0
+		case ir.Jn:
+			cond = val.Sign() < 0
+		default:
+			panic("interp: unrecognized conditional jump op")
+		}
+		if cond {
+			return term.Succ(0)
+		}
+		return term.Succ(1)
+	case *ir.RetTerm:
+		if len(i.calls) == 0 {
+			panic(&RetUnderflowError{
+				RuntimeError{"Call stack underflow", i.block, i.position(term.Pos())},
+				i.recentBlocks(),
+			})
+		}
+		next := i.calls[len(i.calls)-1]
+		i.calls = i.calls[:len(i.calls)-1]
+		return next
+	case *ir.ExitTerm:
+		return nil
+	default:
+		panic("interp: unrecognized terminator type")
+	}
+}
+
+func (i *Interp) binary(bin *ir.BinaryExpr, lhs, rhs *big.Int) *big.Int {
+	result := new(big.Int)
+	switch bin.Op {
+	case ir.Add:
+		return result.Add(lhs, rhs)
+	case ir.Sub:
+		return result.Sub(lhs, rhs)
+	case ir.Mul:
+		return result.Mul(lhs, rhs)
+	case ir.Div:
+		if rhs.Sign() == 0 {
+			i.trap("Division by zero", bin)
+		}
+		return bigint.FloorDiv(result, lhs, rhs)
+	case ir.Mod:
+		if rhs.Sign() == 0 {
+			i.trap("Division by zero", bin)
+		}
+		return bigint.FloorMod(result, lhs, rhs)
+	case ir.Shl:
+		return result.Lsh(lhs, i.shift(rhs, bin))
+	case ir.LShr, ir.AShr:
+		return result.Rsh(lhs, i.shift(rhs, bin))
+	case ir.And:
+		return result.And(lhs, rhs)
+	case ir.Or:
+		return result.Or(lhs, rhs)
+	case ir.Xor:
+		return result.Xor(lhs, rhs)
+	}
+	panic("interp: unrecognized binary op")
+}
+
+func (i *Interp) shift(n *big.Int, inst ir.Inst) uint {
+	s, ok := bigint.ToUint(n)
+	if !ok {
+		i.trap("Shift overflow", inst)
+	}
+	return s
+}
+
+// printByte writes a character in the output encoding.
+func (i *Interp) printByte(val *big.Int) error {
+	if i.enc == ir.UTF8 {
+		r := utf8.RuneError
+		if val.IsInt64() && val.Int64() >= 0 && val.Int64() <= utf8.MaxRune {
+			r = rune(val.Int64()) // WriteRune replaces surrogates
+		}
+		_, err := i.out.WriteRune(r)
+		return err
+	}
+	return i.out.WriteByte(byte(val.Int64()))
+}
+
+func (i *Interp) read(inst *ir.ReadExpr) (*big.Int, error) {
+	switch inst.Op {
+	case ir.ReadByte:
+		b, err := i.in.ReadByte()
+		if err == io.EOF {
+			return big.NewInt(-1), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return big.NewInt(int64(b)), nil
+	case ir.ReadInt:
+		return readInt(i.in)
+	}
+	panic("interp: unrecognized read op")
+}
+
+// readInt reads an integer with the grammar documented for ir.ReadInt.
+func readInt(r *bufio.Reader) (*big.Int, error) {
+	b, err := r.ReadByte()
+	for err == nil && b != '\n' && isSpace(b) {
+		b, err = r.ReadByte()
+	}
+	if err == io.EOF {
+		return big.NewInt(-1), nil
+	}
+	var digits strings.Builder
+	if err == nil && (b == '+' || b == '-') {
+		digits.WriteByte(b)
+		b, err = r.ReadByte()
+	}
+	for err == nil && '0' <= b && b <= '9' {
+		digits.WriteByte(b)
+		b, err = r.ReadByte()
+	}
+	for err == nil && b != '\n' {
+		b, err = r.ReadByte()
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	n := new(big.Int)
+	if s := digits.String(); s != "" && s != "+" && s != "-" {
+		n.SetString(s, 10)
+	}
+	return n, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func (i *Interp) value(val ir.Value) *big.Int {
+	if c, ok := val.(*ir.IntConst); ok {
+		return c.Int()
+	}
+	if n, ok := i.vals[val]; ok {
+		return n
+	}
+	panic(fmt.Sprintf("interp: value not defined at %s", i.position(val.Pos())))
+}
+
+func (i *Interp) stackIndex(pos uint, inst ir.Inst) int {
+	n := len(i.stack) - int(pos)
+	if n < 0 {
+		i.trap("Data stack underflow", inst)
+	}
+	return n
+}
+
+// load reads a heap cell. Cells that have not been stored read as 0,
+// matching the zero-initialized heap in LLVM codegen.
+func (i *Interp) load(addr *big.Int) *big.Int {
+	if val, ok := i.heap.Get(addr); ok {
+		return val.(*big.Int)
+	}
+	return new(big.Int)
+}
+
+func (i *Interp) store(addr, val *big.Int) {
+	i.heap.Put(new(big.Int).Set(addr), val)
+}
+
+// recentBlocks returns the most recently entered blocks, oldest first.
+func (i *Interp) recentBlocks() []*ir.BasicBlock {
+	n := i.nRecent
+	if n > maxRecent {
+		n = maxRecent
+	}
+	blocks := make([]*ir.BasicBlock, n)
+	for k := range blocks {
+		blocks[k] = i.recent[(i.nRecent-n+k)%maxRecent]
+	}
+	return blocks
+}
+
+func (i *Interp) trap(err string, inst ir.Inst) {
+	panic(&RuntimeError{err, i.block, i.position(inst.Pos())})
+}
+
+func (i *Interp) position(pos token.Pos) string {
+	if pos == token.NoPos || i.program.File == nil {
+		return "<unknown>"
+	}
+	return i.program.File.Position(pos).String()
+}
@@ -0,0 +1,393 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/internal/heapimage"
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestReadInt(t *testing.T) {
+	tests := []struct {
+		In   string
+		Want []int64
+	}{
+		{"  -42xyz\n", []int64{-42, -1}},
+		{"abc\n", []int64{0, -1}},
+		{"", []int64{-1}},
+		{"+7\n\n 8", []int64{7, 0, 8, -1}},
+		{" \t\n5\n", []int64{0, 5, -1}},
+		{"-\n12 34\n", []int64{0, 12, -1}},
+	}
+	for i, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.In))
+		for j, want := range test.Want {
+			n, err := readInt(r)
+			if err != nil {
+				t.Errorf("test %d: read %d: unexpected error: %v", i, j, err)
+				break
+			}
+			if n.Int64() != want || !n.IsInt64() {
+				t.Errorf("test %d: read %d: got %s, want %d", i, j, n, want)
+			}
+		}
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	//     push 0
+	//     push 0
+	//     store
+	// loop:
+	//     push 0
+	//     retrieve
+	//     printi
+	//     push 0
+	//     push 0
+	//     retrieve
+	//     push 1
+	//     add
+	//     store
+	//     push 0
+	//     retrieve
+	//     push 5
+	//     sub
+	//     jn loop
+	//     end
+	loop := big.NewInt(1)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Store},
+		{Type: ws.Label, Arg: loop},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Store},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(5)},
+		{Type: ws.Sub},
+		{Type: ws.Jn, Arg: loop},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	var before, after bytes.Buffer
+	vm := NewInterp(p, strings.NewReader(""), &before)
+	for n := 0; n < 12; n++ {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := vm.Save()
+	prefix := before.String()
+	if prefix == "" || vm.Exited() {
+		t.Fatalf("state not saved mid-run: output %q", prefix)
+	}
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := before.String(), "01234"; got != want {
+		t.Fatalf("got output %q, want %q", got, want)
+	}
+
+	vm = NewInterp(p, strings.NewReader(""), &after)
+	vm.Restore(state)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prefix+after.String(), before.String(); got != want {
+		t.Errorf("got output %q after restore, want %q", got, want)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	//     push 7
+	//     push 1
+	//     push 2
+	//     add
+	//     printi
+	//     push 0
+	//     jz done
+	// done:
+	//     end
+	done := big.NewInt(1)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(7)},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Add},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Jz, Arg: done},
+		{Type: ws.Label, Arg: done, ArgString: "done"},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	var out, trace bytes.Buffer
+	vm := NewInterp(p, strings.NewReader(""), &out)
+	vm.Trace(&trace)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	for _, want := range []string{
+		"block_0: add 1 2 -> 3 | top: -",
+		"block_0: printint 3 | top: -",
+		"block_0: storestack 1 7 | top: 7",
+		"block_0: jz 0 -> done | top: 7",
+		"done: exit | top: 7",
+	} {
+		found := false
+		for _, line := range lines {
+			if line == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("trace missing line %q:\n%s", want, trace.String())
+		}
+	}
+}
+
+func TestSeedHeap(t *testing.T) {
+	//     push 2
+	//     retrieve
+	//     printi
+	//     end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	image, err := heapimage.Read(bytes.NewReader([]byte{
+		1, 0, 0, 0, 0, 0, 0, 0,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		0xd6, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	vm := NewInterp(p, strings.NewReader(""), &out)
+	vm.SeedHeap(image)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "-42" {
+		t.Errorf("got output %q, want \"-42\"", out.String())
+	}
+}
+
+func TestRetUnderflowTrace(t *testing.T) {
+	// block_0: call block_2 block_1
+	// block_1: ret
+	// block_2: ret
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.CreateCallTerm(b.Block(2), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateRetTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateRetTerm(token.NoPos)
+	p, err := b.Program()
+	if _, ok := err.(*ir.RetUnderflowError); err != nil && !ok {
+		t.Fatal(err)
+	}
+
+	err = Run(p, strings.NewReader(""), ioutil.Discard)
+	rerr, ok := err.(*RetUnderflowError)
+	if !ok {
+		t.Fatalf("got error %v, want RetUnderflowError", err)
+	}
+	want := []*ir.BasicBlock{p.Blocks[0], p.Blocks[2], p.Blocks[1]}
+	if !reflect.DeepEqual(rerr.Trace, want) || rerr.Block != p.Blocks[1] {
+		t.Errorf("got trace %v in %s, want %v", rerr.Trace, rerr.Block.Name(), want)
+	}
+	if got, want := rerr.Error(), "Call stack underflow in block_1 at <unknown>\n  trace: block_0 -> block_2 -> block_1"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+func TestCopySlideZero(t *testing.T) {
+	tests := []struct {
+		Tokens []*ws.Token
+		Out    string
+		Err    string
+	}{
+		// push 5; copy 0; add; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Copy, Arg: big.NewInt(0)},
+			{Type: ws.Add},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, "10", ""},
+		// push 1; push 7; slide 0; printi; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Push, Arg: big.NewInt(7)},
+			{Type: ws.Slide, Arg: big.NewInt(0)},
+			{Type: ws.Printi},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, "71", ""},
+		// slide 0; end
+		{[]*ws.Token{
+			{Type: ws.Slide, Arg: big.NewInt(0)},
+			{Type: ws.End},
+		}, "", "Data stack underflow"},
+	}
+	for i, test := range tests {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{Tokens: test.Tokens, File: file}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatalf("test %d: %v", i, errs)
+		}
+		var out bytes.Buffer
+		err := Run(p, strings.NewReader(""), &out)
+		if test.Err == "" && err != nil || test.Err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.Err)) {
+			t.Errorf("test %d: got error %v, want %q", i, err, test.Err)
+		}
+		if out.String() != test.Out {
+			t.Errorf("test %d: got output %q, want %q", i, out.String(), test.Out)
+		}
+	}
+}
+
+func TestOutputEncoding(t *testing.T) {
+	// push 200; printc; push -1; printc; end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(200)},
+		{Type: ws.Printc},
+		{Type: ws.Push, Arg: big.NewInt(-1)},
+		{Type: ws.Printc},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, test := range []struct {
+		Enc ir.OutputEncoding
+		Out string
+	}{
+		{ir.Byte, "\xc8\xff"},
+		{ir.UTF8, "\u00c8\ufffd"},
+	} {
+		var out bytes.Buffer
+		vm := NewInterp(p, strings.NewReader(""), &out)
+		vm.SetOutputEncoding(test.Enc)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s: %v", test.Enc, err)
+		}
+		if out.String() != test.Out {
+			t.Errorf("%s: got output %q, want %q", test.Enc, out.String(), test.Out)
+		}
+	}
+}
+
+func TestFloorDivMod(t *testing.T) {
+	// push 0; readi; push 1; readi
+	// push 0; retrieve; push 1; retrieve; div; printi
+	// push ' '; printc
+	// push 0; retrieve; push 1; retrieve; mod; printi
+	// end
+	operands := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Retrieve},
+	}
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Readi},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Readi},
+	}
+	tokens = append(tokens, operands...)
+	tokens = append(tokens, &ws.Token{Type: ws.Div}, &ws.Token{Type: ws.Printi},
+		&ws.Token{Type: ws.Push, Arg: big.NewInt(' ')}, &ws.Token{Type: ws.Printc})
+	tokens = append(tokens, operands...)
+	tokens = append(tokens, &ws.Token{Type: ws.Mod}, &ws.Token{Type: ws.Printi}, &ws.Token{Type: ws.End})
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// Division rounds toward negative infinity, so the modulus has the
+	// sign of the divisor.
+	for _, test := range []struct{ In, Out string }{
+		{"7\n2\n", "3 1"},
+		{"-7\n2\n", "-4 1"},
+		{"7\n-2\n", "-4 -1"},
+		{"-7\n-2\n", "3 -1"},
+	} {
+		var out bytes.Buffer
+		if err := Run(p, strings.NewReader(test.In), &out); err != nil {
+			t.Errorf("input %q: %v", test.In, err)
+		}
+		if out.String() != test.Out {
+			t.Errorf("input %q: got output %q, want %q", test.In, out.String(), test.Out)
+		}
+	}
+}
+
+func TestStackUnderflowError(t *testing.T) {
+	// push 1; printi; drop; end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Printi},
+		{Type: ws.Drop},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	// The error names the block and position, as check_stack does in the
+	// compiled runtime, and the output before the trap is flushed.
+	var out bytes.Buffer
+	err := Run(p, strings.NewReader(""), &out)
+	if _, ok := err.(*RuntimeError); !ok {
+		t.Fatalf("got error %v, want runtime error", err)
+	}
+	if want := "Data stack underflow in block_0 at <unknown>"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err.Error(), want)
+	}
+	if out.String() != "1" {
+		t.Errorf("got output %q, want %q", out.String(), "1")
+	}
+}
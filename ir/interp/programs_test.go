@@ -0,0 +1,203 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/optimize"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+const programsDir = "../../programs"
+
+type programTest struct {
+	Input    string // Input given to the program
+	InFile   string // File given as input, relative to programs
+	MaxLines int    // Lines of output before stopping non-terminating programs
+	Err      string // Expected runtime error
+	Skip     bool   // Requires interactive input
+}
+
+// programTests mirrors the cases in test.sh. Programs in programs
+// without an entry are run with empty input.
+var programTests = map[string]programTest{
+	"caesar.out.ws":             {Skip: true},
+	"collatz.out.ws":            {Input: "10\n"},
+	"factorial.out.ws":          {Input: "10\n"},
+	"fib.out.ws":                {Input: "10\n"},
+	"interpret.out.ws":          {Skip: true}, // see TestInterpretHelloWorld
+	"math.out.ws":               {Skip: true},
+	"pi.out.ws":                 {Input: "5\n"},
+	"postfix.out.ws":            {Skip: true},
+	"test_ret_underflow.out.ws": {Input: "1\n", Err: "Call stack underflow"},
+	"rosetta/add.ws":            {Input: "42\n314\n"},
+	"rosetta/binary.ws":         {MaxLines: 100},
+	"rosetta/fib.ws":            {MaxLines: 6},
+	"rosetta/fibrec.ws":         {Input: "10\n"},
+	"rosetta/freq.ws":           {InFile: "rosetta/freq.ws"},
+	"rosetta/octal.ws":          {MaxLines: 100},
+	"rosetta/shell_sort.ws":     {InFile: "rosetta/shell_sort.in"},
+}
+
+var errOutputLimit = errors.New("output limit reached")
+
+func TestPrograms(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"*.ws", "rosetta/*.ws"} {
+		matches, err := filepath.Glob(filepath.Join(programsDir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no programs found in %s", programsDir)
+	}
+	for _, file := range files {
+		name := filepath.ToSlash(strings.TrimPrefix(file, programsDir+string(filepath.Separator)))
+		test := programTests[name]
+		t.Run(name, func(t *testing.T) {
+			if test.Skip {
+				t.Skip("requires interactive input or scripted input")
+			}
+			testProgram(t, name, test)
+		})
+	}
+}
+
+// TestInterpretHelloWorld scripts interpret.out.ws with hello_world.ws
+// followed by the NUL that ends the program text. The interpreter reads
+// the whole program, but the call to .debug_dump_program left in it
+// drops the IP pushed by its caller, so the data stack underflows at
+// the drop in .select_inst before the first instruction is run.
+func TestInterpretHelloWorld(t *testing.T) {
+	hello, err := ioutil.ReadFile(filepath.Join(programsDir, "hello_world.ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := lowerFile(t, filepath.Join(programsDir, "interpret.out.ws"))
+	optimize.RunPasses(p, optimize.Passes, optimize.PassOptions{})
+	var out bytes.Buffer
+	err = Run(p, strings.NewReader(string(hello)+"\x00"), &out)
+	// programs/interpret.out.ws:732:1 is the drop in .select_inst.
+	if _, ok := err.(*RuntimeError); !ok || !strings.HasPrefix(err.Error(), "Data stack underflow") ||
+		!strings.HasSuffix(err.Error(), "interpret.out.ws:732:1") {
+		t.Fatalf("got error %v, want data stack underflow at interpret.out.ws:732:1", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("got output %q, want none", out.String())
+	}
+}
+
+func testProgram(t *testing.T, name string, test programTest) {
+	t.Helper()
+	p := lowerFile(t, filepath.Join(programsDir, name))
+	optimize.RunPasses(p, optimize.Passes, optimize.PassOptions{})
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("verify: %v", errs)
+	}
+
+	in := test.Input
+	if test.InFile != "" {
+		b, err := ioutil.ReadFile(filepath.Join(programsDir, test.InFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = string(b)
+	}
+	var out bytes.Buffer
+	err := Run(p, strings.NewReader(in), &lineLimitWriter{&out, test.MaxLines})
+	switch {
+	case test.Err != "":
+		_, isRuntime := err.(*RuntimeError)
+		_, isRet := err.(*RetUnderflowError)
+		if !isRuntime && !isRet || !strings.HasPrefix(err.Error(), test.Err) {
+			t.Fatalf("got error %v, want %s", err, test.Err)
+		}
+	case err == errOutputLimit && test.MaxLines != 0:
+	case err != nil:
+		t.Fatalf("run: %v", err)
+	}
+
+	recorded, err := ioutil.ReadFile(filepath.Join(programsDir, strings.TrimSuffix(name, ".ws")+".out"))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := trimLines(out.String()), recordedOutput(recorded); got != want {
+		t.Errorf("output differs\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func lowerFile(t testing.TB, filename string) *ir.Program {
+	t.Helper()
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := token.NewFileSet().AddFile(filename, -1, len(src))
+	tokens, err := ws.LexTokens(file, src)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	for _, err := range errs {
+		if _, ok := err.(*ir.RetUnderflowError); !ok {
+			t.Fatalf("lower: %v", err)
+		}
+	}
+	return p
+}
+
+// recordedOutput strips the shell command line that some recorded
+// outputs begin with.
+func recordedOutput(out []byte) string {
+	s := string(out)
+	if strings.HasPrefix(s, "$ ") {
+		if i := strings.IndexByte(s, '\n'); i != -1 {
+			s = s[i+1:]
+		}
+	}
+	return s
+}
+
+// trimLines removes trailing spaces from each line, which recorded
+// outputs omit.
+func trimLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lineLimitWriter fails once max lines have been written, so that
+// non-terminating programs can be stopped. A max of 0 is unlimited.
+type lineLimitWriter struct {
+	w   *bytes.Buffer
+	max int
+}
+
+func (w *lineLimitWriter) Write(b []byte) (int, error) {
+	if w.max == 0 {
+		return w.w.Write(b)
+	}
+	for i, c := range b {
+		if c == '\n' {
+			w.max--
+			if w.max == 0 {
+				n, _ := w.w.Write(b[:i+1])
+				return n, errOutputLimit
+			}
+		}
+	}
+	return w.w.Write(b)
+}
@@ -0,0 +1,72 @@
+package interp
+
+import (
+	"math/big"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// State is a snapshot of the interpreter state, from which execution
+// can be resumed. Input and output are not part of the state.
+type State struct {
+	Block  *ir.BasicBlock        // Currently executing block, or nil when exited
+	Index  int                   // Index of next instruction in block
+	Prev   *ir.BasicBlock        // Previously executed block
+	Stack  []*big.Int            // Data stack, from bottom to top
+	Heap   *bigint.Map           // map[*big.Int]*big.Int
+	Calls  []*ir.BasicBlock      // Call stack of return blocks
+	Values map[ir.Value]*big.Int // Values computed by instructions
+}
+
+// Save captures the interpreter state. The stack, heap, and values are
+// deep-copied, so continuing execution does not change the state.
+func (i *Interp) Save() *State {
+	return &State{
+		Block:  i.block,
+		Index:  i.index,
+		Prev:   i.prev,
+		Stack:  copyInts(i.stack),
+		Heap:   copyHeap(i.heap),
+		Calls:  append([]*ir.BasicBlock{}, i.calls...),
+		Values: copyValues(i.vals),
+	}
+}
+
+// Restore resumes the interpreter from a saved state. The state is
+// copied, so it can be restored again later.
+func (i *Interp) Restore(s *State) {
+	i.block = s.Block
+	i.index = s.Index
+	i.prev = s.Prev
+	i.stack = copyInts(s.Stack)
+	i.heap = copyHeap(s.Heap)
+	i.calls = append([]*ir.BasicBlock{}, s.Calls...)
+	i.vals = copyValues(s.Values)
+}
+
+func copyInts(ints []*big.Int) []*big.Int {
+	c := make([]*big.Int, len(ints))
+	for i, n := range ints {
+		if n != nil {
+			c[i] = new(big.Int).Set(n)
+		}
+	}
+	return c
+}
+
+func copyHeap(heap *bigint.Map) *bigint.Map {
+	c := bigint.NewMap()
+	for _, pair := range heap.Pairs() {
+		c.Put(new(big.Int).Set(pair.K), new(big.Int).Set(pair.V.(*big.Int)))
+	}
+	return c
+}
+
+func copyValues(vals map[ir.Value]*big.Int) map[ir.Value]*big.Int {
+	c := make(map[ir.Value]*big.Int, len(vals))
+	for val, n := range vals {
+		c[val] = new(big.Int).Set(n)
+	}
+	return c
+}
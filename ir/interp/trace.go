@@ -0,0 +1,73 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Trace enables logging each executed instruction to w, one per line,
+// in the form
+//
+//	block_0: add 1 2 -> 3 | top: 7
+//	block_0: jz 0 -> block_2 | top: 7
+//
+// Operands are resolved to their values, the result or branch target
+// follows the arrow, and the top of the stack is given after
+// execution. Pass nil to stop tracing.
+func (i *Interp) Trace(w io.Writer) {
+	i.trace = w
+}
+
+func (i *Interp) traceInst(inst ir.Inst) {
+	var b strings.Builder
+	i.traceOp(&b, inst)
+	if val, ok := inst.(ir.Value); ok {
+		fmt.Fprintf(&b, " -> %v", i.vals[val])
+	}
+	i.traceLine(&b)
+}
+
+func (i *Interp) traceTerm(term ir.TermInst, next *ir.BasicBlock) {
+	var b strings.Builder
+	i.traceOp(&b, term)
+	if next != nil {
+		fmt.Fprintf(&b, " -> %s", next.Name())
+	}
+	i.traceLine(&b)
+}
+
+func (i *Interp) traceOp(b *strings.Builder, inst ir.Inst) {
+	fmt.Fprintf(b, "%s: %s", i.block.Name(), inst.OpString())
+	switch inst := inst.(type) {
+	case *ir.LoadStackExpr:
+		fmt.Fprintf(b, " %d", inst.StackPos)
+	case *ir.StoreStackStmt:
+		fmt.Fprintf(b, " %d", inst.StackPos)
+	case *ir.AccessStackStmt:
+		fmt.Fprintf(b, " %d", inst.StackSize)
+	case *ir.OffsetStackStmt:
+		fmt.Fprintf(b, " %d", inst.Offset)
+	}
+	if _, ok := inst.(*ir.PhiExpr); ok {
+		return
+	}
+	if user, ok := inst.(ir.User); ok {
+		for _, op := range user.Operands() {
+			fmt.Fprintf(b, " %v", i.value(op.Def()))
+		}
+	}
+}
+
+func (i *Interp) traceLine(b *strings.Builder) {
+	b.WriteString(" | top: ")
+	if len(i.stack) == 0 || i.stack[len(i.stack)-1] == nil {
+		b.WriteByte('-')
+	} else {
+		b.WriteString(i.stack[len(i.stack)-1].String())
+	}
+	b.WriteByte('\n')
+	io.WriteString(i.trace, b.String())
+}
@@ -0,0 +1,63 @@
+package ir
+
+import (
+	"fmt"
+	"go/token"
+)
+
+// NamePolicy assigns LabelName to blocks when a program is built.
+// Blocks left without a LabelName are named by their first label or,
+// failing that, by ID.
+type NamePolicy func(blocks []*BasicBlock, file *token.File)
+
+// LabelIndexNames names each labeled block after its first named label
+// and each following unlabeled block after that label with an
+// incrementing suffix, e.g. foo, foo1, foo2. This is the default.
+func LabelIndexNames(blocks []*BasicBlock, file *token.File) {
+	prevLabel := ""
+	labelIndex := 0
+	for _, block := range blocks {
+		if len(block.Labels) != 0 {
+			prevLabel = ""
+			labelIndex = 0
+			for _, label := range block.Labels {
+				if label.Name != "" && block.LabelName == "" {
+					block.LabelName = label.Name
+					prevLabel = label.Name
+					labelIndex = 1
+				}
+			}
+		}
+		if block.LabelName == "" && prevLabel != "" {
+			block.LabelName = fmt.Sprintf("%s%d", prevLabel, labelIndex)
+			labelIndex++
+		}
+	}
+}
+
+// LabelNames names only labeled blocks, so unlabeled blocks are
+// numbered by ID.
+func LabelNames(blocks []*BasicBlock, file *token.File) {
+	for _, block := range blocks {
+		for _, label := range block.Labels {
+			if label.Name != "" && block.LabelName == "" {
+				block.LabelName = label.Name
+			}
+		}
+	}
+}
+
+// PositionNames names blocks by the source position of their earliest
+// instruction, e.g. pos_3_1 for line 3, column 1. Blocks without
+// positions are numbered by ID.
+func PositionNames(blocks []*BasicBlock, file *token.File) {
+	if file == nil {
+		return
+	}
+	for _, block := range blocks {
+		if pos, _ := block.SourceRange(); pos.IsValid() {
+			position := file.Position(pos)
+			block.LabelName = fmt.Sprintf("pos_%d_%d", position.Line, position.Column)
+		}
+	}
+}
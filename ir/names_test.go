@@ -0,0 +1,53 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestNamePolicies(t *testing.T) {
+	// line 1: push 1
+	// line 2: label foo
+	// line 3: printi
+	// line 4: jz foo
+	// line 5: end
+	src := "push 1\nfoo:\nprinti\njz foo\nend\n"
+	for _, test := range []struct {
+		Policy NamePolicy
+		Names  []string
+	}{
+		{nil, []string{"block_0", "foo", "foo1"}},
+		{LabelIndexNames, []string{"block_0", "foo", "foo1"}},
+		{LabelNames, []string{"block_0", "foo", "block_2"}},
+		{PositionNames, []string{"pos_1_1", "pos_3_1", "pos_5_1"}},
+	} {
+		file := token.NewFileSet().AddFile("test", -1, len(src))
+		file.SetLinesForContent([]byte(src))
+		line := func(n int) token.Pos { return file.LineStart(n) }
+
+		b := NewBuilder(file)
+		b.SetNamePolicy(test.Policy)
+		b.InitBlocks(3)
+		b.CreateJmpTerm(Fallthrough, b.Block(1), line(1))
+		b.Block(1).Labels = []Label{{ID: big.NewInt(1), Name: "foo"}}
+		b.SetCurrentBlock(b.Block(1))
+		one := NewIntConst(big.NewInt(1), line(1))
+		b.CreatePrintStmt(PrintInt, one, line(3))
+		read := b.CreateReadExpr(ReadInt, line(4))
+		b.CreateJmpCondTerm(Jz, read, b.Block(1), b.Block(2), line(4))
+		b.SetCurrentBlock(b.Block(2))
+		b.CreateExitTerm(line(5))
+		p, err := b.Program()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, block := range p.Blocks {
+			names = append(names, block.Name())
+		}
+		if !equalStrings(names, test.Names) {
+			t.Errorf("got names %q, want %q", names, test.Names)
+		}
+	}
+}
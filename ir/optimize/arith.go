@@ -13,12 +13,24 @@ import (
 // FoldConstArith folds and propagates constant arithmetic expressions
 // or identities.
 func FoldConstArith(p *ir.Program) {
+	foldConstArith(p, false)
+}
+
+// FoldConstArithTrapping folds like FoldConstArith, but keeps add, sub,
+// mul, and neg of constants whose result overflows 64 bits and does not
+// reduce multiplication to shifts, so that overflow traps at runtime
+// with codegen.Trap.
+func FoldConstArithTrapping(p *ir.Program) {
+	foldConstArith(p, true)
+}
+
+func foldConstArith(p *ir.Program, trap bool) {
 	for _, block := range p.Blocks {
 		i := 0
 		for _, node := range block.Nodes {
 			switch inst := node.(type) {
 			case *ir.BinaryExpr:
-				val, isNeg := foldBinaryExpr(p, inst)
+				val, isNeg := foldBinaryExpr(p, inst, trap)
 				if isNeg {
 					neg := ir.NewUnaryExpr(ir.Neg, val, inst.Pos())
 					inst.ClearOperands()
@@ -33,7 +45,11 @@ func FoldConstArith(p *ir.Program) {
 				if inst.Op == ir.Neg {
 					val := inst.Operand(0).Def()
 					if lhs, ok := val.(*ir.IntConst); ok {
-						constNeg := ir.NewIntConst(new(big.Int).Neg(lhs.Int()), inst.Pos())
+						neg := new(big.Int).Neg(lhs.Int())
+						if trap && !neg.IsInt64() {
+							break
+						}
+						constNeg := ir.NewIntConst(neg, inst.Pos())
 						inst.ClearOperands()
 						inst.ReplaceUsesWith(constNeg)
 						continue
@@ -47,22 +63,22 @@ func FoldConstArith(p *ir.Program) {
 	}
 }
 
-func foldBinaryExpr(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
+func foldBinaryExpr(p *ir.Program, bin *ir.BinaryExpr, trap bool) (ir.Value, bool) {
 	_, lhsConst := bin.Operand(0).Def().(*ir.IntConst)
 	_, rhsConst := bin.Operand(1).Def().(*ir.IntConst)
 	switch {
 	case lhsConst && rhsConst:
-		return foldBinaryLR(p, bin)
+		return foldBinaryLR(p, bin, trap)
 	case lhsConst:
 		return foldBinaryL(p, bin)
 	case rhsConst:
-		return foldBinaryR(p, bin)
+		return foldBinaryR(p, bin, trap)
 	default:
 		return foldBinary(p, bin)
 	}
 }
 
-func foldBinaryLR(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
+func foldBinaryLR(p *ir.Program, bin *ir.BinaryExpr, trap bool) (ir.Value, bool) {
 	lhs := bin.Operand(0).Def().(*ir.IntConst)
 	rhs := bin.Operand(1).Def().(*ir.IntConst)
 	result := new(big.Int)
@@ -74,9 +90,9 @@ func foldBinaryLR(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
 	case ir.Mul:
 		result.Mul(lhs.Int(), rhs.Int())
 	case ir.Div:
-		result.Div(lhs.Int(), rhs.Int())
+		bigint.FloorDiv(result, lhs.Int(), rhs.Int())
 	case ir.Mod:
-		result.Mod(lhs.Int(), rhs.Int())
+		bigint.FloorMod(result, lhs.Int(), rhs.Int())
 	case ir.Shl:
 		s, ok := bigint.ToUint(rhs.Int())
 		if !ok {
@@ -100,6 +116,9 @@ func foldBinaryLR(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
 	default:
 		return nil, false
 	}
+	if trap && trapsOnOverflow(bin) && !result.IsInt64() {
+		return nil, false
+	}
 	return ir.NewIntConst(result, bin.Pos()), false
 }
 
@@ -137,7 +156,7 @@ func foldBinaryL(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
 	return nil, false
 }
 
-func foldBinaryR(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
+func foldBinaryR(p *ir.Program, bin *ir.BinaryExpr, trap bool) (ir.Value, bool) {
 	lhs := bin.Operand(0).Def()
 	rhs := bin.Operand(1).Def().(*ir.IntConst)
 	switch rhs.Int().Sign() {
@@ -162,6 +181,9 @@ func foldBinaryR(p *ir.Program, bin *ir.BinaryExpr) (ir.Value, bool) {
 			var r *big.Int
 			switch bin.Op {
 			case ir.Mul:
+				if trap {
+					return nil, false
+				}
 				bin.Op = ir.Shl
 				r = new(big.Int).SetUint64(uint64(ntz))
 			case ir.Div:
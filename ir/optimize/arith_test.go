@@ -1,12 +1,15 @@
 package optimize
 
 import (
+	"bytes"
 	"go/token"
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/interp"
 	"github.com/andrewarchi/nebula/ws"
 )
 
@@ -195,3 +198,84 @@ func TestFoldConstArith(t *testing.T) {
 		t.Errorf("constant arithmetic folding not equal\ngot:\n%v\nwant:\n%v", program, programConst)
 	}
 }
+
+func TestFoldConstDivMod(t *testing.T) {
+	for _, test := range []struct {
+		X, Y, Div, Mod int64
+	}{
+		{-7, 2, -4, 1},
+		{7, -2, -4, -1},
+		{-7, -2, 3, -1},
+		{-7, 4, -2, 1}, // Strength reduced to ashr and and
+	} {
+		for _, op := range []ir.BinaryOp{ir.Div, ir.Mod} {
+			b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+			b.InitBlocks(1)
+			x := ir.NewIntConst(big.NewInt(test.X), token.NoPos)
+			y := ir.NewIntConst(big.NewInt(test.Y), token.NoPos)
+			bin := b.CreateBinaryExpr(op, x, y, token.NoPos)
+			print := b.CreatePrintStmt(ir.PrintInt, bin, token.NoPos)
+			b.CreateExitTerm(token.NoPos)
+			p, err := b.Program()
+			if err != nil {
+				t.Fatal(err)
+			}
+			FoldConstArith(p)
+			want := test.Div
+			if op == ir.Mod {
+				want = test.Mod
+			}
+			c, ok := print.Operand(0).Def().(*ir.IntConst)
+			if !ok || c.Int().Int64() != want {
+				t.Errorf("%d %v %d: got %v, want %d", test.X, op, test.Y, print.Operand(0).Def(), want)
+			}
+		}
+	}
+}
+
+func TestFoldConstModOperand(t *testing.T) {
+	// readi x; printi x mod 3; printi 7 mod x; printi x mod 4; end
+	// The constant operand is bound on the correct side when folding
+	// specializes mod, so the folded program prints the same as the
+	// unfolded one.
+	x := func() []*ws.Token {
+		return []*ws.Token{{Type: ws.Push, Arg: big.NewInt(0)}, {Type: ws.Retrieve}}
+	}
+	push := func(n int64) []*ws.Token {
+		return []*ws.Token{{Type: ws.Push, Arg: big.NewInt(n)}}
+	}
+	mod := []*ws.Token{{Type: ws.Mod}, {Type: ws.Printi}, {Type: ws.Push, Arg: big.NewInt(' ')}, {Type: ws.Printc}}
+	tokens := []*ws.Token{{Type: ws.Push, Arg: big.NewInt(0)}, {Type: ws.Readi}}
+	for _, operands := range [][2][]*ws.Token{{x(), push(3)}, {push(7), x()}, {x(), push(4)}} {
+		tokens = append(tokens, operands[0]...)
+		tokens = append(tokens, operands[1]...)
+		tokens = append(tokens, mod...)
+	}
+	tokens = append(tokens, &ws.Token{Type: ws.End})
+
+	for _, test := range []struct{ In, Out string }{
+		{"5\n", "2 2 1 "},
+		{"-5\n", "1 -3 3 "},
+		{"2\n", "2 1 2 "},
+	} {
+		var outs [2]string
+		for i, fold := range []bool{false, true} {
+			file := token.NewFileSet().AddFile("test", -1, 0)
+			p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+			if fold {
+				FoldConstArith(p)
+			}
+			var out bytes.Buffer
+			if err := interp.Run(p, strings.NewReader(test.In), &out); err != nil {
+				t.Fatalf("input %q: %v", test.In, err)
+			}
+			outs[i] = out.String()
+		}
+		if outs[0] != test.Out || outs[1] != test.Out {
+			t.Errorf("input %q: got %q unfolded and %q folded, want %q", test.In, outs[0], outs[1], test.Out)
+		}
+	}
+}
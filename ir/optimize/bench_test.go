@@ -0,0 +1,111 @@
+package optimize
+
+import (
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+const programsDir = "../../programs"
+
+// benchProgram is the program used to benchmark single passes. It is
+// the largest in the corpus and the one with the most for fold and dce
+// to do.
+const benchProgram = "interpret.out.ws"
+
+// BenchmarkPasses measures each default pass on each program in the
+// corpus, after the passes preceding it in the pipeline. It reports
+// the throughput in instructions per second and the number of
+// instructions removed by the pass.
+func BenchmarkPasses(b *testing.B) {
+	files, err := filepath.Glob(filepath.Join(programsDir, "*.ws"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i, pass := range Passes {
+		before := Passes[:i]
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".ws")
+			b.Run(pass.Name+"/"+name, func(b *testing.B) {
+				benchmarkPass(b, file, before, pass.Run)
+			})
+		}
+	}
+}
+
+func BenchmarkFoldConstArith(b *testing.B) {
+	benchmarkPass(b, filepath.Join(programsDir, benchProgram), passesBefore("fold"), pass("fold", FoldConstArith).Run)
+}
+
+func BenchmarkDeadCodeElim(b *testing.B) {
+	benchmarkPass(b, filepath.Join(programsDir, benchProgram), passesBefore("dce"), pass("dce", DeadCodeElim).Run)
+}
+
+// benchmarkPass runs pass on a program freshly lowered from filename
+// and transformed by the passes before it, on each iteration.
+func benchmarkPass(b *testing.B, filename string, before []Pass, run func(*ir.Program) error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var insts, removed int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		p := lowerBench(b, filename, src)
+		RunPasses(p, before, PassOptions{})
+		n := countInsts(p)
+		b.StartTimer()
+		if err := run(p); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		insts += n
+		removed += n - countInsts(p)
+		b.StartTimer()
+	}
+	b.StopTimer()
+	if secs := b.Elapsed().Seconds(); secs > 0 {
+		b.ReportMetric(float64(insts)/secs, "insts/s")
+	}
+	b.ReportMetric(float64(removed)/float64(b.N), "removed/op")
+}
+
+func lowerBench(b *testing.B, filename string, src []byte) *ir.Program {
+	file := token.NewFileSet().AddFile(filename, -1, len(src))
+	tokens, err := ws.LexTokens(file, src)
+	if err != nil {
+		b.Fatalf("lex: %v", err)
+	}
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	for _, err := range errs {
+		if _, ok := err.(*ir.RetUnderflowError); !ok {
+			b.Fatalf("lower: %v", err)
+		}
+	}
+	return p
+}
+
+// passesBefore returns the default passes preceding the named pass.
+func passesBefore(name string) []Pass {
+	for i, pass := range Passes {
+		if pass.Name == name {
+			return Passes[:i]
+		}
+	}
+	return nil
+}
+
+// countInsts counts the instructions and terminators in a program.
+func countInsts(p *ir.Program) int {
+	n := 0
+	for _, block := range p.Blocks {
+		n += len(block.Nodes) + 1
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package optimize
+
+import (
+	"math/big"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// PruneConstBranches replaces conditional jumps on statically known
+// values with unconditional jumps. The condition is known when it is a
+// constant or when it is sub x x, which is always zero, so the branch
+// is resolved even when folding has not run. Blocks made unreachable
+// are removed. Any error from reconnecting the blocks is returned.
+//
+// It is opt-in, so that it does not change the default control flow
+// graph.
+func PruneConstBranches(p *ir.Program) error {
+	changed := false
+	for _, block := range p.Blocks {
+		jc, ok := block.Terminator.(*ir.JmpCondTerm)
+		if !ok {
+			continue
+		}
+		taken, ok := constBranch(jc)
+		if !ok {
+			continue
+		}
+		succ := jc.Succ(1)
+		if taken {
+			succ = jc.Succ(0)
+		}
+		jc.ClearOperands()
+		block.Terminator = ir.NewJmpTerm(ir.Jmp, succ, jc.Pos())
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	err := p.Reconnect()
+	p.TrimUnreachable()
+	return err
+}
+
+// constBranch returns whether the conditional jump is taken, when its
+// condition is statically known.
+func constBranch(jc *ir.JmpCondTerm) (taken, ok bool) {
+	var val *big.Int
+	switch cond := jc.Operand(0).Def().(type) {
+	case *ir.IntConst:
+		val = cond.Int()
+	case *ir.BinaryExpr:
+		if cond.Op != ir.Sub || cond.Operand(0).Def() != cond.Operand(1).Def() {
+			return false, false
+		}
+		val = bigZero
+	default:
+		return false, false
+	}
+	switch jc.Op {
+	case ir.Jz:
+		return val.Sign() == 0, true
+	case ir.Jnz:
+		return val.Sign() != 0, true
+	case ir.Jn:
+		return val.Sign() < 0, true
+	}
+	return false, false
+}
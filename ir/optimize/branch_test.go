@@ -0,0 +1,53 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestPruneConstBranches(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     %1 = sub %0 %0
+	//     jz %1 block_1 block_2
+	// block_1:
+	//     printi 1
+	//     exit
+	// block_2:
+	//     printi 2
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	sub := b.CreateBinaryExpr(ir.Sub, read, read, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, sub, b.Block(1), b.Block(2), token.NoPos)
+	taken := b.Block(1)
+	b.SetCurrentBlock(taken)
+	b.CreatePrintStmt(ir.PrintInt, c(1), token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreatePrintStmt(ir.PrintInt, c(2), token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneConstBranches(p); err != nil {
+		t.Fatal(err)
+	}
+	jmp, ok := p.Entry.Terminator.(*ir.JmpTerm)
+	if !ok || jmp.Op != ir.Jmp || jmp.Succ(0) != taken {
+		t.Errorf("jz on sub x x not replaced with jmp to taken block:\n%v", p)
+	}
+	if len(p.Blocks) != 2 {
+		t.Errorf("got %d blocks, want untaken block removed:\n%v", len(p.Blocks), p)
+	}
+	if len(sub.Uses()) != 0 {
+		t.Errorf("sub still used by %d instructions", len(sub.Uses()))
+	}
+}
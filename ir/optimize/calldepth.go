@@ -0,0 +1,119 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// CallDepth estimates the maximum call stack depth of a program from
+// its call graph. Functions are identified by the blocks that are
+// called and span the blocks reachable from them without returning. The
+// depth is bounded unless the call graph is recursive.
+func CallDepth(p *ir.Program) (depth uint, bounded bool) {
+	c := &callDepth{
+		depths: make(map[*ir.BasicBlock]uint),
+		state:  make(map[*ir.BasicBlock]visitState),
+	}
+	if p.Entry == nil {
+		return 0, true
+	}
+	depth = c.bodyDepth(p.Entry)
+	return depth, !c.recursive
+}
+
+type visitState uint8
+
+const (
+	unvisited visitState = iota
+	visiting
+	visited
+)
+
+type callDepth struct {
+	depths    map[*ir.BasicBlock]uint // depth of calls to a function
+	state     map[*ir.BasicBlock]visitState
+	recursive bool
+}
+
+// funcDepth returns the call depth reached by calling the function
+// starting at entry, including the call itself.
+func (c *callDepth) funcDepth(entry *ir.BasicBlock) uint {
+	switch c.state[entry] {
+	case visiting:
+		c.recursive = true
+		return 0
+	case visited:
+		return c.depths[entry]
+	}
+	c.state[entry] = visiting
+	depth := 1 + c.bodyDepth(entry)
+	c.state[entry] = visited
+	c.depths[entry] = depth
+	return depth
+}
+
+// bodyDepth returns the maximum call depth of the calls made in the
+// blocks reachable from entry without returning.
+func (c *callDepth) bodyDepth(entry *ir.BasicBlock) uint {
+	var depth uint
+	seen := map[*ir.BasicBlock]bool{entry: true}
+	work := []*ir.BasicBlock{entry}
+	for len(work) != 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		var succs []*ir.BasicBlock
+		switch term := block.Terminator.(type) {
+		case *ir.CallTerm:
+			if d := c.funcDepth(term.Succ(0)); d > depth {
+				depth = d
+			}
+			succs = []*ir.BasicBlock{term.Succ(1)}
+		case *ir.RetTerm, *ir.ExitTerm:
+		default:
+			succs = term.Succs()
+		}
+		for _, succ := range succs {
+			if succ != nil && !seen[succ] {
+				seen[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+	return depth
+}
+
+// CallDepthWarning is given when the estimated call stack depth of a
+// program may exceed the call stack length.
+type CallDepthWarning struct {
+	Depth   uint // Estimated maximum depth, if bounded
+	Bounded bool
+	Max     uint // Call stack length
+}
+
+func (w *CallDepthWarning) Error() string {
+	return "warning: " + w.message()
+}
+
+func (w *CallDepthWarning) message() string {
+	if !w.Bounded {
+		return fmt.Sprintf("call stack depth is unbounded due to recursion and may exceed %d; raise -calls or eliminate tail calls", w.Max)
+	}
+	return fmt.Sprintf("call stack depth may reach %d, exceeding %d; raise -calls", w.Depth, w.Max)
+}
+
+// Diagnostic converts the warning to a diagnostic.
+func (w *CallDepthWarning) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Warning, Code: "call-depth", Message: w.message()}
+}
+
+// CheckCallDepth returns a warning when the estimated call stack depth
+// of the program may exceed maxCallStackLen, or nil otherwise.
+func CheckCallDepth(p *ir.Program, maxCallStackLen uint) *CallDepthWarning {
+	depth, bounded := CallDepth(p)
+	if bounded && depth <= maxCallStackLen {
+		return nil
+	}
+	return &CallDepthWarning{depth, bounded, maxCallStackLen}
+}
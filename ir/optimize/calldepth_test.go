@@ -0,0 +1,71 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCallDepth(t *testing.T) {
+	f1, f2, f3 := big.NewInt(1), big.NewInt(2), big.NewInt(3)
+	for i, test := range []struct {
+		Tokens  []*ws.Token
+		Depth   uint
+		Bounded bool
+	}{
+		// call f1; call f3; end
+		// f1: call f2; ret
+		// f2: call f3; ret
+		// f3: ret
+		{[]*ws.Token{
+			{Type: ws.Call, Arg: f1},
+			{Type: ws.Call, Arg: f3},
+			{Type: ws.End},
+			{Type: ws.Label, Arg: f1},
+			{Type: ws.Call, Arg: f2},
+			{Type: ws.Ret},
+			{Type: ws.Label, Arg: f2},
+			{Type: ws.Call, Arg: f3},
+			{Type: ws.Ret},
+			{Type: ws.Label, Arg: f3},
+			{Type: ws.Ret},
+		}, 3, true},
+		// push 1; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.End},
+		}, 0, true},
+		// push 3; call f1; end
+		// f1: dup; jz f2; push 1; sub; call f1; push 0; add; f2: ret
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(3)},
+			{Type: ws.Call, Arg: f1},
+			{Type: ws.End},
+			{Type: ws.Label, Arg: f1},
+			{Type: ws.Dup},
+			{Type: ws.Jz, Arg: f2},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Sub},
+			{Type: ws.Call, Arg: f1},
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Add},
+			{Type: ws.Label, Arg: f2},
+			{Type: ws.Ret},
+		}, 0, false},
+	} {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{File: file, Tokens: test.Tokens}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatalf("test %d: %v", i, errs)
+		}
+		depth, bounded := CallDepth(p)
+		if bounded != test.Bounded || bounded && depth != test.Depth {
+			t.Errorf("test %d: got depth %d, bounded %t, want %d, %t", i, depth, bounded, test.Depth, test.Bounded)
+		}
+		if w := CheckCallDepth(p, 2); (w == nil) != (test.Bounded && test.Depth <= 2) {
+			t.Errorf("test %d: got warning %v", i, w)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package optimize
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andrewarchi/nebula/internal/digraph"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// CFGStats is a complexity profile of the control flow graph of a
+// program.
+type CFGStats struct {
+	Blocks       int
+	Edges        int
+	SCCs         int // Strongly connected components, including acyclic blocks
+	Loops        int // Natural loops, including nested loops
+	MaxLoopDepth int // Deepest loop nesting; 0 when there are no loops
+	MaxDepth     int // Longest shortest path from the entry, in edges
+}
+
+// ComputeCFGStats computes metrics of the control flow graph. Loops
+// are the natural loops found by FindLoops, so cycles without a
+// dominating header, which are irreducible, are not counted.
+func ComputeCFGStats(p *ir.Program) CFGStats {
+	p.RenumberBlockIDs()
+	g := p.Digraph()
+	stats := CFGStats{Blocks: len(p.Blocks)}
+	for _, node := range g {
+		stats.Edges += len(node.Edges)
+	}
+	stats.SCCs = len(g.SCCs())
+	loops := FindLoops(p)
+	stats.Loops = len(loops)
+	for _, loop := range loops {
+		depth := 0
+		for _, outer := range loops {
+			if outer.Contains(loop.Header) {
+				depth++
+			}
+		}
+		if depth > stats.MaxLoopDepth {
+			stats.MaxLoopDepth = depth
+		}
+	}
+	stats.MaxDepth = maxDepth(g, p.Entry.ID)
+	return stats
+}
+
+// maxDepth computes the greatest breadth-first distance from the root
+// to any reachable node.
+func maxDepth(g digraph.Digraph, root int) int {
+	dist := make([]int, len(g))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[root] = 0
+	queue := []int{root}
+	max := 0
+	for len(queue) != 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, edge := range g[node].Edges {
+			if dist[edge] == -1 {
+				dist[edge] = dist[node] + 1
+				if dist[edge] > max {
+					max = dist[edge]
+				}
+				queue = append(queue, edge)
+			}
+		}
+	}
+	return max
+}
+
+func (stats CFGStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "blocks:         %d\n", stats.Blocks)
+	fmt.Fprintf(&b, "edges:          %d\n", stats.Edges)
+	fmt.Fprintf(&b, "sccs:           %d\n", stats.SCCs)
+	fmt.Fprintf(&b, "loops:          %d\n", stats.Loops)
+	fmt.Fprintf(&b, "max loop depth: %d\n", stats.MaxLoopDepth)
+	fmt.Fprintf(&b, "max depth:      %d\n", stats.MaxDepth)
+	return b.String()
+}
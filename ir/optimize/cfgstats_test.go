@@ -0,0 +1,90 @@
+package optimize
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestComputeCFGStats(t *testing.T) {
+	// block_0: jmp block_1
+	// block_1: %0 = readint; jz %0 block_1 block_2
+	// block_2: exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.CreateJmpTerm(ir.Fallthrough, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ComputeCFGStats(p)
+	want := CFGStats{Blocks: 3, Edges: 3, SCCs: 3, Loops: 1, MaxLoopDepth: 1, MaxDepth: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestComputeCFGStatsNested(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_3 block_1
+	// block_1: %1 = readint; jz %1 block_1 block_2
+	// block_2: jmp block_0
+	// block_3: exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	read0 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read0, b.Block(3), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	read1 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read1, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateJmpTerm(ir.Jmp, b.Block(0), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ComputeCFGStats(p)
+	want := CFGStats{Blocks: 4, Edges: 5, SCCs: 2, Loops: 2, MaxLoopDepth: 2, MaxDepth: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestComputeCFGStatsIrreducible(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_1 block_2
+	// block_1: %1 = readint; jz %1 block_2 block_3
+	// block_2: jmp block_1
+	// block_3: exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	read0 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read0, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	read1 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read1, b.Block(2), b.Block(3), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateJmpTerm(ir.Jmp, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cycle of block_1 and block_2 can be entered at either block, so
+	// neither dominates the other and it is not a natural loop.
+	got := ComputeCFGStats(p)
+	want := CFGStats{Blocks: 4, Edges: 5, SCCs: 3, Loops: 0, MaxLoopDepth: 0, MaxDepth: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// PropagateConstants replaces loads of stack slots on entry to a block
+// with a constant when every entry to the block leaves that constant in
+// the slot, either by storing it or by passing on the slot unchanged
+// from its own entries. A block with a single entry takes the value of
+// its predecessor directly, as a trivial copy. At a merge of several
+// entries, the incoming values must be the same constant, so that the
+// phi joining them simplifies away; merges of differing values are left
+// to PropagateStackValues. Replacing a load can expose constants stored
+// by the block, so blocks are visited in reverse post-order and refolded
+// until no loads change.
+//
+// It is not run by default, since the phis it creates cannot be lowered
+// with block functions.
+func PropagateConstants(p *ir.Program) {
+	for {
+		cs := &constSlots{make(map[*ir.BasicBlock]map[uint]*ir.StoreStackStmt)}
+		changed := false
+		for _, block := range p.ReversePostOrder() {
+			if cs.propagate(block) {
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+		FoldConstArith(p)
+	}
+}
+
+// constSlots finds the constants in stack slots at block boundaries.
+type constSlots struct {
+	exits map[*ir.BasicBlock]map[uint]*ir.StoreStackStmt // Cached exitStackStores
+}
+
+// blockSlot is a stack slot on entry to a block.
+type blockSlot struct {
+	block *ir.BasicBlock
+	slot  uint
+}
+
+// propagate replaces the entry stack loads in the block that have a
+// constant value.
+func (cs *constSlots) propagate(block *ir.BasicBlock) bool {
+	replaced := make(map[*ir.LoadStackExpr]bool)
+	for _, l := range entryStackLoads(block) {
+		if c := cs.entryConst(block, l.slot, make(map[blockSlot]bool)); c != nil {
+			l.load.ReplaceUsesWith(c)
+			replaced[l.load] = true
+		}
+	}
+	if len(replaced) == 0 {
+		return false
+	}
+	removeInsts(block, func(inst ir.Inst) bool {
+		load, ok := inst.(*ir.LoadStackExpr)
+		return ok && replaced[load]
+	})
+	delete(cs.exits, block)
+	return true
+}
+
+// entryConst returns the constant in a slot on entry to the block, or
+// nil when it is not constant. Slots in a cycle of blocks that pass
+// them on unchanged are conservatively not constant.
+func (cs *constSlots) entryConst(block *ir.BasicBlock, slot uint, visiting map[blockSlot]bool) *ir.IntConst {
+	if len(block.Entries) == 0 || visiting[blockSlot{block, slot}] {
+		return nil
+	}
+	visiting[blockSlot{block, slot}] = true
+	if len(block.Entries) == 1 {
+		return cs.exitConst(block.Entries[0], slot, visiting)
+	}
+	var merged *ir.IntConst
+	for _, pred := range block.Entries {
+		c := cs.exitConst(pred, slot, visiting)
+		if c == nil || merged != nil && !sameValue(c, merged) {
+			return nil
+		}
+		merged = c
+	}
+	return merged
+}
+
+// exitConst returns the constant in a slot on exit from the block, or
+// nil when it is not constant.
+func (cs *constSlots) exitConst(block *ir.BasicBlock, slot uint, visiting map[blockSlot]bool) *ir.IntConst {
+	if block == nil {
+		return nil
+	}
+	stores, ok := cs.exits[block]
+	if !ok {
+		stores = exitStackStores(block)
+		cs.exits[block] = stores
+	}
+	if store, ok := stores[slot]; ok {
+		c, _ := store.Operand(0).Def().(*ir.IntConst)
+		return c
+	}
+	if entry, ok := passedSlot(block, slot); ok {
+		return cs.entryConst(block, entry, visiting)
+	}
+	return nil
+}
+
+// passedSlot returns the slot on entry to the block that is in the
+// given slot on exit, when the block neither pops nor stores it.
+func passedSlot(block *ir.BasicBlock, slot uint) (uint, bool) {
+	offset, minOffset := 0, 0
+	for _, inst := range block.Nodes {
+		if off, ok := inst.(*ir.OffsetStackStmt); ok {
+			offset += off.Offset
+			if offset < minOffset {
+				minOffset = offset
+			}
+		}
+	}
+	entry := int(slot) - offset
+	if entry <= 0 || entry+minOffset <= 0 {
+		return 0, false
+	}
+	return uint(entry), true
+}
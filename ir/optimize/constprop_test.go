@@ -0,0 +1,82 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestPropagateConstants(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     jz %0 block_1 block_2
+	// block_1:
+	//     offsetstack 1
+	//     storestack 1 5
+	//     jmp block_3
+	// block_2:
+	//     offsetstack 1
+	//     storestack 1 <v>
+	//     jmp block_3
+	// block_3:
+	//     %1 = loadstack 1
+	//     %2 = add %1 1
+	//     jmp block_4
+	// block_4:
+	//     %3 = loadstack 1
+	//     printi %3
+	//     printi %2
+	//     exit
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	build := func(v int64) (*ir.Program, *ir.PrintStmt, *ir.PrintStmt) {
+		b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+		b.InitBlocks(5)
+		read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+		b.CreateJmpCondTerm(ir.Jz, read, b.Block(1), b.Block(2), token.NoPos)
+		for i, n := range []int64{5, v} {
+			b.SetCurrentBlock(b.Block(i + 1))
+			b.CreateOffsetStackStmt(1, token.NoPos)
+			b.CreateStoreStackStmt(1, c(n), token.NoPos)
+			b.CreateJmpTerm(ir.Jmp, b.Block(3), token.NoPos)
+		}
+		b.SetCurrentBlock(b.Block(3))
+		load := b.CreateLoadStackExpr(1, token.NoPos)
+		add := b.CreateBinaryExpr(ir.Add, load, c(1), token.NoPos)
+		b.CreateJmpTerm(ir.Jmp, b.Block(4), token.NoPos)
+		b.SetCurrentBlock(b.Block(4))
+		print1 := b.CreatePrintStmt(ir.PrintInt, b.CreateLoadStackExpr(1, token.NoPos), token.NoPos)
+		print2 := b.CreatePrintStmt(ir.PrintInt, add, token.NoPos)
+		b.CreateExitTerm(token.NoPos)
+		p, err := b.Program()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p, print1, print2
+	}
+
+	// Both entries store 5, so the merge and the single-entry successor
+	// see the constant, and the add folds.
+	p, print1, print2 := build(5)
+	PropagateConstants(p)
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	if !sameValue(print1.Operand(0).Def(), c(5)) {
+		t.Errorf("load in single-entry block not replaced with 5:\n%v", p)
+	}
+	if !sameValue(print2.Operand(0).Def(), c(6)) {
+		t.Errorf("add of merged constant not folded to 6:\n%v", p)
+	}
+
+	// The entries store different constants, so the loads are kept.
+	p, print1, print2 = build(7)
+	PropagateConstants(p)
+	if _, ok := print1.Operand(0).Def().(*ir.LoadStackExpr); !ok {
+		t.Errorf("load of differing constants replaced:\n%v", p)
+	}
+	if _, ok := print2.Operand(0).Def().(*ir.BinaryExpr); !ok {
+		t.Errorf("add of differing constants folded:\n%v", p)
+	}
+}
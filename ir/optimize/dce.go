@@ -0,0 +1,69 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// DeadCodeElim removes instructions whose values are never used and
+// that have no side effects. Removing an instruction can make its
+// operands dead, so elimination repeats until no more can be removed.
+func DeadCodeElim(p *ir.Program) {
+	deadCodeElim(p, hasSideEffects)
+}
+
+// DeadCodeElimTrapping removes dead code like DeadCodeElim, but keeps
+// add, sub, mul, and neg, which trap when they overflow with
+// codegen.Trap, even when their values are unused.
+func DeadCodeElimTrapping(p *ir.Program) {
+	deadCodeElim(p, func(inst ir.Inst) bool {
+		return hasSideEffects(inst) || trapsOnOverflow(inst)
+	})
+}
+
+func deadCodeElim(p *ir.Program, sideEffects func(ir.Inst) bool) {
+	for _, block := range p.Blocks {
+		for changed := true; changed; {
+			changed = false
+			i := 0
+			for _, node := range block.Nodes {
+				if val, ok := node.(ir.Value); ok && val.NUses() == 0 && !sideEffects(node) {
+					if user, ok := node.(ir.User); ok {
+						user.ClearOperands()
+					}
+					changed = true
+					continue
+				}
+				block.Nodes[i] = node
+				i++
+			}
+			block.Nodes = block.Nodes[:i]
+		}
+	}
+}
+
+// hasSideEffects returns whether an instruction affects state other
+// than its value. Division and modulo by a possibly zero value can
+// trap.
+func hasSideEffects(inst ir.Inst) bool {
+	switch inst := inst.(type) {
+	case *ir.BinaryExpr:
+		if inst.Op == ir.Div || inst.Op == ir.Mod {
+			rhs, ok := inst.Operand(1).Def().(*ir.IntConst)
+			return !ok || rhs.Int().Sign() == 0
+		}
+		return false
+	case *ir.UnaryExpr, *ir.LoadStackExpr, *ir.LoadHeapExpr, *ir.PhiExpr:
+		return false
+	}
+	return true
+}
+
+// trapsOnOverflow returns whether an instruction is arithmetic that can
+// overflow 64 bits.
+func trapsOnOverflow(inst ir.Inst) bool {
+	switch inst := inst.(type) {
+	case *ir.BinaryExpr:
+		return inst.Op == ir.Add || inst.Op == ir.Sub || inst.Op == ir.Mul
+	case *ir.UnaryExpr:
+		return inst.Op == ir.Neg
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// Dominators computes the immediate dominator of each block reachable
+// from the entry, which maps to itself. Control flow follows
+// block.Succs, so a ret has an edge to the block that each of its
+// Callers returns to, and a call has edges to both the callee and the
+// block it returns to. Since the return address is dynamic, this
+// over-approximates the paths through a subroutine, so a subroutine is
+// dominated only by the common dominator of its callers and does not
+// dominate the blocks after its calls, but every dominance reported
+// holds on all executions.
+func Dominators(p *ir.Program) map[*ir.BasicBlock]*ir.BasicBlock {
+	idom, _ := immediateDominators(p)
+	return idom
+}
+
+// DominanceFrontier computes the dominance frontier of each block
+// reachable from the entry: the blocks where the dominance of the
+// block ends, which are the join points where phis for values defined
+// in the block are placed. Blocks with an empty frontier are omitted.
+func DominanceFrontier(p *ir.Program) map[*ir.BasicBlock][]*ir.BasicBlock {
+	idom, blocks := immediateDominators(p)
+	return dominanceFrontier(p, idom, blocks)
+}
+
+// dominanceFrontier computes the dominance frontier from the immediate
+// dominators and reachable blocks given by immediateDominators.
+func dominanceFrontier(p *ir.Program, idom map[*ir.BasicBlock]*ir.BasicBlock, blocks []*ir.BasicBlock) map[*ir.BasicBlock][]*ir.BasicBlock {
+	preds := p.Digraph().Reverse()
+	df := make(map[*ir.BasicBlock][]*ir.BasicBlock)
+	for _, block := range blocks {
+		if len(preds[block.ID].Edges) < 2 {
+			continue
+		}
+		for _, pred := range preds[block.ID].Edges {
+			runner := p.Blocks[pred]
+			if _, ok := idom[runner]; !ok {
+				continue
+			}
+			for runner != idom[block] && !containsBlock(df[runner], block) {
+				df[runner] = append(df[runner], block)
+				if idom[runner] == runner {
+					break
+				}
+				runner = idom[runner]
+			}
+		}
+	}
+	return df
+}
+
+func containsBlock(blocks []*ir.BasicBlock, block *ir.BasicBlock) bool {
+	for _, b := range blocks {
+		if b == block {
+			return true
+		}
+	}
+	return false
+}
+
+// immediateDominators computes the immediate dominator of each block
+// reachable from the entry over the control flow graph of p.Digraph,
+// using the iterative algorithm of Cooper, Harvey, and Kennedy. The
+// entry is its own immediate dominator. It returns the reachable blocks
+// in reverse post-order.
+func immediateDominators(p *ir.Program) (map[*ir.BasicBlock]*ir.BasicBlock, []*ir.BasicBlock) {
+	p.RenumberBlockIDs()
+	g := p.Digraph()
+	preds := g.Reverse()
+	rpo := g.ReversePostOrder(p.Entry.ID)
+	order := make([]int, len(g)) // Index in rpo, or -1 when unreachable
+	for i := range order {
+		order[i] = -1
+	}
+	for i, node := range rpo {
+		order[node] = i
+	}
+
+	idom := make([]int, len(g))
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[p.Entry.ID] = p.Entry.ID
+	intersect := func(a, b int) int {
+		for a != b {
+			for order[a] > order[b] {
+				a = idom[a]
+			}
+			for order[b] > order[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, node := range rpo[1:] {
+			dom := -1
+			for _, pred := range preds[node].Edges {
+				if idom[pred] == -1 {
+					continue
+				}
+				if dom == -1 {
+					dom = pred
+				} else {
+					dom = intersect(pred, dom)
+				}
+			}
+			if idom[node] != dom {
+				idom[node] = dom
+				changed = true
+			}
+		}
+	}
+
+	doms := make(map[*ir.BasicBlock]*ir.BasicBlock, len(rpo))
+	blocks := make([]*ir.BasicBlock, len(rpo))
+	for i, node := range rpo {
+		doms[p.Blocks[node]] = p.Blocks[idom[node]]
+		blocks[i] = p.Blocks[node]
+	}
+	return doms, blocks
+}
+
+// dominates returns whether a dominates b, given immediate dominators.
+func dominates(idom map[*ir.BasicBlock]*ir.BasicBlock, a, b *ir.BasicBlock) bool {
+	for {
+		if a == b {
+			return true
+		}
+		dom, ok := idom[b]
+		if !ok || dom == b {
+			return false
+		}
+		b = dom
+	}
+}
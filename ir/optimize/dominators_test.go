@@ -0,0 +1,86 @@
+package optimize
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestDominators(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_1 block_2
+	// block_1: call block_4 block_3
+	// block_2: call block_4 block_5
+	// block_3: jmp block_6
+	// block_4: ret
+	// block_5: jmp block_6
+	// block_6: exit
+	// block_7: exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(8)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateCallTerm(b.Block(4), b.Block(3), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateCallTerm(b.Block(4), b.Block(5), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateJmpTerm(ir.Jmp, b.Block(6), token.NoPos)
+	b.SetCurrentBlock(b.Block(4))
+	b.CreateRetTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(5))
+	b.CreateJmpTerm(ir.Jmp, b.Block(6), token.NoPos)
+	b.SetCurrentBlock(b.Block(6))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(7))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := p.Blocks
+
+	idom := Dominators(p)
+	if len(idom) != 7 {
+		t.Errorf("got %d reachable blocks, want 7", len(idom))
+	}
+	for _, block := range blocks[:7] {
+		if !dominates(idom, p.Entry, block) {
+			t.Errorf("entry does not dominate %s", block.Name())
+		}
+	}
+	if _, ok := idom[blocks[7]]; ok {
+		t.Errorf("unreachable %s has a dominator", blocks[7].Name())
+	}
+	for _, block := range blocks[1:7] {
+		if got := idom[block]; got != p.Entry {
+			t.Errorf("got idom(%s) = %s, want %s", block.Name(), got.Name(), p.Entry.Name())
+		}
+	}
+
+	// The ret has edges to the blocks after both calls, rather than to
+	// the blocks after the calling blocks in source order.
+	df := DominanceFrontier(p)
+	wantDF := map[int][]int{1: {3, 4}, 2: {4, 5}, 3: {6}, 4: {3, 5}, 5: {6}}
+	if len(df) != len(wantDF) {
+		t.Errorf("got frontiers for %d blocks, want %d", len(df), len(wantDF))
+	}
+	for i, want := range wantDF {
+		got := df[blocks[i]]
+		ok := len(got) == len(want)
+		for _, w := range want {
+			ok = ok && containsBlock(got, blocks[w])
+		}
+		if !ok {
+			t.Errorf("got DF(%s) = %v, want blocks %v", blocks[i].Name(), blockNames(got), want)
+		}
+	}
+}
+
+func blockNames(blocks []*ir.BasicBlock) []string {
+	names := make([]string, len(blocks))
+	for i, block := range blocks {
+		names[i] = block.Name()
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// RemoveDuplicateStores removes heap stores that write the value the
+// address is already known to hold within a block, a form of value
+// numbering over heap cells. The known value of an address is the value
+// last stored to it or loaded from it. A store that may alias an
+// address forgets its known value.
+//
+// This generalizes RemoveStoreBacks and catches stores left behind by
+// PromoteHeapScalars for cells it could not promote, such as storing
+// the same value to a cell twice. Since it pairs with
+// PromoteHeapScalars, it is likewise not run by default.
+func RemoveDuplicateStores(p *ir.Program) {
+	for _, block := range p.Blocks {
+		var known []heapValue
+		i := 0
+		for _, node := range block.Nodes {
+			switch inst := node.(type) {
+			case *ir.LoadHeapExpr:
+				addr := inst.Operand(0).Def()
+				if _, ok := lookupHeapValue(known, addr); !ok {
+					known = append(known, heapValue{addr, inst})
+				}
+			case *ir.StoreHeapStmt:
+				addr, val := inst.Operand(0).Def(), inst.Operand(1).Def()
+				if v, ok := lookupHeapValue(known, addr); ok && mustAlias(v, val) {
+					inst.ClearOperands()
+					continue
+				}
+				j := 0
+				for _, hv := range known {
+					if !mayAlias(addr, hv.addr) {
+						known[j] = hv
+						j++
+					}
+				}
+				known = append(known[:j], heapValue{addr, val})
+			}
+			block.Nodes[i] = node
+			i++
+		}
+		block.Nodes = block.Nodes[:i]
+	}
+}
+
+// heapValue is the known value of a heap address.
+type heapValue struct {
+	addr, val ir.Value
+}
+
+func lookupHeapValue(known []heapValue, addr ir.Value) (ir.Value, bool) {
+	for _, hv := range known {
+		if mustAlias(hv.addr, addr) {
+			return hv.val, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,43 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestRemoveDuplicateStores(t *testing.T) {
+	// %0 = readint
+	// storeheap 5 %0
+	// storeheap 5 %0
+	// %1 = readint
+	// storeheap %1 7
+	// storeheap 5 %0
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	first := b.CreateStoreHeapStmt(c(5), read, token.NoPos)
+	b.CreateStoreHeapStmt(c(5), read, token.NoPos)
+	addr := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	clobber := b.CreateStoreHeapStmt(addr, c(7), token.NoPos)
+	kept := b.CreateStoreHeapStmt(c(5), read, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RemoveDuplicateStores(p)
+	var stores []ir.Inst
+	for _, node := range p.Blocks[0].Nodes {
+		if _, ok := node.(*ir.StoreHeapStmt); ok {
+			stores = append(stores, node)
+		}
+	}
+	if len(stores) != 3 || stores[0] != first || stores[1] != clobber || stores[2] != kept {
+		t.Errorf("duplicate store to 5 not removed or store after clobber removed:\n%v", p)
+	}
+}
@@ -0,0 +1,182 @@
+package optimize
+
+import (
+	"github.com/andrewarchi/nebula/internal/digraph"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// HoistHeapLoads moves heap loads with loop-invariant addresses out of
+// loops, when no store in the loop may alias the address. A hoisted
+// load is appended to the preheader, the single block outside the loop
+// that jumps to the loop header, and loads of the same cell share one
+// hoisted load. Loops without a preheader are left unchanged, as are
+// loads in loops with a possibly-aliasing store. Since a hoisted load
+// runs even when its block would not, loads with dynamic addresses are
+// hoisted only from the header, which runs on every entry to the loop.
+//
+// Hoisted loads are used in other blocks, which codegen supports only
+// when the preheader is emitted before the loop and not with block
+// functions, so the pass is not run by default.
+func HoistHeapLoads(p *ir.Program) {
+	p.RenumberBlockIDs()
+	g := p.Digraph()
+	order := make([]int, len(g))
+	for i := range order {
+		order[i] = len(g)
+	}
+	for i, node := range g.ReversePostOrder(p.Entry.ID) {
+		order[node] = i
+	}
+	g.ClearVisited()
+	nodes := make([]int, len(g))
+	for i := range nodes {
+		nodes[i] = i
+	}
+	hoistLoops(p, g, subgraph(g, nodes).SCCs(), nodes, order)
+}
+
+// hoistLoops hoists loads out of the cyclic components among sccs of
+// the subgraph of nodes, then out of the loops nested within them.
+func hoistLoops(p *ir.Program, g digraph.Digraph, sccs [][]int, nodes, order []int) {
+	for _, scc := range sccs {
+		for i := range scc {
+			scc[i] = nodes[scc[i]]
+		}
+		if !isCyclic(g, scc) {
+			continue
+		}
+		header := 0
+		for i, node := range scc {
+			if order[node] < order[scc[header]] {
+				header = i
+			}
+		}
+		loop := make([]*ir.BasicBlock, len(scc))
+		for i, node := range scc {
+			loop[i] = p.Blocks[node]
+		}
+		hoistLoop(loop, loop[header])
+		body := append(append([]int{}, scc[:header]...), scc[header+1:]...)
+		hoistLoops(p, g, subgraph(g, body).SCCs(), body, order)
+	}
+}
+
+func isCyclic(g digraph.Digraph, scc []int) bool {
+	if len(scc) > 1 {
+		return true
+	}
+	for _, edge := range g[scc[0]].Edges {
+		if edge == scc[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// subgraph creates the subgraph of g induced by nodes, with node i of
+// the subgraph corresponding to nodes[i].
+func subgraph(g digraph.Digraph, nodes []int) digraph.Digraph {
+	index := make(map[int]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
+	}
+	sub := make(digraph.Digraph, len(nodes))
+	for i, node := range nodes {
+		for _, edge := range g[node].Edges {
+			if j, ok := index[edge]; ok {
+				sub.AddEdge(i, j)
+			}
+		}
+	}
+	return sub
+}
+
+// hoistLoop hoists the invariant loads of a single loop.
+func hoistLoop(loop []*ir.BasicBlock, header *ir.BasicBlock) {
+	inLoop := make(map[*ir.BasicBlock]bool, len(loop))
+	for _, block := range loop {
+		inLoop[block] = true
+	}
+	preheader := loopPreheader(header, inLoop)
+	if preheader == nil {
+		return
+	}
+	defs := make(map[ir.Value]bool)
+	var stores []ir.Value
+	for _, block := range loop {
+		for _, inst := range block.Nodes {
+			if val, ok := inst.(ir.Value); ok {
+				defs[val] = true
+			}
+			if store, ok := inst.(*ir.StoreHeapStmt); ok {
+				stores = append(stores, store.Operand(0).Def())
+			}
+		}
+	}
+
+	var hoisted []*ir.LoadHeapExpr
+	for _, block := range loop {
+		i := 0
+		for _, inst := range block.Nodes {
+			load, ok := inst.(*ir.LoadHeapExpr)
+			if ok && canHoistLoad(load, block == header, defs, stores) {
+				if prev := lookupHoisted(hoisted, load.Operand(0).Def()); prev != nil {
+					load.ClearOperands()
+					load.ReplaceUsesWith(prev)
+				} else {
+					hoisted = append(hoisted, load)
+					preheader.Nodes = append(preheader.Nodes, load)
+				}
+				continue
+			}
+			block.Nodes[i] = inst
+			i++
+		}
+		block.Nodes = block.Nodes[:i]
+	}
+}
+
+// loopPreheader returns the only block outside the loop that enters the
+// header, if it unconditionally jumps to the header.
+func loopPreheader(header *ir.BasicBlock, inLoop map[*ir.BasicBlock]bool) *ir.BasicBlock {
+	var preheader *ir.BasicBlock
+	for _, entry := range header.Entries {
+		if inLoop[entry] {
+			continue
+		}
+		if preheader != nil && preheader != entry {
+			return nil
+		}
+		preheader = entry
+	}
+	if preheader == nil {
+		return nil
+	}
+	if _, ok := preheader.Terminator.(*ir.JmpTerm); !ok {
+		return nil
+	}
+	return preheader
+}
+
+// canHoistLoad returns whether a load can be moved to the preheader.
+func canHoistLoad(load *ir.LoadHeapExpr, inHeader bool, defs map[ir.Value]bool, stores []ir.Value) bool {
+	addr := load.Operand(0).Def()
+	if _, ok := addr.(*ir.IntConst); !ok && (!inHeader || defs[addr]) {
+		return false
+	}
+	for _, store := range stores {
+		if mayAlias(store, addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupHoisted(hoisted []*ir.LoadHeapExpr, addr ir.Value) *ir.LoadHeapExpr {
+	for _, load := range hoisted {
+		if mustAlias(load.Operand(0).Def(), addr) {
+			return load
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package optimize
+
+import (
+	"bytes"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/interp"
+)
+
+func TestHoistHeapLoads(t *testing.T) {
+	// block_0:
+	//     storeheap 5 7
+	//     jmp block_1
+	// block_1:
+	//     %0 = loadheap 0
+	//     %1 = loadheap 5
+	//     printi %1
+	//     %2 = add %0 1
+	//     storeheap 0 %2
+	//     %3 = sub %2 3
+	//     jn %3 block_1 block_2
+	// block_2:
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	b.CreateStoreHeapStmt(c(5), c(7), token.NoPos)
+	b.CreateJmpTerm(ir.Jmp, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	i := b.CreateLoadHeapExpr(c(0), token.NoPos)
+	x := b.CreateLoadHeapExpr(c(5), token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, x, token.NoPos)
+	n := b.CreateBinaryExpr(ir.Add, i, c(1), token.NoPos)
+	b.CreateStoreHeapStmt(c(0), n, token.NoPos)
+	cond := b.CreateBinaryExpr(ir.Sub, n, c(3), token.NoPos)
+	b.CreateJmpCondTerm(ir.Jn, cond, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	HoistHeapLoads(p)
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	preheader, loop := p.Blocks[0], p.Blocks[1]
+	if len(preheader.Nodes) != 2 || preheader.Nodes[1] != x {
+		t.Errorf("invariant load not hoisted to preheader:\n%v", p)
+	}
+	for _, node := range loop.Nodes {
+		if node == x {
+			t.Errorf("invariant load left in loop:\n%v", p)
+		}
+	}
+	if loop.Nodes[0] != i {
+		t.Errorf("load of stored cell hoisted:\n%v", p)
+	}
+
+	var out bytes.Buffer
+	if err := interp.Run(p, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "777" {
+		t.Errorf("got output %q, want %q", out.String(), "777")
+	}
+}
@@ -0,0 +1,68 @@
+package optimize
+
+import (
+	"sort"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Loop is a natural loop in the control flow graph.
+type Loop struct {
+	Header    *ir.BasicBlock
+	Body      []*ir.BasicBlock // Blocks in the loop, including the header, in source order
+	BackEdges []*ir.BasicBlock // Sources of edges to the header from within the loop
+}
+
+// Contains returns whether the block is in the loop.
+func (l *Loop) Contains(block *ir.BasicBlock) bool {
+	for _, b := range l.Body {
+		if b == block {
+			return true
+		}
+	}
+	return false
+}
+
+// FindLoops finds the natural loops of the program. A back edge is an
+// edge from an entry of a block that the block dominates, and the loop
+// of a header is the header with the blocks it dominates that reach
+// its back edges without passing through it. Subroutines called from
+// outside the loop are not dominated by the header, so they are not
+// part of the loop. Loops are returned in reverse post-order of their
+// headers, so a loop precedes the loops nested within it. Cycles
+// without a dominating header, which are irreducible, are not loops.
+func FindLoops(p *ir.Program) []Loop {
+	idom, blocks := immediateDominators(p)
+	var loops []Loop
+	for _, header := range blocks {
+		var backEdges []*ir.BasicBlock
+		for _, entry := range header.Entries {
+			if entry != nil && dominates(idom, header, entry) {
+				backEdges = append(backEdges, entry)
+			}
+		}
+		if len(backEdges) == 0 {
+			continue
+		}
+		inLoop := map[*ir.BasicBlock]bool{header: true}
+		body := []*ir.BasicBlock{header}
+		work := append([]*ir.BasicBlock{}, backEdges...)
+		for len(work) != 0 {
+			block := work[len(work)-1]
+			work = work[:len(work)-1]
+			if inLoop[block] {
+				continue
+			}
+			inLoop[block] = true
+			body = append(body, block)
+			for _, entry := range block.Entries {
+				if entry != nil && !inLoop[entry] && dominates(idom, header, entry) {
+					work = append(work, entry)
+				}
+			}
+		}
+		sort.Slice(body, func(i, j int) bool { return body[i].ID < body[j].ID })
+		loops = append(loops, Loop{header, body, backEdges})
+	}
+	return loops
+}
@@ -0,0 +1,96 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestFindLoops(t *testing.T) {
+	//     push 3
+	// loop:
+	//     dup
+	//     printi
+	//     push 1
+	//     sub
+	//     dup
+	//     jz done
+	//     jmp loop
+	// done:
+	//     end
+	loop, done := big.NewInt(1), big.NewInt(2)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Label, Arg: loop},
+		{Type: ws.Dup},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Sub},
+		{Type: ws.Dup},
+		{Type: ws.Jz, Arg: done},
+		{Type: ws.Jmp, Arg: loop},
+		{Type: ws.Label, Arg: done},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	loops := FindLoops(p)
+	if len(loops) != 1 {
+		t.Fatalf("got %d loops, want 1\n%v", len(loops), p)
+	}
+	l := loops[0]
+	if len(l.Header.Labels) != 1 || l.Header.Labels[0].ID.Cmp(loop) != 0 {
+		t.Errorf("got header %s, want block of label %v", l.Header.Name(), loop)
+	}
+	jmp := l.Header.Next
+	if len(l.BackEdges) != 1 || l.BackEdges[0] != jmp {
+		t.Errorf("got back edges %v, want %s", l.BackEdges, jmp.Name())
+	}
+	if len(l.Body) != 2 || l.Body[0] != l.Header || l.Body[1] != jmp {
+		t.Errorf("got body %v, want %s and %s", l.Body, l.Header.Name(), jmp.Name())
+	}
+	if l.Contains(p.Entry) || l.Contains(jmp.Next) {
+		t.Errorf("loop contains blocks outside of it: %v", l.Body)
+	}
+}
+
+func TestFindLoopsNested(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_3 block_1
+	// block_1: %1 = readint; jz %1 block_1 block_2
+	// block_2: jmp block_0
+	// block_3: exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	read0 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read0, b.Block(3), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	read1 := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read1, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateJmpTerm(ir.Jmp, b.Block(0), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loops := FindLoops(p)
+	if len(loops) != 2 {
+		t.Fatalf("got %d loops, want 2", len(loops))
+	}
+	outer, inner := loops[0], loops[1]
+	if outer.Header != p.Blocks[0] || len(outer.Body) != 3 || outer.Contains(p.Blocks[3]) {
+		t.Errorf("got outer loop %s with body %v", outer.Header.Name(), outer.Body)
+	}
+	if inner.Header != p.Blocks[1] || len(inner.Body) != 1 || len(inner.BackEdges) != 1 || inner.BackEdges[0] != p.Blocks[1] {
+		t.Errorf("got inner loop %s with body %v and back edges %v", inner.Header.Name(), inner.Body, inner.BackEdges)
+	}
+}
@@ -0,0 +1,174 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// PromoteHeapScalars promotes heap cells at constant addresses to SSA
+// values, like LLVM's mem2reg. Phi expressions for a cell are placed at
+// the iterated dominance frontier of the blocks that store to it, then
+// loads are replaced with the value last stored on the path through
+// the dominator tree and the stores are removed. A cell is promoted
+// only when no heap access with a different address may alias it, so
+// with only constant addresses distinguishable, any access with a
+// dynamic address prevents promotion. A cell is not promoted when a
+// phi would be needed at the program entry. The heap is
+// zero-initialized, so a load before any store yields 0.
+//
+// It is not run by default, since the promoted values are used across
+// blocks, which codegen supports only in some block orders and not with
+// block functions.
+func PromoteHeapScalars(p *ir.Program) {
+	cells := bigint.NewMap() // map[*big.Int]*heapCell
+	var dynamic []ir.Value
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			var addr ir.Value
+			switch inst := inst.(type) {
+			case *ir.LoadHeapExpr:
+				addr = inst.Operand(0).Def()
+			case *ir.StoreHeapStmt:
+				addr = inst.Operand(0).Def()
+			default:
+				continue
+			}
+			c, ok := addr.(*ir.IntConst)
+			if !ok {
+				dynamic = append(dynamic, addr)
+				continue
+			}
+			v, _ := cells.GetOrPut(c.Int(), &heapCell{addr: c, defs: make(map[*ir.BasicBlock]bool)})
+			cell := v.(*heapCell)
+			if _, ok := inst.(*ir.StoreHeapStmt); ok {
+				cell.defs[block] = true
+			}
+		}
+	}
+	pairs := cells.Pairs()
+	if len(pairs) == 0 {
+		return
+	}
+	idom, blocks := immediateDominators(p)
+	df := dominanceFrontier(p, idom, blocks)
+	for _, pair := range pairs {
+		cell := pair.V.(*heapCell)
+		if !cell.aliased(dynamic) {
+			cell.promote(p, idom, blocks, df)
+		}
+	}
+	SimplifyPhis(p)
+}
+
+// heapCell is a heap cell at a constant address and the blocks that
+// store to it.
+type heapCell struct {
+	addr *ir.IntConst
+	defs map[*ir.BasicBlock]bool
+}
+
+// aliased returns whether any of the addresses may alias the cell.
+func (cell *heapCell) aliased(addrs []ir.Value) bool {
+	for _, addr := range addrs {
+		if mayAlias(cell.addr, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// accesses returns whether the load or store is of this cell.
+func (cell *heapCell) accesses(inst ir.User) bool {
+	return mustAlias(cell.addr, inst.Operand(0).Def())
+}
+
+// promote replaces the accesses of the cell with SSA values, given the
+// immediate dominators, the reachable blocks in reverse post-order, and
+// the dominance frontiers.
+func (cell *heapCell) promote(p *ir.Program, idom map[*ir.BasicBlock]*ir.BasicBlock, rpo []*ir.BasicBlock, df map[*ir.BasicBlock][]*ir.BasicBlock) {
+	phis := make(map[*ir.BasicBlock]*ir.PhiExpr)
+	work := make([]*ir.BasicBlock, 0, len(cell.defs))
+	queued := make(map[*ir.BasicBlock]bool, len(cell.defs))
+	for block := range cell.defs {
+		work = append(work, block)
+		queued[block] = true
+	}
+	for len(work) != 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, join := range df[block] {
+			if phis[join] != nil {
+				continue
+			}
+			if join == p.Entry {
+				return
+			}
+			phis[join] = ir.NewPhiExpr(token.NoPos)
+			if !queued[join] {
+				work = append(work, join)
+				queued[join] = true
+			}
+		}
+	}
+
+	// A block without a phi is entered with the value its immediate
+	// dominator exits with, so visiting dominators first suffices.
+	zero := ir.NewIntConst(new(big.Int), token.NoPos)
+	exits := make(map[*ir.BasicBlock]ir.Value, len(p.Blocks))
+	for _, block := range rpo {
+		val := ir.Value(zero)
+		if dom := idom[block]; dom != block {
+			val = exits[dom]
+		}
+		exits[block] = cell.rename(block, phis, val)
+	}
+	for _, block := range p.Blocks {
+		if _, ok := idom[block]; !ok {
+			exits[block] = cell.rename(block, phis, zero) // unreachable
+		}
+	}
+
+	for _, block := range p.Blocks {
+		phi, ok := phis[block]
+		if !ok {
+			continue
+		}
+		for _, pred := range block.Entries {
+			phi.AddIncoming(exits[pred], pred)
+		}
+		block.Nodes = append([]ir.Inst{phi}, block.Nodes...)
+	}
+}
+
+// rename replaces the loads of the cell in the block with the value
+// that reaches them and removes the stores, given the value on entry
+// when the block has no phi for the cell. It returns the value on exit.
+func (cell *heapCell) rename(block *ir.BasicBlock, phis map[*ir.BasicBlock]*ir.PhiExpr, val ir.Value) ir.Value {
+	if phi, ok := phis[block]; ok {
+		val = phi
+	}
+	i := 0
+	for _, inst := range block.Nodes {
+		switch inst := inst.(type) {
+		case *ir.StoreHeapStmt:
+			if cell.accesses(inst) {
+				val = inst.Operand(1).Def()
+				inst.ClearOperands()
+				continue
+			}
+		case *ir.LoadHeapExpr:
+			if cell.accesses(inst) {
+				inst.ReplaceUsesWith(val)
+				inst.ClearOperands()
+				continue
+			}
+		}
+		block.Nodes[i] = inst
+		i++
+	}
+	block.Nodes = block.Nodes[:i]
+	return val
+}
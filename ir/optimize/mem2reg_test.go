@@ -0,0 +1,244 @@
+package optimize
+
+import (
+	"go/parser"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/interp"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestPromoteHeapScalars(t *testing.T) {
+	//     push 0
+	//     push 0
+	//     store     ; i = 0
+	// loop:
+	//     push 0
+	//     retrieve
+	//     printi    ; print i
+	//     push 0
+	//     push 0
+	//     retrieve
+	//     push 1
+	//     add
+	//     store     ; i++
+	//     push 0
+	//     retrieve
+	//     push 5
+	//     sub
+	//     jn loop   ; while i < 5
+	//     end
+	loop := big.NewInt(1)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Store},
+		{Type: ws.Label, Arg: loop},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Store},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(5)},
+		{Type: ws.Sub},
+		{Type: ws.Jn, Arg: loop},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	PromoteHeapScalars(p)
+	phis := 0
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			switch inst.(type) {
+			case *ir.LoadHeapExpr, *ir.StoreHeapStmt:
+				t.Errorf("heap access not promoted:\n%v", p)
+			case *ir.PhiExpr:
+				phis++
+			}
+		}
+	}
+	if phis != 1 {
+		t.Errorf("got %d phis, want 1:\n%v", phis, p)
+	}
+
+	var out strings.Builder
+	if err := interp.Run(p, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "01234"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
+
+func TestPromoteHeapScalarsDynamic(t *testing.T) {
+	// push 0; push 7; store; push 0; retrieve; retrieve; printi; end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(7)},
+		{Type: ws.Store},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	before := p.String()
+	PromoteHeapScalars(p)
+	if after := p.String(); after != before {
+		t.Errorf("promoted with dynamic address:\n%s", after)
+	}
+}
+
+func TestPromoteHeapScalarsJoin(t *testing.T) {
+	//     push 1
+	//     readi
+	//     push 1
+	//     retrieve
+	//     jz zero
+	//     push 0
+	//     push 2
+	//     store     ; x = 2
+	//     jmp join
+	// zero:
+	//     push 0
+	//     push 3
+	//     store     ; x = 3
+	// join:
+	//     push 0
+	//     retrieve
+	//     printi    ; print x
+	//     end
+	zero, join := big.NewInt(1), big.NewInt(2)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Readi},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Retrieve},
+		{Type: ws.Jz, Arg: zero},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Store},
+		{Type: ws.Jmp, Arg: join},
+		{Type: ws.Label, Arg: zero},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Store},
+		{Type: ws.Label, Arg: join},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	for _, tt := range []struct{ in, out string }{{"0\n", "3"}, {"5\n", "2"}} {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		PromoteHeapScalars(p)
+		phis := 0
+		for _, block := range p.Blocks {
+			for _, inst := range block.Nodes {
+				if _, ok := inst.(*ir.PhiExpr); ok {
+					phis++
+				}
+			}
+		}
+		if phis != 1 {
+			t.Errorf("got %d phis, want 1:\n%v", phis, p)
+		}
+		if errs := p.Verify(); len(errs) != 0 {
+			t.Fatalf("verify: %v\n%v", errs, p)
+		}
+		var out strings.Builder
+		if err := interp.Run(p, strings.NewReader(tt.in), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.out {
+			t.Errorf("input %q: got output %q, want %q", tt.in, out.String(), tt.out)
+		}
+	}
+}
+
+func TestPromoteHeapScalarsGoBuilder(t *testing.T) {
+	//     push 0
+	//     push 2
+	//     push 3
+	//     add
+	//     store
+	//     jmp set
+	// print:
+	//     push 0
+	//     retrieve
+	//     printi
+	//     end
+	// set:
+	//     push 0
+	//     push 0
+	//     retrieve
+	//     push 1
+	//     add
+	//     store
+	//     jmp print
+	print, set := big.NewInt(1), big.NewInt(2)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(2)},
+		{Type: ws.Push, Arg: big.NewInt(3)},
+		{Type: ws.Add},
+		{Type: ws.Store},
+		{Type: ws.Jmp, Arg: set},
+		{Type: ws.Label, Arg: print},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Printi},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: set},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Store},
+		{Type: ws.Jmp, Arg: print},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// The increment in set is printed in print, which precedes it in
+	// source order.
+	PromoteHeapScalars(p)
+	src, err := ir.EmitGoBuilder(p)
+	if err != nil {
+		t.Fatalf("%v\n%v", err, p)
+	}
+	if strings.Contains(src, "LoadHeapExpr") {
+		t.Errorf("heap access not promoted:\n%v", p)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "build.go", "package p\n\n"+src, 0); err != nil {
+		t.Errorf("emitted invalid Go: %v\n%s", err, src)
+	}
+}
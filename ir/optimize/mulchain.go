@@ -0,0 +1,115 @@
+package optimize
+
+import (
+	"math/big"
+	"math/bits"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// TargetCost is the relative cost of arithmetic instructions on a
+// target, used to choose between equivalent instruction sequences.
+type TargetCost struct {
+	Mul int
+	Add int // Also the cost of sub
+	Shl int
+}
+
+// SlowMulCost models a target on which multiplication is several times
+// slower than addition and shifting. On modern CPUs, multiplication is
+// cheap and ExpandConstMul is rarely profitable.
+var SlowMulCost = TargetCost{Mul: 4, Add: 1, Shl: 1}
+
+// ExpandConstMul returns a pass that replaces multiplication by a
+// positive constant with a chain of shifts and adds, when that chain is
+// cheaper than a multiply under cost. For example, mul x 3 becomes
+// add (shl x 1) x. Multiplication by a power of two is already reduced
+// to a shift by FoldConstArith.
+//
+// It is not run by default, since it only pays off on targets with slow
+// multiplication.
+func ExpandConstMul(cost TargetCost) func(p *ir.Program) {
+	return func(p *ir.Program) {
+		for _, block := range p.Blocks {
+			nodes := make([]ir.Inst, 0, len(block.Nodes))
+			for _, node := range block.Nodes {
+				if bin, ok := node.(*ir.BinaryExpr); ok && bin.Op == ir.Mul {
+					if chain := expandMul(bin, cost); chain != nil {
+						nodes = append(nodes, chain...)
+						bin.ClearOperands()
+						bin.ReplaceUsesWith(chain[len(chain)-1].(ir.Value))
+						continue
+					}
+				}
+				nodes = append(nodes, node)
+			}
+			block.Nodes = nodes
+		}
+	}
+}
+
+// expandMul returns the instructions computing bin as shifts and adds,
+// with the result last, or nil when a multiply is cheaper.
+func expandMul(bin *ir.BinaryExpr, cost TargetCost) []ir.Inst {
+	x, c := bin.Operand(0).Def(), bin.Operand(1).Def()
+	con, ok := c.(*ir.IntConst)
+	if !ok {
+		x, c = c, x
+		if con, ok = c.(*ir.IntConst); !ok {
+			return nil
+		}
+	}
+	if con.Int().Sign() <= 0 || !con.Int().IsUint64() {
+		return nil
+	}
+	n := con.Int().Uint64()
+	if n <= 1 || n&(n-1) == 0 {
+		return nil
+	}
+
+	// Sum of shifted terms, one per set bit
+	ones := bits.OnesCount64(n)
+	addCost := (ones-1)*cost.Add + ones*cost.Shl
+	if n&1 != 0 {
+		addCost -= cost.Shl
+	}
+	// Shifted difference for n = 2^k - 1
+	k := bits.Len64(n)
+	subCost := -1
+	if n+1 == 1<<uint(k) && k < 64 {
+		subCost = cost.Shl + cost.Add
+	}
+
+	pos := bin.Pos()
+	shl := func(s int) ir.Inst {
+		return ir.NewBinaryExpr(ir.Shl, x, ir.NewIntConst(big.NewInt(int64(s)), pos), pos)
+	}
+	switch {
+	case subCost >= 0 && subCost < addCost && subCost < cost.Mul:
+		hi := shl(k)
+		return []ir.Inst{hi, ir.NewBinaryExpr(ir.Sub, hi.(ir.Value), x, pos)}
+	case addCost < cost.Mul:
+		var chain []ir.Inst
+		var sum ir.Value
+		for s := k - 1; s >= 0; s-- {
+			if n&(1<<uint(s)) == 0 {
+				continue
+			}
+			term := x
+			if s != 0 {
+				t := shl(s)
+				chain = append(chain, t)
+				term = t.(ir.Value)
+			}
+			if sum == nil {
+				sum = term
+				continue
+			}
+			add := ir.NewBinaryExpr(ir.Add, sum, term, pos)
+			chain = append(chain, add)
+			sum = add
+		}
+		return chain
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestExpandConstMul(t *testing.T) {
+	// %0 = readi
+	// %1 = mul %0 3
+	// printi %1
+	newProgram := func() (*ir.Program, *ir.ReadExpr) {
+		b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+		b.InitBlocks(1)
+		read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+		mul := b.CreateBinaryExpr(ir.Mul, read, ir.NewIntConst(big.NewInt(3), token.NoPos), token.NoPos)
+		b.CreatePrintStmt(ir.PrintInt, mul, token.NoPos)
+		b.CreateExitTerm(token.NoPos)
+		p, err := b.Program()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p, read
+	}
+
+	p, read := newProgram()
+	ExpandConstMul(SlowMulCost)(p)
+	nodes := p.Blocks[0].Nodes
+	if len(nodes) != 4 {
+		t.Fatalf("expected read, shl, add, and print:\n%v", p)
+	}
+	shl, ok := nodes[1].(*ir.BinaryExpr)
+	if !ok || shl.Op != ir.Shl || shl.Operand(0).Def() != read ||
+		shl.Operand(1).Def().(*ir.IntConst).Int().Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("expected shl %%0 1, got %v", nodes[1])
+	}
+	add, ok := nodes[2].(*ir.BinaryExpr)
+	if !ok || add.Op != ir.Add || add.Operand(0).Def() != shl || add.Operand(1).Def() != read {
+		t.Errorf("expected add (shl %%0 1) %%0, got %v", nodes[2])
+	}
+	if print := nodes[3].(*ir.PrintStmt); print.Operand(0).Def() != add {
+		t.Errorf("print does not use expanded multiply:\n%v", p)
+	}
+
+	p, _ = newProgram()
+	ExpandConstMul(TargetCost{Mul: 1, Add: 1, Shl: 1})(p)
+	if bin, ok := p.Blocks[0].Nodes[1].(*ir.BinaryExpr); !ok || bin.Op != ir.Mul {
+		t.Errorf("multiply expanded when cheaper:\n%v", p)
+	}
+}
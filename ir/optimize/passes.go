@@ -0,0 +1,169 @@
+package optimize
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Pass is a named transformation of a program. A pass that changes
+// the control flow returns any error from reconnecting the blocks.
+type Pass struct {
+	Name string
+	Run  func(p *ir.Program) error
+}
+
+// pass registers a transformation that cannot fail.
+func pass(name string, run func(p *ir.Program)) Pass {
+	return Pass{name, func(p *ir.Program) error {
+		run(p)
+		return nil
+	}}
+}
+
+// Passes is the default optimization pipeline, in order.
+var Passes = []Pass{
+	pass("trim", (*ir.Program).TrimUnreachable),
+	pass("fold", FoldConstArith),
+	pass("dce", DeadCodeElim),
+	pass("phi", SimplifyPhis),
+}
+
+// OptionalPasses are registered passes that are not run by default.
+var OptionalPasses = []Pass{
+	pass("mem2reg", PromoteHeapScalars),
+	pass("stackprop", PropagateStackValues),
+	pass("licm", HoistHeapLoads),
+	pass("mulchain", ExpandConstMul(SlowMulCost)),
+	pass("storeback", RemoveStoreBacks),
+	{"tailrec", TailRecursionToLoop},
+	pass("sink", SinkStores),
+	pass("dupstore", RemoveDuplicateStores),
+	{"branch", PruneConstBranches},
+	pass("constprop", PropagateConstants),
+	{"tailcall", MarkTailCalls},
+}
+
+// TrapOverflowPasses returns the passes adapted to arithmetic that
+// traps on overflow. Fold and dce are replaced with variants that keep
+// arithmetic that may overflow, and mulchain is removed, since a
+// multiply expanded into shifts and adds would trap on an intermediate
+// add, or not at all, rather than on the multiply.
+func TrapOverflowPasses(passes []Pass) []Pass {
+	var trapping []Pass
+	for _, p := range passes {
+		switch p.Name {
+		case "fold":
+			p = pass("fold", FoldConstArithTrapping)
+		case "dce":
+			p = pass("dce", DeadCodeElimTrapping)
+		case "mulchain":
+			continue
+		}
+		trapping = append(trapping, p)
+	}
+	return trapping
+}
+
+// LookupPass returns the registered pass with the given name.
+func LookupPass(name string) (Pass, bool) {
+	for _, passes := range [][]Pass{Passes, OptionalPasses} {
+		for _, pass := range passes {
+			if pass.Name == name {
+				return pass, true
+			}
+		}
+	}
+	return Pass{}, false
+}
+
+// ParsePasses parses a comma-separated list of pass names.
+func ParsePasses(names string) ([]Pass, error) {
+	var passes []Pass
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		pass, ok := LookupPass(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown pass: %s", name)
+		}
+		passes = append(passes, pass)
+	}
+	return passes, nil
+}
+
+// RunPass runs the registered pass with the given name on the program
+// and reports the number of instructions, including terminators,
+// removed and added by it. An instruction that is moved is neither
+// removed nor added.
+func RunPass(p *ir.Program, name string) (removed, added int, err error) {
+	pass, ok := LookupPass(name)
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown pass: %s", name)
+	}
+	before := programInsts(p)
+	err = pass.Run(p)
+	after := programInsts(p)
+	for inst := range before {
+		if !after[inst] {
+			removed++
+		}
+	}
+	for inst := range after {
+		if !before[inst] {
+			added++
+		}
+	}
+	return removed, added, err
+}
+
+// programInsts returns the set of instructions and terminators in the
+// program.
+func programInsts(p *ir.Program) map[ir.Inst]bool {
+	insts := make(map[ir.Inst]bool)
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			insts[inst] = true
+		}
+		if block.Terminator != nil {
+			insts[block.Terminator] = true
+		}
+	}
+	return insts
+}
+
+// PassOptions configures how passes are run.
+type PassOptions struct {
+	DumpAfter string        // Name of pass after which to dump the IR
+	Dump      io.Writer     // Destination of IR dumps
+	Remarks   func(*Remark) // Called for each value folded, replaced, or removed by a pass
+}
+
+// RunPasses runs the passes on the program in order and returns the
+// errors reported by them.
+func RunPasses(p *ir.Program, passes []Pass, opts PassOptions) []error {
+	var errs []error
+	for _, pass := range passes {
+		var err error
+		if opts.Remarks != nil {
+			s := takeRemarkSnapshot(p)
+			err = pass.Run(p)
+			for _, r := range s.remarks(p, pass.Name) {
+				opts.Remarks(r)
+			}
+		} else {
+			err = pass.Run(p)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if opts.DumpAfter == pass.Name && opts.Dump != nil {
+			fmt.Fprintf(opts.Dump, "; IR after %s\n%s\n", pass.Name, p)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,86 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestRunPassesDumpAfter(t *testing.T) {
+	// push 3
+	// retrieve
+	// dup
+	// sub      ; folds to 0, leaving retrieve unused
+	// printi
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(3), Pos: 1},
+		{Type: ws.Retrieve, Pos: 2},
+		{Type: ws.Dup, Pos: 3},
+		{Type: ws.Sub, Pos: 4},
+		{Type: ws.Printi, Pos: 5},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	var dump strings.Builder
+	RunPasses(p, Passes, PassOptions{DumpAfter: "dce", Dump: &dump})
+	if n := strings.Count(dump.String(), "; IR after"); n != 1 {
+		t.Errorf("got %d dumps, want 1:\n%s", n, dump.String())
+	}
+	if !strings.HasPrefix(dump.String(), "; IR after dce\n") {
+		t.Errorf("dump not after dce:\n%s", dump.String())
+	}
+	if strings.Contains(dump.String(), "loadheap") {
+		t.Errorf("dead load not eliminated before dump:\n%s", dump.String())
+	}
+}
+
+func TestParsePasses(t *testing.T) {
+	passes, err := ParsePasses("fold, dce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passes) != 2 || passes[0].Name != "fold" || passes[1].Name != "dce" {
+		t.Errorf("got passes %v, want fold and dce", passes)
+	}
+	if _, err := ParsePasses("fold,nope"); err == nil {
+		t.Error("unknown pass accepted")
+	}
+}
+
+func TestRunPass(t *testing.T) {
+	// %0 = readint
+	// %1 = add %0 1 ; dead
+	// %2 = mul %0 2 ; dead
+	// printint %0
+	// exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateBinaryExpr(ir.Add, read, ir.NewIntConst(big.NewInt(1), token.NoPos), token.NoPos)
+	b.CreateBinaryExpr(ir.Mul, read, ir.NewIntConst(big.NewInt(2), token.NoPos), token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, read, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, added, err := RunPass(p, "dce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || added != 0 {
+		t.Errorf("got removed %d, added %d, want 2, 0", removed, added)
+	}
+	if _, _, err := RunPass(p, "nope"); err == nil {
+		t.Error("unknown pass accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// SimplifyPhis removes trivial phi expressions and replaces their uses
+// with the single value they select. A phi is trivial when its incoming
+// values, ignoring references to the phi itself, are all the same
+// value. Removing a phi can make phis that use it trivial, so
+// simplification repeats until no more can be removed.
+func SimplifyPhis(p *ir.Program) {
+	for changed := true; changed; {
+		changed = false
+		for _, block := range p.Blocks {
+			i := 0
+			for _, node := range block.Nodes {
+				if phi, ok := node.(*ir.PhiExpr); ok {
+					if same := trivialPhiValue(phi); same != nil {
+						phi.ReplaceUsesWith(same)
+						phi.ClearOperands()
+						changed = true
+						continue
+					}
+				}
+				block.Nodes[i] = node
+				i++
+			}
+			block.Nodes = block.Nodes[:i]
+		}
+	}
+}
+
+// trivialPhiValue returns the only value other than the phi that the
+// phi selects, or nil if the phi selects multiple values or none.
+func trivialPhiValue(phi *ir.PhiExpr) ir.Value {
+	var same ir.Value
+	for _, incoming := range phi.Values() {
+		val := incoming.Value
+		if val == phi || sameValue(val, same) {
+			continue
+		}
+		if same != nil {
+			return nil
+		}
+		same = val
+	}
+	return same
+}
+
+// sameValue returns whether two values are identical or are equal
+// constants.
+func sameValue(a, b ir.Value) bool {
+	if a == b {
+		return true
+	}
+	ca, ok1 := a.(*ir.IntConst)
+	cb, ok2 := b.(*ir.IntConst)
+	return ok1 && ok2 && ca.Int() == cb.Int()
+}
@@ -0,0 +1,61 @@
+package optimize
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestSimplifyPhis(t *testing.T) {
+	// block_0:
+	//     %r = readint
+	//     jz %r block_1 block_2
+	// block_1:
+	//     jmp block_3
+	// block_2:
+	//     fallthrough block_3
+	// block_3:
+	//     %p = phi [%r block_1] [%r block_2]
+	//     %q = phi [%p block_1] [%q block_2]
+	//     printint %p
+	//     printint %q
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	blocks := []*ir.BasicBlock{b.Block(0), b.Block(1), b.Block(2), b.Block(3)}
+	r := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, r, blocks[1], blocks[2], token.NoPos)
+	b.SetCurrentBlock(blocks[1])
+	b.CreateJmpTerm(ir.Jmp, blocks[3], token.NoPos)
+	b.SetCurrentBlock(blocks[2])
+	b.CreateJmpTerm(ir.Fallthrough, blocks[3], token.NoPos)
+	b.SetCurrentBlock(blocks[3])
+	p := b.CreatePhiExpr(token.NoPos)
+	p.AddIncoming(r, blocks[1])
+	p.AddIncoming(r, blocks[2])
+	q := b.CreatePhiExpr(token.NoPos)
+	q.AddIncoming(p, blocks[1])
+	q.AddIncoming(q, blocks[2])
+	printP := b.CreatePrintStmt(ir.PrintInt, p, token.NoPos)
+	printQ := b.CreatePrintStmt(ir.PrintInt, q, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	program, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SimplifyPhis(program)
+	if n := len(blocks[3].Nodes); n != 2 {
+		t.Errorf("got %d nodes in block_3, want 2:\n%v", n, blocks[3])
+	}
+	if def := printP.Operand(0).Def(); def != r {
+		t.Errorf("printint %%p operand is %v, want readint", def)
+	}
+	if def := printQ.Operand(0).Def(); def != r {
+		t.Errorf("printint %%q operand is %v, want readint", def)
+	}
+	if n := r.NUses(); n != 3 {
+		t.Errorf("readint has %d uses, want 3", n)
+	}
+}
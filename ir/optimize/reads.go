@@ -0,0 +1,85 @@
+package optimize
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// UnprintedReadWarning reports a read after which no print is reachable
+// on any path, which usually means input is consumed without producing
+// output.
+type UnprintedReadWarning struct {
+	Read *ir.ReadExpr
+	Pos  token.Position
+}
+
+func (w *UnprintedReadWarning) Error() string {
+	return fmt.Sprintf("warning: %s: %s is never followed by a print", w.Pos, w.Read.OpString())
+}
+
+// Diagnostic converts the warning to a diagnostic.
+func (w *UnprintedReadWarning) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Warning, Code: "unprinted-read",
+		Message: fmt.Sprintf("%s is never followed by a print", w.Read.OpString()), Pos: w.Pos}
+}
+
+// CheckUnprintedReads returns a warning for each read in the program
+// that cannot reach a print. Calls are assumed to return.
+func CheckUnprintedReads(p *ir.Program) []*UnprintedReadWarning {
+	prints := make(map[*ir.BasicBlock]bool) // whether a print is reachable from block entry
+	for _, block := range p.Blocks {
+		if hasPrint(block.Nodes) {
+			prints[block] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range p.Blocks {
+			if prints[block] {
+				continue
+			}
+			for _, succ := range block.Succs() {
+				if prints[succ] {
+					prints[block] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var warnings []*UnprintedReadWarning
+	for _, block := range p.Blocks {
+		succPrints := false
+		for _, succ := range block.Succs() {
+			if prints[succ] {
+				succPrints = true
+				break
+			}
+		}
+		for i, inst := range block.Nodes {
+			read, ok := inst.(*ir.ReadExpr)
+			if !ok || succPrints || hasPrint(block.Nodes[i+1:]) {
+				continue
+			}
+			var pos token.Position
+			if p.File != nil && read.Pos().IsValid() {
+				pos = p.File.Position(read.Pos())
+			}
+			warnings = append(warnings, &UnprintedReadWarning{read, pos})
+		}
+	}
+	return warnings
+}
+
+func hasPrint(insts []ir.Inst) bool {
+	for _, inst := range insts {
+		if _, ok := inst.(*ir.PrintStmt); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCheckUnprintedReads(t *testing.T) {
+	label := big.NewInt(1)
+	for i, test := range []struct {
+		Tokens []*ws.Token
+		Reads  int
+	}{
+		// push 0; readi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Readi},
+			{Type: ws.End},
+		}, 1},
+		// push 0; readc; push 0; retrieve; printc; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Readc},
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Retrieve},
+			{Type: ws.Printc},
+			{Type: ws.End},
+		}, 0},
+		// push 0; readc; jmp l; l: push 1; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Readc},
+			{Type: ws.Jmp, Arg: label},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, 0},
+		// push 1; printi; push 0; readc; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Readc},
+			{Type: ws.End},
+		}, 1},
+	} {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{File: file, Tokens: test.Tokens}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatalf("test %d: %v", i, errs)
+		}
+		if warnings := CheckUnprintedReads(p); len(warnings) != test.Reads {
+			t.Errorf("test %d: got warnings %v, want %d", i, warnings, test.Reads)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package optimize
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// Remark describes a change made by an optimization pass to a value,
+// so that tools can show inline where the program was optimized.
+type Remark struct {
+	Pass   string
+	Action string // "folded", "replaced", or "removed"
+	Value  string // ID of the value in the IR before the pass, such as "%3"
+	Result string // Constant or value that replaced it, if any
+	Pos    token.Position
+}
+
+func (r *Remark) message() string {
+	switch {
+	case r.Action == "folded":
+		return fmt.Sprintf("%s: %s folded to %s", r.Pass, r.Value, r.Result)
+	case r.Result != "":
+		return fmt.Sprintf("%s: %s %s with %s", r.Pass, r.Value, r.Action, r.Result)
+	}
+	return fmt.Sprintf("%s: %s %s", r.Pass, r.Value, r.Action)
+}
+
+func (r *Remark) Error() string {
+	return fmt.Sprintf("%s at %v", r.message(), r.Pos)
+}
+
+// Diagnostic converts the remark to a note, with the pass, action,
+// value, and result as structured data.
+func (r *Remark) Diagnostic() *diag.Diagnostic {
+	data := map[string]string{"pass": r.Pass, "action": r.Action, "value": r.Value}
+	if r.Result != "" {
+		data["result"] = r.Result
+	}
+	return &diag.Diagnostic{Severity: diag.Note, Code: "remark",
+		Message: r.message(), Pos: r.Pos, Data: data}
+}
+
+// remarkSnapshot records the values in a program and their uses before
+// a pass, so that the values the pass removes can be described.
+type remarkSnapshot struct {
+	f      *ir.Formatter
+	values []ir.Value
+	uses   map[ir.Value][]*ir.ValueUse
+}
+
+func takeRemarkSnapshot(p *ir.Program) *remarkSnapshot {
+	s := &remarkSnapshot{f: ir.NewFormatter(), uses: make(map[ir.Value][]*ir.ValueUse)}
+	s.f.AssignIDs(p)
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			if val, ok := inst.(ir.Value); ok {
+				s.values = append(s.values, val)
+				s.uses[val] = append([]*ir.ValueUse(nil), val.Uses()...)
+			}
+		}
+	}
+	return s
+}
+
+// remarks describes each value removed by the pass. A removed value is
+// folded when a remaining user now uses a constant in its place and
+// replaced when it uses another value.
+func (s *remarkSnapshot) remarks(p *ir.Program, pass string) []*Remark {
+	after := programInsts(p)
+	var remarks []*Remark
+	for _, val := range s.values {
+		if after[val.(ir.Inst)] {
+			continue
+		}
+		r := &Remark{Pass: pass, Action: "removed", Value: s.f.FormatValue(val)}
+		if p.File != nil {
+			r.Pos = p.File.Position(val.Pos())
+		}
+		for _, use := range s.uses[val] {
+			user, n := use.User()
+			if !after[user] || user.Operand(n) == nil {
+				continue
+			}
+			repl := user.Operand(n).Def()
+			if repl == val {
+				continue
+			}
+			r.Action = "replaced"
+			if _, ok := repl.(*ir.IntConst); ok {
+				r.Action = "folded"
+			}
+			r.Result = s.f.FormatValue(repl)
+			break
+		}
+		remarks = append(remarks, r)
+	}
+	return remarks
+}
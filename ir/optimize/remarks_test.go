@@ -0,0 +1,59 @@
+package optimize
+
+import (
+	"encoding/json"
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestRemarksFold(t *testing.T) {
+	// %0 = add 2 3
+	// printi %0
+	src := []byte("push 2\npush 3\nadd\nprinti\n")
+	file := token.NewFileSet().AddFile("test.wsa", -1, len(src))
+	file.SetLinesForContent(src)
+	addPos := file.Pos(14) // add on line 3
+	b := ir.NewBuilder(file)
+	b.InitBlocks(1)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	add := b.CreateBinaryExpr(ir.Add, c(2), c(3), addPos)
+	b.CreatePrintStmt(ir.PrintInt, add, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remarks []*Remark
+	RunPasses(p, []Pass{pass("fold", FoldConstArith)}, PassOptions{
+		Remarks: func(r *Remark) { remarks = append(remarks, r) },
+	})
+	if len(remarks) != 1 {
+		t.Fatalf("got remarks %v, want 1", remarks)
+	}
+	r := remarks[0]
+	if r.Pass != "fold" || r.Action != "folded" || r.Value != "%0" || r.Result != "5" {
+		t.Errorf("got remark %+v, want %%0 folded to 5 by fold", r)
+	}
+
+	data, err := json.Marshal(r.Diagnostic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Severity string
+		Code     string
+		Pos      struct{ Line, Column int }
+		Data     map[string]string
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Severity != "note" || got.Code != "remark" || got.Pos.Line != 3 || got.Pos.Column != 1 ||
+		got.Data["pass"] != "fold" || got.Data["action"] != "folded" || got.Data["value"] != "%0" {
+		t.Errorf("got JSON %s", data)
+	}
+}
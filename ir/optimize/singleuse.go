@@ -0,0 +1,38 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// SingleUse is the only use of a value.
+type SingleUse struct {
+	User  ir.User
+	Local bool // Whether the user is in the same block as the value
+}
+
+// SingleUseValues finds the instruction values in the program that have
+// exactly one use. A value used once within its own block can be kept
+// in a register by codegen and never needs to be stored to the stack
+// array. Constants are not included, as their uses are shared across
+// programs.
+func SingleUseValues(p *ir.Program) map[ir.Value]SingleUse {
+	blocks := make(map[ir.Inst]*ir.BasicBlock)
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			blocks[inst] = block
+		}
+		if block.Terminator != nil {
+			blocks[block.Terminator] = block
+		}
+	}
+	single := make(map[ir.Value]SingleUse)
+	for _, block := range p.Blocks {
+		for _, inst := range block.Nodes {
+			val, ok := inst.(ir.Value)
+			if !ok || val.NUses() != 1 {
+				continue
+			}
+			user, _ := val.Uses()[0].User()
+			single[val] = SingleUse{user, blocks[user] == block}
+		}
+	}
+	return single
+}
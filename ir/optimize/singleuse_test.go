@@ -0,0 +1,55 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestSingleUseValues(t *testing.T) {
+	// block_0:
+	//     %0 = readint
+	//     %1 = add %0 1
+	//     %2 = mul %0 %0
+	//     jz %2 block_1 block_1
+	// block_1:
+	//     %3 = loadstack 1
+	//     printint %3
+	//     printint %1
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(2)
+	one := ir.NewIntConst(big.NewInt(1), token.NoPos)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	add := b.CreateBinaryExpr(ir.Add, read, one, token.NoPos)
+	mul := b.CreateBinaryExpr(ir.Mul, read, read, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, mul, b.Block(1), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	load := b.CreateLoadStackExpr(1, token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, load, token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, add, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single := SingleUseValues(p)
+	if _, ok := single[read]; ok {
+		t.Error("multi-use value flagged as single-use")
+	}
+	if _, ok := single[one]; ok {
+		t.Error("constant flagged as single-use")
+	}
+	for _, test := range []struct {
+		Val   ir.Value
+		Local bool
+	}{{mul, true}, {load, true}, {add, false}} {
+		use, ok := single[test.Val]
+		if !ok || use.Local != test.Local {
+			t.Errorf("%s: got %v, %t, want single use with local %t", test.Val.(ir.Inst).OpString(), use, ok, test.Local)
+		}
+	}
+}
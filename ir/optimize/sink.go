@@ -0,0 +1,69 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// SinkStores moves stack and heap stores down past independent
+// instructions toward the block exit or the first instruction that may
+// observe them, shortening the live ranges of stored values. Stores do
+// not move past I/O, instructions that can throw, or stack offsets.
+//
+// It is opt-in, so that it does not reorder the default output.
+func SinkStores(p *ir.Program) {
+	for _, block := range p.Blocks {
+		nodes := block.Nodes
+		for i := len(nodes) - 1; i >= 0; i-- {
+			if !isStore(nodes[i]) {
+				continue
+			}
+			j := i
+			for j+1 < len(nodes) && !blocksSink(nodes[i], nodes[j+1]) {
+				j++
+			}
+			if j != i {
+				store := nodes[i]
+				copy(nodes[i:j], nodes[i+1:j+1])
+				nodes[j] = store
+			}
+		}
+	}
+}
+
+func isStore(inst ir.Inst) bool {
+	switch inst.(type) {
+	case *ir.StoreStackStmt, *ir.StoreHeapStmt:
+		return true
+	}
+	return false
+}
+
+// blocksSink returns whether store cannot be moved past inst.
+func blocksSink(store, inst ir.Inst) bool {
+	if Dependent(store, inst) || isIO(inst) || canThrow(inst) {
+		return true
+	}
+	switch inst := inst.(type) {
+	case *ir.FlushStmt, *ir.OffsetStackStmt, *ir.AccessStackStmt:
+		return true
+	case *ir.LoadStackExpr:
+		s, ok := store.(*ir.StoreStackStmt)
+		return ok && s.StackPos == inst.StackPos
+	case *ir.StoreStackStmt:
+		s, ok := store.(*ir.StoreStackStmt)
+		return ok && s.StackPos == inst.StackPos
+	case *ir.LoadHeapExpr:
+		s, ok := store.(*ir.StoreHeapStmt)
+		return ok && mayAlias(s.Operand(0).Def(), inst.Operand(0).Def())
+	case *ir.StoreHeapStmt:
+		s, ok := store.(*ir.StoreHeapStmt)
+		return ok && mayAlias(s.Operand(0).Def(), inst.Operand(0).Def())
+	}
+	return false
+}
+
+// mayAlias returns whether two heap addresses may be equal. Only
+// distinct constants are known not to alias.
+func mayAlias(a, b ir.Value) bool {
+	ca, ok1 := a.(*ir.IntConst)
+	cb, ok2 := b.(*ir.IntConst)
+	return !ok1 || !ok2 || ca.Int().Cmp(cb.Int()) == 0
+}
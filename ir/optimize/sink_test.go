@@ -0,0 +1,50 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestSinkStores(t *testing.T) {
+	// storeheap 0 %0
+	// %1 = add %0 1
+	// %2 = mul %1 2
+	// %3 = loadheap 1
+	// %4 = loadheap 0
+	// storeheap 1 %2
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	store := b.CreateStoreHeapStmt(c(0), read, token.NoPos)
+	add := b.CreateBinaryExpr(ir.Add, read, c(1), token.NoPos)
+	mul := b.CreateBinaryExpr(ir.Mul, add, c(2), token.NoPos)
+	load1 := b.CreateLoadHeapExpr(c(1), token.NoPos)
+	load0 := b.CreateLoadHeapExpr(c(0), token.NoPos)
+	b.CreateStoreHeapStmt(c(1), mul, token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, load0, token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, load1, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SinkStores(p)
+	nodes := p.Blocks[0].Nodes
+	var i int
+	for i = range nodes {
+		if nodes[i] == store {
+			break
+		}
+	}
+	if i == 0 || nodes[i-1] != load1 || nodes[i+1] != load0 {
+		t.Errorf("store not sunk past arithmetic to its load:\n%v", p)
+	}
+	if _, ok := nodes[i+2].(*ir.StoreHeapStmt); !ok {
+		t.Errorf("store to 1 moved past print:\n%v", p)
+	}
+}
@@ -0,0 +1,67 @@
+package optimize
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// StackBoundsError reports a stack access that exceeds the stack length
+// guaranteed on some path to it.
+type StackBoundsError struct {
+	Inst  ir.Inst
+	Pos   token.Position
+	Depth uint // Stack length required by the access
+	Min   uint // Minimum stack length guaranteed at the access
+}
+
+func (err *StackBoundsError) Error() string {
+	return fmt.Sprintf("%s: %s requires stack length %d, but may be %d", err.Pos, err.Inst.OpString(), err.Depth, err.Min)
+}
+
+// Diagnostic converts the error to a diagnostic. The bound is
+// conservative, so it is a warning.
+func (err *StackBoundsError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Warning, Code: "stack-bounds",
+		Message: fmt.Sprintf("%s requires stack length %d, but may be %d", err.Inst.OpString(), err.Depth, err.Min), Pos: err.Pos}
+}
+
+// CheckStackBounds verifies that each stack access, such as those from
+// copy, is within the stack length guaranteed on all paths to it, as
+// computed by ir.Program.MinStackDepths.
+func CheckStackBounds(p *ir.Program) []*StackBoundsError {
+	depths := p.MinStackDepths()
+	var errs []*StackBoundsError
+	for _, block := range p.Blocks {
+		depth, ok := depths[block]
+		if !ok {
+			continue
+		}
+		offset := 0
+		for _, inst := range block.Nodes {
+			var n uint
+			switch inst := inst.(type) {
+			case *ir.AccessStackStmt:
+				n = inst.StackSize
+			case *ir.LoadStackExpr:
+				n = inst.StackPos
+			case *ir.OffsetStackStmt:
+				offset += inst.Offset
+				continue
+			default:
+				continue
+			}
+			if d := int(n) - offset; d > int(depth) {
+				var pos token.Position
+				if p.File != nil && inst.Pos().IsValid() {
+					pos = p.File.Position(inst.Pos())
+				}
+				errs = append(errs, &StackBoundsError{inst, pos, uint(d), depth})
+				depth = uint(d) // report each shortfall once
+			}
+		}
+	}
+	return errs
+}
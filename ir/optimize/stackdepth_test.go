@@ -0,0 +1,83 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCheckStackBounds(t *testing.T) {
+	label := big.NewInt(1)
+	for i, test := range []struct {
+		Tokens []*ws.Token
+		Errs   []uint // Required depths of reported accesses
+	}{
+		// push 1; copy 3; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Copy, Arg: big.NewInt(3)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, []uint{3}},
+		// push 1; push 2; copy 1; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Push, Arg: big.NewInt(2)},
+			{Type: ws.Copy, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, nil},
+		// push 1; push 0; jz l; push 2; l: copy 1; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Jz, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(2)},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Copy, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, []uint{2}},
+		// push 1; push 2; call f; copy 1; printi; end; f: drop; ret
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Push, Arg: big.NewInt(2)},
+			{Type: ws.Call, Arg: label},
+			{Type: ws.Copy, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Drop},
+			{Type: ws.Ret},
+		}, []uint{2}},
+		// call f; copy 1; printi; end; f: push 1; push 2; ret
+		{[]*ws.Token{
+			{Type: ws.Call, Arg: label},
+			{Type: ws.Copy, Arg: big.NewInt(1)},
+			{Type: ws.Printi},
+			{Type: ws.End},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Push, Arg: big.NewInt(2)},
+			{Type: ws.Ret},
+		}, nil},
+	} {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{File: file, Tokens: test.Tokens}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatalf("test %d: %v", i, errs)
+		}
+		boundsErrs := CheckStackBounds(p)
+		if len(boundsErrs) != len(test.Errs) {
+			t.Errorf("test %d: got errors %v, want depths %v", i, boundsErrs, test.Errs)
+			continue
+		}
+		for j, err := range boundsErrs {
+			if err.Depth != test.Errs[j] {
+				t.Errorf("test %d: got error %v, want depth %d", i, err, test.Errs[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// InsertStackPhis makes the values transferred between blocks through
+// the stack explicit as phis, without promoting them out of the stack.
+// At each block with multiple entries, a phi is inserted for each slot
+// of the entry stack that the block loads before writing and that every
+// entry stores, joining the stored values. The loads and stores are
+// kept, so each phi equals the load of its slot and is otherwise
+// unused. This shows the SSA form that PropagateStackValues constructs,
+// for reading and for checking that pass.
+func InsertStackPhis(p *ir.Program) {
+	exits := make(map[*ir.BasicBlock]map[uint]*ir.StoreStackStmt)
+	for _, block := range p.Blocks {
+		if len(block.Entries) < 2 {
+			continue
+		}
+		var phis []ir.Inst
+		slots := make(map[uint]bool)
+		for _, l := range entryStackLoads(block) {
+			if slots[l.slot] {
+				continue
+			}
+			slots[l.slot] = true
+			vals := make([]ir.Value, len(block.Entries))
+			for i, pred := range block.Entries {
+				if pred == nil {
+					vals = nil
+					break
+				}
+				stores, ok := exits[pred]
+				if !ok {
+					stores = exitStackStores(pred)
+					exits[pred] = stores
+				}
+				store, ok := stores[l.slot]
+				if !ok {
+					vals = nil
+					break
+				}
+				vals[i] = store.Operand(0).Def()
+			}
+			if vals == nil {
+				continue
+			}
+			phi := ir.NewPhiExpr(l.load.Pos())
+			for i, pred := range block.Entries {
+				phi.AddIncoming(vals[i], pred)
+			}
+			phis = append(phis, phi)
+		}
+		if len(phis) != 0 {
+			block.Nodes = append(phis, block.Nodes...)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestInsertStackPhis(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     jz %0 block_1 block_2
+	// block_1:
+	//     offsetstack 1
+	//     storestack 1 1
+	//     jmp block_3
+	// block_2:
+	//     offsetstack 1
+	//     storestack 1 2
+	//     jmp block_3
+	// block_3:
+	//     %1 = loadstack 1
+	//     printi %1
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read, b.Block(1), b.Block(2), token.NoPos)
+	for i := 1; i <= 2; i++ {
+		b.SetCurrentBlock(b.Block(i))
+		b.CreateOffsetStackStmt(1, token.NoPos)
+		b.CreateStoreStackStmt(1, c(int64(i)), token.NoPos)
+		b.CreateJmpTerm(ir.Jmp, b.Block(3), token.NoPos)
+	}
+	b.SetCurrentBlock(b.Block(3))
+	load := b.CreateLoadStackExpr(1, token.NoPos)
+	print := b.CreatePrintStmt(ir.PrintInt, load, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	InsertStackPhis(p)
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	merge := p.Blocks[3]
+	if len(merge.Nodes) != 3 {
+		t.Fatalf("got %d instructions in merge block, want phi, load, and print:\n%v", len(merge.Nodes), p)
+	}
+	phi, ok := merge.Nodes[0].(*ir.PhiExpr)
+	if !ok || len(phi.Values()) != 2 {
+		t.Fatalf("phi not inserted at merge block:\n%v", p)
+	}
+	if merge.Nodes[1] != load || print.Operand(0).Def() != load {
+		t.Errorf("stack load not kept:\n%v", p)
+	}
+	for _, block := range p.Blocks[:3] {
+		if strings.Contains(block.String(), "phi") {
+			t.Errorf("phi inserted at %s with a single entry:\n%v", block.Name(), p)
+		}
+	}
+	want := "%1 = phi [1 block_1] [2 block_2]\n"
+	if got := ir.NewFormatter().FormatProgram(p); !strings.Contains(got, want) {
+		t.Errorf("phi not listed at merge block, want %q in:\n%s", want, got)
+	}
+}
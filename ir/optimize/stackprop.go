@@ -0,0 +1,200 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// PropagateStackValues forwards values stored to the stack at the end
+// of a block to loads of the same slot in its successors. When every
+// entry to a block stores a slot that the block loads before writing,
+// the load is replaced with the stored value, joined by a phi when the
+// block has multiple entries. A store is then removed when every
+// successor reads it only through forwarded loads and pops or
+// overwrites the slot, so that the value is never read from the stack.
+// Stores before calls and returns are kept.
+//
+// Like PromoteHeapScalars, it is not run by default, because forwarded
+// values are used across blocks.
+func PropagateStackValues(p *ir.Program) {
+	exits := make(map[*ir.BasicBlock]map[uint]*ir.StoreStackStmt, len(p.Blocks))
+	for _, block := range p.Blocks {
+		exits[block] = exitStackStores(block)
+	}
+
+	replaced := make(map[*ir.LoadStackExpr]ir.Value)
+	var phis []*ir.PhiExpr
+	for _, block := range p.Blocks {
+		loads := entryStackLoads(block)
+		if len(loads) == 0 || len(block.Entries) == 0 {
+			continue
+		}
+		for _, l := range loads {
+			vals := make([]ir.Value, len(block.Entries))
+			for i, pred := range block.Entries {
+				if pred == nil {
+					vals = nil
+					break
+				}
+				store, ok := exits[pred][l.slot]
+				if !ok {
+					vals = nil
+					break
+				}
+				vals[i] = store.Operand(0).Def()
+			}
+			if vals == nil {
+				continue
+			}
+			same := vals[0]
+			for _, val := range vals[1:] {
+				if !sameValue(val, same) {
+					same = nil
+					break
+				}
+			}
+			if same == nil || block.Entries[0] == block {
+				phi := ir.NewPhiExpr(l.load.Pos())
+				for i, pred := range block.Entries {
+					phi.AddIncoming(vals[i], pred)
+				}
+				block.Nodes = append([]ir.Inst{phi}, block.Nodes...)
+				phis = append(phis, phi)
+				same = phi
+			}
+			replaced[l.load] = same
+		}
+	}
+
+	for load := range replaced {
+		val, ok := resolveStackValue(load, replaced)
+		if !ok {
+			delete(replaced, load)
+			continue
+		}
+		load.ReplaceUsesWith(val)
+	}
+	for _, block := range p.Blocks {
+		removeInsts(block, func(inst ir.Inst) bool {
+			load, ok := inst.(*ir.LoadStackExpr)
+			return ok && replaced[load] != nil
+		})
+	}
+
+	for _, block := range p.Blocks {
+		switch block.Terminator.(type) {
+		case *ir.JmpTerm, *ir.JmpCondTerm:
+		default:
+			continue
+		}
+		dead := make(map[*ir.StoreStackStmt]bool)
+		for slot, store := range exits[block] {
+			if stackSlotDead(block.Terminator.Succs(), slot) {
+				dead[store] = true
+			}
+		}
+		removeInsts(block, func(inst ir.Inst) bool {
+			store, ok := inst.(*ir.StoreStackStmt)
+			if ok && dead[store] {
+				store.ClearOperands()
+			}
+			return ok && dead[store]
+		})
+	}
+	if len(phis) != 0 {
+		SimplifyPhis(p)
+	}
+}
+
+// exitStackStores returns the stores in the block that determine the
+// stack slots on exit, keyed by position relative to the exit stack.
+func exitStackStores(block *ir.BasicBlock) map[uint]*ir.StoreStackStmt {
+	stores := make(map[uint]*ir.StoreStackStmt)
+	for _, inst := range block.Nodes {
+		switch inst := inst.(type) {
+		case *ir.StoreStackStmt:
+			stores[inst.StackPos] = inst
+		case *ir.OffsetStackStmt:
+			shifted := make(map[uint]*ir.StoreStackStmt, len(stores))
+			for slot, store := range stores {
+				if s := int(slot) + inst.Offset; s > 0 {
+					shifted[uint(s)] = store
+				}
+			}
+			stores = shifted
+		}
+	}
+	return stores
+}
+
+// stackLoad is a load of a slot of the stack on entry to a block.
+type stackLoad struct {
+	load *ir.LoadStackExpr
+	slot uint // Position relative to the entry stack
+}
+
+// entryStackLoads returns the loads in the block that read slots of the
+// entry stack that the block has not yet written.
+func entryStackLoads(block *ir.BasicBlock) []stackLoad {
+	var loads []stackLoad
+	written := make(map[int]bool)
+	offset := 0
+	for _, inst := range block.Nodes {
+		switch inst := inst.(type) {
+		case *ir.LoadStackExpr:
+			if slot := int(inst.StackPos) - offset; slot > 0 && !written[slot] {
+				loads = append(loads, stackLoad{inst, uint(slot)})
+			}
+		case *ir.StoreStackStmt:
+			written[int(inst.StackPos)-offset] = true
+		case *ir.OffsetStackStmt:
+			offset += inst.Offset
+		}
+	}
+	return loads
+}
+
+// resolveStackValue follows forwarded loads to the value that replaces
+// load. It returns false for a cycle of loads, which can only occur in
+// unreachable blocks.
+func resolveStackValue(load *ir.LoadStackExpr, replaced map[*ir.LoadStackExpr]ir.Value) (ir.Value, bool) {
+	seen := map[*ir.LoadStackExpr]bool{load: true}
+	val := replaced[load]
+	for {
+		next, ok := val.(*ir.LoadStackExpr)
+		if !ok || replaced[next] == nil {
+			return val, true
+		}
+		if seen[next] {
+			return nil, false
+		}
+		seen[next] = true
+		val = replaced[next]
+	}
+}
+
+// stackSlotDead returns whether no successor reads a slot of its entry
+// stack from the stack and every successor pops or overwrites it.
+func stackSlotDead(succs []*ir.BasicBlock, slot uint) bool {
+	for _, succ := range succs {
+		if succ == nil || succ.StackEffect().Pops < slot {
+			return false
+		}
+		for _, l := range entryStackLoads(succ) {
+			if l.slot == slot {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// removeInsts removes the instructions in the block for which remove
+// returns true.
+func removeInsts(block *ir.BasicBlock, remove func(inst ir.Inst) bool) {
+	i := 0
+	for _, inst := range block.Nodes {
+		if !remove(inst) {
+			block.Nodes[i] = inst
+			i++
+		}
+	}
+	block.Nodes = block.Nodes[:i]
+}
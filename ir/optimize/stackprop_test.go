@@ -0,0 +1,100 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestPropagateStackValues(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     offsetstack 1
+	//     storestack 1 %0
+	//     jmp block_1
+	// block_1:
+	//     %1 = loadstack 1
+	//     offsetstack -1
+	//     printi %1
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(2)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateOffsetStackStmt(1, token.NoPos)
+	b.CreateStoreStackStmt(1, read, token.NoPos)
+	b.CreateJmpTerm(ir.Jmp, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	load := b.CreateLoadStackExpr(1, token.NoPos)
+	b.CreateOffsetStackStmt(-1, token.NoPos)
+	print := b.CreatePrintStmt(ir.PrintInt, load, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	PropagateStackValues(p)
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	if print.Operand(0).Def() != read {
+		t.Errorf("stored value not used directly in successor:\n%v", p)
+	}
+	if len(p.Blocks[0].Nodes) != 2 || len(p.Blocks[1].Nodes) != 2 {
+		t.Errorf("store and load not removed:\n%v", p)
+	}
+}
+
+func TestPropagateStackValuesPhi(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     jz %0 block_1 block_2
+	// block_1:
+	//     offsetstack 1
+	//     storestack 1 1
+	//     jmp block_3
+	// block_2:
+	//     offsetstack 1
+	//     storestack 1 2
+	//     jmp block_3
+	// block_3:
+	//     %1 = loadstack 1
+	//     printi %1
+	//     exit
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(4)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(ir.Jz, read, b.Block(1), b.Block(2), token.NoPos)
+	for i := 1; i <= 2; i++ {
+		b.SetCurrentBlock(b.Block(i))
+		b.CreateOffsetStackStmt(1, token.NoPos)
+		b.CreateStoreStackStmt(1, c(int64(i)), token.NoPos)
+		b.CreateJmpTerm(ir.Jmp, b.Block(3), token.NoPos)
+	}
+	b.SetCurrentBlock(b.Block(3))
+	load := b.CreateLoadStackExpr(1, token.NoPos)
+	print := b.CreatePrintStmt(ir.PrintInt, load, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	PropagateStackValues(p)
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	phi, ok := print.Operand(0).Def().(*ir.PhiExpr)
+	if !ok || len(phi.Values()) != 2 {
+		t.Fatalf("load not replaced with phi:\n%v", p)
+	}
+	// Block 3 does not pop the slot, so the stores are kept.
+	for _, block := range p.Blocks[1:3] {
+		if len(block.Nodes) != 2 {
+			t.Errorf("store removed from %s with live slot:\n%v", block.Name(), p)
+		}
+	}
+}
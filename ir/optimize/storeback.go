@@ -0,0 +1,60 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// RemoveStoreBacks removes heap stores that write back the value just
+// loaded from the same address, such as from retrieve followed by store
+// with no change in between. The store is a no-op when no store that
+// may alias the address intervenes between the load and the store.
+//
+// It is not run by default, as RemoveDuplicateStores subsumes it.
+func RemoveStoreBacks(p *ir.Program) {
+	for _, block := range p.Blocks {
+		i := 0
+		for j, node := range block.Nodes {
+			if store, ok := node.(*ir.StoreHeapStmt); ok && isStoreBack(store, block.Nodes[:j]) {
+				store.ClearOperands()
+				continue
+			}
+			block.Nodes[i] = node
+			i++
+		}
+		block.Nodes = block.Nodes[:i]
+	}
+}
+
+// isStoreBack returns whether store writes the value of a load from the
+// same address in prev that is not clobbered before the store.
+func isStoreBack(store *ir.StoreHeapStmt, prev []ir.Inst) bool {
+	load, ok := store.Operand(1).Def().(*ir.LoadHeapExpr)
+	if !ok {
+		return false
+	}
+	addr := store.Operand(0).Def()
+	if !mustAlias(addr, load.Operand(0).Def()) {
+		return false
+	}
+	for i := len(prev) - 1; i >= 0; i-- {
+		switch inst := prev[i].(type) {
+		case *ir.LoadHeapExpr:
+			if inst == load {
+				return true
+			}
+		case *ir.StoreHeapStmt:
+			if mayAlias(addr, inst.Operand(0).Def()) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// mustAlias returns whether two heap addresses are known to be equal.
+func mustAlias(a, b ir.Value) bool {
+	if a == b {
+		return true
+	}
+	ca, ok1 := a.(*ir.IntConst)
+	cb, ok2 := b.(*ir.IntConst)
+	return ok1 && ok2 && ca.Int().Cmp(cb.Int()) == 0
+}
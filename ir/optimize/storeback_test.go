@@ -0,0 +1,44 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestRemoveStoreBacks(t *testing.T) {
+	// %0 = loadheap 5
+	// printi %0
+	// storeheap 5 %0
+	// %1 = loadheap 6
+	// storeheap %r %0
+	// storeheap 6 %1
+	b := ir.NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	c := func(n int64) *ir.IntConst { return ir.NewIntConst(big.NewInt(n), token.NoPos) }
+	load5 := b.CreateLoadHeapExpr(c(5), token.NoPos)
+	b.CreatePrintStmt(ir.PrintInt, load5, token.NoPos)
+	b.CreateStoreHeapStmt(c(5), load5, token.NoPos)
+	load6 := b.CreateLoadHeapExpr(c(6), token.NoPos)
+	read := b.CreateReadExpr(ir.ReadInt, token.NoPos)
+	clobber := b.CreateStoreHeapStmt(read, load5, token.NoPos)
+	kept := b.CreateStoreHeapStmt(c(6), load6, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RemoveStoreBacks(p)
+	var stores []ir.Inst
+	for _, node := range p.Blocks[0].Nodes {
+		if _, ok := node.(*ir.StoreHeapStmt); ok {
+			stores = append(stores, node)
+		}
+	}
+	if len(stores) != 2 || stores[0] != clobber || stores[1] != kept {
+		t.Errorf("store back to 5 not removed or clobbered store to 6 removed:\n%v", p)
+	}
+}
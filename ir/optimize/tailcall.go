@@ -0,0 +1,54 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// MarkTailCalls converts calls in tail position into jumps to the
+// callee, so that the callee returns directly to the caller of the
+// calling block and the call stack does not grow. This generalizes
+// TailRecursionToLoop to calls between subroutines, such as mutual
+// recursion. A call is in tail position when the block it returns to
+// only returns and is entered only through that call. Calls that may
+// be reached without a caller are kept, so that their call stack
+// underflow is reported at the same ret. Any error from reconnecting
+// the blocks is returned.
+//
+// It is not run by default, since it changes the call stack depth at
+// which compiled programs overflow.
+func MarkTailCalls(p *ir.Program) error {
+	refs := make(map[*ir.BasicBlock]int)
+	for _, block := range p.Blocks {
+		for _, succ := range block.Terminator.Succs() {
+			refs[succ]++
+		}
+	}
+	changed := false
+	for _, block := range p.Blocks {
+		call, ok := block.Terminator.(*ir.CallTerm)
+		if !ok {
+			continue
+		}
+		next := call.Succ(1)
+		if !isRetBlock(next) || refs[next] != 1 || hasEntryCaller(block) {
+			continue
+		}
+		block.Terminator = ir.NewJmpTerm(ir.Jmp, call.Succ(0), call.Pos())
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	err := p.Reconnect()
+	p.TrimUnreachable()
+	return err
+}
+
+// hasEntryCaller returns whether the block may execute outside of any
+// call.
+func hasEntryCaller(block *ir.BasicBlock) bool {
+	for _, caller := range block.Callers {
+		if caller == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package optimize
+
+import (
+	"bytes"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir/interp"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestMarkTailCalls(t *testing.T) {
+	//     push 7
+	//     call even
+	//     printi
+	//     end
+	// even:
+	//     dup
+	//     jz yes
+	//     push 1
+	//     sub
+	//     call odd
+	//     ret
+	// odd:
+	//     dup
+	//     jz no
+	//     push 1
+	//     sub
+	//     call even
+	//     ret
+	// yes:
+	//     drop
+	//     push 1
+	//     ret
+	// no:
+	//     drop
+	//     push 0
+	//     ret
+	even, odd, yes, no := big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(7)},
+		{Type: ws.Call, Arg: even},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	for _, sub := range []struct{ Label, Other, Base *big.Int }{{even, odd, yes}, {odd, even, no}} {
+		tokens = append(tokens,
+			&ws.Token{Type: ws.Label, Arg: sub.Label},
+			&ws.Token{Type: ws.Dup},
+			&ws.Token{Type: ws.Jz, Arg: sub.Base},
+			&ws.Token{Type: ws.Push, Arg: big.NewInt(1)},
+			&ws.Token{Type: ws.Sub},
+			&ws.Token{Type: ws.Call, Arg: sub.Other},
+			&ws.Token{Type: ws.Ret})
+	}
+	for i, base := range []*big.Int{yes, no} {
+		tokens = append(tokens,
+			&ws.Token{Type: ws.Label, Arg: base},
+			&ws.Token{Type: ws.Drop},
+			&ws.Token{Type: ws.Push, Arg: big.NewInt(int64(1 - i))},
+			&ws.Token{Type: ws.Ret})
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	p.TrimUnreachable()
+	if calls := countCalls(p); calls != 3 {
+		t.Fatalf("got %d calls before, want 3", calls)
+	}
+
+	// Mutual recursion is not converted by TailRecursionToLoop.
+	if err := TailRecursionToLoop(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkTailCalls(p); err != nil {
+		t.Fatal(err)
+	}
+	if calls := countCalls(p); calls != 1 {
+		t.Errorf("got %d calls after, want 1\n%v", calls, p)
+	}
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Fatalf("invalid IR: %v\n%v", errs, p)
+	}
+	var out bytes.Buffer
+	if err := interp.Run(p, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "0" {
+		t.Errorf("got output %q, want %q", out.String(), "0")
+	}
+}
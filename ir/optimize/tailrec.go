@@ -0,0 +1,87 @@
+package optimize
+
+import "github.com/andrewarchi/nebula/ir"
+
+// TailRecursionToLoop converts self-recursive calls in tail position
+// into jumps to the start of the subroutine, so that the recursion
+// runs as a loop without growing the call stack. A call is in tail
+// position when the block it returns to only returns. Subroutines with
+// any self-recursive call not in tail position are left unchanged.
+// Calls into the subroutine from outside it are preserved.
+//
+// It is not run by default, as MarkTailCalls subsumes it.
+func TailRecursionToLoop(p *ir.Program) error {
+	changed := false
+	for _, callee := range callees(p) {
+		var tailCalls []*ir.BasicBlock
+		tail := true
+		for _, block := range subroutineBody(callee) {
+			if call, ok := block.Terminator.(*ir.CallTerm); ok && call.Succ(0) == callee {
+				if !isRetBlock(call.Succ(1)) {
+					tail = false
+					break
+				}
+				tailCalls = append(tailCalls, block)
+			}
+		}
+		if !tail {
+			continue
+		}
+		for _, block := range tailCalls {
+			call := block.Terminator.(*ir.CallTerm)
+			block.Terminator = ir.NewJmpTerm(ir.Jmp, callee, call.Pos())
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	err := p.Reconnect()
+	p.TrimUnreachable()
+	return err
+}
+
+// callees returns the blocks called by call terminators, in order of
+// first call.
+func callees(p *ir.Program) []*ir.BasicBlock {
+	var blocks []*ir.BasicBlock
+	seen := make(map[*ir.BasicBlock]bool)
+	for _, block := range p.Blocks {
+		if call, ok := block.Terminator.(*ir.CallTerm); ok && !seen[call.Succ(0)] {
+			seen[call.Succ(0)] = true
+			blocks = append(blocks, call.Succ(0))
+		}
+	}
+	return blocks
+}
+
+// subroutineBody returns the blocks reachable from the subroutine
+// entry without returning. Calls are followed to the block that the
+// callee returns to, rather than into the callee.
+func subroutineBody(entry *ir.BasicBlock) []*ir.BasicBlock {
+	visited := map[*ir.BasicBlock]bool{entry: true}
+	body := []*ir.BasicBlock{entry}
+	for i := 0; i < len(body); i++ {
+		var succs []*ir.BasicBlock
+		switch term := body[i].Terminator.(type) {
+		case *ir.CallTerm:
+			succs = term.Succs()[1:]
+		case *ir.JmpTerm, *ir.JmpCondTerm:
+			succs = term.Succs()
+		}
+		for _, succ := range succs {
+			if !visited[succ] {
+				visited[succ] = true
+				body = append(body, succ)
+			}
+		}
+	}
+	return body
+}
+
+// isRetBlock returns whether the block has no instructions other than a
+// ret terminator.
+func isRetBlock(block *ir.BasicBlock) bool {
+	_, ok := block.Terminator.(*ir.RetTerm)
+	return ok && len(block.Nodes) == 0
+}
@@ -0,0 +1,100 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestTailRecursionToLoop(t *testing.T) {
+	//     push 5
+	//     push 1
+	//     call fact
+	//     printi
+	//     end
+	// fact:         ; n acc
+	//     copy 1
+	//     jz done
+	//     copy 1
+	//     mul       ; n acc*n
+	//     swap
+	//     push 1
+	//     sub
+	//     swap      ; n-1 acc*n
+	//     call fact
+	//     ret
+	// done:
+	//     slide 1
+	//     ret
+	fact, done := big.NewInt(1), big.NewInt(2)
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(5)},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Call, Arg: fact},
+		{Type: ws.Printi},
+		{Type: ws.End},
+		{Type: ws.Label, Arg: fact},
+		{Type: ws.Copy, Arg: big.NewInt(1)},
+		{Type: ws.Jz, Arg: done},
+		{Type: ws.Copy, Arg: big.NewInt(1)},
+		{Type: ws.Mul},
+		{Type: ws.Swap},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Sub},
+		{Type: ws.Swap},
+		{Type: ws.Call, Arg: fact},
+		{Type: ws.Ret},
+		{Type: ws.Label, Arg: done},
+		{Type: ws.Slide, Arg: big.NewInt(1)},
+		{Type: ws.Ret},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p, errs := (&ws.Program{File: file, Tokens: tokens}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	p.TrimUnreachable()
+	if calls := countCalls(p); calls != 2 {
+		t.Fatalf("got %d calls before, want 2", calls)
+	}
+
+	if err := TailRecursionToLoop(p); err != nil {
+		t.Fatal(err)
+	}
+	if calls := countCalls(p); calls != 1 {
+		t.Errorf("got %d calls after, want 1\n%v", calls, p)
+	}
+	var factBlock *ir.BasicBlock
+	for _, block := range p.Blocks {
+		if call, ok := block.Terminator.(*ir.CallTerm); ok {
+			factBlock = call.Succ(0)
+		}
+	}
+	looped := false
+	for _, entry := range factBlock.Entries {
+		if jmp, ok := entry.Terminator.(*ir.JmpTerm); ok && jmp.Op == ir.Jmp {
+			looped = true
+		}
+	}
+	if !looped {
+		t.Errorf("%s has no back edge\n%v", factBlock.Name(), p)
+	}
+	for _, block := range p.Blocks {
+		if isRetBlock(block) && len(block.Entries) == 0 {
+			t.Errorf("unreachable block %s not removed", block.Name())
+		}
+	}
+}
+
+func countCalls(p *ir.Program) int {
+	calls := 0
+	for _, block := range p.Blocks {
+		if _, ok := block.Terminator.(*ir.CallTerm); ok {
+			calls++
+		}
+	}
+	return calls
+}
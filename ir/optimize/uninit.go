@@ -0,0 +1,170 @@
+package optimize
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// UninitializedLoadWarning reports a load of a heap cell that is not
+// stored on some path to it. The heap is zero-initialized, both in the
+// interpreter and in LLVM codegen, so the load reads 0. This is
+// well-defined, but is sometimes unintended.
+type UninitializedLoadWarning struct {
+	Load *ir.LoadHeapExpr
+	Addr *big.Int
+	Pos  token.Position
+}
+
+func (w *UninitializedLoadWarning) Error() string {
+	return fmt.Sprintf("warning: %s: %s", w.Pos, w.message())
+}
+
+func (w *UninitializedLoadWarning) message() string {
+	return fmt.Sprintf("%s of %s may read the zero-initialized heap before any store", w.Load.OpString(), w.Addr)
+}
+
+// Diagnostic converts the warning to a diagnostic.
+func (w *UninitializedLoadWarning) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Warning, Code: "uninitialized-load",
+		Message: w.message(), Pos: w.Pos}
+}
+
+// storedCells is the set of constant heap addresses stored on every
+// path to a point. When all is set, every cell is considered stored,
+// such as after a store to a dynamic address, which may store to any
+// cell.
+type storedCells struct {
+	all   bool
+	cells map[string]bool // keyed by decimal address
+}
+
+func (s storedCells) has(addr string) bool {
+	return s.all || s.cells[addr]
+}
+
+// meet intersects two sets.
+func (s storedCells) meet(t storedCells) storedCells {
+	if s.all {
+		return t
+	}
+	if t.all {
+		return s
+	}
+	cells := make(map[string]bool)
+	for addr := range s.cells {
+		if t.cells[addr] {
+			cells[addr] = true
+		}
+	}
+	return storedCells{cells: cells}
+}
+
+func (s storedCells) equal(t storedCells) bool {
+	if s.all || t.all {
+		return s.all == t.all
+	}
+	if len(s.cells) != len(t.cells) {
+		return false
+	}
+	for addr := range s.cells {
+		if !t.cells[addr] {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckUninitializedLoads returns a warning for each load of a constant
+// heap address that may execute before any store to that cell. Loads of
+// dynamic addresses are not checked, and stores to dynamic addresses
+// are assumed to store to every cell, so that only definite reliance
+// on zero-initialization is reported.
+func CheckUninitializedLoads(p *ir.Program) []*UninitializedLoadWarning {
+	if p.Entry == nil {
+		return nil
+	}
+	entries := map[*ir.BasicBlock]storedCells{p.Entry: {cells: map[string]bool{}}}
+	exits := make(map[*ir.BasicBlock]storedCells)
+	for changed := true; changed; {
+		changed = false
+		for _, block := range p.Blocks {
+			in, ok := entries[block]
+			if !ok {
+				continue // not yet reached
+			}
+			out := transferStores(block, in, nil)
+			if prev, ok := exits[block]; ok && prev.equal(out) {
+				continue
+			}
+			exits[block] = out
+			for _, succ := range block.Succs() {
+				if succ == nil {
+					continue
+				}
+				next := out
+				if prev, ok := entries[succ]; ok {
+					next = prev.meet(out)
+					if next.equal(prev) {
+						continue
+					}
+				}
+				entries[succ] = next
+				changed = true
+			}
+		}
+	}
+
+	var warnings []*UninitializedLoadWarning
+	for _, block := range p.Blocks {
+		if in, ok := entries[block]; ok {
+			transferStores(block, in, func(load *ir.LoadHeapExpr) {
+				var pos token.Position
+				if p.File != nil && load.Pos().IsValid() {
+					pos = p.File.Position(load.Pos())
+				}
+				addr := load.Operand(0).Def().(*ir.IntConst).Int()
+				warnings = append(warnings, &UninitializedLoadWarning{load, addr, pos})
+			})
+		}
+	}
+	return warnings
+}
+
+// transferStores computes the cells stored at the exit of a block,
+// given those stored at its entry, and calls uninit, if non-nil, for
+// each load of a constant address not yet stored.
+func transferStores(block *ir.BasicBlock, in storedCells, uninit func(*ir.LoadHeapExpr)) storedCells {
+	out := in
+	copied := false
+	for _, inst := range block.Nodes {
+		switch inst := inst.(type) {
+		case *ir.LoadHeapExpr:
+			if c, ok := inst.Operand(0).Def().(*ir.IntConst); ok && !out.has(c.Int().String()) && uninit != nil {
+				uninit(inst)
+			}
+		case *ir.StoreHeapStmt:
+			c, ok := inst.Operand(0).Def().(*ir.IntConst)
+			if !ok {
+				out = storedCells{all: true}
+				continue
+			}
+			if out.has(c.Int().String()) {
+				continue
+			}
+			if !copied {
+				cells := make(map[string]bool, len(out.cells)+1)
+				for addr := range out.cells {
+					cells[addr] = true
+				}
+				out = storedCells{cells: cells}
+				copied = true
+			}
+			out.cells[c.Int().String()] = true
+		}
+	}
+	return out
+}
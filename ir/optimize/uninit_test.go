@@ -0,0 +1,76 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCheckUninitializedLoads(t *testing.T) {
+	label := big.NewInt(1)
+	for i, test := range []struct {
+		Tokens []*ws.Token
+		Loads  int
+	}{
+		// push 5; retrieve; printi; push 5; push 1; store; push 5; retrieve; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Retrieve},
+			{Type: ws.Printi},
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Store},
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Retrieve},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, 1},
+		// push 0; readi; push 0; retrieve; jz l; push 5; push 1; store; l: push 5; retrieve; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Readi},
+			{Type: ws.Push, Arg: big.NewInt(0)},
+			{Type: ws.Retrieve},
+			{Type: ws.Jz, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Store},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Retrieve},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, 1},
+		// push 5; push 1; store; jmp l; l: push 5; retrieve; printi; end
+		{[]*ws.Token{
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Push, Arg: big.NewInt(1)},
+			{Type: ws.Store},
+			{Type: ws.Jmp, Arg: label},
+			{Type: ws.Label, Arg: label},
+			{Type: ws.Push, Arg: big.NewInt(5)},
+			{Type: ws.Retrieve},
+			{Type: ws.Printi},
+			{Type: ws.End},
+		}, 0},
+	} {
+		file := token.NewFileSet().AddFile("test", -1, 0)
+		p, errs := (&ws.Program{File: file, Tokens: test.Tokens}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatalf("test %d: %v", i, errs)
+		}
+		warnings := CheckUninitializedLoads(p)
+		if len(warnings) != test.Loads {
+			t.Errorf("test %d: got warnings %v, want %d", i, warnings, test.Loads)
+			continue
+		}
+		for _, w := range warnings {
+			if !strings.Contains(w.Error(), "loadheap of 5 may read") {
+				t.Errorf("test %d: got warning %q", i, w)
+			}
+		}
+	}
+}
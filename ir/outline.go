@@ -0,0 +1,133 @@
+package ir
+
+// ProgramOutline is a plain-data snapshot of a program's structure,
+// suitable for text/template or other renderers. Blocks are referenced
+// by index into Blocks and values by the IDs that a Formatter would
+// print, so the outline holds no pointers into the IR.
+type ProgramOutline struct {
+	Name   string
+	Entry  int // Index of the entry block
+	Blocks []BlockOutline
+}
+
+// BlockOutline is a plain-data snapshot of a basic block. Entries holds
+// -1 for the program entry.
+type BlockOutline struct {
+	Index      int
+	ID         int
+	Name       string
+	Labels     []string
+	Entries    []int
+	Callers    []int
+	Returns    []int
+	Succs      []int
+	Insts      []InstOutline
+	Terminator InstOutline
+}
+
+// InstOutline is a plain-data snapshot of an instruction. Operands are
+// formatted as by Formatter.FormatValue and Succs are block indices. For
+// phi expressions, Operands and Succs are parallel: each incoming value
+// is paired with its predecessor block.
+type InstOutline struct {
+	Value    string // Formatted value, if the instruction is a value
+	Op       string
+	Operands []string
+	StackPos int // Stack position, size, or offset; 0 otherwise
+	Succs    []int
+	Text     string // Instruction as formatted by FormatInst
+}
+
+// Outline constructs a plain-data snapshot of the program, in source
+// block order.
+func (p *Program) Outline() ProgramOutline {
+	return NewFormatter().Outline(p)
+}
+
+// Outline constructs a plain-data snapshot of the program, assigning
+// value IDs with AssignIDs the same as when formatting with f.
+func (f *Formatter) Outline(p *Program) ProgramOutline {
+	f.AssignIDs(p)
+	indices := make(map[*BasicBlock]int, len(p.Blocks))
+	for i, block := range p.Blocks {
+		indices[block] = i
+	}
+	blockIndices := func(blocks []*BasicBlock) []int {
+		if len(blocks) == 0 {
+			return nil
+		}
+		idx := make([]int, len(blocks))
+		for i, block := range blocks {
+			if block == nil {
+				idx[i] = -1
+			} else {
+				idx[i] = indices[block]
+			}
+		}
+		return idx
+	}
+
+	outline := ProgramOutline{Name: p.Name, Entry: -1}
+	if entry, ok := indices[p.Entry]; ok {
+		outline.Entry = entry
+	}
+	outline.Blocks = make([]BlockOutline, len(p.Blocks))
+	for i, block := range p.Blocks {
+		b := BlockOutline{
+			Index:   i,
+			ID:      block.ID,
+			Name:    block.Name(),
+			Entries: blockIndices(block.Entries),
+			Callers: blockIndices(block.Callers),
+			Returns: blockIndices(block.Returns),
+			Succs:   blockIndices(block.Succs()),
+		}
+		for _, label := range block.Labels {
+			b.Labels = append(b.Labels, label.String())
+		}
+		b.Insts = make([]InstOutline, len(block.Nodes))
+		for j, inst := range block.Nodes {
+			b.Insts[j] = f.outlineInst(inst, blockIndices)
+		}
+		b.Terminator = f.outlineInst(block.Terminator, blockIndices)
+		outline.Blocks[i] = b
+	}
+	return outline
+}
+
+func (f *Formatter) outlineInst(inst Inst, blockIndices func([]*BasicBlock) []int) InstOutline {
+	o := InstOutline{Op: inst.OpString(), Text: f.FormatInst(inst)}
+	if val, ok := inst.(Value); ok {
+		o.Value = f.FormatValue(val)
+	}
+	switch s := inst.(type) {
+	case *LoadStackExpr:
+		o.StackPos = int(s.StackPos)
+	case *StoreStackStmt:
+		o.StackPos = int(s.StackPos)
+	case *AccessStackStmt:
+		o.StackPos = int(s.StackSize)
+	case *OffsetStackStmt:
+		o.StackPos = s.Offset
+	}
+	if phi, ok := inst.(*PhiExpr); ok {
+		for _, val := range phi.Values() {
+			o.Operands = append(o.Operands, f.FormatValue(val.Value))
+			o.Succs = append(o.Succs, blockIndices([]*BasicBlock{val.Block})...)
+		}
+		return o
+	}
+	if user, ok := inst.(User); ok {
+		for _, op := range user.Operands() {
+			if op == nil {
+				o.Operands = append(o.Operands, "<nil>")
+			} else {
+				o.Operands = append(o.Operands, f.FormatValue(op.Def()))
+			}
+		}
+	}
+	if term, ok := inst.(TermInst); ok {
+		o.Succs = blockIndices(term.Succs())
+	}
+	return o
+}
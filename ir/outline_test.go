@@ -0,0 +1,75 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestOutline(t *testing.T) {
+	// block_0: %0 = readint; jz %0 block_1 block_2
+	// block_1: printint (add %0 1); jmp block_2
+	// block_2: exit
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	read := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(1), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	add := b.CreateBinaryExpr(Add, read, NewIntConst(big.NewInt(1), token.NoPos), token.NoPos)
+	b.CreatePrintStmt(PrintInt, add, token.NoPos)
+	b.CreateJmpTerm(Jmp, b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ProgramOutline{
+		Name:  "test",
+		Entry: 0,
+		Blocks: []BlockOutline{
+			{
+				Index: 0, ID: 0, Name: "block_0",
+				Entries: []int{-1}, Callers: []int{-1}, Succs: []int{1, 2},
+				Insts: []InstOutline{
+					{Value: "%0", Op: "readint", Text: "%0 = readint"},
+				},
+				Terminator: InstOutline{Op: "jz", Operands: []string{"%0"}, Succs: []int{1, 2}, Text: "jz %0 block_1 block_2"},
+			},
+			{
+				Index: 1, ID: 1, Name: "block_1",
+				Entries: []int{0}, Callers: []int{-1}, Succs: []int{2},
+				Insts: []InstOutline{
+					{Value: "%1", Op: "add", Operands: []string{"%0", "1"}, Text: "%1 = add %0 1"},
+					{Op: "printint", Operands: []string{"%1"}, Text: "printint %1"},
+				},
+				Terminator: InstOutline{Op: "jmp", Succs: []int{2}, Text: "jmp block_2"},
+			},
+			{
+				Index: 2, ID: 2, Name: "block_2",
+				Entries: []int{0, 1}, Callers: []int{-1},
+				Insts:      []InstOutline{},
+				Terminator: InstOutline{Op: "exit", Text: "exit"},
+			},
+		},
+	}
+	got := p.Outline()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got outline\n%+v\nwant\n%+v", got, want)
+	}
+
+	tmpl := template.Must(template.New("outline").Parse(
+		"{{range .Blocks}}{{.Name}}:{{range .Insts}} {{.Op}}{{end}} {{.Terminator.Op}}\n{{end}}"))
+	var out strings.Builder
+	if err := tmpl.Execute(&out, got); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := "block_0: readint jz\nblock_1: add printint jmp\nblock_2: exit\n"
+	if out.String() != wantOut {
+		t.Errorf("got template output %q, want %q", out.String(), wantOut)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"go/token"
 	"strings"
 
+	"github.com/andrewarchi/nebula/diag"
 	"github.com/andrewarchi/nebula/internal/digraph"
 )
 
@@ -17,22 +18,278 @@ type Program struct {
 	File        *token.File
 }
 
-// TrimUnreachable removes uncalled blocks.
+// TrimUnreachable removes blocks that are not reachable from the entry
+// by control flow, including blocks reachable only through other
+// unreachable blocks, whose callers may be stale after passes change
+// terminators. The remaining blocks keep their source order.
 func (p *Program) TrimUnreachable() {
-	// TODO traverse in topological order
+	if p.Entry == nil {
+		return
+	}
+	reachable := map[*BasicBlock]bool{p.Entry: true}
+	work := []*BasicBlock{p.Entry}
+	for len(work) != 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range block.Succs() {
+			if succ != nil && !reachable[succ] {
+				reachable[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+
 	i := 0
 	for _, block := range p.Blocks {
-		if len(block.Callers) == 0 {
-			block.Disconnect()
-		} else {
+		if reachable[block] {
 			p.Blocks[i] = block
 			i++
+		} else {
+			block.Disconnect()
+		}
+	}
+	if i == len(p.Blocks) {
+		return
+	}
+	p.Blocks = p.Blocks[:i]
+	for _, block := range p.Blocks {
+		block.Callers = filterReachable(block.Callers, reachable)
+		block.Returns = filterReachable(block.Returns, reachable)
+	}
+	p.RenumberBlockIDs()
+}
+
+// filterReachable removes unreachable blocks from a list, keeping nil,
+// which stands for the entry.
+func filterReachable(blocks []*BasicBlock, reachable map[*BasicBlock]bool) []*BasicBlock {
+	i := 0
+	for _, block := range blocks {
+		if block == nil || reachable[block] {
+			blocks[i] = block
+			i++
+		}
+	}
+	return blocks[:i]
+}
+
+// Reconnect recomputes the entries, callers, and returns of all blocks
+// after terminators have been changed.
+func (p *Program) Reconnect() error {
+	for _, block := range p.Blocks {
+		block.Entries = nil
+		block.Callers = nil
+		block.Returns = nil
+	}
+	return connectEntries(p.Entry, p.Blocks)
+}
+
+// MaxStackDepth computes the greatest stack length reachable from the
+// entry, starting with an empty stack, by propagating the stack effect
+// of each block along control flow. A block is assumed to complete only
+// when its accesses succeed. Each subroutine is summarized by its effect
+// on the stack length, so that a call continues only at the block it
+// returns to, rather than at the return site of every call to the
+// subroutine. It returns false when a cycle or recursion grows the
+// stack, so that the depth is unbounded.
+func (p *Program) MaxStackDepth() (int, bool) {
+	if p.Entry == nil {
+		return 0, true
+	}
+	a := &depthAnalysis{
+		effects: make(map[*BasicBlock]blockDepth, len(p.Blocks)),
+		subs:    make(map[*BasicBlock]*depthSummary),
+		limit:   len(p.Blocks),
+	}
+	// Summaries are refined until they agree with the summaries of their
+	// callees, which converges unless recursion grows the stack.
+	for round := 0; round <= a.limit; round++ {
+		a.changed = false
+		main, ok := a.summarize(p.Entry)
+		if !ok {
+			return 0, false
+		}
+		for i := 0; i < len(a.order); i++ {
+			entry := a.order[i]
+			sum, ok := a.summarize(entry)
+			if !ok {
+				return 0, false
+			}
+			if *sum != *a.subs[entry] {
+				a.subs[entry] = sum
+				a.changed = true
+			}
+		}
+		if !a.changed {
+			return main.peak.apply(0), true
 		}
 	}
-	if i != len(p.Blocks)-1 {
-		p.Blocks = p.Blocks[:i]
-		p.RenumberBlockIDs()
+	return 0, false
+}
+
+// MinStackDepths computes the stack length guaranteed on entry to each
+// block over all paths from the entry, starting with an empty stack.
+// Blocks that are unreachable are absent from the map. Block effects are
+// those of MaxStackDepth, but paths meet at the least length rather than
+// the greatest. A call continues only into its callee and the block it
+// returns to is entered from the rets of the callee, so that the length
+// there includes the net effect of the callee.
+func (p *Program) MinStackDepths() map[*BasicBlock]uint {
+	depths := make(map[*BasicBlock]uint)
+	if p.Entry == nil {
+		return depths
 	}
+	a := &depthAnalysis{effects: make(map[*BasicBlock]blockDepth, len(p.Blocks))}
+	depths[p.Entry] = 0
+	work := []*BasicBlock{p.Entry}
+	for len(work) != 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		exit := uint(a.effect(block).exit.apply(int(depths[block])))
+		succs := block.Succs()
+		if call, ok := block.Terminator.(*CallTerm); ok {
+			succs = call.succs[:1]
+		}
+		for _, succ := range succs {
+			if succ == nil {
+				continue
+			}
+			if d, ok := depths[succ]; !ok || exit < d {
+				depths[succ] = exit
+				work = append(work, succ)
+			}
+		}
+	}
+	return depths
+}
+
+// depthFunc maps a stack length d to max(d+shift, floor). The effect of
+// a block on the stack length has this form, which is preserved by
+// composing effects along a path and by joining paths with max.
+type depthFunc struct {
+	shift, floor int
+}
+
+func (f depthFunc) then(g depthFunc) depthFunc {
+	return depthFunc{f.shift + g.shift, maxInt(f.floor+g.shift, g.floor)}
+}
+
+func (f depthFunc) join(g depthFunc) depthFunc {
+	return depthFunc{maxInt(f.shift, g.shift), maxInt(f.floor, g.floor)}
+}
+
+func (f depthFunc) apply(d int) int {
+	return maxInt(d+f.shift, f.floor)
+}
+
+// blockDepth is the stack length on exit from a block and the greatest
+// stack length within it, as functions of the length on entry.
+type blockDepth struct {
+	exit, peak depthFunc
+}
+
+// depthSummary is the effect of a subroutine on the stack length, as
+// functions of the length on entry.
+type depthSummary struct {
+	ret     depthFunc // Length on return
+	returns bool      // Whether any path returns
+	peak    depthFunc // Greatest length within, including callees
+}
+
+type depthAnalysis struct {
+	effects map[*BasicBlock]blockDepth
+	subs    map[*BasicBlock]*depthSummary // Summaries of called subroutines
+	order   []*BasicBlock                 // Subroutines in order of first call
+	limit   int
+	changed bool
+}
+
+// summarize computes the summary of the code entered at entry, by
+// longest paths with Bellman-Ford, stopping at rets and applying the
+// current summary of each callee at calls. It returns false when a
+// cycle grows the stack.
+func (a *depthAnalysis) summarize(entry *BasicBlock) (*depthSummary, bool) {
+	sum := &depthSummary{}
+	in := map[*BasicBlock]depthFunc{entry: {}}
+	updates := make(map[*BasicBlock]int)
+	queue := []*BasicBlock{entry}
+	for len(queue) != 0 {
+		block := queue[0]
+		queue = queue[1:]
+		effect := a.effect(block)
+		f := in[block]
+		sum.peak = sum.peak.join(f.then(effect.peak))
+		out := f.then(effect.exit)
+		var succs []*BasicBlock
+		switch term := block.Terminator.(type) {
+		case *CallTerm:
+			callee := a.callee(term.succs[0])
+			sum.peak = sum.peak.join(out.then(callee.peak))
+			if callee.returns {
+				out = out.then(callee.ret)
+				succs = []*BasicBlock{term.succs[1]}
+			}
+		case *RetTerm:
+			if sum.returns {
+				out = sum.ret.join(out)
+			}
+			sum.ret, sum.returns = out, true
+		default:
+			succs = term.Succs()
+		}
+		for _, succ := range succs {
+			if succ == nil {
+				continue
+			}
+			g := out
+			if old, ok := in[succ]; ok {
+				if g = old.join(out); g == old {
+					continue
+				}
+			}
+			in[succ] = g
+			updates[succ]++
+			if updates[succ] > a.limit {
+				return nil, false
+			}
+			queue = append(queue, succ)
+		}
+	}
+	return sum, true
+}
+
+// callee returns the current summary of the subroutine, which is
+// initially that it does not return.
+func (a *depthAnalysis) callee(entry *BasicBlock) *depthSummary {
+	if sum, ok := a.subs[entry]; ok {
+		return sum
+	}
+	sum := &depthSummary{}
+	a.subs[entry] = sum
+	a.order = append(a.order, entry)
+	a.changed = true
+	return sum
+}
+
+func (a *depthAnalysis) effect(block *BasicBlock) blockDepth {
+	if d, ok := a.effects[block]; ok {
+		return d
+	}
+	effect := block.StackEffect()
+	shift := int(effect.Pushes) - int(effect.Pops)
+	rise := maxInt(shift, 0)
+	d := blockDepth{
+		exit: depthFunc{shift, int(effect.Access) + shift},
+		peak: depthFunc{rise, int(effect.Access) + rise},
+	}
+	a.effects[block] = d
+	return d
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 // RenumberBlockIDs cleans up block IDs to match the block index.
@@ -48,12 +305,79 @@ func (p *Program) Digraph() digraph.Digraph {
 	g := make(digraph.Digraph, p.NextBlockID)
 	for _, block := range p.Blocks {
 		for _, edge := range block.Succs() {
-			g.AddEdge(block.ID, edge.ID)
+			if edge != nil {
+				g.AddEdge(block.ID, edge.ID)
+			}
 		}
 	}
 	return g
 }
 
+// ReversePostOrder returns the blocks reachable from the entry in
+// reverse post-order, followed by any unreachable blocks in source
+// order. Block IDs are left unchanged.
+func (p *Program) ReversePostOrder() []*BasicBlock {
+	visited := make(map[*BasicBlock]bool, len(p.Blocks))
+	post := make([]*BasicBlock, 0, len(p.Blocks))
+	var visit func(block *BasicBlock)
+	visit = func(block *BasicBlock) {
+		visited[block] = true
+		for _, succ := range block.Succs() {
+			if succ != nil && !visited[succ] {
+				visit(succ)
+			}
+		}
+		post = append(post, block)
+	}
+	if p.Entry != nil {
+		visit(p.Entry)
+	}
+	blocks := make([]*BasicBlock, 0, len(p.Blocks))
+	for i := len(post) - 1; i >= 0; i-- {
+		blocks = append(blocks, post[i])
+	}
+	for _, block := range p.Blocks {
+		if !visited[block] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// Edge is a control flow edge between two blocks.
+type Edge struct {
+	From, To *BasicBlock
+	Kind     string      // One of call, jmp, true, false, or ret
+	Caller   *BasicBlock // Calling block of a ret edge
+}
+
+// Edges enumerates the control flow edges of the program in block
+// order. A ret edge is created for each caller of the returning block.
+func (p *Program) Edges() []Edge {
+	var edges []Edge
+	for _, block := range p.Blocks {
+		switch term := block.Terminator.(type) {
+		case *CallTerm:
+			edges = append(edges, Edge{block, term.succs[0], "call", nil})
+		case *JmpTerm:
+			edges = append(edges, Edge{block, term.succs[0], "jmp", nil})
+		case *JmpCondTerm:
+			edges = append(edges, Edge{block, term.succs[0], "true", nil})
+			edges = append(edges, Edge{block, term.succs[1], "false", nil})
+		case *RetTerm:
+			for _, caller := range block.Callers {
+				if caller != nil {
+					edges = append(edges, Edge{block, returnSucc(caller), "ret", caller})
+				}
+			}
+		case *ExitTerm:
+		default:
+			panic("ir: unrecognized terminator type")
+		}
+	}
+	return edges
+}
+
 // DotDigraph creates a control flow graph in the Graphviz DOT format.
 func (p *Program) DotDigraph() string {
 	var b strings.Builder
@@ -74,23 +398,12 @@ func (p *Program) DotDigraph() string {
 	}
 	b.WriteByte('\n')
 	fmt.Fprintf(&b, "  entry -> block_%d;\n", p.Entry.ID)
-	for _, block := range p.Blocks {
-		switch term := block.Terminator.(type) {
-		case *CallTerm:
-			fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"call\"];\n", block.ID, term.succs[0].ID)
-		case *JmpTerm:
-			fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"jmp\"];\n", block.ID, term.succs[0].ID)
-		case *JmpCondTerm:
-			fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"true\"];\n", block.ID, term.succs[0].ID)
-			fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"false\"];\n", block.ID, term.succs[1].ID)
-		case *RetTerm:
-			for _, caller := range block.Callers {
-				fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"ret\\n%s\"];\n", block.ID, caller.Next.ID, caller.Name())
-			}
-		case *ExitTerm:
-		default:
-			panic("ir: unrecognized terminator type")
+	for _, e := range p.Edges() {
+		label := e.Kind
+		if e.Kind == "ret" {
+			label += "\\n" + e.Caller.Name()
 		}
+		fmt.Fprintf(&b, "  block_%d -> block_%d[label=\"%s\"];\n", e.From.ID, e.To.ID, label)
 	}
 	b.WriteString("}\n")
 	return b.String()
@@ -114,6 +427,12 @@ func (err *RetUnderflowError) addTrace(err2 *RetUnderflowError, trace *BasicBloc
 	return err
 }
 
+// Diagnostic converts the error to a diagnostic. Underflow is only
+// possible on some paths, so it is a warning.
+func (err *RetUnderflowError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Warning, Code: "ret-underflow", Message: strings.TrimSuffix(err.Error(), "\n")}
+}
+
 func (err *RetUnderflowError) Error() string {
 	if err == nil {
 		return "<nil>"
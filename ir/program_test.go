@@ -0,0 +1,206 @@
+package ir
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestMaxStackDepth(t *testing.T) {
+	c := func(n int64) *IntConst { return NewIntConst(big.NewInt(n), token.NoPos) }
+
+	// block_0:         ; push 1, push 2, push 3
+	//     offsetstack 3
+	//     storestack 3 1
+	//     storestack 2 2
+	//     storestack 1 3
+	//     jmp block_1
+	// block_1:         ; drop, drop
+	//     accessstack 2
+	//     offsetstack -2
+	//     exit
+	b := NewBuilder(token.NewFileSet().AddFile("bounded", -1, 0))
+	b.InitBlocks(2)
+	b.CreateOffsetStackStmt(3, token.NoPos)
+	for i := int64(1); i <= 3; i++ {
+		b.CreateStoreStackStmt(uint(4-i), c(i), token.NoPos)
+	}
+	b.CreateJmpTerm(Jmp, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateAccessStackStmt(2, token.NoPos)
+	b.CreateOffsetStackStmt(-2, token.NoPos)
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ok := p.MaxStackDepth(); !ok || depth != 3 {
+		t.Errorf("bounded: got depth %d, %t, want 3, true", depth, ok)
+	}
+
+	// block_0:         ; loop: push 1, readi, jz loop
+	//     offsetstack 1
+	//     storestack 1 1
+	//     %0 = readi
+	//     jz %0 block_0 block_1
+	// block_1:
+	//     exit
+	b = NewBuilder(token.NewFileSet().AddFile("unbounded", -1, 0))
+	b.InitBlocks(2)
+	b.CreateOffsetStackStmt(1, token.NoPos)
+	b.CreateStoreStackStmt(1, c(1), token.NoPos)
+	read := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(0), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateExitTerm(token.NoPos)
+	p, err = b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ok := p.MaxStackDepth(); ok {
+		t.Errorf("unbounded: got depth %d, want unbounded", depth)
+	}
+
+	// block_0:         ; call f
+	//     call block_3 block_1
+	// block_1:         ; push 1, call f
+	//     offsetstack 1
+	//     storestack 1 1
+	//     call block_3 block_2
+	// block_2:         ; end
+	//     exit
+	// block_3:         ; f: ret
+	//     ret
+	b = NewBuilder(token.NewFileSet().AddFile("calls", -1, 0))
+	b.InitBlocks(4)
+	b.CreateCallTerm(b.Block(3), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateOffsetStackStmt(1, token.NoPos)
+	b.CreateStoreStackStmt(1, c(1), token.NoPos)
+	b.CreateCallTerm(b.Block(3), b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateRetTerm(token.NoPos)
+	p, err = b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ok := p.MaxStackDepth(); !ok || depth != 1 {
+		t.Errorf("calls: got depth %d, %t, want 1, true", depth, ok)
+	}
+
+	// block_0:         ; call f, end
+	//     call block_2 block_1
+	// block_1:
+	//     exit
+	// block_2:         ; f: push 1, readi, jz f, ret
+	//     offsetstack 1
+	//     storestack 1 1
+	//     %0 = readi
+	//     jz %0 block_3 block_4
+	// block_3:
+	//     call block_2 block_4
+	// block_4:
+	//     ret
+	b = NewBuilder(token.NewFileSet().AddFile("recursion", -1, 0))
+	b.InitBlocks(5)
+	b.CreateCallTerm(b.Block(2), b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateOffsetStackStmt(1, token.NoPos)
+	b.CreateStoreStackStmt(1, c(1), token.NoPos)
+	read = b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(3), b.Block(4), token.NoPos)
+	b.SetCurrentBlock(b.Block(3))
+	b.CreateCallTerm(b.Block(2), b.Block(4), token.NoPos)
+	b.SetCurrentBlock(b.Block(4))
+	b.CreateRetTerm(token.NoPos)
+	p, err = b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ok := p.MaxStackDepth(); ok {
+		t.Errorf("recursion: got depth %d, want unbounded", depth)
+	}
+}
+
+func TestTrimUnreachable(t *testing.T) {
+	// block_0:
+	//     %0 = readi
+	//     jz %0 block_1 block_4
+	// block_1:
+	//     jmp block_2
+	// block_2:
+	//     jmp block_3
+	// block_3:
+	//     jmp block_4
+	// block_4:
+	//     exit
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(5)
+	read := b.CreateReadExpr(ReadInt, token.NoPos)
+	b.CreateJmpCondTerm(Jz, read, b.Block(1), b.Block(4), token.NoPos)
+	for i := 1; i <= 3; i++ {
+		b.SetCurrentBlock(b.Block(i))
+		b.CreateJmpTerm(Jmp, b.Block(i+1), token.NoPos)
+	}
+	b.SetCurrentBlock(b.Block(4))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, exit := p.Blocks[0], p.Blocks[4]
+
+	// Pruning the branch leaves the chain with callers, but unreachable.
+	entry.Terminator.(*JmpCondTerm).ClearOperands()
+	entry.Terminator = NewJmpTerm(Jmp, exit, token.NoPos)
+	p.TrimUnreachable()
+
+	if len(p.Blocks) != 2 || p.Blocks[0] != entry || p.Blocks[1] != exit {
+		t.Fatalf("unreachable chain not removed:\n%v", p)
+	}
+	if len(exit.Entries) != 1 || exit.Entries[0] != entry {
+		t.Errorf("got entries %v for exit, want only the entry", exit.Entries)
+	}
+	if entry.ID != 0 || exit.ID != 1 || p.NextBlockID != 2 {
+		t.Errorf("blocks not renumbered: got IDs %d, %d, next %d", entry.ID, exit.ID, p.NextBlockID)
+	}
+}
+
+func TestReversePostOrder(t *testing.T) {
+	// block_0:
+	//     jmp block_2
+	// block_1:
+	//     exit
+	// block_2:
+	//     jmp block_1
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.CreateJmpTerm(Jmp, b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateExitTerm(token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateJmpTerm(Jmp, b.Block(1), token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IDs that differ from the block indices are left as they are.
+	ids := []int{5, 3, 7}
+	for i, block := range p.Blocks {
+		block.ID = ids[i]
+	}
+
+	order := p.ReversePostOrder()
+	if len(order) != 3 || order[0] != p.Blocks[0] || order[1] != p.Blocks[2] || order[2] != p.Blocks[1] {
+		t.Errorf("got order %v, want block_0, block_2, block_1", order)
+	}
+	for i, block := range p.Blocks {
+		if block.ID != ids[i] {
+			t.Errorf("block %d renumbered to %d, want %d", i, block.ID, ids[i])
+		}
+	}
+}
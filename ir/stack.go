@@ -75,7 +75,8 @@ func (s *Stack) Dup(pos token.Pos) (top Value) {
 	return top
 }
 
-// Copy copies the nth value and pushes it to the stack.
+// Copy copies the nth value and pushes it to the stack. Copy 0 is
+// equivalent to Dup.
 func (s *Stack) Copy(n uint, pos token.Pos) (nth Value) {
 	nth = s.At(n, pos)
 	s.values = append(s.values, nth)
@@ -89,9 +90,21 @@ func (s *Stack) Swap(pos token.Pos) {
 	s.simplify()
 }
 
-// Slide discards n values on the stack, leaving the top value.
+// Slide discards n values on the stack, leaving the top value. When
+// the discarded values were all pushed in the stack frame, nothing
+// under the frame is accessed. As in the reference interpreter, slide 0
+// leaves the stack unchanged, but still requires a top value.
 func (s *Stack) Slide(n uint, pos token.Pos) {
 	if n == 0 {
+		if len(s.values) == 0 {
+			s.Access(s.pops+1, pos)
+		}
+		return
+	}
+	if l := uint(len(s.values)); n < l {
+		top := s.values[l-1]
+		s.values = append(s.values[:l-n-1], top)
+		s.simplify()
 		return
 	}
 	top := s.Top(pos)
@@ -100,6 +113,19 @@ func (s *Stack) Slide(n uint, pos token.Pos) {
 	s.simplify()
 }
 
+// Materialize emits the instructions that flush the stack frame at the
+// end of a block to the current block of b: an offset of the stack
+// length by the net change of the frame, positioned at pos, followed by
+// a store of each value in the frame, positioned at the value.
+func (s *Stack) Materialize(b *Builder, pos token.Pos) {
+	if offset := int(s.Len()) - int(s.Pops()); offset != 0 {
+		b.CreateOffsetStackStmt(offset, pos)
+	}
+	for i, val := range s.Values() {
+		b.CreateStoreStackStmt(s.Len()-uint(i), val, val.Pos())
+	}
+}
+
 // Top accesses and returns the top value on the stack.
 func (s *Stack) Top(pos token.Pos) (top Value) {
 	return s.At(0, pos)
@@ -186,6 +212,26 @@ func (s *Stack) Len() uint {
 	return uint(len(s.values))
 }
 
+// Equal returns whether two stacks have the same values, pops, and
+// accesses. The handler funcs are not compared.
+func (s *Stack) Equal(other *Stack) bool {
+	if s.pops != other.pops || s.accesses != other.accesses ||
+		len(s.values) != len(other.values) || len(s.under) != len(other.under) {
+		return false
+	}
+	for i := range s.values {
+		if s.values[i] != other.values[i] {
+			return false
+		}
+	}
+	for i := range s.under {
+		if s.under[i] != other.under[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Stack) String() string {
 	return NewFormatter().FormatStack(s)
 }
@@ -153,6 +153,59 @@ func TestSwap(t *testing.T) {
 	}
 }
 
+func TestSlide(t *testing.T) {
+	for i, test := range []stackTest{
+		{
+			Stack: &Stack{[]Value{v0, v1, v2}, nil, 0, 0, handleAccess, handleLoad},
+			Want:  &Stack{[]Value{v0, v2}, nil, 0, 0, handleAccess, handleLoad},
+			N:     1,
+		},
+		{
+			Stack: &Stack{[]Value{v0, v1, v2, v3}, nil, 0, 0, handleAccess, handleLoad},
+			Want:  &Stack{[]Value{v3}, nil, 0, 0, handleAccess, handleLoad},
+			N:     3,
+		},
+		{
+			Stack: &Stack{[]Value{v1, v2}, nil, 2, 3, handleAccess, handleLoad},
+			Want:  &Stack{[]Value{v2}, nil, 2, 3, handleAccess, handleLoad},
+			N:     1,
+		},
+		{
+			Stack: &Stack{[]Value{v0, v1}, nil, 0, 0, handleAccess, handleLoad},
+			Want:  &Stack{[]Value{v1}, nil, 1, 1, handleAccess, handleLoad},
+			N:     2,
+		},
+		{
+			Stack: &Stack{[]Value{v0, v1}, nil, 0, 0, handleAccess, handleLoad},
+			Want:  &Stack{[]Value{v0, v1}, nil, 0, 0, handleAccess, handleLoad},
+			N:     0,
+		},
+		{
+			Stack: &Stack{nil, nil, 2, 2, handleAccess, handleLoad},
+			Want:  &Stack{nil, nil, 2, 3, handleAccess, handleLoad},
+			N:     0,
+		},
+	} {
+		var accesses []uint
+		test.Stack.HandleAccess = func(n uint, pos token.Pos) { accesses = append(accesses, n) }
+		inFrame := test.N < test.Stack.Len()
+		test.Stack.Slide(test.N, token.NoPos)
+		checkStack(t, i, test.Stack, test.Want)
+		if inFrame && len(accesses) != 0 {
+			t.Errorf("test %d: in-frame slide accessed under frame: %v", i, accesses)
+		}
+	}
+}
+
+func TestCopyZero(t *testing.T) {
+	for i, values := range [][]Value{{v0, v1}, nil} {
+		copied := &Stack{values, nil, 0, 0, handleAccess, handleLoad}
+		dupped := &Stack{append([]Value{}, values...), nil, 0, 0, handleAccess, handleLoad}
+		checkValue(t, i, copied.Copy(0, token.NoPos), dupped.Dup(token.NoPos))
+		checkStack(t, i, copied, dupped)
+	}
+}
+
 func TestSimplify(t *testing.T) {
 	for i, test := range []stackTest{
 		{
@@ -177,6 +230,21 @@ func TestSimplify(t *testing.T) {
 	}
 }
 
+func TestStackEqual(t *testing.T) {
+	a := &Stack{[]Value{v0, v1}, []Value{load1}, 1, 1, handleAccess, handleLoad}
+	b := &Stack{[]Value{v0, v1}, []Value{load1}, 1, 1, nil, nil}
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Errorf("stacks differing only in handlers are not equal: %s", f.FormatStackDiff(a, b))
+	}
+	c := &Stack{[]Value{v0, v2}, []Value{load1}, 1, 1, handleAccess, handleLoad}
+	if a.Equal(c) || c.Equal(a) {
+		t.Error("stacks differing in value slot are equal")
+	}
+	if diff, want := f.FormatStackDiff(a, c), "values[1]: 1 != 2\n"; diff != want {
+		t.Errorf("got diff %q, want %q", diff, want)
+	}
+}
+
 func handleAccess(n uint, pos token.Pos) {}
 
 func handleLoad(n uint, pos token.Pos) Value {
@@ -186,31 +254,18 @@ func handleLoad(n uint, pos token.Pos) Value {
 	return []Value{load1, load2, load3, load4}[n-1]
 }
 
-func equals(a, b *Stack) bool {
-	if a.pops != b.pops || a.accesses != b.accesses ||
-		len(a.values) != len(b.values) || len(a.under) != len(b.under) ||
-		(a.values == nil) != (b.values == nil) ||
-		(a.under == nil) != (b.under == nil) ||
-		(a.HandleLoad == nil) != (b.HandleLoad == nil) {
-		return false
-	}
-	for i := range a.values {
-		if a.values[i] != b.values[i] {
-			return false
-		}
-	}
-	for i := range a.under {
-		if a.under[i] != b.under[i] {
-			return false
-		}
-	}
-	return true
-}
-
 func checkStack(t *testing.T, testIndex int, got, want *Stack) {
 	t.Helper()
-	if !equals(got, want) {
-		t.Errorf("test %d: got stack %s, want %s", testIndex, f.FormatStack(got), f.FormatStack(want))
+	if !got.Equal(want) {
+		t.Errorf("test %d: got stack %s, want %s\n%s", testIndex, f.FormatStack(got), f.FormatStack(want), f.FormatStackDiff(got, want))
+		return
+	}
+	// Equal does not distinguish nil from empty slices or compare
+	// handlers, but the tests specify both.
+	if (got.values == nil) != (want.values == nil) ||
+		(got.under == nil) != (want.under == nil) ||
+		(got.HandleLoad == nil) != (want.HandleLoad == nil) {
+		t.Errorf("test %d: got stack %#v, want %#v", testIndex, got, want)
 	}
 }
 
@@ -231,3 +286,32 @@ func checkPanic(t *testing.T, want interface{}, mightPanic func()) {
 	}()
 	mightPanic()
 }
+
+func TestMaterialize(t *testing.T) {
+	// Frame with 1 value popped from under it and 3 values pushed
+	s := &Stack{[]Value{v0, v1, v2}, nil, 1, 1, handleAccess, handleLoad}
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	s.Materialize(b, 5)
+	nodes := b.Block(0).Nodes
+	if len(nodes) != 4 {
+		t.Fatalf("got %d instructions, want 4", len(nodes))
+	}
+	if offset, ok := nodes[0].(*OffsetStackStmt); !ok || offset.Offset != 2 || offset.Pos() != 5 {
+		t.Errorf("got %s, want offsetstack 2", f.FormatInst(nodes[0]))
+	}
+	for i, val := range []Value{v0, v1, v2} {
+		store, ok := nodes[i+1].(*StoreStackStmt)
+		if !ok || store.StackPos != uint(3-i) || store.Operand(0).Def() != val {
+			t.Errorf("got %s, want storestack %d %s", f.FormatInst(nodes[i+1]), 3-i, f.FormatValue(val))
+		}
+	}
+
+	empty := &Stack{nil, nil, 0, 0, handleAccess, handleLoad}
+	b = NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(1)
+	empty.Materialize(b, token.NoPos)
+	if nodes := b.Block(0).Nodes; len(nodes) != 0 {
+		t.Errorf("empty frame emitted %d instructions", len(nodes))
+	}
+}
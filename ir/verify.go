@@ -0,0 +1,44 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/andrewarchi/nebula/diag"
+)
+
+// VerifyError is an error given when a program is malformed.
+type VerifyError struct {
+	Block *BasicBlock
+	Err   string
+}
+
+func (err *VerifyError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Block.Name(), err.Err)
+}
+
+// Diagnostic converts the error to a diagnostic.
+func (err *VerifyError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Error, Code: "verify", Message: err.Error()}
+}
+
+// Verify checks the structural invariants of the program: every block
+// has a terminator and every fallthrough targets the next block.
+func (p *Program) Verify() []error {
+	var errs []error
+	for _, block := range p.Blocks {
+		switch term := block.Terminator.(type) {
+		case nil:
+			errs = append(errs, &VerifyError{block, "missing terminator"})
+		case *JmpTerm:
+			if term.Op == Fallthrough && term.Succ(0) != block.Next {
+				next := "<nil>"
+				if block.Next != nil {
+					next = block.Next.Name()
+				}
+				errs = append(errs, &VerifyError{block, fmt.Sprintf("fallthrough targets %s, not next block %s",
+					term.Succ(0).Name(), next)})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,35 @@
+package ir
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestVerifyFallthrough(t *testing.T) {
+	// block_0: fallthrough block_1
+	// block_1: fallthrough block_2
+	// block_2: exit
+	b := NewBuilder(token.NewFileSet().AddFile("test", -1, 0))
+	b.InitBlocks(3)
+	b.CreateJmpTerm(Fallthrough, b.Block(1), token.NoPos)
+	b.SetCurrentBlock(b.Block(1))
+	b.CreateJmpTerm(Fallthrough, b.Block(2), token.NoPos)
+	b.SetCurrentBlock(b.Block(2))
+	b.CreateExitTerm(token.NoPos)
+	p, err := b.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := p.Verify(); len(errs) != 0 {
+		t.Errorf("in-order fallthroughs flagged: %v", errs)
+	}
+
+	p.Blocks[0].Terminator.(*JmpTerm).SetSucc(0, p.Blocks[2])
+	errs := p.Verify()
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want 1", errs)
+	}
+	if err, ok := errs[0].(*VerifyError); !ok || err.Block != p.Blocks[0] {
+		t.Errorf("got error %v, want error in block_0", errs[0])
+	}
+}
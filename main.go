@@ -2,41 +2,119 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed" // for runtimeSource
 	"flag"
 	"fmt"
 	"go/token"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/andrewarchi/graph"
 	"github.com/andrewarchi/nebula/bf"
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/frontend"
+	"github.com/andrewarchi/nebula/internal/heapimage"
+	"github.com/andrewarchi/nebula/internal/watch"
 	"github.com/andrewarchi/nebula/ir"
 	"github.com/andrewarchi/nebula/ir/codegen"
+	"github.com/andrewarchi/nebula/ir/codegen/jit"
+	"github.com/andrewarchi/nebula/ir/interp"
 	"github.com/andrewarchi/nebula/ir/optimize"
+	"github.com/andrewarchi/nebula/pipeline"
 	"github.com/andrewarchi/nebula/ws"
+	"github.com/andrewarchi/nebula/wsa"
+	"llvm.org/llvm/bindings/go/llvm"
 )
 
 var (
 	name = os.Args[0]
 
 	ascii           bool
+	graphML         bool
+	cfgStats        bool
+	stackDepth      bool
 	format          string
+	blockOrder      string
+	stackArt        bool
+	verbose         bool
+	elideFall       bool
+	emitGo          bool
+	rawIR           bool
+	stackPhis       bool
 	noFold          bool
+	passNames       string
+	dumpAfter       string
 	maxStackLen     uint
 	maxCallStackLen uint
 	maxHeapBound    uint
+	sharedHeap      bool
+	arithOverflow   string
+	stackTraps      bool
+	allocaStack     bool
+	growableHeap    bool
+	blockFuncs      bool
+	outputEncoding  string
+	inputFile       string
+	outDir          string
+	scaffoldLib     bool
+	outFile         string
+	traceFile       string
+	watchStage      string
+	watchInterval   time.Duration
+	watchDebounce   time.Duration
+	maxTokens       int
+	wsSpec          string
+	maxInsts        int
+	maxBlocks       int
+	blockNames      string
+	checkStack      bool
+	warnUninit      bool
+	jsonDiags       bool
+	remarks         bool
+	strictLabels    bool
+	lexComments     bool
+	commentMapFile  string
+	stripHeader     bool
+	bfCellBits      int
+	bfTapeSize      int
+	bfMaxNesting    int
+	bfEOF           string
+	seedHeapFile    string
+	determinism     bool
 
-	commands    map[string]commandConfig
-	packFlags   = flag.NewFlagSet("pack", flag.ExitOnError)
-	unpackFlags = flag.NewFlagSet("unpack", flag.ExitOnError)
-	graphFlags  = flag.NewFlagSet("graph", flag.ExitOnError)
-	astFlags    = flag.NewFlagSet("ast", flag.ExitOnError)
-	irFlags     = flag.NewFlagSet("ir", flag.ExitOnError)
-	llvmFlags   = flag.NewFlagSet("llvm", flag.ExitOnError)
-	helpFlags   = flag.NewFlagSet("help", flag.ExitOnError)
+	commands      map[string]commandConfig
+	packFlags     = flag.NewFlagSet("pack", flag.ExitOnError)
+	unpackFlags   = flag.NewFlagSet("unpack", flag.ExitOnError)
+	graphFlags    = flag.NewFlagSet("graph", flag.ExitOnError)
+	astFlags      = flag.NewFlagSet("ast", flag.ExitOnError)
+	histFlags     = flag.NewFlagSet("hist", flag.ExitOnError)
+	irFlags       = flag.NewFlagSet("ir", flag.ExitOnError)
+	llvmFlags     = flag.NewFlagSet("llvm", flag.ExitOnError)
+	checkFlags    = flag.NewFlagSet("check", flag.ExitOnError)
+	pipelineFlags = flag.NewFlagSet("check-pipeline", flag.ExitOnError)
+	roundFlags    = flag.NewFlagSet("check-roundtrip", flag.ExitOnError)
+	diffFlags     = flag.NewFlagSet("diff", flag.ExitOnError)
+	coverFlags    = flag.NewFlagSet("coverage", flag.ExitOnError)
+	scaffoldFlags = flag.NewFlagSet("scaffold", flag.ExitOnError)
+	runFlags      = flag.NewFlagSet("run", flag.ExitOnError)
+	watchFlags    = flag.NewFlagSet("watch", flag.ExitOnError)
+	versionFlags  = flag.NewFlagSet("version", flag.ExitOnError)
+	helpFlags     = flag.NewFlagSet("help", flag.ExitOnError)
 )
 
+// runtimeSource is the C runtime linked with compiled programs.
+//
+//go:embed ir/codegen/ext/ext.c
+var runtimeSource []byte
+
 type commandConfig struct {
 	run   func([]string)
 	flags *flag.FlagSet
@@ -51,12 +129,22 @@ Usage:
 
 The commands are:
 
-	pack    compress program to bit packed format
-	unpack  uncompress program from bit packed format
-	graph   print Nebula IR control flow graph
-	ast     emit Whitespace AST
-	ir      emit Nebula IR
-	llvm    emit LLVM IR
+	pack            compress program to bit packed format
+	unpack          uncompress program from bit packed format
+	graph           print Nebula IR control flow graph
+	ast             emit Whitespace AST
+	hist            count instructions used by category
+	ir              emit Nebula IR
+	llvm            emit LLVM IR
+	check           compare JIT compiled and interpreted output
+	check-pipeline  run every compilation stage without output
+	check-roundtrip check that re-emitted Whitespace lexes to the same tokens
+	diff            compare the Nebula IR of two programs
+	scaffold        emit LLVM IR, runtime, and Makefile to a directory
+	run             interpret a program
+	coverage        report source not executed when interpreting a program
+	watch           rerun a command when a program changes
+	version         print Nebula, Go, and LLVM versions
 
 Use "%s help <command>" for more information about a command.
 
@@ -72,8 +160,45 @@ Examples:
 	unpackHeader = "Unpack decompresses a program from the bit packed format."
 	graphHeader  = "Graph prints the control flow graph of a program's Nebula IR."
 	astHeader    = "AST emits a program's AST in Whitespace syntax."
+	histHeader   = "Hist prints how many of each instruction a program uses, by category."
 	irHeader     = "IR emits the Nebula IR of a program."
-	llvmHeader   = "LLVM emits the LLVM IR of a program."
+	llvmHeader   = `LLVM emits the LLVM IR of a program.
+
+When multiple programs are given, they are combined into one module
+with an entry function for each program, named <prefix>_main, where
+the prefix is derived from the program file name. No main function is
+emitted, so the module can be linked with a dispatcher.`
+	checkHeader = `Check JIT compiles a program and runs it alongside the interpreter
+on the same input, then reports any divergence in output or exit
+status. Nebula must be built with -tags jit.`
+	pipelineHeader = `Check-pipeline runs each program through lexing, lowering,
+verification, each optimization pass, and a mock codegen without
+producing output, then reports the first stage that fails for each
+program. It exits non-zero if any program fails, for use in CI.`
+	roundHeader = `Check-roundtrip lexes each program, emits it as Whitespace, lexes
+the result again, and reports the first token that differs, verifying
+that the lexer and emitter are inverses. It exits non-zero if any
+program differs.`
+	diffHeader = `Diff lowers and optimizes two programs and prints the blocks added,
+removed, or changed between their Nebula IR, with the changed
+instructions of each changed block.`
+	coverHeader = `Coverage interprets a program, reading from stdin, and reports which
+spans of source were never executed. The program is lowered without
+optimization, unless passes are given, so that dead code is reported.
+Program output is written to stderr.`
+	scaffoldHeader = `Scaffold writes a ready-to-build project for a program to a directory:
+the LLVM IR, the C runtime ext.c, and a Makefile that links them into
+an executable with clang, llvm-link, and llc. With -lib, the Makefile
+instead builds a static archive, lib<name>.a, for linking into a C or
+Go program, which calls the program as
+int <name>_main(int argc, char **argv), declared in <name>.h.`
+	runHeader   = "Run interprets the Nebula IR of a program, reading from stdin."
+	watchHeader = `Watch polls a program for changes and reruns a command on it after
+each save, e.g. ir, llvm, or run. Rapid saves are debounced into a
+single rerun. Arguments after the program are passed to the command.`
+	versionHeader = `Version prints the versions of Nebula, the Go toolchain it was built
+with, and the linked LLVM libraries, for inclusion in bug reports about
+generated IR.`
 )
 
 func main() {
@@ -82,13 +207,20 @@ func main() {
 		os.Exit(2)
 	}
 	initFlags()
-	commandName := os.Args[1]
+	registerFrontends()
+	dispatch(os.Args[1:])
+}
+
+// dispatch runs the command named by the first argument with the rest
+// of the arguments.
+func dispatch(args []string) {
+	commandName := args[0]
 	command, ok := commands[commandName]
 	if !ok {
-		helpFlags.Parse(os.Args[1:]) // print usage if a help flag given
+		helpFlags.Parse(args) // print usage if a help flag given
 		usageErrorf("%s %s: unknown command", name, commandName)
 	}
-	command.flags.Parse(os.Args[2:])
+	command.flags.Parse(args[1:])
 	command.run(command.flags.Args())
 }
 
@@ -98,33 +230,119 @@ func usage() {
 
 func initFlags() {
 	commands = map[string]commandConfig{
-		"pack":   {runPack, packFlags},
-		"unpack": {runUnpack, unpackFlags},
-		"graph":  {runGraph, graphFlags},
-		"ast":    {runAST, astFlags},
-		"ir":     {runIR, irFlags},
-		"llvm":   {runLLVM, llvmFlags},
-		"help":   {runHelp, helpFlags},
+		"pack":            {runPack, packFlags},
+		"unpack":          {runUnpack, unpackFlags},
+		"graph":           {runGraph, graphFlags},
+		"ast":             {runAST, astFlags},
+		"hist":            {runHist, histFlags},
+		"ir":              {runIR, irFlags},
+		"llvm":            {runLLVM, llvmFlags},
+		"check":           {runCheck, checkFlags},
+		"check-pipeline":  {runCheckPipeline, pipelineFlags},
+		"check-roundtrip": {runCheckRoundTrip, roundFlags},
+		"diff":            {runDiff, diffFlags},
+		"coverage":        {runCoverage, coverFlags},
+		"scaffold":        {runScaffold, scaffoldFlags},
+		"run":             {runRun, runFlags},
+		"watch":           {runWatch, watchFlags},
+		"version":         {runVersion, versionFlags},
+		"help":            {runHelp, helpFlags},
 	}
 	graphFlags.BoolVar(&ascii, "ascii", false, "print as ASCII grid rather than DOT digraph")
+	graphFlags.BoolVar(&graphML, "graphml", false, "print as GraphML rather than DOT digraph")
+	graphFlags.BoolVar(&cfgStats, "print-cfg-stats", false, "print counts of blocks, edges, SCCs, and loops and the loop nesting and CFG depth")
+	graphFlags.BoolVar(&stackDepth, "print-stack-depth", false, "print the maximum stack length reachable from the entry, for sizing -stack")
 	astFlags.StringVar(&format, "format", "wsa", "output format; options: ws, wsa, wsx, wsapos, wsacomment")
-	llvmFlags.UintVar(&maxStackLen, "stack", codegen.DefaultMaxStackLen, "maximum stack length for LLVM codegen")
-	llvmFlags.UintVar(&maxCallStackLen, "calls", codegen.DefaultMaxCallStackLen, "maximum call stack length for LLVM codegen")
-	llvmFlags.UintVar(&maxHeapBound, "heap", codegen.DefaultMaxHeapBound, "maximum heap address bound for LLVM codegen")
+	astFlags.StringVar(&commentMapFile, "comment-map", "", "write the comments to a source map file, which is read back from <file>.comments when lexing")
+	astFlags.BoolVar(&strictLabels, "strict-labels", false, "report duplicate and missing labels before printing")
+	astFlags.BoolVar(&jsonDiags, "json-diagnostics", false, "print errors and warnings as JSON objects, one per line")
+	astFlags.StringVar(&wsSpec, "spec", "", "Whitespace version to validate against, rejecting later instructions; options: 0.2, 0.3")
+	astFlags.BoolVar(&stripHeader, "strip-header", false, "skip a leading UTF-8 BOM and #! line in Whitespace source")
+	irFlags.StringVar(&blockOrder, "sort", "source", "block order; options: source, rpo, id, name")
+	irFlags.BoolVar(&stackArt, "ascii-art", false, "draw the stack effect above each block")
+	irFlags.BoolVar(&verbose, "v", false, "show pseudo-ops, such as inc and dec")
+	irFlags.BoolVar(&elideFall, "elide-fallthrough", false, "omit fallthroughs to the next block printed")
+	irFlags.BoolVar(&emitGo, "go", false, "emit Go source that rebuilds the IR with ir.Builder")
+	irFlags.BoolVar(&rawIR, "raw-ir", false, "print the IR as produced by lowering, without optimization passes")
+	irFlags.BoolVar(&stackPhis, "phi", false, "show phis at block entries for values passed on the stack, keeping the stack loads")
+	irFlags.StringVar(&blockNames, "names", "label-index", "block naming; options: label-index, label, position")
+	addLLVMFlags(llvmFlags)
+	llvmFlags.BoolVar(&sharedHeap, "sharedheap", false, "share one heap between multiple programs")
+	llvmFlags.StringVar(&outFile, "o", "", "file to write the module to, as bitcode when it ends in .bc; default stdout")
 	addIRFlags(graphFlags)
 	addIRFlags(irFlags)
 	addIRFlags(llvmFlags)
+	checkFlags.StringVar(&inputFile, "in", "", "file to read program input from")
+	checkFlags.StringVar(&traceFile, "trace", "", "file to write the interpreter execution trace to")
+	addIRFlags(checkFlags)
+	addLLVMFlags(checkFlags)
+	scaffoldFlags.StringVar(&outDir, "o", ".", "directory to write the project to")
+	scaffoldFlags.BoolVar(&scaffoldLib, "lib", false, "build a static archive exposing <name>_main rather than an executable")
+	addIRFlags(pipelineFlags)
+	addIRFlags(diffFlags)
+	addIRFlags(coverFlags)
+	addIRFlags(scaffoldFlags)
+	addLLVMFlags(scaffoldFlags)
+	addIRFlags(runFlags)
+	runFlags.StringVar(&seedHeapFile, "seed-heap", "", "file of little-endian 64-bit cells to initialize the heap from")
+	addEncodingFlag(runFlags)
+	runFlags.BoolVar(&determinism, "determinism", false, "run a program without input twice and report any difference in output or final state")
+	watchFlags.StringVar(&watchStage, "stage", "ir", "command to rerun; options: ir, llvm, run, ast, graph")
+	watchFlags.DurationVar(&watchInterval, "interval", 250*time.Millisecond, "time between polls of the program")
+	watchFlags.DurationVar(&watchDebounce, "debounce", 100*time.Millisecond, "time a change must be stable before rerunning")
 	setUsage(packFlags, "pack <program>", packHeader, false)
 	setUsage(unpackFlags, "unpack <program>", unpackHeader, false)
-	setUsage(graphFlags, "graph [-ascii] [-nofold] <program>", graphHeader, true)
+	setUsage(graphFlags, "graph [-ascii] [-graphml] [-print-cfg-stats] [-print-stack-depth] [-nofold] [-passes=p] [-dump-after=p] <program>", graphHeader, true)
 	setUsage(astFlags, "ast [-format=f] <program>", astHeader, true)
-	setUsage(irFlags, "ir [-nofold] <program>", irHeader, true)
-	setUsage(llvmFlags, "llvm [-nofold] [-stack=n] [-calls=n] [-heap=n] <program>", llvmHeader, true)
+	setUsage(histFlags, "hist <program>", histHeader, false)
+	setUsage(irFlags, "ir [-nofold] [-passes=p] [-dump-after=p] [-sort=order] [-names=n] [-ascii-art] [-v] [-elide-fallthrough] [-go] [-raw-ir] [-phi] <program>", irHeader, true)
+	setUsage(llvmFlags, "llvm [-nofold] [-passes=p] [-dump-after=p] [-stack=n] [-calls=n] [-heap=n] [-sharedheap] [-overflow=o] <program>...", llvmHeader, true)
+	setUsage(checkFlags, "check [-in=file] [-trace=file] [-nofold] [-passes=p] [-stack=n] [-calls=n] [-heap=n] [-overflow=o] <program>", checkHeader, true)
+	setUsage(pipelineFlags, "check-pipeline [-nofold] [-passes=p] <program>...", pipelineHeader, true)
+	setUsage(roundFlags, "check-roundtrip <program>...", roundHeader, false)
+	setUsage(diffFlags, "diff [-nofold] [-passes=p] <program> <program>", diffHeader, true)
+	setUsage(coverFlags, "coverage [-passes=p] <program>", coverHeader, true)
+	setUsage(runFlags, "run [-nofold] [-passes=p] <program>", runHeader, true)
+	setUsage(watchFlags, "watch [-stage=s] [-interval=d] [-debounce=d] <program> [flags]", watchHeader, true)
+	setUsage(scaffoldFlags, "scaffold [-o=dir] [-lib] [-nofold] [-passes=p] [-stack=n] [-calls=n] [-heap=n] [-overflow=o] <program>", scaffoldHeader, true)
+	setUsage(versionFlags, "version", versionHeader, false)
 	helpFlags.Usage = usage
 }
 
 func addIRFlags(flags *flag.FlagSet) {
 	flags.BoolVar(&noFold, "nofold", false, "disable constant folding")
+	flags.StringVar(&passNames, "passes", "", "comma-separated optimization passes to run (default trim,fold,dce,phi)")
+	flags.StringVar(&dumpAfter, "dump-after", "", "print IR to stderr after the named pass")
+	flags.BoolVar(&checkStack, "check-stack", false, "warn on stack accesses that may exceed the stack length on some path")
+	flags.BoolVar(&remarks, "remarks", false, "report labels merged into adjacent labels and values folded, replaced, or removed by each pass as notes")
+	flags.BoolVar(&warnUninit, "warn-uninit", false, "warn on heap loads that may read the zero-initialized heap before any store")
+	flags.IntVar(&maxTokens, "max-tokens", 0, "maximum tokens to lex before aborting; 0 is unlimited")
+	flags.StringVar(&wsSpec, "spec", "", "Whitespace version to validate against, rejecting later instructions; options: 0.2, 0.3")
+	flags.BoolVar(&stripHeader, "strip-header", false, "skip a leading UTF-8 BOM and #! line in Whitespace source")
+	flags.IntVar(&maxInsts, "max-insts", 0, "maximum IR instructions to lower before aborting; 0 is unlimited")
+	flags.IntVar(&maxBlocks, "max-blocks", 0, "maximum basic blocks to lower before aborting; 0 is unlimited")
+	flags.BoolVar(&jsonDiags, "json-diagnostics", false, "print errors and warnings as JSON objects, one per line")
+	flags.IntVar(&bfCellBits, "bf-cell-bits", 0, "wrap Brainfuck cells to the given width; 0 is unbounded")
+	flags.IntVar(&bfTapeSize, "bf-tape", 0, "number of Brainfuck cells, with the pointer wrapping around; 0 is unbounded")
+	flags.IntVar(&bfMaxNesting, "bf-max-nesting", 0, "maximum depth of nested Brainfuck brackets; 0 is unlimited")
+	flags.StringVar(&bfEOF, "bf-eof", "unchanged", "Brainfuck cell value after , at EOF; options: unchanged, zero, negone")
+}
+
+func addLLVMFlags(flags *flag.FlagSet) {
+	flags.UintVar(&maxStackLen, "stack", codegen.DefaultMaxStackLen, "maximum stack length for LLVM codegen")
+	flags.UintVar(&maxCallStackLen, "calls", codegen.DefaultMaxCallStackLen, "maximum call stack length for LLVM codegen")
+	flags.UintVar(&maxHeapBound, "heap", codegen.DefaultMaxHeapBound, "maximum heap address bound for LLVM codegen")
+	flags.StringVar(&arithOverflow, "overflow", "wrap", "behavior of overflowing arithmetic; options: wrap, trap, nsw")
+	flags.BoolVar(&stackTraps, "stack-traps", false, "guard each block with one stack length check branching to a shared trap block")
+	flags.BoolVar(&allocaStack, "alloca-stack", false, "allocate the stack in the program function, rather than as a global, so LLVM can optimize it")
+	flags.BoolVar(&growableHeap, "growable-heap", false, "grow the heap at runtime to fit any address, rather than allocating -heap cells")
+	flags.BoolVar(&blockFuncs, "block-funcs", false, "emit each basic block as a function tail calling its successors, for per-block profiling; the output must be built with optimization, or long-running programs overflow the C stack")
+	flags.StringVar(&seedHeapFile, "seed-heap", "", "file of little-endian 64-bit cells to initialize the heap from")
+	addEncodingFlag(flags)
+}
+
+func addEncodingFlag(flags *flag.FlagSet) {
+	flags.StringVar(&outputEncoding, "encoding", "byte", "encoding of printc output; options: byte, utf8")
 }
 
 func setUsage(flags *flag.FlagSet, usage, header string, printFlags bool) {
@@ -156,12 +374,19 @@ func readFile(args []string) (string, []byte) {
 	return filename, src
 }
 
-func lexWS(src []byte, filename string) *ws.Program {
+func lexWS(src []byte, filename string) (*ws.Program, error) {
 	fset := token.NewFileSet()
-	file := fset.AddFile(filename, -1, len(src))
-	tokens, err := ws.LexTokens(file, src)
+	return lexWSFile(fset.AddFile(filename, -1, len(src)), src, filename)
+}
+
+func lexWSFile(file *token.File, src []byte, filename string) (*ws.Program, error) {
+	spec, err := ws.ParseSpec(wsSpec)
 	if err != nil {
-		exitError(err)
+		return nil, err
+	}
+	tokens, err := ws.LexTokensOptions(file, src, ws.LexOptions{MaxTokens: maxTokens, Comments: lexComments, Spec: spec, StripHeader: stripHeader})
+	if err != nil {
+		return nil, err
 	}
 	program := &ws.Program{Tokens: tokens, File: file}
 
@@ -169,76 +394,245 @@ func lexWS(src []byte, filename string) *ws.Program {
 	if info, err := os.Stat(mapFilename); err == nil && !info.IsDir() {
 		labelMap, err := os.Open(mapFilename)
 		if err != nil {
-			exitError(err)
+			return nil, err
 		}
 		defer labelMap.Close()
 		labelNames, err := ws.ParseLabelMap(labelMap)
 		if err != nil {
-			exitError(err)
+			return nil, err
 		}
 		ws.ApplyLabelMap(tokens, labelNames)
 	}
-	return program
+
+	commentFilename := filename + ".comments"
+	if info, err := os.Stat(commentFilename); lexComments && err == nil && !info.IsDir() {
+		commentMap, err := os.Open(commentFilename)
+		if err != nil {
+			return nil, err
+		}
+		defer commentMap.Close()
+		comments, err := ws.ParseCommentMap(commentMap)
+		if err != nil {
+			return nil, err
+		}
+		ws.ApplyCommentMap(tokens, comments)
+	}
+	return program, nil
 }
 
-func lexBF(src []byte, filename string) *bf.Program {
+func lexBF(src []byte, filename string) (*bf.Program, error) {
 	fset := token.NewFileSet()
 	file := fset.AddFile(filename, -1, len(src))
 	tokens, err := bf.LexTokens(file, src)
 	if err != nil {
-		exitError(err)
+		return nil, err
+	}
+	return &bf.Program{Tokens: tokens, File: file, Options: bf.Options{
+		CellBits:   bfCellBits,
+		Wrap:       bfCellBits > 0,
+		TapeSize:   bfTapeSize,
+		MaxNesting: bfMaxNesting,
+		EOF:        bfEOFPolicy(bfEOF),
+	}}, nil
+}
+
+func bfEOFPolicy(policy string) bf.EOFPolicy {
+	switch policy {
+	case "unchanged":
+		return bf.LeaveUnchanged
+	case "zero":
+		return bf.Zero
+	case "negone":
+		return bf.NegOne
 	}
-	return &bf.Program{Tokens: tokens, File: file}
+	exitErrorf("Unknown Brainfuck EOF policy: %s.", policy)
+	panic("unreachable")
+}
+
+// registerFrontends registers the built-in frontends by file
+// extension.
+func registerFrontends() {
+	lexWSFrontend := func(filename string, src []byte) (frontend.Frontend, error) {
+		program, _, err := parseFileWS(src, filename)
+		if err != nil {
+			return nil, err
+		}
+		aliases := program.CanonicalizeLabels()
+		if remarks {
+			for _, alias := range aliases {
+				report(alias)
+			}
+		}
+		program.MaxInsts = maxInsts
+		program.MaxBlocks = maxBlocks
+		program.MaxStackLen = int(maxStackLen)
+		program.NamePolicy = namePolicy(blockNames)
+		return program, nil
+	}
+	frontend.Register(".ws", lexWSFrontend)
+	frontend.Register(".wsa", lexWSFrontend)
+	frontend.Register(".wsx", lexWSFrontend)
+	frontend.Register(".bf", func(filename string, src []byte) (frontend.Frontend, error) {
+		return lexBF(src, filename)
+	})
 }
 
 func lexFileWS(src []byte, filename string) (*ws.Program, []byte) {
+	program, src, err := parseFileWS(src, filename)
+	if err != nil {
+		exitDiagnostic(err)
+	}
+	return program, src
+}
+
+func parseFileWS(src []byte, filename string) (*ws.Program, []byte, error) {
 	switch {
 	case strings.HasSuffix(filename, ".ws"):
-		return lexWS(src, filename), src
+		program, err := lexWS(src, filename)
+		return program, src, err
 	case strings.HasSuffix(filename, ".wsa"):
-		exitError("WSA lexing not implemented.")
+		file := token.NewFileSet().AddFile(filename, -1, len(src))
+		tokens, err := wsa.LexOptions(file, src, wsa.Options{Comments: lexComments})
+		if err != nil {
+			return nil, nil, err
+		}
+		return &ws.Program{Tokens: tokens, File: file}, src, nil
 	case strings.HasSuffix(filename, ".wsx"):
-		src = ws.Unpack(src)
-		return lexWS(src, filename), src
-	default:
-		exitError("Unrecognized file type: " + filename)
+		file, src := ws.UnpackFile(token.NewFileSet(), filename, src)
+		program, err := lexWSFile(file, src, filename)
+		return program, src, err
 	}
-	panic("unreachable")
+	return nil, nil, fmt.Errorf("unrecognized file type: %s", filename)
 }
 
 func convertSSA(args []string) *ir.Program {
+	return convertSSAPasses(args, selectPasses())
+}
+
+func convertSSAPasses(args []string, passes []optimize.Pass) *ir.Program {
 	filename, src := readFile(args)
-	var program interface{ LowerIR() (*ir.Program, []error) }
-	if strings.HasSuffix(filename, ".bf") {
-		program = lexBF(src, filename)
-	} else {
-		program, _ = lexFileWS(src, filename)
+	program, err := frontend.Lex(filename, src)
+	if err != nil {
+		exitDiagnostic(err)
 	}
 	ssa, errs := program.LowerIR()
-	if len(errs) != 0 {
-		fatal := false
-		for _, err := range errs {
-			if _, ok := err.(*ir.RetUnderflowError); !ok {
-				fatal = true
-			}
-			fmt.Fprintln(os.Stderr, err)
-		}
-		if fatal {
-			os.Exit(1)
+	reportErrors(errs)
+	opts := optimize.PassOptions{DumpAfter: dumpAfter, Dump: os.Stderr}
+	if remarks {
+		opts.Remarks = func(r *optimize.Remark) { report(r) }
+	}
+	reportErrors(optimize.RunPasses(ssa, passes, opts))
+	// IR left malformed by a pass is a compiler bug, which is clearer
+	// reported here, naming the broken invariant, than as a crash in
+	// codegen or a wrong result from the interpreter.
+	reportErrors(ssa.Verify())
+	for _, warning := range optimize.CheckUnprintedReads(ssa) {
+		report(warning)
+	}
+	if checkStack {
+		for _, err := range optimize.CheckStackBounds(ssa) {
+			report(err)
 		}
 	}
-	ssa.TrimUnreachable()
-	if !noFold {
-		optimize.FoldConstArith(ssa)
+	if warnUninit {
+		for _, warning := range optimize.CheckUninitializedLoads(ssa) {
+			report(warning)
+		}
 	}
 	return ssa
 }
 
+// selectPasses returns the passes given by -passes, or the default
+// pipeline, without fold if -nofold is set and adapted to overflow
+// traps if -overflow=trap is set.
+func selectPasses() []optimize.Pass {
+	passes := optimize.Passes
+	if passNames != "" {
+		var err error
+		if passes, err = optimize.ParsePasses(passNames); err != nil {
+			usageError(err)
+		}
+	}
+	if noFold {
+		passes = withoutPass(passes, "fold")
+	}
+	if arithOverflow == "trap" {
+		passes = optimize.TrapOverflowPasses(passes)
+	}
+	if dumpAfter != "" {
+		if err := checkDumpAfter(passes, dumpAfter); err != nil {
+			usageError(err)
+		}
+	}
+	// A seeded heap breaks the assumption that a load before any store
+	// reads 0.
+	if seedHeapFile != "" {
+		if warnUninit {
+			usageError("-seed-heap cannot be used with -warn-uninit, which assumes a zero-initialized heap")
+		}
+		if hasPass(passes, "mem2reg") {
+			usageError("-seed-heap cannot be used with the mem2reg pass, which assumes a zero-initialized heap")
+		}
+	}
+	return passes
+}
+
+// checkDumpAfter reports whether name, given by -dump-after, is a pass
+// that runs in the selected pipeline, so that no dump is silently
+// skipped.
+func checkDumpAfter(passes []optimize.Pass, name string) error {
+	if _, ok := optimize.LookupPass(name); !ok {
+		return fmt.Errorf("unknown pass: %s", name)
+	}
+	if !hasPass(passes, name) {
+		return fmt.Errorf("pass not in pipeline: %s", name)
+	}
+	return nil
+}
+
+// hasPass returns whether the passes include one with the given name.
+func hasPass(passes []optimize.Pass, name string) bool {
+	for _, pass := range passes {
+		if pass.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPass returns the passes without those with the given name.
+func withoutPass(passes []optimize.Pass, name string) []optimize.Pass {
+	var rest []optimize.Pass
+	for _, pass := range passes {
+		if pass.Name != name {
+			rest = append(rest, pass)
+		}
+	}
+	return rest
+}
+
+func namePolicy(names string) ir.NamePolicy {
+	switch names {
+	case "", "label-index":
+		return ir.LabelIndexNames
+	case "label":
+		return ir.LabelNames
+	case "position":
+		return ir.PositionNames
+	}
+	exitErrorf("Unknown block naming: %s.", names)
+	panic("unreachable")
+}
+
 func runPack(args []string) {
 	filename, src := readFile(args)
 	switch {
 	case strings.HasSuffix(filename, ".wsa"):
-		exitError("WSA lexing not implemented.")
+		program, _ := lexFileWS(src, filename)
+		if err := ws.PackTokens(os.Stdout, program.Tokens); err != nil {
+			exitError(err)
+		}
+		return
 	case strings.HasSuffix(filename, ".wsx"):
 		usageError("Program is already packed.")
 	}
@@ -252,9 +646,20 @@ func runUnpack(args []string) {
 
 func runGraph(args []string) {
 	ssa := convertSSA(args)
-	if !ascii {
+	switch {
+	case cfgStats:
+		fmt.Print(optimize.ComputeCFGStats(ssa))
+	case stackDepth:
+		if depth, ok := ssa.MaxStackDepth(); ok {
+			fmt.Printf("max stack depth: %d\n", depth)
+		} else {
+			fmt.Println("max stack depth: unbounded")
+		}
+	case graphML:
+		fmt.Print(ssa.GraphML())
+	case !ascii:
 		fmt.Print(ssa.DotDigraph())
-	} else {
+	default:
 		labels := make([]string, len(ssa.Blocks))
 		for i, block := range ssa.Blocks {
 			labels[i] = block.Name()
@@ -263,44 +668,422 @@ func runGraph(args []string) {
 	}
 }
 
+func runHist(args []string) {
+	filename, src := readFile(args)
+	program, _ := lexFileWS(src, filename)
+	fmt.Print(ws.FormatHistogram(ws.Histogram(program.Tokens)))
+}
+
 func runAST(args []string) {
 	filename, src := readFile(args)
 	if strings.HasSuffix(filename, ".bf") {
 		panic("BF printing not implemented")
 	}
-	program, src := lexFileWS(src, filename)
+	lexComments = format == "wsacomment" || commentMapFile != ""
+	program, _ := lexFileWS(src, filename)
+	if strictLabels {
+		if errs := program.CheckLabels(); len(errs) != 0 {
+			for _, err := range errs {
+				report(err)
+			}
+			os.Exit(1)
+		}
+	}
 	switch format {
 	case "ws":
 		fmt.Print(program.DumpWS())
 	case "wsa":
 		fmt.Print(program.Dump("    "))
 	case "wsx":
-		fmt.Print(string(ws.Pack([]byte(program.DumpWS()))))
+		if err := ws.PackTokens(os.Stdout, program.Tokens); err != nil {
+			exitError(err)
+		}
 	case "wsapos":
 		fmt.Print(program.DumpPos())
 	case "wsacomment":
-		fmt.Print(program.DumpCommented(src, "    "))
+		fmt.Print(program.DumpComments("    "))
 	default:
 		exitErrorf("Unknown format: %s.", format)
 	}
+	if commentMapFile != "" {
+		if err := ioutil.WriteFile(commentMapFile, []byte(ws.FormatCommentMap(program.Tokens)), 0644); err != nil {
+			exitError(err)
+		}
+	}
+}
+
+// rawIRConflict returns the name of a set pass flag, which -raw-ir
+// would otherwise ignore, or "" when there is none.
+func rawIRConflict() string {
+	switch {
+	case passNames != "":
+		return "passes"
+	case noFold:
+		return "nofold"
+	case dumpAfter != "":
+		return "dump-after"
+	case remarks:
+		return "remarks"
+	}
+	return ""
 }
 
 func runIR(args []string) {
-	program := convertSSA(args)
-	fmt.Print(program.String())
+	var program *ir.Program
+	if rawIR {
+		if flag := rawIRConflict(); flag != "" {
+			usageErrorf("-raw-ir cannot be used with -%s", flag)
+		}
+		program = convertSSAPasses(args, nil)
+	} else {
+		program = convertSSA(args)
+	}
+	if stackPhis {
+		optimize.InsertStackPhis(program)
+	}
+	if emitGo {
+		src, err := ir.EmitGoBuilder(program)
+		if err != nil {
+			exitError(err)
+		}
+		fmt.Print(src)
+		return
+	}
+	f := ir.NewFormatter()
+	f.StackArt = stackArt
+	f.Verbose = verbose
+	f.ElideFallthrough = elideFall
+	switch blockOrder {
+	case "source":
+		f.BlockOrder = ir.SourceOrder
+	case "rpo":
+		f.BlockOrder = ir.RPOOrder
+	case "id":
+		f.BlockOrder = ir.IDOrder
+	case "name":
+		f.BlockOrder = ir.NameOrder
+	default:
+		exitErrorf("Unknown block order: %s.", blockOrder)
+	}
+	fmt.Print(f.FormatProgram(program))
 }
 
 func runLLVM(args []string) {
-	program := convertSSA(args)
-	mod, err := codegen.EmitLLVMModule(program, codegen.Config{
+	config := llvmConfig()
+	var mod llvm.Module
+	var err error
+	if len(args) > 1 {
+		programs := make([]*ir.Program, len(args))
+		for i, arg := range args {
+			programs[i] = convertSSA([]string{arg})
+			warnCallDepth(programs[i])
+		}
+		mod, err = codegen.EmitLLVMModules(programs, config)
+	} else {
+		program := convertSSA(args)
+		warnCallDepth(program)
+		mod, err = codegen.EmitLLVMModule(program, config)
+	}
+	if err != nil {
+		exitError(err)
+	}
+	if outFile == "" {
+		fmt.Print(mod.String())
+		return
+	}
+	f, err := os.Create(outFile)
+	if err != nil {
+		exitError(err)
+	}
+	err = codegen.WriteModule(f, mod, strings.HasSuffix(outFile, ".bc"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		exitError(err)
+	}
+}
+
+// warnCallDepth warns when the call stack of the program may overflow
+// in LLVM codegen.
+func warnCallDepth(program *ir.Program) {
+	if w := optimize.CheckCallDepth(program, maxCallStackLen); w != nil {
+		report(w)
+	}
+}
+
+func llvmConfig() codegen.Config {
+	config := codegen.Config{
 		MaxStackLen:     maxStackLen,
 		MaxCallStackLen: maxCallStackLen,
 		MaxHeapBound:    maxHeapBound,
-	})
+		SharedHeap:      sharedHeap,
+		StackTraps:      stackTraps,
+		AllocaStack:     allocaStack,
+		GrowableHeap:    growableHeap,
+		BlockFuncs:      blockFuncs,
+		OutputEncoding:  encoding(),
+		HeapImage:       seedHeap(),
+	}
+	switch arithOverflow {
+	case "wrap":
+		config.ArithOverflow = codegen.Wrap
+	case "trap":
+		config.ArithOverflow = codegen.Trap
+	case "nsw":
+		config.ArithOverflow = codegen.NoSignedWrap
+	default:
+		exitErrorf("Unknown overflow behavior: %s.", arithOverflow)
+	}
+	return config
+}
+
+// encoding returns the printc output encoding given by -encoding.
+func encoding() ir.OutputEncoding {
+	switch outputEncoding {
+	case "byte":
+		return ir.Byte
+	case "utf8":
+		return ir.UTF8
+	}
+	exitErrorf("Unknown output encoding: %s.", outputEncoding)
+	panic("unreachable")
+}
+
+// seedHeap reads the heap image given by -seed-heap, if any.
+func seedHeap() []int64 {
+	if seedHeapFile == "" {
+		return nil
+	}
+	image, err := heapimage.ReadFile(seedHeapFile)
+	if err != nil {
+		exitError(err)
+	}
+	return image
+}
+
+func runScaffold(args []string) {
+	program := convertSSA(args)
+	warnCallDepth(program)
+	var mod llvm.Module
+	var err error
+	if scaffoldLib {
+		mod, err = codegen.EmitLLVMModules([]*ir.Program{program}, llvmConfig())
+	} else {
+		mod, err = codegen.EmitLLVMModule(program, llvmConfig())
+	}
+	if err != nil {
+		exitError(err)
+	}
+	scaffold := &codegen.Scaffold{
+		Name:    codegen.ProgramPrefixes([]*ir.Program{program})[0],
+		LLVMIR:  mod.String(),
+		Runtime: runtimeSource,
+		Library: scaffoldLib,
+	}
+	if err := scaffold.Write(outDir); err != nil {
+		exitError(err)
+	}
+}
+
+func runRun(args []string) {
+	program := convertSSA(args)
+	if determinism {
+		out, err := interp.CheckDeterminism(program, seedHeap(), encoding())
+		fmt.Print(out)
+		if err != nil {
+			exitError(err)
+		}
+		return
+	}
+	vm := interp.NewInterp(program, os.Stdin, os.Stdout)
+	vm.SeedHeap(seedHeap())
+	vm.SetOutputEncoding(encoding())
+	if err := vm.Run(); err != nil {
+		exitError(err)
+	}
+}
+
+func runCoverage(args []string) {
+	var passes []optimize.Pass
+	if passNames != "" {
+		passes = selectPasses()
+	}
+	program := convertSSAPasses(args, passes)
+	vm := interp.NewInterp(program, os.Stdin, os.Stderr)
+	vm.Profile()
+	err := vm.Run()
+	fmt.Print(interp.FormatCoverage(program.File, interp.Coverage(program, vm.BlockCounts())))
+	if err != nil {
+		exitError(err)
+	}
+}
+
+func runWatch(args []string) {
+	if len(args) == 0 {
+		usageError("No program provided.")
+	}
+	if _, ok := commands[watchStage]; !ok || watchStage == "watch" || watchStage == "help" {
+		exitErrorf("Unknown stage: %s.", watchStage)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		exitError(err)
+	}
+	filename := args[0]
+	stageArgs := append(append([]string{watchStage}, args[1:]...), filename)
+	rerun := func() {
+		fmt.Fprintf(os.Stderr, "--- %s %s %s\n", time.Now().Format("15:04:05"), watchStage, filename)
+		cmd := exec.Command(self, stageArgs...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	rerun()
+	poller := &watch.Poller{Path: filename, Interval: watchInterval, Debounce: watchDebounce}
+	if err := poller.Watch(context.Background(), rerun); err != nil {
+		exitError(err)
+	}
+}
+
+func runCheck(args []string) {
+	if !jit.Available {
+		exitError(jit.ErrUnavailable)
+	}
+	var in []byte
+	if inputFile != "" {
+		var err error
+		if in, err = ioutil.ReadFile(inputFile); err != nil {
+			exitError(err)
+		}
+	}
+	program := convertSSA(args)
+	warnCallDepth(program)
+
+	var want bytes.Buffer
+	vm := interp.NewInterp(program, bytes.NewReader(in), &want)
+	vm.SeedHeap(seedHeap())
+	vm.SetOutputEncoding(encoding())
+	var trace *bufio.Writer
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			exitError(err)
+		}
+		defer f.Close()
+		trace = bufio.NewWriter(f)
+		vm.Trace(trace)
+	}
+	interpErr := vm.Run()
+	if trace != nil {
+		if err := trace.Flush(); err != nil {
+			exitError(err)
+		}
+	}
+	mod, err := codegen.EmitLLVMModule(program, llvmConfig())
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		exitError(err)
+	}
+	got, code, err := jit.Run(mod, "main", in)
+	if err != nil {
+		exitError(err)
+	}
+
+	diverged := false
+	if (interpErr != nil) != (code != 0) {
+		fmt.Fprintf(os.Stderr, "Exit status differs: interpreter: %v, LLVM: exit %d\n", interpErr, code)
+		diverged = true
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		i := 0
+		for i < len(got) && i < len(want.Bytes()) && got[i] == want.Bytes()[i] {
+			i++
+		}
+		fmt.Fprintf(os.Stderr, "Output differs at byte %d:\n  interpreter: %q\n  LLVM:        %q\n",
+			i, divergence(want.Bytes(), i), divergence(got, i))
+		diverged = true
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+// divergence returns the output surrounding the first differing byte.
+func divergence(out []byte, i int) []byte {
+	const context = 32
+	lo, hi := i-context, i+context
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(out) {
+		hi = len(out)
+	}
+	return out[lo:hi]
+}
+
+func runCheckPipeline(args []string) {
+	if len(args) == 0 {
+		usageError("No program provided.")
+	}
+	passes := selectPasses()
+	failed := false
+	for _, filename := range args {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			exitError(err)
+		}
+		if err := pipeline.Check(filename, src, pipeline.Options{Passes: passes}); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s failed\n", filename, err.Stage)
+			for _, err := range err.Errs {
+				report(err)
+			}
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runCheckRoundTrip(args []string) {
+	if len(args) == 0 {
+		usageError("No program provided.")
+	}
+	failed := false
+	for _, filename := range args {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			exitError(err)
+		}
+		program, _ := lexFileWS(src, filename)
+		if err := program.CheckRoundTrip(); err != nil {
+			report(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
-	fmt.Print(mod.String())
+}
+
+func runDiff(args []string) {
+	if len(args) != 2 {
+		usageError("Two programs required.")
+	}
+	a, b := convertSSA(args[:1]), convertSSA(args[1:])
+	fmt.Printf("--- %s\n+++ %s\n", args[0], args[1])
+	fmt.Print(ir.DiffOutlines(a.Outline(), b.Outline()))
+}
+
+func runVersion(args []string) {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	fmt.Printf("nebula %s\n", version)
+	fmt.Printf("go     %s\n", runtime.Version())
+	fmt.Printf("llvm   %s\n", codegen.LLVMVersion())
 }
 
 func runHelp(args []string) {
@@ -315,6 +1098,32 @@ func runHelp(args []string) {
 	os.Exit(2)
 }
 
+// report prints an error or warning to stderr as a diagnostic.
+func report(err error) {
+	p := &diag.Printer{W: os.Stderr, JSON: jsonDiags}
+	p.Print(err)
+}
+
+// reportErrors reports each error and exits if any is an error rather
+// than a warning.
+func reportErrors(errs []error) {
+	fatal := false
+	for _, err := range errs {
+		if diag.From(err).Severity == diag.Error {
+			fatal = true
+		}
+		report(err)
+	}
+	if fatal {
+		os.Exit(1)
+	}
+}
+
+func exitDiagnostic(err error) {
+	report(err)
+	os.Exit(1)
+}
+
 func exitError(msg interface{}) {
 	fmt.Fprintln(os.Stderr, msg)
 	os.Exit(1)
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir/optimize"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestDispatchHist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nebula")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "prog.ws")
+	src := "   \t\n" + // push 1
+		" \n " + // dup
+		"\t\n \t" + // printi
+		"\t\n \t" + // printi
+		"\n\n\n" // end
+	if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	initDispatch()
+	out := captureStdout(t, func() { dispatch([]string{"hist", filename}) })
+	want := "" +
+		"stack           2\n" +
+		"  push          1\n" +
+		"  dup           1\n" +
+		"control         1\n" +
+		"  end           1\n" +
+		"io              2\n" +
+		"  printi        2\n" +
+		"total           5\n"
+	if out != want {
+		t.Errorf("hist output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestDispatchRawIR(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nebula")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "prog.ws")
+	src := " \n " + // dup
+		"\t  \t" + // sub      ; folds to 0
+		"\t\n \t" + // printi
+		"\n\n\n" // end
+	if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	initDispatch()
+	defer func(raw bool) { rawIR = raw }(rawIR)
+	raw := captureStdout(t, func() { dispatch([]string{"ir", "-raw-ir", filename}) })
+	rawIR = false
+	optimized := captureStdout(t, func() { dispatch([]string{"ir", filename}) })
+	for _, want := range []string{"accessstack 1", "loadstack 1", "sub"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("raw IR does not contain %q:\n%s", want, raw)
+		}
+	}
+	if !strings.Contains(optimized, "accessstack 1") {
+		t.Errorf("optimized IR does not contain stack access:\n%s", optimized)
+	}
+	if strings.Contains(optimized, "sub") {
+		t.Errorf("optimized IR contains folded sub:\n%s", optimized)
+	}
+}
+
+func TestRawIRConflict(t *testing.T) {
+	defer func(names string, fold bool, dump string, rem bool) {
+		passNames, noFold, dumpAfter, remarks = names, fold, dump, rem
+	}(passNames, noFold, dumpAfter, remarks)
+	passNames, noFold, dumpAfter, remarks = "", false, "", false
+	if flag := rawIRConflict(); flag != "" {
+		t.Errorf("got conflict with -%s, want none", flag)
+	}
+	dumpAfter = "dce"
+	if flag := rawIRConflict(); flag != "dump-after" {
+		t.Errorf("got conflict with %q, want dump-after", flag)
+	}
+}
+
+var dispatchOnce sync.Once
+
+// initDispatch registers the commands and frontends once, since flags
+// cannot be defined twice.
+func initDispatch() {
+	dispatchOnce.Do(func() {
+		initFlags()
+		registerFrontends()
+	})
+}
+
+// captureStdout returns what fn writes to standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestSelectPassesOverflowTrap(t *testing.T) {
+	defer func(names, overflow string) { passNames, arithOverflow = names, overflow }(passNames, arithOverflow)
+	passNames = "fold,mulchain,dce"
+	for _, test := range []struct {
+		Overflow string
+		Passes   string
+	}{
+		{"wrap", "fold,mulchain,dce"},
+		{"trap", "fold,dce"},
+	} {
+		arithOverflow = test.Overflow
+		var names []string
+		for _, pass := range selectPasses() {
+			names = append(names, pass.Name)
+		}
+		if got := strings.Join(names, ","); got != test.Passes {
+			t.Errorf("-overflow=%s: got passes %s, want %s", test.Overflow, got, test.Passes)
+		}
+	}
+}
+
+func TestCheckDumpAfter(t *testing.T) {
+	for _, test := range []struct {
+		Name string
+		Err  string
+	}{
+		{"dce", ""},
+		{"licm", "pass not in pipeline: licm"},
+		{"nope", "unknown pass: nope"},
+	} {
+		err := checkDumpAfter(optimize.Passes, test.Name)
+		if got := fmt.Sprint(err); err == nil && test.Err != "" || err != nil && got != test.Err {
+			t.Errorf("-dump-after=%s: got error %v, want %q", test.Name, err, test.Err)
+		}
+	}
+}
+
+func TestSelectPassesOverflowTrapKeepsArith(t *testing.T) {
+	defer func(names, overflow string) { passNames, arithOverflow = names, overflow }(passNames, arithOverflow)
+	passNames = ""
+	max := big.NewInt(math.MaxInt64)
+	// push 2^63-1
+	// push 1
+	// add       ; unused, but overflows
+	// drop
+	// push 2^63-1
+	// push 2^63-1
+	// mul       ; overflows when folded
+	// printi
+	// end
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: max},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Drop},
+		{Type: ws.Push, Arg: max},
+		{Type: ws.Push, Arg: max},
+		{Type: ws.Mul},
+		{Type: ws.Printi},
+		{Type: ws.End},
+	}
+	for _, test := range []struct {
+		Overflow string
+		Kept     bool
+	}{
+		{"wrap", false},
+		{"trap", true},
+	} {
+		arithOverflow = test.Overflow
+		file := token.NewFileSet().AddFile("overflow.ws", -1, 0)
+		p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		if errs := optimize.RunPasses(p, selectPasses(), optimize.PassOptions{}); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		ir := p.String()
+		for _, op := range []string{"add", "mul"} {
+			if kept := strings.Contains(ir, op); kept != test.Kept {
+				t.Errorf("-overflow=%s: %s kept is %t, want %t:\n%s", test.Overflow, op, kept, test.Kept, ir)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package pipeline runs every stage of compilation on a program without
+// producing output, to check that a corpus of programs compiles.
+package pipeline // import "github.com/andrewarchi/nebula/pipeline"
+
+import (
+	"fmt"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/frontend"
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/optimize"
+)
+
+// StageError is an error from a stage of the pipeline. Stages are lex,
+// lower, verify, pass NAME, and codegen. A pass fails when it panics
+// or leaves the program failing verification.
+type StageError struct {
+	Stage string
+	Errs  []error
+}
+
+// Options configures the stages of the pipeline.
+type Options struct {
+	Passes  []optimize.Pass
+	Codegen func(p *ir.Program) error // Defaults to MockCodegen
+}
+
+// Check runs the program through lexing, lowering, verification, each
+// optimization pass, and codegen, in order, and returns the first stage
+// that fails. Warnings do not fail a stage.
+func Check(filename string, src []byte, opts Options) *StageError {
+	f, err := frontend.Lex(filename, src)
+	if err != nil {
+		return &StageError{"lex", []error{err}}
+	}
+	p, errs := f.LowerIR()
+	if errs = fatalErrors(errs); len(errs) != 0 || p == nil {
+		return &StageError{"lower", errs}
+	}
+	if errs := p.Verify(); len(errs) != 0 {
+		return &StageError{"verify", errs}
+	}
+	for _, pass := range opts.Passes {
+		stage := "pass " + pass.Name
+		if err := runPass(p, pass); err != nil {
+			return &StageError{stage, []error{err}}
+		}
+		if errs := p.Verify(); len(errs) != 0 {
+			return &StageError{stage, errs}
+		}
+	}
+	codegen := opts.Codegen
+	if codegen == nil {
+		codegen = MockCodegen
+	}
+	if err := protect(func() error { return codegen(p) }); err != nil {
+		return &StageError{"codegen", []error{err}}
+	}
+	return nil
+}
+
+func fatalErrors(errs []error) []error {
+	var fatal []error
+	for _, err := range errs {
+		if diag.From(err).Severity == diag.Error {
+			fatal = append(fatal, err)
+		}
+	}
+	return fatal
+}
+
+func runPass(p *ir.Program, pass optimize.Pass) error {
+	return protect(func() error {
+		if err := pass.Run(p); err != nil && diag.From(err).Severity == diag.Error {
+			return err
+		}
+		return nil
+	})
+}
+
+// protect converts a panic in fn to an error.
+func protect(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// MockCodegen checks that LLVM codegen supports the program without
+// emitting a module. Constants must fit in 64 bits.
+func MockCodegen(p *ir.Program) error {
+	for _, block := range p.Blocks {
+		insts := append(block.Nodes[:len(block.Nodes):len(block.Nodes)], block.Terminator)
+		for _, inst := range insts {
+			user, ok := inst.(ir.User)
+			if !ok {
+				continue
+			}
+			for _, use := range user.Operands() {
+				if c, ok := use.Def().(*ir.IntConst); ok {
+					if _, ok := bigint.ToInt64(c.Int()); !ok {
+						return fmt.Errorf("%v: value overflows 64 bits: %v", p.File.Position(c.Pos()), c)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (err *StageError) Error() string {
+	if len(err.Errs) == 0 {
+		return err.Stage + " failed"
+	}
+	return fmt.Sprintf("%s failed: %v", err.Stage, err.Errs[0])
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/frontend"
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ir/optimize"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func init() {
+	frontend.Register(".ws", func(filename string, src []byte) (frontend.Frontend, error) {
+		file := token.NewFileSet().AddFile(filename, -1, len(src))
+		tokens, err := ws.LexTokens(file, src)
+		if err != nil {
+			return nil, err
+		}
+		return &ws.Program{Tokens: tokens, File: file}, nil
+	})
+}
+
+func TestCheck(t *testing.T) {
+	const (
+		push1  = "   \t\n"
+		printi = "\t\n \t"
+		exit   = "\n\n\n"
+		jmp1   = "\n \n\t\n"
+	)
+	panicPass := optimize.Pass{Name: "boom", Run: func(p *ir.Program) error { panic("boom") }}
+	tests := []struct {
+		filename, src string
+		passes        []optimize.Pass
+		stage         string
+	}{
+		{"ok.ws", push1 + printi + exit, optimize.Passes, ""},
+		{"bad.txt", exit, nil, "lex"},
+		{"lex.ws", "\t\n\n", nil, "lex"},
+		{"label.ws", jmp1 + exit, nil, "lower"},
+		{"pass.ws", push1 + printi + exit, []optimize.Pass{panicPass}, "pass boom"},
+		{"big.ws", "   \t" + strings.Repeat(" ", 70) + "\n" + printi + exit, nil, "codegen"},
+	}
+	for _, tt := range tests {
+		err := Check(tt.filename, []byte(tt.src), Options{Passes: tt.passes})
+		switch {
+		case tt.stage == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.filename, err)
+		case tt.stage != "" && err == nil:
+			t.Errorf("%s: expected %s to fail", tt.filename, tt.stage)
+		case err != nil && err.Stage != tt.stage:
+			t.Errorf("%s: got failing stage %q, want %q: %v", tt.filename, err.Stage, tt.stage, err)
+		}
+	}
+}
+
+func TestCheckMem2Reg(t *testing.T) {
+	// push 0; push 5; store
+	// loop:
+	//   push 0; retrieve; dup; printi
+	//   push 1; sub; dup; push 0; swap; store
+	//   jz end; jmp loop
+	// end: end
+	loop, end := big.NewInt(1), big.NewInt(2)
+	program := &ws.Program{Tokens: []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Push, Arg: big.NewInt(5)},
+		{Type: ws.Store},
+		{Type: ws.Label, Arg: loop},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Retrieve},
+		{Type: ws.Dup},
+		{Type: ws.Printi},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Sub},
+		{Type: ws.Dup},
+		{Type: ws.Push, Arg: big.NewInt(0)},
+		{Type: ws.Swap},
+		{Type: ws.Store},
+		{Type: ws.Jz, Arg: end},
+		{Type: ws.Jmp, Arg: loop},
+		{Type: ws.Label, Arg: end},
+		{Type: ws.End},
+	}}
+	mem2reg, ok := optimize.LookupPass("mem2reg")
+	if !ok {
+		t.Fatal("mem2reg not registered")
+	}
+	passes := append(append([]optimize.Pass{}, optimize.Passes...), mem2reg)
+
+	// The promoted cell is carried around the loop by a phi, which
+	// codegen supports.
+	phis := 0
+	codegen := func(p *ir.Program) error {
+		for _, block := range p.Blocks {
+			for _, inst := range block.Nodes {
+				if _, ok := inst.(*ir.PhiExpr); ok {
+					phis++
+				}
+			}
+		}
+		return MockCodegen(p)
+	}
+	if err := Check("mem2reg.ws", []byte(program.DumpWS()), Options{Passes: passes, Codegen: codegen}); err != nil {
+		t.Fatal(err)
+	}
+	if phis == 0 {
+		t.Error("mem2reg did not create a phi")
+	}
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Histogram counts the tokens of each instruction type.
+func Histogram(tokens []*Token) map[Type]int {
+	hist := make(map[Type]int)
+	for _, tok := range tokens {
+		hist[tok.Type]++
+	}
+	return hist
+}
+
+// Category returns the name of the instruction category of the type:
+// stack, arith, heap, control, io, or debug.
+func (typ Type) Category() string {
+	switch {
+	case typ.IsStack():
+		return "stack"
+	case typ.IsArith():
+		return "arith"
+	case typ.IsHeap():
+		return "heap"
+	case typ.IsControl():
+		return "control"
+	case typ.IsIO():
+		return "io"
+	case typ.IsDebug():
+		return "debug"
+	}
+	return "illegal"
+}
+
+// FormatHistogram formats a histogram as a table grouped by category.
+// Each category is headed by its subtotal and types that do not occur
+// are omitted, e.g.:
+//
+//	stack           5
+//	  push          4
+//	  dup           1
+//	io              1
+//	  printi        1
+//	total           6
+func FormatHistogram(hist map[Type]int) string {
+	var b strings.Builder
+	total := 0
+	for typ := Illegal; typ <= DumpHeap; {
+		category := typ.Category()
+		start, subtotal := typ, 0
+		for ; typ <= DumpHeap && typ.Category() == category; typ++ {
+			subtotal += hist[typ]
+		}
+		if subtotal == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%-10s %6d\n", category, subtotal)
+		for t := start; t < typ; t++ {
+			if n := hist[t]; n != 0 {
+				fmt.Fprintf(&b, "  %-8s %6d\n", t, n)
+			}
+		}
+		total += subtotal
+	}
+	fmt.Fprintf(&b, "%-10s %6d\n", "total", total)
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package ws
+
+import (
+	"go/token"
+	"io/ioutil"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	filename := "../programs/hello_world.ws"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := token.NewFileSet().AddFile(filename, -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hist := Histogram(tokens)
+	want := map[Type]int{Push: 14, Printc: 14, End: 1}
+	if len(hist) != len(want) {
+		t.Errorf("got histogram %v, want %v", hist, want)
+	}
+	for typ, n := range want {
+		if hist[typ] != n {
+			t.Errorf("got %d %v, want %d", hist[typ], typ, n)
+		}
+	}
+
+	wantTable := `stack          14
+  push         14
+control         1
+  end           1
+io             14
+  printc       14
+total          29
+`
+	if table := FormatHistogram(hist); table != wantTable {
+		t.Errorf("got table\n%s\nwant\n%s", table, wantTable)
+	}
+}
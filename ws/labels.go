@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+
+	"github.com/andrewarchi/nebula/diag"
+	"github.com/andrewarchi/nebula/internal/bigint"
+)
+
+// LabelAlias records a label removed by CanonicalizeLabels in favor of
+// the adjacent label that represents it.
+type LabelAlias struct {
+	Label *Token // Removed label
+	Rep   *Token // Representative label that branches now target
+	Pos   token.Position
+}
+
+func (a *LabelAlias) Error() string {
+	return fmt.Sprintf("label %v merged into %v at %v", a.Label, a.Rep, a.Pos)
+}
+
+// Diagnostic converts the alias to a note.
+func (a *LabelAlias) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Note, Code: "label-alias", Message: fmt.Sprintf("label %v merged into %v", a.Label, a.Rep), Pos: a.Pos}
+}
+
+// CanonicalizeLabels merges adjacent labels, which mark the same
+// location, into the first label of each run. The other labels in the
+// run are removed and branches to them are rewritten to target the
+// representative. Labels that are defined more than once are kept, so
+// that the duplicates are still reported when lowering. It returns the
+// removed labels in source order.
+func (p *Program) CanonicalizeLabels() []*LabelAlias {
+	defs := bigint.NewMap() // map[*big.Int]int
+	for _, tok := range p.Tokens {
+		if tok.Type == Label {
+			n, _ := defs.GetOrPut(tok.Arg, 0)
+			defs.Put(tok.Arg, n.(int)+1)
+		}
+	}
+
+	var aliases []*LabelAlias
+	reps := bigint.NewMap() // map[*big.Int]*Token
+	tokens := p.Tokens[:0]
+	var rep *Token
+	for _, tok := range p.Tokens {
+		if tok.Type != Label {
+			rep = nil
+		} else if rep == nil {
+			rep = tok
+		} else if n, _ := defs.Get(tok.Arg); n.(int) == 1 && tok.Arg.Cmp(rep.Arg) != 0 {
+			aliases = append(aliases, &LabelAlias{tok, rep, p.File.Position(tok.Pos)})
+			reps.Put(tok.Arg, rep)
+			continue
+		}
+		tokens = append(tokens, tok)
+	}
+	p.Tokens = tokens
+	if len(aliases) == 0 {
+		return nil
+	}
+	for _, tok := range p.Tokens {
+		switch tok.Type {
+		case Call, Jmp, Jz, Jn:
+			if r, ok := reps.Get(tok.Arg); ok {
+				rep := r.(*Token)
+				tok.Arg = new(big.Int).Set(rep.Arg)
+				tok.ArgString = rep.ArgString
+			}
+		}
+	}
+	return aliases
+}
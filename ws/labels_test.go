@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestCanonicalizeLabels(t *testing.T) {
+	//     jmp start
+	// loop:
+	// start:
+	//     call loop
+	//     jz start
+	//     end
+	tokens := []*Token{
+		{Type: Jmp, Arg: big.NewInt(2), ArgString: "start"},
+		{Type: Label, Arg: big.NewInt(1), ArgString: "loop"},
+		{Type: Label, Arg: big.NewInt(2), ArgString: "start"},
+		{Type: Call, Arg: big.NewInt(1), ArgString: "loop"},
+		{Type: Jz, Arg: big.NewInt(2), ArgString: "start"},
+		{Type: End},
+	}
+	p := &Program{Tokens: tokens, File: token.NewFileSet().AddFile("test", -1, 0)}
+	aliases := p.CanonicalizeLabels()
+
+	want := []string{"jmp loop", "loop", "call loop", "jz loop", "end"}
+	if len(p.Tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(p.Tokens), len(want))
+	}
+	for i, tok := range p.Tokens {
+		if tok.String() != want[i] {
+			t.Errorf("token %d: got %q, want %q", i, tok, want[i])
+		}
+	}
+	if len(aliases) != 1 || aliases[0].Label.Arg.Int64() != 2 || aliases[0].Rep.Arg.Int64() != 1 {
+		t.Errorf("got aliases %v, want label 2 aliased to label 1", aliases)
+	}
+
+	ssa, errs := p.LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, block := range ssa.Blocks {
+		if len(block.Labels) > 1 {
+			t.Errorf("block %s has %d labels, want at most 1", block.Name(), len(block.Labels))
+		}
+	}
+}
+
+func TestCanonicalizeLabelsDuplicate(t *testing.T) {
+	// label_1:
+	// label_2:
+	//     jmp label_2
+	// label_2:
+	//     end
+	src := []byte("\n   \t\n" + "\n   \t \n" + "\n \n \t \n" + "\n   \t \n" + "\n\n\n")
+	file := token.NewFileSet().AddFile("labels.ws", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Program{Tokens: tokens, File: file}
+	if aliases := p.CanonicalizeLabels(); len(aliases) != 0 {
+		t.Errorf("got aliases %v, want none for a label defined twice", aliases)
+	}
+	want := "Label is not unique: label_2 at labels.ws:8:1"
+	if errs := p.CheckLabels(); len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v, want %q", errs, want)
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	// label_1:
+	//     jmp label_2
+	// label_1:
+	//     call label_3
+	// label_1:
+	//     end
+	// label_2:
+	src := []byte("\n   \t\n" + "\n \n \t \n" + "\n   \t\n" + "\n \t \t\t\n" + "\n   \t\n" + "\n\n\n" + "\n   \t \n")
+	file := token.NewFileSet().AddFile("labels.ws", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Program{Tokens: tokens, File: file}
+	want := []string{
+		"Label is not unique: label_1 at labels.ws:6:1",
+		"Label does not exist: call label_3 at labels.ws:8:1",
+		"Label is not unique: label_1 at labels.ws:10:1",
+	}
+	checkErrs := p.CheckLabels()
+	ssa, lowerErrs := p.LowerIR()
+	if ssa != nil {
+		t.Error("LowerIR returned a program with label errors")
+	}
+	for name, errs := range map[string][]error{"CheckLabels": checkErrs, "LowerIR": lowerErrs} {
+		if len(errs) != len(want) {
+			t.Errorf("%s: got errors %v, want %q", name, errs, want)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != want[i] {
+				t.Errorf("%s: error %d: got %q, want %q", name, i, err, want[i])
+			}
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package ws
 
 import (
+	"bytes"
 	"fmt"
 	"go/token"
 	"io"
 	"math/big"
 	"unicode/utf8"
+
+	"github.com/andrewarchi/nebula/diag"
 )
 
 // lexer is a lexical analyzer that scans tokens in Whitespace source.
@@ -15,6 +18,9 @@ type lexer struct {
 	tokens      []*Token
 	offset      int
 	startOffset int
+	maxTokens   int
+	comments    bool
+	spec        Spec
 }
 
 // SyntaxError identifies the location of a syntactic error.
@@ -30,14 +36,115 @@ const (
 	lf    = '\n'
 )
 
+// BudgetError is an error given when a program exceeds a configured
+// size limit.
+type BudgetError struct {
+	Kind  string // "token", "instruction", or "block"
+	Limit int
+}
+
+func (err *BudgetError) Error() string {
+	return fmt.Sprintf("program exceeds %s budget of %d", err.Kind, err.Limit)
+}
+
+// Diagnostic converts the error to a diagnostic.
+func (err *BudgetError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Error, Code: "budget", Message: err.Error()}
+}
+
 // LexTokens scans a Whitespace source file into tokens.
 func LexTokens(file *token.File, src []byte) ([]*Token, error) {
-	l := &lexer{file: file, src: src}
+	return LexTokensLimit(file, src, 0)
+}
+
+// LexTokensLimit scans a Whitespace source file into tokens and stops
+// with a *BudgetError once more than maxTokens tokens have been
+// scanned. A maxTokens of 0 is unlimited.
+func LexTokensLimit(file *token.File, src []byte, maxTokens int) ([]*Token, error) {
+	return LexTokensOptions(file, src, LexOptions{MaxTokens: maxTokens})
+}
+
+// LexOptions configures the lexer.
+type LexOptions struct {
+	MaxTokens int  // Maximum tokens to scan; 0 is unlimited
+	Comments  bool // Capture non-token text in Token.Comment
+	Spec      Spec // Specification version restricting the instructions accepted
+	// StripHeader skips a leading UTF-8 byte order mark and #! line, so
+	// that source files can be executable scripts.
+	StripHeader bool
+}
+
+// Spec is a version of the Whitespace language specification, which
+// determines the instructions that the lexer accepts.
+type Spec uint8
+
+// Specification versions.
+const (
+	// SpecAll accepts all instructions, including extensions such as
+	// shuffle.
+	SpecAll Spec = iota
+	// Spec02 is Whitespace 0.2, which lacks copy, slide, and shuffle.
+	Spec02
+	// Spec03 is Whitespace 0.3, which adds copy and slide.
+	Spec03
+)
+
+// ParseSpec parses a specification version of the form 0.2 or 0.3. An
+// empty version is SpecAll.
+func ParseSpec(version string) (Spec, error) {
+	switch version {
+	case "":
+		return SpecAll, nil
+	case "0.2":
+		return Spec02, nil
+	case "0.3":
+		return Spec03, nil
+	}
+	return SpecAll, fmt.Errorf("unknown Whitespace version: %s", version)
+}
+
+func (spec Spec) String() string {
+	switch spec {
+	case SpecAll:
+		return "all"
+	case Spec02:
+		return "0.2"
+	case Spec03:
+		return "0.3"
+	}
+	return "specerr"
+}
+
+// Allows returns whether the instruction is defined in the
+// specification version.
+func (spec Spec) Allows(typ Type) bool {
+	switch typ {
+	case Copy, Slide:
+		return spec != Spec02
+	case Shuffle:
+		return spec == SpecAll
+	}
+	return true
+}
+
+// LexTokensOptions scans a Whitespace source file into tokens. When
+// opts.Comments is set, the non-token text within each token, which
+// includes any text since the previous token, is stored in the token's
+// Comment, with runs of whitespace collapsed to a single space. Text
+// after the last token is appended to the comment of the last token.
+func LexTokensOptions(file *token.File, src []byte, opts LexOptions) ([]*Token, error) {
+	l := &lexer{file: file, src: src, maxTokens: opts.MaxTokens, comments: opts.Comments, spec: opts.Spec}
+	if opts.StripHeader {
+		l.skipHeader()
+	}
 	s := rootState
 	var err error
 	for {
 		s, err = s.nextState(l)
 		if err == io.EOF {
+			if l.comments && len(l.tokens) != 0 {
+				l.appendTrailingComment()
+			}
 			return l.tokens, nil
 		}
 		if err != nil {
@@ -46,6 +153,42 @@ func LexTokens(file *token.File, src []byte) ([]*Token, error) {
 	}
 }
 
+// skipHeader advances past a UTF-8 byte order mark and a #! line at
+// the start of the source. Offsets are unchanged, so positions remain
+// relative to the start of the file.
+func (l *lexer) skipHeader() {
+	if bytes.HasPrefix(l.src, bom) {
+		l.offset = len(bom)
+	}
+	if bytes.HasPrefix(l.src[l.offset:], []byte("#!")) {
+		if i := bytes.IndexByte(l.src[l.offset:], '\n'); i != -1 {
+			l.offset += i + 1
+			l.file.AddLine(l.offset)
+		} else {
+			l.offset = len(l.src)
+		}
+	}
+	l.startOffset = l.offset
+}
+
+var bom = []byte("\ufeff")
+
+func (l *lexer) comment(start, end int) string {
+	return string(bytes.TrimSpace(spacePattern.ReplaceAll(l.src[start:end], []byte{' '})))
+}
+
+func (l *lexer) appendTrailingComment() {
+	comment := l.comment(l.startOffset, len(l.src))
+	if comment == "" {
+		return
+	}
+	last := l.tokens[len(l.tokens)-1]
+	if last.Comment != "" {
+		last.Comment += " "
+	}
+	last.Comment += comment
+}
+
 func (l *lexer) next() (rune, bool) {
 	if l.offset < len(l.src) {
 		ch, size := utf8.DecodeRune(l.src[l.offset:])
@@ -78,6 +221,11 @@ func (err *SyntaxError) Error() string {
 	return fmt.Sprintf("syntax error: %s at %v-%v", err.Err, err.Pos, end)
 }
 
+// Diagnostic converts the error to a diagnostic.
+func (err *SyntaxError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Error, Code: "syntax", Message: err.Err, Pos: err.Pos, End: err.End}
+}
+
 type state interface {
 	nextState(*lexer) (state, error)
 }
@@ -138,10 +286,19 @@ func (acc *accept) nextState(l *lexer) (state, error) {
 		}
 		tok.Arg = num
 	}
+	if !l.spec.Allows(acc.Type) {
+		return nil, l.errorf("%v is not defined in Whitespace %v", acc.Type, l.spec)
+	}
 	tok.Pos = l.file.Pos(l.startOffset)
 	tok.End = l.file.Pos(l.offset)
+	if l.comments {
+		tok.Comment = l.comment(l.startOffset, l.offset)
+	}
 	l.startOffset = l.offset
 	l.tokens = append(l.tokens, tok)
+	if l.maxTokens != 0 && len(l.tokens) > l.maxTokens {
+		return nil, &BudgetError{"token", l.maxTokens}
+	}
 	return rootState, nil
 }
 
@@ -0,0 +1,190 @@
+package ws
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/diag"
+)
+
+func TestLexTokensLimit(t *testing.T) {
+	src := []byte(strings.Repeat(" \n ", 10) + "\n\n\n") // 10 dups, end
+	for _, test := range []struct {
+		Max int
+		Err bool
+	}{{0, false}, {11, false}, {10, true}, {1, true}} {
+		file := token.NewFileSet().AddFile("test", -1, len(src))
+		tokens, err := LexTokensLimit(file, src, test.Max)
+		if !test.Err {
+			if err != nil || len(tokens) != 11 {
+				t.Errorf("max %d: got %d tokens and error %v, want 11 tokens", test.Max, len(tokens), err)
+			}
+			continue
+		}
+		if berr, ok := err.(*BudgetError); !ok || berr.Kind != "token" || berr.Limit != test.Max {
+			t.Errorf("max %d: got error %v, want token budget error", test.Max, err)
+		}
+		if tokens != nil {
+			t.Errorf("max %d: got tokens with budget error", test.Max)
+		}
+	}
+}
+
+func TestLexTokensComments(t *testing.T) {
+	// dup, preceded by "print"
+	// push 1, preceded by "one"
+	// end, preceded by "done" and followed by "bye"
+	src := []byte("print \n one   \t\ndone\n\n\nbye")
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokensOptions(file, src, LexOptions{Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []string
+	for _, tok := range tokens {
+		comments = append(comments, tok.Comment)
+	}
+	if want := []string{"print", "one", "done bye"}; strings.Join(comments, "|") != strings.Join(want, "|") {
+		t.Errorf("got comments %q, want %q", comments, want)
+	}
+
+	p := &Program{Tokens: tokens, File: file}
+	want := "    ; print\n    dup\n    ; one\n    push 1\n    ; done bye\n    end\n"
+	if got := p.DumpComments("    "); got != want {
+		t.Errorf("got dump:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without opting in, tokens are the same, but without comments.
+	plain, err := LexTokens(token.NewFileSet().AddFile("test", -1, len(src)), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != len(tokens) {
+		t.Fatalf("got %d tokens without comments, want %d", len(plain), len(tokens))
+	}
+	for i, tok := range plain {
+		if tok.Comment != "" || tok.String() != tokens[i].String() || tok.Pos != tokens[i].Pos || tok.End != tokens[i].End {
+			t.Errorf("token %d without comments: got %v %q, want %v", i, tok, tok.Comment, tokens[i])
+		}
+	}
+}
+
+func TestLowerIRMaxInsts(t *testing.T) {
+	src := []byte(strings.Repeat("   \t\n\t\n \t", 10) + "\n\n\n") // 10 push 1 printi, end
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Program{Tokens: tokens, File: file, MaxInsts: 5}
+	ssa, errs := p.LowerIR()
+	if ssa != nil || len(errs) != 1 {
+		t.Fatalf("got program and errors %v, want budget error", errs)
+	}
+	if berr, ok := errs[0].(*BudgetError); !ok || berr.Kind != "instruction" {
+		t.Errorf("got error %v, want instruction budget error", errs[0])
+	}
+	p.MaxInsts = 0
+	if _, errs := p.LowerIR(); len(errs) != 0 {
+		t.Errorf("unlimited: unexpected errors %v", errs)
+	}
+}
+
+func TestLowerIRMaxBlocks(t *testing.T) {
+	var tokens []*Token
+	for i := int64(0); i < 10; i++ {
+		tokens = append(tokens,
+			&Token{Type: Label, Arg: big.NewInt(i)},
+			&Token{Type: Jmp, Arg: big.NewInt(i)})
+	}
+	tokens = append(tokens, &Token{Type: End})
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p := &Program{Tokens: tokens, File: file, MaxBlocks: 3}
+	ssa, errs := p.LowerIR()
+	if ssa != nil || len(errs) != 1 {
+		t.Fatalf("got program and errors %v, want budget error", errs)
+	}
+	if berr, ok := errs[0].(*BudgetError); !ok || berr.Kind != "block" {
+		t.Errorf("got error %v, want block budget error", errs[0])
+	}
+	p.MaxBlocks = 0
+	if ssa, errs := p.LowerIR(); len(errs) != 0 || len(ssa.Blocks) != 11 {
+		t.Errorf("unlimited: got errors %v", errs)
+	}
+}
+
+func TestLowerIRDiagnostic(t *testing.T) {
+	src := []byte("   \t\n\t\n \t" + " \t \t\t\n" + "\n\n\n") // push 1, printi, copy -1, end
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := (&Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want 1 error", errs)
+	}
+	d := diag.From(errs[0])
+	if d.Severity != diag.Error || d.Code != "lower" {
+		t.Errorf("got severity %v and code %q, want error and \"lower\"", d.Severity, d.Code)
+	}
+	if d.Pos.Filename != "test.ws" || d.Pos.Line != 3 || d.Pos.Column != 3 {
+		t.Errorf("got position %v, want test.ws:3:3", d.Pos)
+	}
+	if want := "test.ws:3:3: error: argument is negative: copy -1 [lower]"; d.Error() != want {
+		t.Errorf("got %q, want %q", d.Error(), want)
+	}
+}
+
+func TestLexTokensSpec(t *testing.T) {
+	src := []byte("   \t\n" + " \t  \n" + "\n\n\n") // push 1, copy 0, end
+	for _, spec := range []Spec{SpecAll, Spec02, Spec03} {
+		file := token.NewFileSet().AddFile("test", -1, len(src))
+		tokens, err := LexTokensOptions(file, src, LexOptions{Spec: spec})
+		if spec != Spec02 {
+			if err != nil || len(tokens) != 3 || tokens[1].Type != Copy {
+				t.Errorf("spec %v: got tokens %v and error %v, want copy accepted", spec, tokens, err)
+			}
+			continue
+		}
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("spec %v: got error %v, want syntax error", spec, err)
+			continue
+		}
+		if serr.Err != "copy is not defined in Whitespace 0.2" || serr.Pos.Offset != 5 || serr.End.Offset != 9 {
+			t.Errorf("spec %v: got %q at %d-%d, want copy rejected at 5-9", spec, serr.Err, serr.Pos.Offset, serr.End.Offset)
+		}
+	}
+	if _, err := ParseSpec("0.4"); err == nil {
+		t.Error("unknown version accepted")
+	}
+}
+
+func TestLexTokensStripHeader(t *testing.T) {
+	header := "\ufeff#!/usr/bin/env nebula run\n"
+	src := []byte(header + "   \t\n" + "\t\n \t" + "\n\n\n") // push 1, printi, end
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := LexTokensOptions(file, src, LexOptions{StripHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 || tokens[0].Type != Push || tokens[1].Type != Printi || tokens[2].Type != End {
+		t.Fatalf("got tokens %v, want push 1, printi, end", tokens)
+	}
+	pos := file.Position(tokens[0].Pos)
+	if pos.Offset != len(header) || pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("got push at %v (offset %d), want test.ws:2:1 (offset %d)", pos, pos.Offset, len(header))
+	}
+	if pos := file.Position(tokens[1].Pos); pos.Line != 3 || pos.Column != 1 {
+		t.Errorf("got printi at %v, want test.ws:3:1", pos)
+	}
+
+	// Without stripping, the spaces in the #! line are lexed.
+	plain, err := LexTokens(token.NewFileSet().AddFile("test.ws", -1, len(src)), src)
+	if err == nil && len(plain) == 3 {
+		t.Error("header lexed as no tokens without stripping")
+	}
+}
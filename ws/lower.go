@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"go/token"
 
+	"github.com/andrewarchi/nebula/diag"
 	"github.com/andrewarchi/nebula/internal/bigint"
 	"github.com/andrewarchi/nebula/ir"
 )
 
+const maxInt = int(^uint(0) >> 1)
+
 // irBuilder lowers a Whitespace AST to SSA form.
 type irBuilder struct {
 	*ir.Builder
@@ -15,6 +18,7 @@ type irBuilder struct {
 	tokenBlocks [][]*Token
 	stack       *ir.Stack
 	labelBlocks *bigint.Map // map[*big.Int]*ir.BasicBlock
+	maxStackLen int
 	file        *token.File
 	errs        []error
 }
@@ -30,6 +34,11 @@ func (err *TokenError) Error() string {
 	return fmt.Sprintf("%s: %v at %v", err.Err, err.Token, err.Pos)
 }
 
+// Diagnostic converts the error to a diagnostic.
+func (err *TokenError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Error, Code: "lower", Message: fmt.Sprintf("%s: %v", err.Err, err.Token), Pos: err.Pos}
+}
+
 func (ib *irBuilder) err(err string, tok *Token) {
 	ib.errs = append(ib.errs, &TokenError{tok, ib.file.Position(tok.Pos), err})
 }
@@ -38,22 +47,44 @@ func (ib *irBuilder) Errs() []error {
 	return ib.errs
 }
 
-// LowerIR lowers a Whitespace program to Nebula IR in SSA form.
+// LowerIR lowers a Whitespace program to Nebula IR in SSA form. When
+// the program splits into more than MaxBlocks basic blocks or lowers to
+// more than MaxInsts instructions, lowering stops with a *BudgetError
+// and no program is returned. The block budget is checked before any
+// blocks are allocated. Likewise, when labels are duplicated or
+// missing, all label errors are returned, as from CheckLabels, and no
+// program is returned. When MaxStackLen is set, copy and slide
+// arguments that would need a longer stack are errors.
 func (p *Program) LowerIR() (*ir.Program, []error) {
 	ib := &irBuilder{
 		Builder:     ir.NewBuilder(p.File),
 		tokens:      p.Tokens,
 		labelBlocks: bigint.NewMap(),
+		maxStackLen: p.MaxStackLen,
 		file:        p.File,
 	}
+	ib.SetNamePolicy(p.NamePolicy)
 	ib.stack = &ir.Stack{
 		HandleAccess: ib.handleAccess,
 		HandleLoad:   ib.handleLoad,
 	}
-	labelUses := ib.collectLabels()
+	labelUses, labelErrs := collectLabels(p.Tokens, p.File)
+	if len(labelErrs) != 0 {
+		return nil, labelErrs
+	}
 	ib.splitTokens(labelUses)
+	if p.MaxBlocks != 0 && len(ib.tokenBlocks) > p.MaxBlocks {
+		return nil, []error{&BudgetError{"block", p.MaxBlocks}}
+	}
+	ib.initBlocks()
+	insts := 0
 	for i, tokens := range ib.tokenBlocks {
-		ib.convertBlock(ib.Block(i), tokens)
+		block := ib.Block(i)
+		ib.convertBlock(block, tokens)
+		insts += len(block.Nodes) + 1
+		if p.MaxInsts != 0 && insts > p.MaxInsts {
+			return nil, append(ib.errs, &BudgetError{"instruction", p.MaxInsts})
+		}
 	}
 	ssa, err := ib.Program()
 	if err != nil {
@@ -62,17 +93,23 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 	return ssa, ib.errs
 }
 
+// CheckLabels reports every duplicate label definition and every
+// branch to a label that does not exist, in source order. The errors
+// are the same as those given by LowerIR.
+func (p *Program) CheckLabels() []error {
+	_, errs := collectLabels(p.Tokens, p.File)
+	return errs
+}
+
 // collectLabels collects all labels from the tokens into maps and
 // enforces that all labels are unique and callees exist.
-func (ib *irBuilder) collectLabels() *bigint.Map {
+func collectLabels(tokens []*Token, file *token.File) (*bigint.Map, []error) {
 	labels := bigint.NewMap()    // map[*big.Int]bool
 	labelUses := bigint.NewMap() // map[*big.Int][]int
-	for i, tok := range ib.tokens {
+	for i, tok := range tokens {
 		switch tok.Type {
 		case Label:
-			if labels.Put(tok.Arg, nil) {
-				ib.err("Label is not unique", tok)
-			}
+			labels.Put(tok.Arg, false)
 		case Call, Jmp, Jz, Jn:
 			if l, ok := labelUses.Get(tok.Arg); ok {
 				labelUses.Put(tok.Arg, append(l.([]int), i))
@@ -82,14 +119,25 @@ func (ib *irBuilder) collectLabels() *bigint.Map {
 		}
 	}
 
-	for _, use := range labelUses.Pairs() {
-		if !labels.Has(use.K) {
-			for _, branch := range use.V.([]int) {
-				ib.err("Label does not exist", ib.tokens[branch])
+	var errs []error
+	for _, tok := range tokens {
+		var err string
+		switch tok.Type {
+		case Label:
+			if seen, _ := labels.Get(tok.Arg); seen.(bool) {
+				err = "Label is not unique"
 			}
+			labels.Put(tok.Arg, true)
+		case Call, Jmp, Jz, Jn:
+			if !labels.Has(tok.Arg) {
+				err = "Label does not exist"
+			}
+		}
+		if err != "" {
+			errs = append(errs, &TokenError{tok, file.Position(tok.Pos), err})
 		}
 	}
-	return labelUses
+	return labelUses, errs
 }
 
 // splitTokens splits the tokens into sequences of non-branching tokens.
@@ -118,7 +166,11 @@ func (ib *irBuilder) splitTokens(labelUses *bigint.Map) {
 	if needsFinalBlock(ib.tokens) {
 		ib.tokenBlocks = append(ib.tokenBlocks, []*Token{})
 	}
+}
 
+// initBlocks creates a basic block for each span of tokens and maps
+// labels to the blocks they start.
+func (ib *irBuilder) initBlocks() {
 	ib.InitBlocks(len(ib.tokenBlocks))
 	for i, block := range ib.Blocks() {
 		for _, tok := range ib.tokenBlocks[i] {
@@ -236,12 +288,7 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 			start = false
 		}
 	}
-	if offset := int(ib.stack.Len()) - int(ib.stack.Pops()); offset != 0 {
-		ib.CreateOffsetStackStmt(offset, token.NoPos) // TODO source position
-	}
-	for i, val := range ib.stack.Values() {
-		ib.CreateStoreStackStmt(ib.stack.Len()-uint(i), val, val.Pos())
-	}
+	ib.stack.Materialize(ib.Builder, blockEnd(tokens))
 	if block.Terminator == nil {
 		if block.Next != nil {
 			ib.CreateJmpTerm(ir.Fallthrough, block.Next, token.NoPos) // TODO source position
@@ -251,14 +298,32 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 	}
 }
 
+// blockEnd returns the end of the last token in a block, which
+// positions the stack offset at the end of the block, or NoPos when the
+// block is empty.
+func blockEnd(tokens []*Token) token.Pos {
+	if len(tokens) == 0 {
+		return token.NoPos
+	}
+	return tokens[len(tokens)-1].End
+}
+
 func (ib *irBuilder) uintArg(tok *Token) (uint, bool) {
-	n, ok := bigint.ToUint(tok.Arg)
 	if tok.Arg.Sign() == -1 {
 		ib.err("argument is negative", tok)
-	} else if !ok {
-		ib.err("argument overflows uint", tok)
+		return 0, false
+	}
+	// Copy and slide with argument n access n+1 values on the stack.
+	limit := maxInt
+	if ib.maxStackLen != 0 {
+		limit = ib.maxStackLen - 1
+	}
+	n, err := bigint.ToIntChecked(tok.Arg, limit)
+	if err != nil {
+		ib.err("argument out of range: "+err.Error(), tok)
+		return 0, false
 	}
-	return n, ok
+	return uint(n), true
 }
 
 func (ib *irBuilder) callee(tok *Token) *ir.BasicBlock {
@@ -0,0 +1,151 @@
+package ws
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestLowerConstPositions(t *testing.T) {
+	// push 1
+	// push 1
+	// add
+	// printi
+	// end
+	tokens := []*Token{
+		{Type: Push, Arg: big.NewInt(1), Pos: 1},
+		{Type: Push, Arg: big.NewInt(1), Pos: 8},
+		{Type: Add, Pos: 15},
+		{Type: Printi, Pos: 19},
+		{Type: End, Pos: 26},
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("test", -1, 30)
+	p, errs := (&Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	var add *ir.BinaryExpr
+	for _, node := range p.Entry.Nodes {
+		if bin, ok := node.(*ir.BinaryExpr); ok {
+			add = bin
+		}
+	}
+	if add == nil {
+		t.Fatalf("add not found:\n%v", p)
+	}
+	lhs, rhs := add.Operand(0).Def(), add.Operand(1).Def()
+	if lhs.Pos() != 1 || rhs.Pos() != 8 {
+		t.Errorf("got constants at %v and %v, want %v and %v",
+			fset.Position(lhs.Pos()), fset.Position(rhs.Pos()), fset.Position(1), fset.Position(8))
+	}
+}
+
+func TestLowerIRBigLabels(t *testing.T) {
+	// call 1
+	// call 2^64+1
+	// end
+	// label 1
+	// ret
+	// label 2^64+1
+	// ret
+	small := big.NewInt(1)
+	large := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), small)
+	if small.Int64() != large.Int64() {
+		t.Fatal("labels do not share low 64 bits")
+	}
+	tokens := []*Token{
+		{Type: Call, Arg: small},
+		{Type: Call, Arg: large},
+		{Type: End},
+		{Type: Label, Arg: small},
+		{Type: Ret},
+		{Type: Label, Arg: large},
+		{Type: Ret},
+	}
+	p, errs := (&Program{Tokens: tokens, File: token.NewFileSet().AddFile("test", -1, 0)}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	call1, ok1 := p.Entry.Terminator.(*ir.CallTerm)
+	if !ok1 {
+		t.Fatalf("entry does not call:\n%v", p)
+	}
+	call2, ok2 := p.Entry.Next.Terminator.(*ir.CallTerm)
+	if !ok2 {
+		t.Fatalf("second block does not call:\n%v", p)
+	}
+	callee1, callee2 := call1.Succ(0), call2.Succ(0)
+	if callee1 == callee2 {
+		t.Fatalf("labels %v and %v map to the same block %s", small, large, callee1.Name())
+	}
+	for _, test := range []struct {
+		Block *ir.BasicBlock
+		Label *big.Int
+	}{{callee1, small}, {callee2, large}} {
+		if len(test.Block.Labels) != 1 || test.Block.Labels[0].ID.Cmp(test.Label) != 0 {
+			t.Errorf("got labels %v for %s, want %v", test.Block.Labels, test.Block.Name(), test.Label)
+		}
+	}
+}
+
+func TestLowerIRMaxStackLen(t *testing.T) {
+	huge := new(big.Int).Lsh(big.NewInt(1), 64)
+	for _, test := range []struct {
+		MaxStackLen int
+		Arg         *big.Int
+		Err         string
+	}{
+		{3, big.NewInt(2), ""},
+		{3, big.NewInt(3), "argument out of range: value 3 exceeds limit of 2 by 1: copy 3"},
+		{0, huge, fmt.Sprintf("argument out of range: value %v exceeds limit of %d by ", huge, maxInt)},
+	} {
+		// push 1; push 2; push 3; copy n; end
+		tokens := []*Token{
+			{Type: Push, Arg: big.NewInt(1)},
+			{Type: Push, Arg: big.NewInt(2)},
+			{Type: Push, Arg: big.NewInt(3)},
+			{Type: Copy, Arg: test.Arg},
+			{Type: End},
+		}
+		p := &Program{Tokens: tokens, File: token.NewFileSet().AddFile("test", -1, 0), MaxStackLen: test.MaxStackLen}
+		_, errs := p.LowerIR()
+		if test.Err == "" {
+			if len(errs) != 0 {
+				t.Errorf("copy %v: unexpected errors: %v", test.Arg, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), test.Err) {
+			t.Errorf("copy %v: got errors %v, want %q", test.Arg, errs, test.Err)
+		}
+	}
+}
+
+func TestLowerOffsetStackPosition(t *testing.T) {
+	// push 1
+	// push 2
+	// end
+	tokens := []*Token{
+		{Type: Push, Arg: big.NewInt(1), Pos: 1, End: 6},
+		{Type: Push, Arg: big.NewInt(2), Pos: 6, End: 11},
+		{Type: End, Pos: 11, End: 14},
+	}
+	p, errs := (&Program{Tokens: tokens, File: token.NewFileSet().AddFile("test", -1, 20)}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, node := range p.Entry.Nodes {
+		if offset, ok := node.(*ir.OffsetStackStmt); ok {
+			if offset.Pos() != 14 {
+				t.Errorf("got offsetstack at %d, want 14", offset.Pos())
+			}
+			return
+		}
+	}
+	t.Fatalf("offsetstack not found:\n%v", p)
+}
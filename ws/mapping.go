@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
 
 	"github.com/andrewarchi/nebula/internal/bigint"
 )
@@ -49,3 +51,53 @@ func ApplyLabelMap(tokens []*Token, labelNames *bigint.Map /* map[*big.Int]strin
 		}
 	}
 }
+
+// FormatCommentMap formats the comments captured in tokens as a comment
+// source map, with one index:comment line per commented token. Comments
+// have no place in Whitespace source, so the map carries them alongside.
+func FormatCommentMap(tokens []*Token) string {
+	var b strings.Builder
+	for i, tok := range tokens {
+		if tok.Comment != "" {
+			fmt.Fprintf(&b, "%d:%s\n", i, tok.Comment)
+		}
+	}
+	return b.String()
+}
+
+// ParseCommentMap reads a comment source map and parses it into
+// mappings from token index to comment.
+func ParseCommentMap(r io.Reader) (map[int]string, error) {
+	br := bufio.NewReader(r)
+	comments := make(map[int]string)
+	for {
+		indexText, err := br.ReadString(':')
+		if err == io.EOF {
+			return comments, nil
+		} else if err != nil {
+			return nil, err
+		}
+		indexText = indexText[:len(indexText)-1]
+		index, err := strconv.Atoi(indexText)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid source map token index: %v", indexText)
+		}
+		comment, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := comments[index]; ok {
+			return nil, fmt.Errorf("duplicate source map token index: %v", indexText)
+		}
+		comments[index] = comment[:len(comment)-1]
+	}
+}
+
+// ApplyCommentMap adds comments from mapping to tokens.
+func ApplyCommentMap(tokens []*Token, comments map[int]string) {
+	for i, tok := range tokens {
+		if comment, ok := comments[i]; ok && tok.Comment == "" {
+			tok.Comment = comment
+		}
+	}
+}
@@ -1,45 +1,81 @@
 package ws
 
+import (
+	"bufio"
+	"go/token"
+	"io"
+)
+
 type packer struct {
-	text   []byte
-	bits   []byte
-	curr   byte
-	offset uint
-	bit    uint
+	text      []byte
+	bits      []byte
+	curr      byte
+	offset    uint
+	bit       uint
+	appendOne bool
 }
 
 // Pack bit packs a Whitespace source.
 func Pack(src []byte) []byte {
-	p := packer{src, nil, 0, 0, 7}
-	appendOne := false
+	p := packer{text: src, bit: 7}
 	for {
 		c, eof := p.readByte()
 		if eof {
-			if appendOne { // marker bit follows trailing zeros
-				p.writeBit(1)
-			}
-			p.flushBits()
+			p.finishBits()
 			return p.bits
 		}
-		switch c {
-		case space:
-			p.writeBit(0)
-			appendOne = true
-		case tab:
-			p.writeBit(1)
-			p.writeBit(0)
-			appendOne = true
-		case lf:
-			p.writeBit(1)
-			p.writeBit(1)
-			appendOne = false
+		p.packByte(c)
+	}
+}
+
+// PackTokens bit packs tokens directly to a writer. The output is the
+// same as packing the Whitespace formatting of the tokens, but the
+// full text is never materialized.
+func PackTokens(w io.Writer, tokens []*Token) error {
+	bw := bufio.NewWriter(w)
+	p := packer{bit: 7}
+	for _, tok := range tokens {
+		for _, c := range []byte(tok.StringWS()) {
+			p.packByte(c)
+		}
+		if _, err := bw.Write(p.bits); err != nil {
+			return err
 		}
+		p.bits = p.bits[:0]
 	}
+	p.finishBits()
+	if _, err := bw.Write(p.bits); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (p *packer) packByte(c byte) {
+	switch c {
+	case space:
+		p.writeBit(0)
+		p.appendOne = true
+	case tab:
+		p.writeBit(1)
+		p.writeBit(0)
+		p.appendOne = true
+	case lf:
+		p.writeBit(1)
+		p.writeBit(1)
+		p.appendOne = false
+	}
+}
+
+func (p *packer) finishBits() {
+	if p.appendOne { // marker bit follows trailing zeros
+		p.writeBit(1)
+	}
+	p.flushBits()
 }
 
 // Unpack expands a bit packed source.
 func Unpack(bits []byte) []byte {
-	p := packer{nil, bits, 0, 0, 7}
+	p := packer{bits: bits, bit: 7}
 	for {
 		b, eof := p.readBit()
 		if eof {
@@ -61,6 +97,16 @@ func Unpack(bits []byte) []byte {
 	}
 }
 
+// UnpackFile expands a bit packed source and adds a file for the
+// unpacked text to fset. Positions in the packed stream do not
+// correspond to tokens, so the file is sized to the unpacked text and
+// named with an " (unpacked)" suffix to mark that lines and columns
+// refer to the expanded bytes rather than the original file.
+func UnpackFile(fset *token.FileSet, filename string, bits []byte) (*token.File, []byte) {
+	src := Unpack(bits)
+	return fset.AddFile(filename+" (unpacked)", -1, len(src)), src
+}
+
 func (p *packer) readByte() (byte, bool) {
 	if p.offset >= uint(len(p.text)) {
 		return 0, true
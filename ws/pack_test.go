@@ -1,6 +1,12 @@
 package ws
 
-import "testing"
+import (
+	"bytes"
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
 
 var tests = []struct{ unpacked, packed []byte }{
 	{ // no marker bit, no padding
@@ -38,3 +44,63 @@ func TestUnpack(t *testing.T) {
 		}
 	}
 }
+
+func TestPackTokens(t *testing.T) {
+	loop := big.NewInt(1)
+	programs := [][]*Token{
+		{},
+		{{Type: End}},
+		{{Type: Push, Arg: big.NewInt(0)}},
+		{
+			{Type: Push, Arg: big.NewInt(-72)},
+			{Type: Label, Arg: loop},
+			{Type: Dup},
+			{Type: Printc},
+			{Type: Push, Arg: big.NewInt(1)},
+			{Type: Add},
+			{Type: Dup},
+			{Type: Jn, Arg: loop},
+			{Type: Slide, Arg: big.NewInt(3)},
+			{Type: End},
+		},
+	}
+	for i, tokens := range programs {
+		var b bytes.Buffer
+		if err := PackTokens(&b, tokens); err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		p := &Program{Tokens: tokens}
+		if want := Pack([]byte(p.DumpWS())); !bytes.Equal(b.Bytes(), want) {
+			t.Errorf("test %d: got %b, want %b", i, b.Bytes(), want)
+		}
+	}
+}
+
+func TestUnpackFilePositions(t *testing.T) {
+	src, err := ioutil.ReadFile("../programs/hello_world.ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := Pack(src)
+	fset := token.NewFileSet()
+	file, unpacked := UnpackFile(fset, "hello_world.wsx", bits)
+	if file.Size() != len(unpacked) {
+		t.Errorf("file size: got %d, want %d", file.Size(), len(unpacked))
+	}
+	tokens, err := LexTokens(file, unpacked)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) == 0 {
+		t.Fatal("no tokens")
+	}
+	last := tokens[len(tokens)-1]
+	if last.Pos < token.Pos(file.Base()) || last.Pos > token.Pos(file.Base()+file.Size()) {
+		t.Errorf("token position %d out of bounds [%d, %d]", last.Pos, file.Base(), file.Base()+file.Size())
+	}
+	pos := fset.Position(last.Pos)
+	if pos.Filename != "hello_world.wsx (unpacked)" || pos.Line < 1 {
+		t.Errorf("unexpected position %v", pos)
+	}
+}
@@ -2,65 +2,100 @@ package ws
 
 import (
 	"bytes"
+	"fmt"
 	"go/token"
 	"regexp"
 	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
 )
 
 // Program is a sequence of Whitespace tokens with file information.
 type Program struct {
-	Tokens []*Token
-	File   *token.File
+	Tokens      []*Token
+	File        *token.File
+	MaxInsts    int           // Maximum IR instructions when lowering; 0 is unlimited
+	MaxBlocks   int           // Maximum basic blocks when lowering; 0 is unlimited
+	MaxStackLen int           // Maximum stack length, bounding copy and slide arguments; 0 is unlimited
+	NamePolicy  ir.NamePolicy // Block naming when lowering; nil is ir.LabelIndexNames
+}
+
+// DumpOptions configures the formatting of Whitespace assembly.
+type DumpOptions struct {
+	Indent       string // Prefix of each instruction
+	LabelSuffix  string // Suffix of each label definition, such as ":"
+	ArgColumn    int    // Width to pad instruction names to before arguments; 0 is one space
+	ResolveNames bool   // Print label names, when known, rather than label_N
+	Positions    bool   // Append the source position of each token as a comment
+	Comments     bool   // Precede each token with its captured comment
 }
 
 // Dump formats a program as Whitespace assembly.
 func (p *Program) Dump(indent string) string {
-	var b strings.Builder
-	for _, tok := range p.Tokens {
-		if tok.Type == Label {
-			b.WriteString(tok.String())
-			b.WriteByte(':')
-		} else {
-			b.WriteString(indent)
-			b.WriteString(tok.String())
-		}
-		b.WriteByte('\n')
-	}
-	return b.String()
+	return p.DumpWith(DumpOptions{Indent: indent, LabelSuffix: ":", ResolveNames: true})
 }
 
 // DumpPos formats a program as Whitespace assembly with source position
 // information.
 func (p *Program) DumpPos() string {
-	const indent = "    "
+	return p.DumpWith(DumpOptions{Indent: "    ", LabelSuffix: ":", ResolveNames: true, Positions: true})
+}
+
+// DumpComments formats a program as Whitespace assembly with the
+// comments captured in its tokens preceding each token, which lexing
+// with wsa.LexOptions and SemicolonComments captures again.
+func (p *Program) DumpComments(indent string) string {
+	return p.DumpWith(DumpOptions{Indent: indent, LabelSuffix: ":", ResolveNames: true, Comments: true})
+}
+
+// DumpWith formats a program as Whitespace assembly according to the
+// options.
+func (p *Program) DumpWith(opts DumpOptions) string {
 	const padWidth = 39
 	padding := strings.Repeat(" ", padWidth)
 
 	var b strings.Builder
 	for _, tok := range p.Tokens {
-		t := tok.String()
-		l := len(t)
-		if tok.Type == Label {
-			b.WriteString(t)
-			b.WriteByte(':')
-			l++
-		} else {
-			b.WriteString(indent)
-			b.WriteString(t)
-			l += len(indent)
+		if opts.Comments && tok.Comment != "" {
+			if tok.Type != Label {
+				b.WriteString(opts.Indent)
+			}
+			b.WriteString("; ")
+			b.WriteString(tok.Comment)
+			b.WriteByte('\n')
 		}
-		if l < padWidth {
-			b.WriteString(padding[:padWidth-l])
+		line := tok.format(opts)
+		b.WriteString(line)
+		if opts.Positions {
+			if len(line) < padWidth {
+				b.WriteString(padding[:padWidth-len(line)])
+			}
+			b.WriteString(" ; ")
+			pos := p.File.Position(tok.Pos)
+			pos.Filename = ""
+			b.WriteString(pos.String())
 		}
-		b.WriteString(" ; ")
-		pos := p.File.Position(tok.Pos)
-		pos.Filename = ""
-		b.WriteString(pos.String())
 		b.WriteByte('\n')
 	}
 	return b.String()
 }
 
+// format formats a token as a line of assembly, without a trailing
+// newline.
+func (tok *Token) format(opts DumpOptions) string {
+	t := *tok
+	if !opts.ResolveNames {
+		t.ArgString = ""
+	}
+	if tok.Type == Label {
+		return t.formatArg() + opts.LabelSuffix
+	}
+	if !tok.Type.HasArg() {
+		return opts.Indent + tok.Type.String()
+	}
+	return fmt.Sprintf("%s%-*s %s", opts.Indent, opts.ArgColumn, tok.Type, t.formatArg())
+}
+
 var spacePattern = regexp.MustCompile("[ \t\n]+")
 
 // DumpCommented formats a program as Whitesapce assembly with comments
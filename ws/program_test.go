@@ -0,0 +1,34 @@
+package ws
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestDumpWith(t *testing.T) {
+	// start:
+	//     push 1
+	//     jmp start
+	tokens := []*Token{
+		{Type: Label, Arg: big.NewInt(0), ArgString: "start"},
+		{Type: Push, Arg: big.NewInt(1)},
+		{Type: Jmp, Arg: big.NewInt(0), ArgString: "start"},
+	}
+	p := &Program{Tokens: tokens, File: token.NewFileSet().AddFile("test", -1, 0)}
+
+	tests := []struct {
+		Opts DumpOptions
+		Want string
+	}{
+		{DumpOptions{Indent: "    ", LabelSuffix: ":", ResolveNames: true},
+			"start:\n    push 1\n    jmp start\n"},
+		{DumpOptions{Indent: "\t", ArgColumn: 6},
+			"label_0\n\tpush   1\n\tjmp    label_0\n"},
+	}
+	for i, test := range tests {
+		if got := p.DumpWith(test.Opts); got != test.Want {
+			t.Errorf("test %d: got:\n%s\nwant:\n%s", i, got, test.Want)
+		}
+	}
+}
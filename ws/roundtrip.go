@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/diag"
+)
+
+// RoundTripError is the first token that differs after a program is
+// emitted as Whitespace and lexed again.
+type RoundTripError struct {
+	Index int
+	Got   *Token // Token lexed from the emitted program; nil when it ends early
+	Want  *Token // Original token; nil when the emitted program has more
+	Pos   token.Position
+}
+
+func (err *RoundTripError) Error() string {
+	return fmt.Sprintf("%s at %v", err.message(), err.Pos)
+}
+
+// Diagnostic converts the error to a diagnostic.
+func (err *RoundTripError) Diagnostic() *diag.Diagnostic {
+	return &diag.Diagnostic{Severity: diag.Error, Code: "roundtrip", Message: err.message(), Pos: err.Pos}
+}
+
+func (err *RoundTripError) message() string {
+	got, want := "end of program", "end of program"
+	if err.Got != nil {
+		got = err.Got.String()
+	}
+	if err.Want != nil {
+		want = err.Want.String()
+	}
+	return fmt.Sprintf("round trip differs at token %d: got %s, want %s", err.Index, got, want)
+}
+
+// CheckRoundTrip emits the program as Whitespace with DumpWS, lexes the
+// result, and checks that the token streams are identical, so that the
+// lexer and emitter are inverses. Tokens are compared by type and
+// argument. It returns a *RoundTripError for the first differing token.
+func (p *Program) CheckRoundTrip() error {
+	src := []byte(p.DumpWS())
+	file := token.NewFileSet().AddFile(p.File.Name(), -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(tokens) || i < len(p.Tokens); i++ {
+		var got, want *Token
+		if i < len(tokens) {
+			got = tokens[i]
+		}
+		var pos token.Position
+		if i < len(p.Tokens) {
+			want = p.Tokens[i]
+			pos = p.File.Position(want.Pos)
+		} else if len(p.Tokens) != 0 {
+			pos = p.File.Position(p.Tokens[len(p.Tokens)-1].End)
+		}
+		if got == nil || want == nil || !sameToken(got, want) {
+			return &RoundTripError{i, got, want, pos}
+		}
+	}
+	return nil
+}
+
+func sameToken(a, b *Token) bool {
+	if a.Type != b.Type || (a.Arg == nil) != (b.Arg == nil) {
+		return false
+	}
+	return a.Arg == nil || a.Arg.Cmp(b.Arg) == 0
+}
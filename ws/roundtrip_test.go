@@ -0,0 +1,44 @@
+package ws
+
+import (
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../programs/rosetta/*.ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, "../programs/interpret.out.ws")
+	for _, filename := range files {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := token.NewFileSet().AddFile(filename, -1, len(src))
+		tokens, err := LexTokens(file, src)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if err := (&Program{Tokens: tokens, File: file}).CheckRoundTrip(); err != nil {
+			t.Errorf("%s: %v", filename, err)
+		}
+	}
+
+	// Labels are unsigned, so a negative label is emitted as its
+	// magnitude.
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p := &Program{Tokens: []*Token{
+		{Type: Push, Arg: big.NewInt(1)},
+		{Type: Label, Arg: big.NewInt(-3)},
+		{Type: End},
+	}, File: file}
+	err = p.CheckRoundTrip()
+	if rerr, ok := err.(*RoundTripError); !ok || rerr.Index != 1 || rerr.Got.Arg.Int64() != 3 {
+		t.Errorf("got error %v, want round trip error at token 1", err)
+	}
+}
@@ -16,6 +16,7 @@ type Token struct {
 	ArgString string    // Label string, if exists
 	Pos       token.Pos // Start position in source
 	End       token.Pos // End position in source (exclusive)
+	Comment   string    // Non-token text within the token, if captured
 }
 
 func (tok *Token) String() string {
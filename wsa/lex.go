@@ -0,0 +1,391 @@
+// Package wsa parses Whitespace assembly source files.
+package wsa // import "github.com/andrewarchi/nebula/wsa"
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// Lex scans a Whitespace assembly source file into tokens.
+//
+// Instructions are separated by whitespace or semicolons and comments
+// extend from # to the end of the line. The annotated dumps of
+// ws.Program, such as DumpPos, write comments with ;, so they are read
+// with LexOptions and SemicolonComments. Labels are defined with a
+// trailing colon and are referenced by number, by label_N, or by name.
+// Names beginning with a dot are local to the preceding label.
+//
+// A line of the form
+//
+//	#define name instructions...
+//
+// defines a macro that expands to the given instructions wherever name
+// is used, for example "#define inc push 1 add". Macros take precedence
+// over instructions of the same name. Errors within a macro body are
+// reported at the definition and expanded tokens are positioned at the
+// use.
+func Lex(file *token.File, src []byte) ([]*ws.Token, error) {
+	return LexOptions(file, src, Options{})
+}
+
+// Options configures lexing.
+type Options struct {
+	Comments          bool // Capture comments in Token.Comment
+	SemicolonComments bool // Start comments with ; rather than separating instructions
+}
+
+// LexOptions scans a Whitespace assembly source file into tokens. When
+// opts.Comments is set, comments on their own lines are stored in the
+// Comment of the next token and comments following instructions are
+// appended to the Comment of the last token on the line, with runs of
+// whitespace collapsed to a single space. Comments after the last
+// token are appended to the comment of the last token. This matches
+// the placement of comments by ws.Program.DumpComments, so comments
+// survive formatting.
+func LexOptions(file *token.File, src []byte, opts Options) ([]*ws.Token, error) {
+	file.SetLinesForContent(src)
+	l := &lexer{
+		file:      file,
+		src:       src,
+		macros:    make(map[string]*macro),
+		comments:  opts.Comments,
+		semicolon: opts.SemicolonComments,
+	}
+	for start := 0; start < len(src); {
+		end := start
+		for end < len(src) && src[end] != '\n' {
+			end++
+		}
+		if err := l.lexLine(start, end); err != nil {
+			return nil, err
+		}
+		start = end + 1
+	}
+	if l.pending != "" && len(l.tokens) != 0 {
+		appendComment(l.tokens[len(l.tokens)-1], l.pending)
+	}
+	l.resolveLabels()
+	return l.tokens, nil
+}
+
+type lexer struct {
+	file   *token.File
+	src    []byte
+	tokens []*ws.Token
+	macros map[string]*macro
+	global string // Enclosing label for local labels
+
+	comments  bool   // Capture comments
+	semicolon bool   // Start comments with ;
+	pending   string // Comment for the next token
+}
+
+// macro is a named sequence of tokens defined with #define.
+type macro struct {
+	Name   string
+	Tokens []*ws.Token
+}
+
+// word is a whitespace-delimited span of source.
+type word struct {
+	Text       string
+	Start, End int // Offsets in source
+}
+
+func (l *lexer) lexLine(start, end int) error {
+	words, comment := l.words(start, end)
+	if len(words) != 0 && words[0].Text == "#define" {
+		return l.define(words)
+	}
+	tokens, err := l.parse(words)
+	if err != nil {
+		return err
+	}
+	if l.comments {
+		l.comment(tokens, comment, end)
+	}
+	l.tokens = append(l.tokens, tokens...)
+	return nil
+}
+
+// comment attaches the pending comment and the comment of the line,
+// starting at the # or ; at offset start, to the tokens of the line.
+func (l *lexer) comment(tokens []*ws.Token, start, end int) {
+	if l.pending != "" && len(tokens) != 0 {
+		appendComment(tokens[0], l.pending)
+		l.pending = ""
+	}
+	if start == end {
+		return
+	}
+	text := strings.Join(strings.Fields(string(l.src[start+1:end])), " ")
+	if text == "" {
+		return
+	}
+	if len(tokens) != 0 {
+		appendComment(tokens[len(tokens)-1], text)
+	} else if l.pending != "" {
+		l.pending += " " + text
+	} else {
+		l.pending = text
+	}
+}
+
+func appendComment(tok *ws.Token, comment string) {
+	if tok.Comment != "" {
+		tok.Comment += " "
+	}
+	tok.Comment += comment
+}
+
+// words splits a line into words, stopping at a comment, and returns
+// the offset of the comment, or end when there is none. A #define at
+// the start of the line is kept as a word.
+func (l *lexer) words(start, end int) ([]word, int) {
+	var words []word
+	i := start
+	for i < end {
+		c := l.src[i]
+		switch {
+		case c == ';' && l.semicolon:
+			return words, i
+		case c == ' ' || c == '\t' || c == '\r' || c == ';':
+			i++
+			continue
+		case c == '#':
+			if len(words) == 0 && strings.HasPrefix(string(l.src[i:end]), "#define") {
+				j := i + len("#define")
+				if j == end || l.src[j] == ' ' || l.src[j] == '\t' {
+					words = append(words, word{"#define", i, j})
+					i = j
+					continue
+				}
+			}
+			return words, i
+		}
+		j := i
+		if c == '\'' {
+			for j++; j < end && l.src[j] != '\''; j++ {
+				if l.src[j] == '\\' {
+					j++
+				}
+			}
+			if j < end {
+				j++
+			}
+		} else {
+			for j < end && !isSpace(l.src[j]) && l.src[j] != ';' && l.src[j] != '#' {
+				j++
+			}
+		}
+		words = append(words, word{string(l.src[i:j]), i, j})
+		i = j
+	}
+	return words, end
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+func (l *lexer) define(words []word) error {
+	if len(words) < 2 {
+		return l.errorf(words[0], "macro name expected")
+	}
+	name := words[1]
+	if _, ok := l.macros[name.Text]; ok {
+		return l.errorf(name, "macro %s redefined", name.Text)
+	}
+	if strings.HasSuffix(name.Text, ":") || !isIdent(name.Text) {
+		return l.errorf(name, "invalid macro name %s", name.Text)
+	}
+	tokens, err := l.parse(words[2:])
+	if err != nil {
+		return err
+	}
+	l.macros[name.Text] = &macro{name.Text, tokens}
+	return nil
+}
+
+func (l *lexer) parse(words []word) ([]*ws.Token, error) {
+	var tokens []*ws.Token
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if strings.HasSuffix(w.Text, ":") {
+			name := w.Text[:len(w.Text)-1]
+			if !strings.HasPrefix(name, ".") {
+				l.global = name
+			}
+			arg, argString, err := l.label(w, name)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, l.token(ws.Label, arg, argString, w, w))
+			continue
+		}
+		if m, ok := l.macros[w.Text]; ok {
+			tokens = append(tokens, l.expand(m, w)...)
+			continue
+		}
+		typ, ok := instNames[strings.ToLower(w.Text)]
+		if !ok {
+			return nil, l.errorf(w, "unknown instruction %s", w.Text)
+		}
+		if !typ.HasArg() {
+			tokens = append(tokens, l.token(typ, nil, "", w, w))
+			continue
+		}
+		if i+1 == len(words) {
+			return nil, l.errorf(w, "%s requires an argument", w.Text)
+		}
+		i++
+		argWord := words[i]
+		var arg *big.Int
+		var argString string
+		var err error
+		if typ.IsControl() {
+			arg, argString, err = l.label(argWord, argWord.Text)
+		} else {
+			arg, err = l.number(argWord)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, l.token(typ, arg, argString, w, argWord))
+	}
+	return tokens, nil
+}
+
+// expand copies the tokens of a macro, positioned at the use.
+func (l *lexer) expand(m *macro, use word) []*ws.Token {
+	tokens := make([]*ws.Token, len(m.Tokens))
+	for i, tok := range m.Tokens {
+		t := *tok
+		t.Pos, t.End = l.file.Pos(use.Start), l.file.Pos(use.End)
+		tokens[i] = &t
+	}
+	return tokens
+}
+
+func (l *lexer) token(typ ws.Type, arg *big.Int, argString string, start, end word) *ws.Token {
+	return &ws.Token{
+		Type:      typ,
+		Arg:       arg,
+		ArgString: argString,
+		Pos:       l.file.Pos(start.Start),
+		End:       l.file.Pos(end.End),
+	}
+}
+
+// label parses a label reference. Numeric labels are returned as a
+// number and named labels as a name, which is later assigned a number
+// by resolveLabels.
+func (l *lexer) label(w word, name string) (*big.Int, string, error) {
+	if n, ok := new(big.Int).SetString(strings.TrimPrefix(name, "label_"), 10); ok {
+		return n, "", nil
+	}
+	if !isIdent(name) {
+		return nil, "", l.errorf(w, "invalid label %s", name)
+	}
+	if strings.HasPrefix(name, ".") {
+		name = l.global + name
+	}
+	return nil, name, nil
+}
+
+func (l *lexer) number(w word) (*big.Int, error) {
+	if strings.HasPrefix(w.Text, "'") {
+		s, err := strconv.Unquote(w.Text)
+		if err != nil || len([]rune(s)) != 1 {
+			return nil, l.errorf(w, "invalid character %s", w.Text)
+		}
+		return big.NewInt(int64([]rune(s)[0])), nil
+	}
+	if n, ok := parseNumber(w.Text); ok {
+		return n, nil
+	}
+	return nil, l.errorf(w, "invalid number %s", w.Text)
+}
+
+// parseNumber parses an arbitrary-precision integer in decimal, hex
+// with a 0x prefix, or binary with a 0b prefix, with an optional sign.
+// Unlike base 0 in big.Int.SetString, a leading zero is decimal, not
+// octal.
+func parseNumber(s string) (*big.Int, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 {
+		return nil, false
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, false
+	}
+	if strings.HasPrefix(s, "-") {
+		n.Neg(n)
+	}
+	return n, true
+}
+
+// resolveLabels numbers named labels after the largest numeric label,
+// in order of first appearance.
+func (l *lexer) resolveLabels() {
+	next := new(big.Int)
+	for _, tok := range l.tokens {
+		if tok.Type.IsControl() && tok.Arg != nil && tok.Arg.Cmp(next) >= 0 {
+			next.Add(tok.Arg, big.NewInt(1))
+		}
+	}
+	ids := make(map[string]*big.Int)
+	for _, tok := range l.tokens {
+		if tok.ArgString == "" {
+			continue
+		}
+		id, ok := ids[tok.ArgString]
+		if !ok {
+			id = new(big.Int).Set(next)
+			ids[tok.ArgString] = id
+			next.Add(next, big.NewInt(1))
+		}
+		tok.Arg = id
+	}
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c == '.' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i != 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (l *lexer) errorf(w word, format string, args ...interface{}) error {
+	return &ws.SyntaxError{
+		Err: fmt.Sprintf(format, args...),
+		Pos: l.file.Position(l.file.Pos(w.Start)),
+		End: l.file.Position(l.file.Pos(w.End - 1)),
+	}
+}
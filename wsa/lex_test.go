@@ -0,0 +1,100 @@
+package wsa
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestLexMacro(t *testing.T) {
+	src := "#define inc push 1 add\n" +
+		"    push 'a'\n" +
+		"loop:\n" +
+		"    inc; dup; printc\n" +
+		"    jmp loop # forever\n"
+	fset := token.NewFileSet()
+	file := fset.AddFile("macro.wsa", -1, len(src))
+	tokens, err := Lex(file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt('a')},
+		{Type: ws.Label, Arg: big.NewInt(0), ArgString: "loop"},
+		{Type: ws.Push, Arg: big.NewInt(1)},
+		{Type: ws.Add},
+		{Type: ws.Dup},
+		{Type: ws.Printc},
+		{Type: ws.Jmp, Arg: big.NewInt(0), ArgString: "loop"},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens %v, want %v", len(tokens), tokens, want)
+	}
+	for i, tok := range tokens {
+		w := want[i]
+		if tok.Type != w.Type || tok.ArgString != w.ArgString ||
+			(tok.Arg == nil) != (w.Arg == nil) || tok.Arg != nil && tok.Arg.Cmp(w.Arg) != 0 {
+			t.Errorf("token %d: got %v, want %v", i, tok, w)
+		}
+	}
+	for _, tok := range tokens[2:4] {
+		if pos := fset.Position(tok.Pos); pos.Line != 4 || pos.Column != 5 {
+			t.Errorf("expanded %v at %v, want macro.wsa:4:5", tok, pos)
+		}
+	}
+}
+
+func TestLexMacroErrors(t *testing.T) {
+	for _, test := range []struct {
+		Src, Err string
+		Line     int
+	}{
+		{"#define bad push x\n    bad\n", "invalid number x", 1},
+		{"#define twice dup\n#define twice drop\n", "macro twice redefined", 2},
+		{"    push 1\n    nop\n", "unknown instruction nop", 2},
+	} {
+		file := token.NewFileSet().AddFile("err.wsa", -1, len(test.Src))
+		_, err := Lex(file, []byte(test.Src))
+		serr, ok := err.(*ws.SyntaxError)
+		if !ok {
+			t.Errorf("%q: got error %v, want syntax error", test.Src, err)
+			continue
+		}
+		if serr.Err != test.Err || serr.Pos.Line != test.Line {
+			t.Errorf("%q: got %q at line %d, want %q at line %d", test.Src, serr.Err, serr.Pos.Line, test.Err, test.Line)
+		}
+	}
+}
+
+func TestLexNumberBases(t *testing.T) {
+	for _, test := range []struct {
+		Arg  string
+		Want *big.Int
+	}{
+		{"0xFF", big.NewInt(255)},
+		{"0b1010", big.NewInt(10)},
+		{"-0x10", big.NewInt(-16)},
+		{"010", big.NewInt(10)},
+		{"0x10000000000000000", new(big.Int).Lsh(big.NewInt(1), 64)},
+	} {
+		src := "    push " + test.Arg + "\n"
+		file := token.NewFileSet().AddFile("bases.wsa", -1, len(src))
+		tokens, err := Lex(file, []byte(src))
+		if err != nil {
+			t.Errorf("push %s: %v", test.Arg, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Arg.Cmp(test.Want) != 0 {
+			t.Errorf("push %s: got %v, want push %v", test.Arg, tokens, test.Want)
+		}
+	}
+	for _, arg := range []string{"0x", "0b12", "--1", "1_000"} {
+		src := "    push " + arg + "\n"
+		file := token.NewFileSet().AddFile("bases.wsa", -1, len(src))
+		if _, err := Lex(file, []byte(src)); err == nil {
+			t.Errorf("push %s: expected error", arg)
+		}
+	}
+}
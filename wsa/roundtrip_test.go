@@ -0,0 +1,216 @@
+package wsa
+
+import (
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// TestLexDumpRoundTrip checks that lexing the assembly formatted by
+// Program.Dump reproduces the Whitespace program.
+func TestLexDumpRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../programs/*.ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs found")
+	}
+	for _, filename := range files {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		tokens, err := ws.LexTokens(fset.AddFile(filename, -1, len(src)), src)
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+		program := &ws.Program{Tokens: tokens}
+		asm := []byte(program.Dump("    "))
+		tokens2, err := Lex(fset.AddFile(filename+"a", -1, len(asm)), asm)
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+		program2 := &ws.Program{Tokens: tokens2}
+		if got, want := program2.DumpWS(), program.DumpWS(); got != want {
+			t.Errorf("%s: Dump then Lex does not reproduce the program", filename)
+		}
+	}
+}
+
+// TestLexAnnotatedDumpRoundTrip checks that the ; comments written by
+// Program.DumpPos and Program.DumpCommented are skipped by the lexer
+// with SemicolonComments.
+func TestLexAnnotatedDumpRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../programs/*.ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range files {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		file := fset.AddFile(filename, -1, len(src))
+		tokens, err := ws.LexTokens(file, src)
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+		program := &ws.Program{Tokens: tokens, File: file}
+		for _, dump := range []struct{ name, asm string }{
+			{"DumpPos", program.DumpPos()},
+			{"DumpCommented", program.DumpCommented(src, "    ")},
+		} {
+			asm := []byte(dump.asm)
+			tokens2, err := LexOptions(fset.AddFile(filename+"a", -1, len(asm)), asm, Options{SemicolonComments: true})
+			if err != nil {
+				t.Errorf("%s: %s: %v", filename, dump.name, err)
+				continue
+			}
+			program2 := &ws.Program{Tokens: tokens2}
+			if got, want := program2.DumpWS(), program.DumpWS(); got != want {
+				t.Errorf("%s: %s then Lex does not reproduce the program", filename, dump.name)
+			}
+		}
+	}
+}
+
+// TestCommentsRoundTrip checks that comments survive formatting
+// assembly with Program.DumpComments and Whitespace with a comment
+// source map.
+func TestCommentsRoundTrip(t *testing.T) {
+	src := []byte(`# Print the sum
+# of two numbers
+    push 1   # first
+    push  2
+    add      ;   printi # sum  of	both
+# end of
+# program
+`)
+	want := []string{"Print the sum of two numbers first", "", "", "sum of both end of program"}
+
+	fset := token.NewFileSet()
+	tokens, err := LexOptions(fset.AddFile("test.wsa", -1, len(src)), src, Options{Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := &ws.Program{Tokens: tokens}
+	checkComments(t, "lex", tokens, want)
+
+	asm := []byte(program.DumpComments("    "))
+	tokens2, err := LexOptions(fset.AddFile("test2.wsa", -1, len(asm)), asm, Options{Comments: true, SemicolonComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkComments(t, "DumpComments", tokens2, want)
+
+	wsSrc := []byte(program.DumpWS())
+	tokens3, err := ws.LexTokensOptions(fset.AddFile("test.ws", -1, len(wsSrc)), wsSrc, ws.LexOptions{Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := ws.ParseCommentMap(strings.NewReader(ws.FormatCommentMap(tokens)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.ApplyCommentMap(tokens3, comments)
+	checkComments(t, "FormatCommentMap", tokens3, want)
+
+	// Without opting in, comments are not captured.
+	plain, err := Lex(fset.AddFile("test.wsa", -1, len(src)), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkComments(t, "Lex", plain, []string{"", "", "", ""})
+}
+
+func checkComments(t *testing.T, stage string, tokens []*ws.Token, want []string) {
+	t.Helper()
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Comment)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("%s: got comments %q, want %q", stage, got, want)
+	}
+}
+
+// lexProgramsSkip lists the assembly programs that Lex does not
+// reproduce as their .out.ws, with the reason.
+var lexProgramsSkip = map[string]string{
+	"interpret.wsa":          "define constants are not supported",
+	"pi.wsa":                 "define constants are not supported",
+	"postfix.wsa":            "define constants are not supported",
+	"test_ret_underflow.wsa": "test_ret_underflow.out.ws is a different program",
+}
+
+// TestLexPrograms checks that lexing each assembly program reproduces
+// the Whitespace program assembled from it.
+func TestLexPrograms(t *testing.T) {
+	files, err := filepath.Glob("../programs/*.wsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs found")
+	}
+	for _, filename := range files {
+		if _, ok := lexProgramsSkip[filepath.Base(filename)]; ok {
+			continue
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wsFilename := strings.TrimSuffix(filename, ".wsa") + ".out.ws"
+		wsSrc, err := ioutil.ReadFile(wsFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		tokens, err := Lex(fset.AddFile(filename, -1, len(src)), src)
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+		want, err := ws.LexTokens(fset.AddFile(wsFilename, -1, len(wsSrc)), wsSrc)
+		if err != nil {
+			t.Errorf("%s: %v", wsFilename, err)
+			continue
+		}
+		// Labels are numbered by the assembler, so they are compared by
+		// their correspondence rather than their values.
+		labels := make(map[string]string)
+		for i := 0; i < len(tokens) || i < len(want); i++ {
+			if i >= len(tokens) || i >= len(want) {
+				t.Errorf("%s: got %d tokens, want %d", filename, len(tokens), len(want))
+				break
+			}
+			got, w := tokens[i], want[i]
+			same := got.Type == w.Type
+			if same && got.Type.IsControl() && got.Type.HasArg() {
+				l, ok := labels[got.Arg.String()]
+				if !ok {
+					l = w.Arg.String()
+					labels[got.Arg.String()] = l
+				}
+				same = l == w.Arg.String()
+			} else if same && got.Type.HasArg() {
+				same = got.Arg.Cmp(w.Arg) == 0
+			}
+			if !same {
+				t.Errorf("%s: token %d: got %v, want %v", filename, i, got, w)
+				break
+			}
+		}
+	}
+}